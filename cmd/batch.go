@@ -0,0 +1,644 @@
+package cmd
+
+import (
+	"bufio"
+	"context"
+	"crypto/sha256"
+	"encoding/csv"
+	"encoding/hex"
+	"encoding/json"
+	"io"
+	"os"
+	"os/signal"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"syscall"
+
+	"github.com/digitorus/pdfsign/sign"
+	"github.com/digitorus/pdfsigner/db"
+	"github.com/digitorus/pdfsigner/license"
+	"github.com/digitorus/pdfsigner/queues/priority_queue"
+	"github.com/digitorus/pdfsigner/queues/queue"
+	"github.com/pkg/errors"
+	log "github.com/sirupsen/logrus"
+	"github.com/spf13/cobra"
+)
+
+var (
+	// batchResultPathFlag defines the path of the result manifest.
+	batchResultPathFlag string
+	// batchFormatFlag defines the format of the manifest and the result manifest.
+	batchFormatFlag string
+	// batchWorkersFlag defines the number of the files signed concurrently by every signer.
+	batchWorkersFlag int
+	// batchRestartFlag defines whether to ignore the progress of the previous run of the manifest.
+	batchRestartFlag bool
+)
+
+// batchCmd represents the batch command.
+var batchCmd = &cobra.Command{
+	Use:   "batch [manifest]",
+	Short: "Sign files listed in JSONL or CSV manifest",
+	Long:  `Signs the files listed in JSONL or CSV manifest with the signers from the config file using the queue. The interrupted run is resumed by running the same command with the same manifest. The result manifest contains the status and the digests of every line.`,
+	Args:  cobra.ExactArgs(1),
+	Run: func(cmd *cobra.Command, args []string) {
+		// require license
+		err := requireLicense()
+		if err != nil {
+			log.Fatal(err)
+		}
+
+		runBatch(args[0])
+	},
+}
+
+// batchLine represents the line of the manifest, the file signed by the signer with the sign fields overriding the signer.
+type batchLine struct {
+	// Line represents the number of the line inside the manifest
+	Line     int    `json:"-"`
+	Input    string `json:"input"`
+	Output   string `json:"output"`
+	Signer   string `json:"signer"`
+	Name     string `json:"name,omitempty"`
+	Location string `json:"location,omitempty"`
+	Reason   string `json:"reason,omitempty"`
+	Contact  string `json:"contact,omitempty"`
+	CertType uint   `json:"cert_type,omitempty"`
+	DocMDP   uint   `json:"docmdp,omitempty"`
+	Priority string `json:"priority,omitempty"`
+}
+
+// batchResult represents the line of the result manifest.
+type batchResult struct {
+	Line         int    `json:"line"`
+	Input        string `json:"input"`
+	Output       string `json:"output"`
+	Signer       string `json:"signer"`
+	Status       string `json:"status"`
+	Error        string `json:"error,omitempty"`
+	JobID        string `json:"job_id,omitempty"`
+	TaskID       string `json:"task_id,omitempty"`
+	InputSHA256  string `json:"input_sha256,omitempty"`
+	OutputSHA256 string `json:"output_sha256,omitempty"`
+	OutputSize   int64  `json:"output_size,omitempty"`
+}
+
+// batchResultColumns represents the header of CSV result manifest.
+var batchResultColumns = []string{"line", "input", "output", "signer", "status", "error", "job_id", "task_id", "input_sha256", "output_sha256", "output_size"}
+
+// batchState represents the progress of the manifest saved to the db, so the interrupted run could be resumed.
+type batchState struct {
+	// Jobs represents the ids of the jobs by the sign settings of their lines
+	Jobs map[string]string `json:"jobs"`
+}
+
+// runBatch queues the lines of the manifest, waits until they're signed and writes the result manifest.
+func runBatch(manifestPath string) {
+	format := batchFormat(manifestPath)
+
+	lines, err := readBatchManifest(manifestPath, format)
+	if err != nil {
+		log.Fatal(err)
+	}
+
+	// the progress is saved by the digest of the manifest, the changed manifest is signed from the start
+	digest, err := manifestDigest(manifestPath)
+	if err != nil {
+		log.Fatal(err)
+	}
+
+	stateKey := "batch_" + digest
+
+	state := batchState{Jobs: map[string]string{}}
+	if !batchRestartFlag {
+		state, err = loadBatchState(stateKey)
+		if err != nil {
+			log.Fatal(err)
+		}
+	}
+
+	setupStorage()
+
+	// the tasks of the resumed jobs are queued to the units of the signers
+	for _, l := range lines {
+		if _, err := l.validate(); err == nil {
+			// the sessions of the PKSC11 token are opened for the workers of the batch
+			loadSignerSessions(l.Signer, batchWorkersFlag)
+			setupSignerUnit(l.Signer, l.Signer, batchWorkersFlag)
+		}
+	}
+
+	// load only the jobs of the manifest, the jobs of the services stay unfinished
+	for key, jobID := range state.Jobs {
+		err := signVerifyQueue.ResumeJob(jobID)
+		if err != nil {
+			log.Warnf("Couldn't resume job %s, the files are queued again: %s", jobID, err)
+			delete(state.Jobs, key)
+		}
+	}
+
+	results := queueBatchLines(lines, &state, stateKey)
+
+	// run queue processors
+	signVerifyQueue.StartProcessor()
+
+	// run license auto save
+	license.LD.AutoSave()
+
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	defer stop()
+
+	// wait for the jobs of the queued lines
+	jobs := map[string]queue.Job{}
+
+	for _, r := range results {
+		if r.TaskID == "" {
+			continue
+		}
+
+		if _, exists := jobs[r.JobID]; exists {
+			continue
+		}
+
+		job, err := signVerifyQueue.WaitForJob(ctx, r.JobID)
+		if err != nil {
+			stop()
+			shutdown()
+			log.Fatalf("Interrupted, run the same command to resume: %s", err)
+		}
+
+		jobs[r.JobID] = job
+	}
+
+	failed := 0
+
+	for i, r := range results {
+		if r.TaskID != "" {
+			results[i] = batchTaskResult(r, jobs[r.JobID].TasksMap[r.TaskID])
+		}
+
+		if results[i].Status != queue.StatusCompleted {
+			failed++
+		}
+	}
+
+	resultPath := batchResultPathFlag
+	if resultPath == "" {
+		ext := filepath.Ext(manifestPath)
+		resultPath = strings.TrimSuffix(manifestPath, ext) + ".result" + ext
+	}
+
+	err = writeBatchResults(resultPath, format, results)
+	if err != nil {
+		log.Fatal(err)
+	}
+
+	shutdown()
+
+	if failed > 0 {
+		log.Fatalf("%d of %d files failed, see %s", failed, len(results), resultPath)
+	}
+
+	log.Infof("Signed %d files, see %s", len(results), resultPath)
+}
+
+// queueBatchLines adds the tasks of the lines to the jobs grouped by the sign settings, the lines queued by the previous run are not queued again.
+// The lines which couldn't be queued are failed.
+func queueBatchLines(lines []batchLine, state *batchState, stateKey string) []batchResult {
+	results := make([]batchResult, 0, len(lines))
+
+	// tasks represents the ids of the tasks of the jobs by the input and the output paths
+	tasks := map[string]map[string]string{}
+
+	// outputs represents the numbers of the lines by the output paths
+	outputs := map[string]int{}
+
+	for _, l := range lines {
+		r := batchResult{Line: l.Line, Input: l.Input, Output: l.Output, Signer: l.Signer}
+
+		priority, err := l.validate()
+
+		// the lines with the same output would overwrite the signed files of each other
+		if err == nil {
+			output := outputPathKey(l.Output)
+
+			if line, exists := outputs[output]; exists {
+				err = errors.Errorf("output is used by the line %d", line)
+			} else {
+				outputs[output] = l.Line
+			}
+		}
+
+		if err != nil {
+			r.Status = queue.StatusFailed
+			r.Error = err.Error()
+			results = append(results, r)
+
+			continue
+		}
+
+		// the lines with the same sign settings share the job
+		signConfig := l.signConfig()
+
+		key, err := json.Marshal(signConfig)
+		if err != nil {
+			log.Fatal(err)
+		}
+
+		jobID, exists := state.Jobs[string(key)]
+		if !exists {
+			jobID = signVerifyQueue.AddSignJob(signConfig)
+			state.Jobs[string(key)] = jobID
+
+			err := saveBatchState(stateKey, *state)
+			if err != nil {
+				log.Fatal(err)
+			}
+		}
+
+		r.JobID = jobID
+
+		if tasks[jobID] == nil {
+			tasks[jobID] = batchJobTasks(jobID)
+		}
+
+		// the line was queued by the previous run
+		fileKey := l.Input + "\x00" + l.Output
+		if taskID, exists := tasks[jobID][fileKey]; exists {
+			r.TaskID = taskID
+			results = append(results, r)
+
+			continue
+		}
+
+		err = os.MkdirAll(filepath.Dir(l.Output), 0o755)
+		if err == nil {
+			r.TaskID, err = signVerifyQueue.AddTask(l.Signer, jobID, filepath.Base(l.Input), l.Input, l.Output, priority)
+		}
+
+		if err != nil {
+			r.Status = queue.StatusFailed
+			r.Error = err.Error()
+			results = append(results, r)
+
+			continue
+		}
+
+		tasks[jobID][fileKey] = r.TaskID
+		results = append(results, r)
+	}
+
+	return results
+}
+
+// outputPathKey returns the absolute path of the output, so the same file referenced by different paths is found.
+func outputPathKey(output string) string {
+	abs, err := filepath.Abs(output)
+	if err != nil {
+		return filepath.Clean(output)
+	}
+
+	return abs
+}
+
+// batchJobTasks returns the ids of the tasks of the job by the input and the output paths.
+func batchJobTasks(jobID string) map[string]string {
+	tasks := map[string]string{}
+
+	job, err := signVerifyQueue.GetJobByID(jobID)
+	if err != nil {
+		return tasks
+	}
+
+	for id, t := range job.TasksMap {
+		tasks[t.InputFilePath+"\x00"+t.OutputFilePath] = id
+	}
+
+	return tasks
+}
+
+// batchTaskResult returns the result of the line with the status and the digests of the task.
+func batchTaskResult(r batchResult, t queue.Task) batchResult {
+	r.Status = t.Status
+	r.Error = t.Error
+	r.InputSHA256 = t.InputSHA256
+	r.OutputSHA256 = t.OutputSHA256
+	r.OutputSize = t.OutputSize
+
+	return r
+}
+
+// validate checks if the line could be signed and returns the priority of the line, medium if it's not provided.
+func (l batchLine) validate() (priority_queue.Priority, error) {
+	switch {
+	case l.Input == "":
+		return priority_queue.UnknownPriority, errors.New("input is not provided")
+	case l.Output == "":
+		return priority_queue.UnknownPriority, errors.New("output is not provided")
+	case l.Signer == "":
+		return priority_queue.UnknownPriority, errors.New("signer is not provided")
+	case !signerExists(l.Signer):
+		return priority_queue.UnknownPriority, errors.Errorf("signer %q not found", l.Signer)
+	case l.Priority == "":
+		return priority_queue.MediumPriority, nil
+	}
+
+	return priority_queue.ParsePriority(l.Priority)
+}
+
+// signConfig returns the sign settings of the line.
+func (l batchLine) signConfig() queue.JobSignConfig {
+	return queue.JobSignConfig{
+		Signer:            l.Signer,
+		Name:              l.Name,
+		Location:          l.Location,
+		Reason:            l.Reason,
+		ContactInfo:       l.Contact,
+		CertType:          sign.CertType(l.CertType),
+		DocMDPPerms:       sign.DocMDPPerm(l.DocMDP),
+		ValidateSignature: validateSignature,
+	}
+}
+
+// signerExists checks if the signer is provided inside the config.
+func signerExists(signerName string) bool {
+	for _, s := range signersConfigArr {
+		if s.Name == signerName {
+			return true
+		}
+	}
+
+	return false
+}
+
+// batchFormat returns the format of the manifest, csv for the files with .csv extension if the format is not provided.
+func batchFormat(manifestPath string) string {
+	format := batchFormatFlag
+	if format == "" {
+		format = "jsonl"
+		if strings.EqualFold(filepath.Ext(manifestPath), ".csv") {
+			format = "csv"
+		}
+	}
+
+	if format != "jsonl" && format != "csv" {
+		log.Fatal("format is not supported: ", format)
+	}
+
+	return format
+}
+
+// readBatchManifest reads the lines of the manifest, the first line of CSV manifest names the columns.
+func readBatchManifest(path, format string) ([]batchLine, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, errors.Wrap(err, "open manifest")
+	}
+	defer func() { _ = f.Close() }()
+
+	if format == "csv" {
+		return readBatchCSV(f)
+	}
+
+	return readBatchJSONL(f)
+}
+
+// readBatchJSONL reads JSON object of every non-empty line.
+func readBatchJSONL(r io.Reader) ([]batchLine, error) {
+	var lines []batchLine
+
+	s := bufio.NewScanner(r)
+	s.Buffer(make([]byte, 64*1024), 1024*1024)
+
+	for n := 1; s.Scan(); n++ {
+		if strings.TrimSpace(s.Text()) == "" {
+			continue
+		}
+
+		var l batchLine
+
+		err := json.Unmarshal(s.Bytes(), &l)
+		if err != nil {
+			return nil, errors.Wrapf(err, "manifest line %d", n)
+		}
+
+		l.Line = n
+		lines = append(lines, l)
+	}
+
+	if err := s.Err(); err != nil {
+		return nil, errors.Wrap(err, "read manifest")
+	}
+
+	return lines, nil
+}
+
+// readBatchCSV reads the records of CSV, the columns are named by the header.
+func readBatchCSV(r io.Reader) ([]batchLine, error) {
+	cr := csv.NewReader(r)
+	cr.FieldsPerRecord = -1
+
+	header, err := cr.Read()
+	if err != nil {
+		return nil, errors.Wrap(err, "read manifest header")
+	}
+
+	var lines []batchLine
+
+	for {
+		record, err := cr.Read()
+		if err == io.EOF {
+			break
+		}
+
+		if err != nil {
+			return nil, errors.Wrap(err, "read manifest")
+		}
+
+		n, _ := cr.FieldPos(0)
+
+		l := batchLine{Line: n}
+
+		for i, column := range header {
+			if i >= len(record) {
+				break
+			}
+
+			err := l.setField(strings.TrimSpace(column), record[i])
+			if err != nil {
+				return nil, errors.Wrapf(err, "manifest line %d", n)
+			}
+		}
+
+		lines = append(lines, l)
+	}
+
+	return lines, nil
+}
+
+// setField sets the field of the line by CSV column name.
+func (l *batchLine) setField(column, value string) error {
+	switch column {
+	case "input":
+		l.Input = value
+	case "output":
+		l.Output = value
+	case "signer":
+		l.Signer = value
+	case "name":
+		l.Name = value
+	case "location":
+		l.Location = value
+	case "reason":
+		l.Reason = value
+	case "contact":
+		l.Contact = value
+	case "priority":
+		l.Priority = value
+	case "cert_type", "docmdp":
+		if value == "" {
+			return nil
+		}
+
+		v, err := strconv.ParseUint(value, 10, 32)
+		if err != nil {
+			return errors.Wrap(err, column)
+		}
+
+		if column == "cert_type" {
+			l.CertType = uint(v)
+		} else {
+			l.DocMDP = uint(v)
+		}
+	default:
+		return errors.Errorf("unknown column %q", column)
+	}
+
+	return nil
+}
+
+// writeBatchResults writes the results of the lines in the format of the manifest.
+func writeBatchResults(path, format string, results []batchResult) error {
+	f, err := os.Create(path)
+	if err != nil {
+		return errors.Wrap(err, "create result manifest")
+	}
+
+	if format == "csv" {
+		err = writeBatchCSV(f, results)
+	} else {
+		err = writeBatchJSONL(f, results)
+	}
+
+	if err != nil {
+		_ = f.Close()
+
+		return errors.Wrap(err, "write result manifest")
+	}
+
+	return errors.Wrap(f.Close(), "write result manifest")
+}
+
+// writeBatchJSONL writes JSON object of every result as a line.
+func writeBatchJSONL(w io.Writer, results []batchResult) error {
+	enc := json.NewEncoder(w)
+
+	for _, r := range results {
+		err := enc.Encode(r)
+		if err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// writeBatchCSV writes the header and the record of every result.
+func writeBatchCSV(w io.Writer, results []batchResult) error {
+	cw := csv.NewWriter(w)
+
+	err := cw.Write(batchResultColumns)
+	if err != nil {
+		return err
+	}
+
+	for _, r := range results {
+		var outputSize string
+		if r.OutputSize > 0 {
+			outputSize = strconv.FormatInt(r.OutputSize, 10)
+		}
+
+		err := cw.Write([]string{
+			strconv.Itoa(r.Line), r.Input, r.Output, r.Signer, r.Status, r.Error,
+			r.JobID, r.TaskID, r.InputSHA256, r.OutputSHA256, outputSize,
+		})
+		if err != nil {
+			return err
+		}
+	}
+
+	cw.Flush()
+
+	return cw.Error()
+}
+
+// manifestDigest returns hex encoded SHA-256 of the manifest.
+func manifestDigest(path string) (string, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return "", errors.Wrap(err, "open manifest")
+	}
+	defer func() { _ = f.Close() }()
+
+	h := sha256.New()
+
+	_, err = io.Copy(h, f)
+	if err != nil {
+		return "", errors.Wrap(err, "read manifest")
+	}
+
+	return hex.EncodeToString(h.Sum(nil)), nil
+}
+
+// loadBatchState loads the progress of the previous run of the manifest, empty if the manifest wasn't run.
+func loadBatchState(key string) (batchState, error) {
+	state := batchState{Jobs: map[string]string{}}
+
+	b, err := db.LoadByKey(key)
+	if err != nil || len(b) == 0 {
+		return state, err
+	}
+
+	err = json.Unmarshal(b, &state)
+	if err != nil {
+		return state, errors.Wrap(err, "load batch state")
+	}
+
+	if state.Jobs == nil {
+		state.Jobs = map[string]string{}
+	}
+
+	return state, nil
+}
+
+// saveBatchState saves the progress of the manifest.
+func saveBatchState(key string, state batchState) error {
+	b, err := json.Marshal(state)
+	if err != nil {
+		return errors.Wrap(err, "save batch state")
+	}
+
+	return db.SaveByKey(key, b)
+}
+
+func init() {
+	RootCmd.AddCommand(batchCmd)
+	parseConfigFlag(batchCmd)
+
+	batchCmd.PersistentFlags().StringVar(&batchResultPathFlag, "result", "", "Path to result manifest, Ex. manifest.result.jsonl for manifest.jsonl if not provided")
+	batchCmd.PersistentFlags().StringVar(&batchFormatFlag, "format", "", "Format of the manifest: jsonl or csv, determined by the extension if not provided")
+	batchCmd.PersistentFlags().IntVar(&batchWorkersFlag, "workers", 0, "Number of the files signed concurrently by every signer, the workers of the signer are used if not provided")
+	batchCmd.PersistentFlags().BoolVar(&batchRestartFlag, "restart", false, "Sign all the files again ignoring the progress of the previous run")
+	batchCmd.PersistentFlags().BoolVar(&validateSignature, "validate-signature", true, "Validate signature after signing")
+}
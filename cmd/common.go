@@ -4,10 +4,15 @@ import (
 	"os"
 	"path/filepath"
 	"strings"
+	"time"
 
 	"github.com/digitorus/pdfsign/sign"
 	"github.com/digitorus/pdfsigner/license"
+	"github.com/digitorus/pdfsigner/queues/priority_queue"
 	"github.com/digitorus/pdfsigner/queues/queue"
+	"github.com/digitorus/pdfsigner/utils"
+	"github.com/digitorus/pdfsigner/webapi"
+	"github.com/digitorus/pdfsigner/webhook"
 	log "github.com/sirupsen/logrus"
 	"github.com/spf13/cobra"
 )
@@ -22,6 +27,178 @@ func init() {
 
 func setupVerifier() {
 	signVerifyQueue.AddVerifyUnit()
+
+	// set the number of the files verified concurrently
+	setupWorkers(queue.VerificationUnitName, config.VerifyWorkers)
+
+	// set retry policy of the failed verifications
+	setupRetryPolicy(queue.VerificationUnitName, config.VerifyRetry)
+
+	// enable verification results cache if configured
+	if config.VerifyCache.TTL > 0 {
+		signVerifyQueue.SetVerifyCache(queue.VerifyCacheConfig{
+			TTL:     config.VerifyCache.TTL,
+			Profile: config.VerifyCache.Profile,
+		})
+	}
+}
+
+// defaultSQLiteFileName represents the file name of the SQLite database next to the executable if the path is not configured.
+const defaultSQLiteFileName = "pdfsigner.sqlite"
+
+// jobsStore represents the store of the jobs and the tasks if it's not the default bolt store.
+var jobsStore queue.Store
+
+// setupStorage sets the store of the jobs and the tasks configured inside storage section.
+func setupStorage() {
+	switch config.Storage.Type {
+	case "", "bolt":
+		return
+	case "sqlite":
+	default:
+		log.Fatal("storage type is not supported: ", config.Storage.Type)
+	}
+
+	path := config.Storage.Path
+	if path == "" {
+		runFileFolder, err := utils.GetRunFileFolder()
+		if err != nil {
+			log.Fatal(err)
+		}
+
+		path = filepath.Join(runFileFolder, defaultSQLiteFileName)
+	}
+
+	store, err := queue.NewSQLiteStore(path)
+	if err != nil {
+		log.Fatal(err)
+	}
+
+	jobsStore = store
+	signVerifyQueue.SetStore(store)
+}
+
+// loadJobs sets the store and loads the unfinished jobs.
+func loadJobs() {
+	setupStorage()
+
+	err := signVerifyQueue.LoadFromDB()
+	if err != nil {
+		log.Fatal(err)
+	}
+}
+
+// closeStorage closes the store of the jobs and the tasks.
+func closeStorage() {
+	if jobsStore == nil {
+		return
+	}
+
+	err := jobsStore.Close()
+	if err != nil {
+		log.Errorf("Couldn't close the storage: %s", err)
+	}
+}
+
+// setupQueue sets the capacity, the aging, the deduplication and the retention of the queues.
+func setupQueue() {
+	err := signVerifyQueue.SetCapacity(config.Queue.Capacity)
+	if err != nil {
+		log.Fatal(err)
+	}
+
+	err = signVerifyQueue.SetAging(config.Queue.Aging)
+	if err != nil {
+		log.Fatal(err)
+	}
+
+	err = signVerifyQueue.SetIdempotencyWindow(config.Queue.IdempotencyWindow)
+	if err != nil {
+		log.Fatal(err)
+	}
+
+	signVerifyQueue.SetDeduplication(config.Queue.Deduplicate)
+
+	// share the units by the clients of the web api
+	for name, c := range config.APIClients {
+		err := signVerifyQueue.SetTenantPolicy(name, priority_queue.TenantPolicy{Weight: c.Weight, MaxInFlight: c.MaxInFlight})
+		if err != nil {
+			log.Fatalf("api client %s: %s", name, err)
+		}
+	}
+
+	err = signVerifyQueue.SetRetentionPolicy(queue.RetentionPolicy{
+		AfterCompletion: config.Retention.AfterCompletion,
+		AfterDownload:   config.Retention.AfterDownload,
+		MaxStorage:      config.Retention.MaxStorageMB * 1024 * 1024,
+	})
+	if err != nil {
+		log.Fatal(err)
+	}
+}
+
+// setupWebhooks starts delivering the webhooks of the processed jobs.
+func setupWebhooks() {
+	d, err := webhook.NewDispatcher(webhook.Config{
+		Secret:          config.Webhooks.Secret,
+		MaxAttempts:     config.Webhooks.MaxAttempts,
+		Backoff:         config.Webhooks.Backoff,
+		MaxBackoff:      config.Webhooks.MaxBackoff,
+		Timeout:         config.Webhooks.Timeout,
+		AllowedNetworks: config.Webhooks.AllowedNetworks,
+		ClaimCompletion: signVerifyQueue.ClaimJobCompletion,
+	})
+	if err != nil {
+		log.Fatal(err)
+	}
+
+	if config.Webhooks.Secret == "" {
+		log.Warn("Webhooks secret is not provided, the payloads are not signed")
+	}
+
+	// deliver the webhooks persisted before the restart
+	err = d.Start()
+	if err != nil {
+		log.Fatal(err)
+	}
+
+	signVerifyQueue.Subscribe(d.HandleEvent)
+}
+
+// defaultJanitorInterval represents how often the expired jobs are deleted if the interval is not configured.
+const defaultJanitorInterval = 10 * time.Minute
+
+// startJanitor starts deleting the expired jobs and the temporary files in the background.
+func startJanitor() {
+	interval := config.Retention.Interval
+	if interval <= 0 {
+		interval = defaultJanitorInterval
+	}
+
+	signVerifyQueue.StartJanitor(servicesCtx, interval)
+}
+
+// getAPIClients returns the clients of the web api from the config.
+func getAPIClients() []webapi.APIClient {
+	var clients []webapi.APIClient
+
+	for name, c := range config.APIClients {
+		client := webapi.APIClient{Name: name, Key: c.Key}
+
+		// parse maximum priority if provided
+		if c.MaxPriority != "" {
+			p, err := priority_queue.ParsePriority(c.MaxPriority)
+			if err != nil {
+				log.Fatalf("api client %s: %s", name, err)
+			}
+
+			client.MaxPriority = p
+		}
+
+		clients = append(clients, client)
+	}
+
+	return clients
 }
 
 var (
@@ -54,6 +231,7 @@ var (
 	// serve flags.
 	serveAddrFlag string
 	servePortFlag string
+	workersFlag   int
 )
 
 // parseCommonFlags binds common flags to variables.
@@ -114,6 +292,40 @@ func parseServeFlags(cmd *cobra.Command) {
 	_ = cmd.MarkPersistentFlagRequired("serve-port")
 }
 
+// parseWorkersFlag binds workers flag to variable.
+func parseWorkersFlag(cmd *cobra.Command) {
+	cmd.PersistentFlags().IntVar(&workersFlag, "workers", 1, "Number of the files signed concurrently")
+}
+
+// setupWorkers sets the number of the tasks processed concurrently by the unit.
+func setupWorkers(unitName string, workers int) {
+	if workers <= 1 {
+		return
+	}
+
+	err := signVerifyQueue.SetUnitWorkers(unitName, workers)
+	if err != nil {
+		log.Fatal(err)
+	}
+}
+
+// setupRetryPolicy sets the retry policy of the failed tasks of the unit.
+func setupRetryPolicy(unitName string, c retryConfig) {
+	if c.MaxAttempts < 2 {
+		return
+	}
+
+	err := signVerifyQueue.SetUnitRetryPolicy(unitName, queue.RetryPolicy{
+		MaxAttempts: c.MaxAttempts,
+		Backoff:     c.Backoff,
+		MaxBackoff:  c.MaxBackoff,
+		Retryable:   c.Retryable,
+	})
+	if err != nil {
+		log.Fatal(err)
+	}
+}
+
 func isMultiSignerCmd() bool {
 	if len(os.Args) < 3 {
 		return false
@@ -286,6 +498,11 @@ func bindSignerFlagsToConfig(cmd *cobra.Command, c *signerConfig) {
 	if cmd.PersistentFlags().Changed("pass") {
 		c.Pass = pksc11PassFlag
 	}
+
+	// Workers
+	if cmd.PersistentFlags().Changed("workers") {
+		c.Workers = workersFlag
+	}
 }
 
 // getSignerConfigByName returns config of the signer by name.
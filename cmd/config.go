@@ -5,7 +5,9 @@ import (
 	"fmt"
 	"os"
 	"strings"
+	"time"
 
+	"github.com/digitorus/pdfsign/sign"
 	"github.com/digitorus/pdfsigner/signer"
 	"github.com/mitchellh/go-homedir"
 	log "github.com/sirupsen/logrus"
@@ -18,6 +20,101 @@ type Config struct {
 	LicensePath string                   `mapstructure:"licensePath"`
 	Services    map[string]serviceConfig `mapstructure:"services"`
 	Signers     map[string]signerConfig  `mapstructure:"signers"`
+	VerifyCache verifyCacheConfig        `mapstructure:"verifyCache"`
+	// VerifyWorkers represents the number of the files verified concurrently
+	VerifyWorkers int `mapstructure:"verifyWorkers,omitempty"`
+	// VerifyRetry represents retry policy of the verification
+	VerifyRetry retryConfig     `mapstructure:"verifyRetry"`
+	Queue       queueConfig     `mapstructure:"queue"`
+	Storage     storageConfig   `mapstructure:"storage"`
+	Retention   retentionConfig `mapstructure:"retention"`
+	Webhooks    webhooksConfig  `mapstructure:"webhooks"`
+	// APIClients represents the clients of the web api by name
+	APIClients map[string]apiClientConfig `mapstructure:"apiClients"`
+	// ShutdownTimeout represents the time to finish the requests and the tasks being processed on shutdown
+	ShutdownTimeout time.Duration `mapstructure:"shutdownTimeout"`
+	// Pipelines represents the pipelines the files could be processed with by name
+	Pipelines map[string]pipelineConfig `mapstructure:"pipelines"`
+	// VerifyPolicies represents the policies of the verify steps of the pipelines by name
+	VerifyPolicies map[string]verifyPolicyConfig `mapstructure:"verifyPolicies"`
+}
+
+// pipelineConfig is a config of the pipeline, the ordered steps the files are processed with.
+type pipelineConfig struct {
+	Steps []pipelineStepConfig `mapstructure:"steps"`
+}
+
+// pipelineStepConfig is a config of the step of the pipeline.
+type pipelineStepConfig struct {
+	Type     string   `mapstructure:"type"`               // Type of the step: sign, timestamp, verify or deliver
+	Signer   string   `mapstructure:"signer,omitempty"`   // Signer of the sign step
+	CertType uint     `mapstructure:"certType,omitempty"` // Certificate type of the sign step overriding the signer, Ex. 2 for countersigning
+	TSA      sign.TSA `mapstructure:"tsa"`                // Time Stamping Authority of the timestamp step
+	Policy   string   `mapstructure:"policy,omitempty"`   // Verification policy of the verify step
+	Out      string   `mapstructure:"out,omitempty"`      // Folder the deliver step copies the file to
+}
+
+// verifyPolicyConfig is a config of the requirements the file should meet to pass the verify step.
+type verifyPolicyConfig struct {
+	MinSignatures        int  `mapstructure:"minSignatures"`        // Minimum number of the valid signatures
+	RequireTrustedIssuer bool `mapstructure:"requireTrustedIssuer"` // Require certificates issued by the trusted authority
+	RejectChanges        bool `mapstructure:"rejectChanges"`        // Reject modifications not permitted after signing
+}
+
+// retentionConfig is a config of the retention of the processed jobs and their files.
+type retentionConfig struct {
+	AfterCompletion time.Duration `mapstructure:"afterCompletion"` // How long the job is kept after it's processed
+	AfterDownload   time.Duration `mapstructure:"afterDownload"`   // How long the job is kept after the signed files are downloaded
+	MaxStorageMB    int64         `mapstructure:"maxStorageMB"`    // Maximum size of the uploaded and signed files in megabytes
+	Interval        time.Duration `mapstructure:"interval"`        // How often the expired jobs are deleted, default 10m
+}
+
+// webhooksConfig is a config of the delivery of the webhooks.
+type webhooksConfig struct {
+	Secret      string        `mapstructure:"secret"`      // Key of HMAC signature of the payloads
+	MaxAttempts int           `mapstructure:"maxAttempts"` // Maximum number of the delivery attempts
+	Backoff     time.Duration `mapstructure:"backoff"`     // Delay before the first retry, doubled after every attempt
+	MaxBackoff  time.Duration `mapstructure:"maxBackoff"`  // Maximum delay between the attempts
+	Timeout     time.Duration `mapstructure:"timeout"`     // Timeout of the single attempt
+	// AllowedNetworks represents CIDR ranges of the private networks the webhooks could be delivered to
+	AllowedNetworks []string `mapstructure:"allowedNetworks"`
+}
+
+// apiClientConfig is a config of the client of the web api.
+type apiClientConfig struct {
+	Key         string `mapstructure:"key"`                   // Key provided by the client inside X-API-Key header
+	MaxPriority string `mapstructure:"maxPriority,omitempty"` // Highest priority of the jobs of the client: low, medium or high
+	Weight      int    `mapstructure:"weight,omitempty"`      // Share of the files processed by every signer relative to other clients, default 1
+	MaxInFlight int    `mapstructure:"maxInFlight,omitempty"` // Maximum number of the files processed by every signer at the same time
+}
+
+// queueConfig is a config of the queues of the signers and the verifier.
+type queueConfig struct {
+	Capacity          int           `mapstructure:"capacity"`          // Maximum number of the queued files of every signer, unbounded if not set
+	Aging             time.Duration `mapstructure:"aging"`             // Waiting time which raises the priority of the queued file by one level
+	Deduplicate       bool          `mapstructure:"deduplicate"`       // Process the files of the job with the same content once
+	IdempotencyWindow time.Duration `mapstructure:"idempotencyWindow"` // How long the Idempotency-Key of the web api request is mapped to the job, default 24h
+}
+
+// storageConfig is a config of the storage of the jobs and the tasks.
+type storageConfig struct {
+	Type  string        `mapstructure:"type"`  // Type of the storage: bolt or sqlite, default bolt
+	Path  string        `mapstructure:"path"`  // Path to the SQLite database, default pdfsigner.sqlite next to the executable
+	Lease time.Duration `mapstructure:"lease"` // How long the task claimed by the worker is leased to it, default 30s
+}
+
+// retryConfig is a config of the retry policy of the failed tasks.
+type retryConfig struct {
+	MaxAttempts int           `mapstructure:"maxAttempts"`
+	Backoff     time.Duration `mapstructure:"backoff"`
+	MaxBackoff  time.Duration `mapstructure:"maxBackoff,omitempty"`
+	Retryable   []string      `mapstructure:"retryable,omitempty"`
+}
+
+// verifyCacheConfig is a config of the verification results cache.
+type verifyCacheConfig struct {
+	TTL     time.Duration `mapstructure:"ttl"`
+	Profile string        `mapstructure:"profile,omitempty"`
 }
 
 // serviceConfig is a config of the service.
@@ -31,6 +128,13 @@ type serviceConfig struct {
 	ValidateSignature bool     `mapstructure:"validateSignature"`
 	Addr              string   `mapstructure:"addr,omitempty"`
 	Port              string   `mapstructure:"port,omitempty"` // Changed to string
+	Webhooks          []string `mapstructure:"webhooks,omitempty"`
+	Schedule          string   `mapstructure:"schedule,omitempty"`  // Cron expression of the runs signing the watched files, Ex. "0 0 * * *"
+	Pipeline          string   `mapstructure:"pipeline,omitempty"`  // Pipeline processing the watched files instead of the signer
+	Pipelines         []string `mapstructure:"pipelines,omitempty"` // Pipelines the jobs of the web api could be processed with
+	Workers           int      `mapstructure:"workers,omitempty"`   // Number of the files of the service signed concurrently by every signer, default workers of the signer
+	Capacity          int      `mapstructure:"capacity,omitempty"`  // Maximum number of the queued files of the service of every signer, default capacity of the queue
+	Priority          string   `mapstructure:"priority,omitempty"`  // Priority of the watched files: low, medium or high, default low
 }
 
 type signerConfig struct {
@@ -42,6 +146,8 @@ type signerConfig struct {
 	Pass         string          `mapstructure:"pass,omitempty"`
 	CrtChainPath string          `mapstructure:"crtChainPath,omitempty"`
 	SignData     signer.SignData `mapstructure:"signData"`
+	Workers      int             `mapstructure:"workers,omitempty"` // Number of the files signed concurrently
+	Retry        retryConfig     `mapstructure:"retry"`
 }
 
 var (
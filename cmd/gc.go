@@ -0,0 +1,33 @@
+package cmd
+
+import (
+	"fmt"
+
+	log "github.com/sirupsen/logrus"
+	"github.com/spf13/cobra"
+)
+
+// gcCmd represents the gc command.
+var gcCmd = &cobra.Command{
+	Use:   "gc",
+	Short: "Delete expired jobs and temporary files",
+	Long:  `Deletes the processed jobs expired by the retention settings of the config file with their uploaded and signed files, and removes the temporary files not used by any job. The same is done by the Web API in the background, the command should be used while the Web API is stopped.`,
+	Run: func(cmd *cobra.Command, args []string) {
+		// loading jobs from the db
+		loadJobs()
+
+		setupQueue()
+
+		stats, err := signVerifyQueue.CollectGarbage()
+		if err != nil {
+			log.Fatal(err)
+		}
+
+		fmt.Printf("Deleted %d jobs, removed %d files, freed %d bytes\n", stats.Jobs, stats.Files, stats.Bytes)
+	},
+}
+
+func init() {
+	RootCmd.AddCommand(gcCmd)
+	gcCmd.PersistentFlags().StringVar(&configFilePathFlag, "config", "", "Path to config file")
+}
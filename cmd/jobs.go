@@ -0,0 +1,190 @@
+package cmd
+
+import (
+	"encoding/json"
+	"fmt"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/digitorus/pdfsigner/queues/queue"
+	log "github.com/sirupsen/logrus"
+	"github.com/spf13/cobra"
+)
+
+var (
+	// jobsFilter represents the conditions of the listed jobs.
+	jobsFilter queue.JobFilter
+	// jobsCreatedAfterFlag defines the time the listed jobs were created at or after.
+	jobsCreatedAfterFlag string
+	// jobsCreatedBeforeFlag defines the time the listed jobs were created before.
+	jobsCreatedBeforeFlag string
+	// jobsFormatFlag defines the output format of the jobs.
+	jobsFormatFlag string
+)
+
+// jobsCmd represents the jobs command.
+var jobsCmd = &cobra.Command{
+	Use:   "jobs",
+	Short: "List, show and delete jobs of the local database",
+	Long:  `Lists, shows and deletes the signing and verification jobs saved to the local database or the storage of the config file. The commands should be used while the Web API is stopped.`,
+	PersistentPreRun: func(cmd *cobra.Command, args []string) {
+		setupStorage()
+	},
+}
+
+// jobsListCmd represents the jobs list command.
+var jobsListCmd = &cobra.Command{
+	Use:   "list",
+	Short: "List jobs from the newest to the oldest",
+	Run: func(cmd *cobra.Command, args []string) {
+		if jobsFormatFlag != "text" && jobsFormatFlag != "json" {
+			log.Fatal("format is not supported: ", jobsFormatFlag)
+		}
+
+		f := jobsFilter
+		f.Unit = getJobsUnitName(f.Unit)
+		f.CreatedAfter = parseJobsTime("created-after", jobsCreatedAfterFlag)
+		f.CreatedBefore = parseJobsTime("created-before", jobsCreatedBeforeFlag)
+
+		jobs, nextCursor, err := signVerifyQueue.ListJobs(f)
+		if err != nil {
+			log.Fatal(err)
+		}
+
+		if jobsFormatFlag == "json" {
+			printJSON(map[string]interface{}{"jobs": jobs, "next_cursor": nextCursor})
+
+			return
+		}
+
+		for _, j := range jobs {
+			fmt.Printf("%s %s %s %s %s\n", j.ID, j.JobType(), j.CreatedAt.Format(time.RFC3339), jobTaskStatuses(j), jobFileNames(j))
+		}
+
+		if nextCursor != "" {
+			fmt.Printf("Next page: --cursor %s\n", nextCursor)
+		}
+	},
+}
+
+// jobsShowCmd represents the jobs show command.
+var jobsShowCmd = &cobra.Command{
+	Use:   "show [job id]",
+	Short: "Show job with the tasks",
+	Args:  cobra.ExactArgs(1),
+	Run: func(cmd *cobra.Command, args []string) {
+		err := signVerifyQueue.LoadJobFromDB(args[0])
+		if err != nil {
+			log.Fatal(err)
+		}
+
+		j, err := signVerifyQueue.GetJobByID(args[0])
+		if err != nil {
+			log.Fatal(err)
+		}
+
+		printJSON(j)
+	},
+}
+
+// jobsDeleteCmd represents the jobs delete command.
+var jobsDeleteCmd = &cobra.Command{
+	Use:   "delete [job id]",
+	Short: "Delete job with the temporary files",
+	Args:  cobra.MinimumNArgs(1),
+	Run: func(cmd *cobra.Command, jobIDs []string) {
+		for _, id := range jobIDs {
+			err := signVerifyQueue.LoadJobFromDB(id)
+			if err != nil {
+				log.Fatal("Couldn't delete job ", id, ", ", err)
+			}
+
+			err = signVerifyQueue.DeleteJob(id)
+			if err != nil {
+				log.Fatal("Couldn't delete job ", id, ", ", err)
+			}
+
+			fmt.Println("Deleted job", id)
+		}
+	},
+}
+
+// getJobsUnitName returns the name of the queue unit, "verify" is used for the verification unit.
+func getJobsUnitName(name string) string {
+	if name == "verify" {
+		return queue.VerificationUnitName
+	}
+
+	return name
+}
+
+// parseJobsTime parses RFC 3339 time of the flag if it's provided.
+func parseJobsTime(flagName, s string) time.Time {
+	if s == "" {
+		return time.Time{}
+	}
+
+	t, err := time.Parse(time.RFC3339, s)
+	if err != nil {
+		log.Fatalf("%s should be RFC 3339 time: %s", flagName, s)
+	}
+
+	return t
+}
+
+// jobTaskStatuses returns the number of the tasks of the job by status, Ex. Completed:2,Failed:1.
+func jobTaskStatuses(j queue.Job) string {
+	counts := map[string]int{}
+	for _, t := range j.TasksMap {
+		counts[t.Status]++
+	}
+
+	var statuses []string
+	for s, c := range counts {
+		statuses = append(statuses, fmt.Sprintf("%s:%d", s, c))
+	}
+
+	sort.Strings(statuses)
+
+	return strings.Join(statuses, ",")
+}
+
+// jobFileNames returns the original file names of the tasks of the job.
+func jobFileNames(j queue.Job) string {
+	var names []string
+	for _, t := range j.TasksMap {
+		names = append(names, t.OriginalFileName)
+	}
+
+	sort.Strings(names)
+
+	return strings.Join(names, ",")
+}
+
+// printJSON prints the value as indented json.
+func printJSON(v interface{}) {
+	b, err := json.MarshalIndent(v, "", "  ")
+	if err != nil {
+		log.Fatal(err)
+	}
+
+	fmt.Println(string(b))
+}
+
+func init() {
+	RootCmd.AddCommand(jobsCmd)
+	jobsCmd.AddCommand(jobsListCmd, jobsShowCmd, jobsDeleteCmd)
+	jobsCmd.PersistentFlags().StringVar(&configFilePathFlag, "config", "", "Path to config file")
+
+	jobsListCmd.Flags().StringVar(&jobsFilter.Type, "type", "", "Type of the jobs: sign or verify")
+	jobsListCmd.Flags().StringVar(&jobsFilter.Unit, "unit", "", "Signer processing the tasks of the jobs, verify for the verification")
+	jobsListCmd.Flags().StringVar(&jobsFilter.Status, "status", "", "Status of any task of the jobs, Ex. Failed")
+	jobsListCmd.Flags().StringVar(&jobsFilter.Client, "client", "", "Web API client added the jobs")
+	jobsListCmd.Flags().StringVar(&jobsFilter.FileName, "file", "", "Original file name of any task of the jobs")
+	jobsListCmd.Flags().StringVar(&jobsCreatedAfterFlag, "created-after", "", "RFC 3339 time the jobs were created at or after")
+	jobsListCmd.Flags().StringVar(&jobsCreatedBeforeFlag, "created-before", "", "RFC 3339 time the jobs were created before")
+	jobsListCmd.Flags().IntVar(&jobsFilter.Limit, "limit", queue.DefaultJobsLimit, "Maximum number of the listed jobs")
+	jobsListCmd.Flags().StringVar(&jobsFilter.Cursor, "cursor", "", "Cursor of the next page printed by the previous list")
+	jobsListCmd.Flags().StringVar(&jobsFormatFlag, "format", "text", "Output format: text or json")
+}
@@ -2,12 +2,15 @@ package cmd
 
 import (
 	"sync"
+	"time"
 
 	"github.com/digitorus/pdfsigner/files"
 	"github.com/digitorus/pdfsigner/license"
 	"github.com/digitorus/pdfsigner/queues/priority_queue"
 	"github.com/digitorus/pdfsigner/queues/queue"
+	"github.com/digitorus/pdfsigner/schedule"
 	"github.com/digitorus/pdfsigner/webapi"
+	"github.com/pkg/errors"
 	log "github.com/sirupsen/logrus"
 	"github.com/spf13/cobra"
 )
@@ -24,10 +27,7 @@ var multiCmd = &cobra.Command{
 		}
 
 		// loading jobs from the db
-		err = signVerifyQueue.LoadFromDB()
-		if err != nil {
-			log.Fatal(err)
-		}
+		loadJobs()
 
 		// check if the config contains services
 		if len(servicesConfigArr) < 1 {
@@ -38,7 +38,7 @@ var multiCmd = &cobra.Command{
 		var wg sync.WaitGroup
 
 		// setup services
-		if len(serviceNames) > 1 {
+		if len(serviceNames) > 0 {
 			// setup services by name
 			wg.Add(len(serviceNames))
 			for _, n := range serviceNames {
@@ -62,14 +62,16 @@ var multiCmd = &cobra.Command{
 		// run auto save license
 		license.LD.AutoSave()
 
-		// wait
+		// wait for the services to stop after shutdown
+		waitForShutdown()
 		wg.Wait()
 	},
 }
 
 // setupServiceWithSigners setup used by service signers and setup signer.
 func setupServiceWithSigners(serviceConf serviceConfig, wg *sync.WaitGroup) {
-	setupSigners(serviceConf.Type, serviceConf.Signer, serviceConf.Signers)
+	setupSigners(serviceConf)
+	setupServicePipelines(serviceConf)
 
 	go func(serviceConf serviceConfig) {
 		setupService(serviceConf)
@@ -80,9 +82,11 @@ func setupServiceWithSigners(serviceConf serviceConfig, wg *sync.WaitGroup) {
 // directoryWatchersCount used to count the amount of directories watched. Required for license limits.
 var directoryWatchersCount int
 
-// setupSigners depending on the service type, watch or serve, setups the signer or signers.
-func setupSigners(serviceType, configSignerName string, configSignerNames []string) {
-	switch serviceType {
+// setupSigners depending on the service type, watch or serve, setups the signer or signers of the service.
+func setupSigners(service serviceConfig) {
+	configSignerName, configSignerNames := service.Signer, service.Signers
+
+	switch service.Type {
 	case "watch":
 		directoryWatchersCount++
 		if directoryWatchersCount > license.LD.MaxDirectoryWatchers {
@@ -96,7 +100,7 @@ func setupSigners(serviceType, configSignerName string, configSignerNames []stri
 
 		// setup signer
 		if configSignerName != "" {
-			setupSigner(configSignerName)
+			setupServiceSigner(service, configSignerName)
 
 			return
 		}
@@ -107,10 +111,8 @@ func setupSigners(serviceType, configSignerName string, configSignerNames []stri
 		}
 
 		// setup signers
-		if len(configSignerNames) > 1 {
-			for _, sn := range configSignerNames {
-				setupSigner(sn)
-			}
+		for _, sn := range configSignerNames {
+			setupServiceSigner(service, sn)
 		}
 
 		// setup verifier unit
@@ -120,21 +122,107 @@ func setupSigners(serviceType, configSignerName string, configSignerNames []stri
 	}
 }
 
-// setupSigner adds found inside the config by name signer to the queue for later use.
-func setupSigner(signerName string) {
+// signerNames represents the names of the units of the signers added to the queue.
+var signerNames = map[string]bool{}
+
+// loadedSigners represents the signers with the loaded keys by name, the units of the same signer share the key.
+var loadedSigners = map[string]signerConfig{}
+
+// loadSigner loads the key of the signer found inside the config by name, the key is loaded once.
+func loadSigner(signerName string) signerConfig {
+	return loadSignerSessions(signerName, 0)
+}
+
+// loadSignerSessions loads the key of the signer found inside the config by name, the key is loaded once.
+// The sessions of the PKSC11 token are opened for the workers, the workers of the signer are used if 0.
+func loadSignerSessions(signerName string, workers int) signerConfig {
+	if config, exists := loadedSigners[signerName]; exists {
+		return config
+	}
+
 	// get config signer by name
 	config := getSignerConfigByName(signerName)
 
+	if workers > 0 {
+		config.Workers = workers
+	}
+
 	// set sign data
 	switch config.Type {
 	case "pem":
 		config.SignData.SetPEM(config.CrtPath, config.KeyPath, config.CrtChainPath)
 	case "pksc11":
-		config.SignData.SetPKSC11(config.LibPath, config.Pass, config.CrtChainPath)
+		// every worker requires a separate session of the token
+		config.Workers = config.SignData.SetPKSC11Sessions(config.LibPath, config.Pass, config.CrtChainPath, config.Workers)
 	}
 
+	loadedSigners[signerName] = config
+
+	return config
+}
+
+// setupSigner adds found inside the config by name signer to the queue for later use.
+func setupSigner(signerName string) {
+	setupSignerUnit(signerName, signerName, 0)
+}
+
+// setupSignerUnit adds the unit signing the files with the signer to the queue,
+// the unit uses the workers of the signer if the workers are not provided.
+// The workers of the unit of the PKSC11 signer are limited by the sessions opened for the signer.
+func setupSignerUnit(unitName, signerName string, workers int) {
+	// skip the unit used by another service or pipeline
+	if signerNames[unitName] {
+		return
+	}
+
+	signerNames[unitName] = true
+
+	config := loadSigner(signerName)
+
 	// add signer to signers map
-	signVerifyQueue.AddSignUnit(signerName, config.SignData)
+	signVerifyQueue.AddSignUnit(unitName, config.SignData)
+
+	// set the number of the files signed concurrently
+	if workers == 0 {
+		workers = config.Workers
+	}
+
+	// the sessions of the token are opened once for the workers of the signer and shared by its units
+	if config.Type == "pksc11" && workers > config.Workers {
+		log.Warnf("%s: workers are limited to %d sessions of the token opened for the signer %s", unitName, config.Workers, signerName)
+
+		workers = config.Workers
+	}
+
+	setupWorkers(unitName, workers)
+
+	// set retry policy of the failed signings
+	setupRetryPolicy(unitName, config.Retry)
+}
+
+// serviceUnitName returns the name of the unit signing the files of the service with the signer,
+// the services sharing the signer have separate queues, quotas and statistics.
+func serviceUnitName(serviceName, signerName string) string {
+	return serviceName + ":" + signerName
+}
+
+// setupServiceSigner adds the unit of the signer used by the service with the quotas of the service.
+func setupServiceSigner(service serviceConfig, signerName string) {
+	unitName := serviceUnitName(service.Name, signerName)
+	setupSignerUnit(unitName, signerName, service.Workers)
+
+	// the tasks saved when the unit was named as the signer are processed by the unit of the service
+	err := signVerifyQueue.SetUnitAlias(signerName, unitName)
+	if err != nil {
+		log.Fatalf("service %s: %s", service.Name, err)
+	}
+
+	if service.Capacity > 0 {
+		err = signVerifyQueue.SetUnitCapacity(unitName, service.Capacity)
+		if err != nil {
+			log.Fatalf("service %s: %s", service.Name, err)
+		}
+	}
 }
 
 // setupService depending on the type of the service setups service.
@@ -148,20 +236,72 @@ func setupService(service serviceConfig) {
 	}
 }
 
-// setupWatch setups watcher which watches the input folder and adds the tasks to the queue.
+// setupWatch setups watcher which watches the input folder and adds the tasks to the queue,
+// the tasks are scheduled to the next run if the schedule of the service is provided.
 func setupWatch(service serviceConfig) {
-	files.Watch(service.In, func(inputFilePath string, left int) {
+	var runs *schedule.Schedule
+
+	// the watched files are signed with low priority if the priority is not provided
+	priority := priority_queue.LowPriority
+
+	if service.Priority != "" {
+		var err error
+
+		priority, err = priority_queue.ParsePriority(service.Priority)
+		if err != nil {
+			log.Fatalf("service %s: %s", service.Name, err)
+		}
+	}
+
+	// the files are signed by the unit of the service, the pipeline chooses the units itself
+	var unitName string
+	if service.Signer != "" {
+		unitName = serviceUnitName(service.Name, service.Signer)
+	}
+
+	if service.Schedule != "" {
+		var err error
+
+		runs, err = schedule.Parse(service.Schedule)
+		if err != nil {
+			log.Fatalf("service %s: %s", service.Name, err)
+		}
+	}
+
+	files.Watch(servicesCtx, service.In, func(inputFilePath string, left int) {
 		// make signed file path
 		signedFilePath := getOutputFilePathByInputFilePath(inputFilePath, service.Out)
 
 		// create session
-		jobID := signVerifyQueue.AddSignJob(queue.JobSignConfig{
-			ValidateSignature: service.ValidateSignature,
-		})
+		jobID, err := addWatchJob(service)
+		if err != nil {
+			log.Errorf("service %s: %s", service.Name, err)
+
+			return
+		}
+
+		// notify default webhooks of the service
+		if len(service.Webhooks) > 0 {
+			_ = signVerifyQueue.SetJobWebhooks(jobID, service.Webhooks)
+		}
+
+		// schedule to the next run
+		var notBefore time.Time
+		if runs != nil {
+			notBefore = runs.Next(time.Now())
+		}
+
+		// push job, the watcher waits while the queue is full
+		err = addWatchTask(unitName, jobID, inputFilePath, signedFilePath, priority, notBefore)
+		if err != nil {
+			log.Errorf("service %s: file %s is not queued: %s", service.Name, inputFilePath, err)
+
+			// the job without the task is never completed
+			_ = signVerifyQueue.DeleteJob(jobID)
+
+			return
+		}
 
-		// push job
-		// TODO: should we write any errors to the debug log?
-		_, _ = signVerifyQueue.AddTask(service.Signer, jobID, "", inputFilePath, signedFilePath, priority_queue.LowPriority)
 		if left == 0 {
 			_ = signVerifyQueue.SaveToDB(jobID)
 		}
@@ -169,16 +309,64 @@ func setupWatch(service serviceConfig) {
 	// batch save to the db
 }
 
+// watchRetryInterval represents delay before the watched file is queued again if the queue is full.
+const watchRetryInterval = time.Second
+
+// addWatchTask adds the task of the watched file, waits until the file is queued if the queue is full.
+func addWatchTask(unitName, jobID, inputFilePath, signedFilePath string, priority priority_queue.Priority, notBefore time.Time) error {
+	for {
+		_, err := signVerifyQueue.AddScheduledTask(unitName, jobID, "", inputFilePath, signedFilePath, priority, notBefore)
+		if !errors.Is(err, priority_queue.ErrFull) {
+			return err
+		}
+
+		log.Debugf("Queue is full, waiting to queue file: %s", inputFilePath)
+
+		select {
+		case <-time.After(watchRetryInterval):
+		case <-servicesCtx.Done():
+			return err
+		}
+	}
+}
+
+// addWatchJob adds the job of the watched file processed by the signer or the pipeline of the service.
+func addWatchJob(service serviceConfig) (string, error) {
+	signConfig := queue.JobSignConfig{
+		ValidateSignature: service.ValidateSignature,
+	}
+
+	if service.Pipeline != "" {
+		return signVerifyQueue.AddPipelineJob(service.Pipeline, signConfig)
+	}
+
+	return signVerifyQueue.AddSignJob(signConfig), nil
+}
+
 // setupServe runs the web api according to the config settings.
 func setupServe(service serviceConfig) {
 	// serve but only use allowed signers
 	wa := webapi.NewWebAPI(service.Addr+":"+service.Port, signVerifyQueue, service.Signers, ver, service.ValidateSignature)
+	wa.SetAPIClients(getAPIClients())
+
+	// the signers of the web api are processed by the units of the service
+	units := make(map[string]string, len(service.Signers))
+	for _, sn := range service.Signers {
+		units[sn] = serviceUnitName(service.Name, sn)
+	}
+
+	wa.SetSignerUnits(units)
+	wa.SetWebhooks(service.Webhooks)
+	onShutdown(wa.Shutdown)
 	wa.Serve()
 }
 
 // runQueues starts the mechanism to sign the files whenever they are getting into the queue.
 func runQueues() {
+	setupQueue()
+	setupWebhooks()
 	signVerifyQueue.StartProcessor()
+	startJanitor()
 }
 
 func init() {
@@ -0,0 +1,177 @@
+package cmd
+
+import (
+	"fmt"
+	"os"
+	"sort"
+
+	"github.com/digitorus/pdfsigner/license"
+	"github.com/digitorus/pdfsigner/signer"
+	"github.com/digitorus/pdfsigner/webapi"
+	log "github.com/sirupsen/logrus"
+	"github.com/spf13/cobra"
+)
+
+// workerIDFlag defines id of the worker claiming the tasks from the shared storage.
+var workerIDFlag string
+
+// apiCmd runs the web api adding the jobs to the storage shared with the workers.
+var apiCmd = &cobra.Command{
+	Use:   "api [signers]",
+	Short: "Run web server adding the jobs to the storage shared with the workers",
+	Long: `Runs the Web API without processing the files, the jobs are added to the SQLite storage shared with the workers started by the worker command.
+Several API nodes and workers could run at the same time, the storage should be configured with the sqlite type.`,
+	Run: func(cmd *cobra.Command, signerNames []string) {
+		// require license
+		err := requireLicense()
+		if err != nil {
+			log.Fatal(err)
+		}
+
+		// check if the signer names provided
+		if len(signerNames) < 1 {
+			log.Fatal("signers are not provided")
+		}
+
+		setupSharedStorage("")
+
+		// the files are signed by the workers, so the signers are added without loading the keys
+		for _, sn := range signerNames {
+			addRemoteSigner(sn)
+		}
+
+		signVerifyQueue.AddVerifyUnit()
+		setupSharedPipelines(addRemoteSigner)
+
+		wa := webapi.NewWebAPI(getAddrPort(), signVerifyQueue, signerNames, ver, validateSignature)
+		wa.SetAPIClients(getAPIClients())
+
+		// the cancelled tasks are notified by the api node
+		setupQueue()
+		setupWebhooks()
+		startJanitor()
+
+		// run license auto save
+		license.LD.AutoSave()
+
+		// run serve until shutdown
+		onShutdown(wa.Shutdown)
+
+		go wa.Serve()
+
+		waitForShutdown()
+	},
+}
+
+// workerCmd runs the worker processing the jobs of the storage shared with the api nodes.
+var workerCmd = &cobra.Command{
+	Use:   "worker [signers]",
+	Short: "Run worker processing the jobs of the storage shared with the api nodes",
+	Long: `Runs the worker claiming the tasks of the signers and the verifier from the SQLite storage shared with the api nodes started by the api command.
+The claimed tasks are leased to the worker while they're processed, the tasks of the stopped or crashed worker are claimed by other workers when the leases expire.
+The steps of the pipelines using the signers of other workers are processed by them.`,
+	Run: func(cmd *cobra.Command, signerNames []string) {
+		// require license
+		err := requireLicense()
+		if err != nil {
+			log.Fatal(err)
+		}
+
+		id := workerIDFlag
+		if id == "" {
+			id = defaultWorkerID()
+		}
+
+		setupSharedStorage(id)
+
+		// setup signers
+		for _, sn := range signerNames {
+			setupSigner(sn)
+		}
+
+		// setup verifier
+		setupVerifier()
+
+		// the signers of other workers are not set up
+		setupSharedPipelines(func(string) {})
+
+		setupQueue()
+		setupWebhooks()
+		signVerifyQueue.StartProcessor()
+
+		// run license auto save
+		license.LD.AutoSave()
+
+		log.WithField("worker", id).Info("Worker started")
+
+		waitForShutdown()
+	},
+}
+
+// setupSharedStorage sets the SQLite storage shared by the api nodes and the workers, the worker with the id claims the tasks.
+// The license limits are shared by the nodes through the storage.
+func setupSharedStorage(worker string) {
+	if config.Storage.Type != "sqlite" {
+		log.Fatal("shared storage should be configured with sqlite type")
+	}
+
+	setupStorage()
+
+	err := signVerifyQueue.SetShared(worker, config.Storage.Lease)
+	if err != nil {
+		log.Fatal(err)
+	}
+
+	// the limits of the license are counted once for all the nodes
+	if s, ok := jobsStore.(license.StateStore); ok {
+		license.LD.SetStateStore(s)
+	}
+}
+
+// addRemoteSigner adds the signer processed by the workers to the queue, the keys of the signer are not loaded.
+func addRemoteSigner(signerName string) {
+	if signerNames[signerName] {
+		return
+	}
+
+	// check if the signer is in the config
+	getSignerConfigByName(signerName)
+
+	signerNames[signerName] = true
+
+	signVerifyQueue.AddSignUnit(signerName, signer.SignData{})
+}
+
+// setupSharedPipelines adds all the pipelines of the config to the queue, the signers of the sign steps are set up by the function.
+func setupSharedPipelines(setupStepSigner func(signerName string)) {
+	names := make([]string, 0, len(config.Pipelines))
+	for name := range config.Pipelines {
+		names = append(names, name)
+	}
+
+	sort.Strings(names)
+
+	for _, name := range names {
+		addPipeline(name, setupStepSigner)
+	}
+}
+
+// defaultWorkerID returns id of the worker made of the host name and the process id.
+func defaultWorkerID() string {
+	hostname, err := os.Hostname()
+	if err != nil {
+		hostname = "worker"
+	}
+
+	return fmt.Sprintf("%s-%d", hostname, os.Getpid())
+}
+
+func init() {
+	RootCmd.AddCommand(apiCmd)
+	parseConfigFlag(apiCmd)
+	parseServeFlags(apiCmd)
+
+	RootCmd.AddCommand(workerCmd)
+	parseConfigFlag(workerCmd)
+	workerCmd.PersistentFlags().StringVar(&workerIDFlag, "id", "", "Id of the worker claiming the tasks, default host name and process id")
+}
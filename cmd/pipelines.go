@@ -0,0 +1,111 @@
+package cmd
+
+import (
+	"github.com/digitorus/pdfsign/sign"
+	"github.com/digitorus/pdfsigner/queues/queue"
+	log "github.com/sirupsen/logrus"
+)
+
+// pipelineNames represents the names of the pipelines added to the queue.
+var pipelineNames = map[string]bool{}
+
+// setupServicePipelines adds the pipelines used by the service to the queue,
+// watch service processes the files with single pipeline instead of the signer.
+func setupServicePipelines(service serviceConfig) {
+	names := service.Pipelines
+
+	if service.Type == "watch" {
+		if len(service.Pipelines) > 0 {
+			log.Fatal(`Use pipeline instead of pipelines config setting for watch`)
+		}
+
+		if service.Pipeline != "" && service.Signer != "" {
+			log.Fatal(`Use either signer or pipeline config setting for watch`)
+		}
+
+		names = nil
+		if service.Pipeline != "" {
+			names = append(names, service.Pipeline)
+		}
+	}
+
+	for _, name := range names {
+		setupPipeline(name)
+	}
+}
+
+// setupPipeline adds found inside the config by name pipeline to the queue, the signers and the verifier of the steps are set up as well.
+func setupPipeline(name string) {
+	addPipeline(name, setupSigner)
+}
+
+// addPipeline adds found inside the config by name pipeline to the queue, the signers of the sign steps are set up by the function.
+func addPipeline(name string, setupStepSigner func(signerName string)) {
+	// skip the pipeline used by another service
+	if pipelineNames[name] {
+		return
+	}
+
+	c, exists := config.Pipelines[name]
+	if !exists {
+		log.Fatalf("pipeline %s is not found", name)
+	}
+
+	p := queue.Pipeline{Name: name}
+	needsVerifier := false
+
+	for _, s := range c.Steps {
+		step := queue.PipelineStep{
+			Type:     s.Type,
+			Signer:   s.Signer,
+			CertType: sign.CertType(s.CertType),
+			TSA:      s.TSA,
+			Out:      s.Out,
+		}
+
+		switch s.Type {
+		case queue.StepSign:
+			setupStepSigner(s.Signer)
+		case queue.StepVerify:
+			step.Policy = getVerifyPolicy(s.Policy)
+		}
+
+		// the steps other than signing are processed by the verifier
+		if s.Type != queue.StepSign {
+			needsVerifier = true
+		}
+
+		p.Steps = append(p.Steps, step)
+	}
+
+	if needsVerifier {
+		setupVerifier()
+	}
+
+	err := signVerifyQueue.AddPipeline(p)
+	if err != nil {
+		log.Fatal(err)
+	}
+
+	pipelineNames[name] = true
+}
+
+// getVerifyPolicy returns the policy of the verify step found inside the config by name,
+// the signatures are only required to be valid if the name is not provided.
+func getVerifyPolicy(name string) queue.VerifyPolicy {
+	if name == "" {
+		return queue.VerifyPolicy{}
+	}
+
+	c, exists := config.VerifyPolicies[name]
+	if !exists {
+		log.Fatalf("verify policy %s is not found", name)
+	}
+
+	return queue.VerifyPolicy{
+		Name:                 name,
+		MinSignatures:        c.MinSignatures,
+		RequireTrustedIssuer: c.RequireTrustedIssuer,
+		RejectChanges:        c.RejectChanges,
+	}
+}
@@ -0,0 +1,128 @@
+package cmd
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/digitorus/pdfsigner/revision"
+	log "github.com/sirupsen/logrus"
+	"github.com/spf13/cobra"
+)
+
+var (
+	// revisionsOutputPathFlag defines the folder to write the signed revisions to.
+	revisionsOutputPathFlag string
+	// revisionsFormatFlag defines the output format of the revisions list.
+	revisionsFormatFlag string
+)
+
+// revisionsCmd represents the revisions command.
+var revisionsCmd = &cobra.Command{
+	Use:   "revisions",
+	Short: "List incremental revisions of PDF and extract signed revisions",
+	Long:  `Lists every incremental revision of the document with byte offsets, hash and the signatures covering it. With --out the exact revision covered by each signature is written as a standalone PDF.`,
+	Run: func(cmd *cobra.Command, inputFileNames []string) {
+		if len(inputFileNames) < 1 {
+			log.Fatal("no files provided")
+		}
+
+		if revisionsFormatFlag != "text" && revisionsFormatFlag != "json" {
+			log.Fatal("format is not supported: ", revisionsFormatFlag)
+		}
+
+		for _, f := range inputFileNames {
+			err := listRevisions(f)
+			if err != nil {
+				log.Fatal("Couldn't list revisions of file ", f, ", ", err)
+			}
+		}
+	},
+}
+
+// listRevisions prints revisions of the file and extracts signed revisions if output path provided.
+func listRevisions(filePath string) error {
+	inputFile, err := os.Open(filePath)
+	if err != nil {
+		return err
+	}
+	defer func() { _ = inputFile.Close() }()
+
+	fileInfo, err := inputFile.Stat()
+	if err != nil {
+		return err
+	}
+
+	revisions, err := revision.List(inputFile, fileInfo.Size())
+	if err != nil {
+		return err
+	}
+
+	// print revisions
+	if revisionsFormatFlag == "json" {
+		b, err := json.MarshalIndent(revisions, "", "  ")
+		if err != nil {
+			return err
+		}
+
+		fmt.Println(string(b))
+	} else {
+		for _, r := range revisions {
+			var signatures []string
+			for _, s := range r.Signatures {
+				signatures = append(signatures, s.Name)
+			}
+
+			log.Printf("%s revision %d: bytes %d-%d, sha256 %s, signed by %v", filePath, r.Number, r.Offset, r.End, r.Hash, signatures)
+		}
+	}
+
+	if revisionsOutputPathFlag == "" {
+		return nil
+	}
+
+	// write signed revisions
+	for _, r := range revisions {
+		if len(r.Signatures) == 0 {
+			continue
+		}
+
+		outputFilePath := getRevisionFilePath(filePath, revisionsOutputPathFlag, r.Number)
+
+		err := writeRevision(inputFile, r.Revision, outputFilePath)
+		if err != nil {
+			return err
+		}
+
+		log.Println("Revision", r.Number, "written to", outputFilePath)
+	}
+
+	return nil
+}
+
+// writeRevision writes the revision as standalone PDF.
+func writeRevision(inputFile *os.File, r revision.Revision, outputFilePath string) error {
+	outputFile, err := os.Create(outputFilePath)
+	if err != nil {
+		return err
+	}
+	defer func() { _ = outputFile.Close() }()
+
+	return revision.Extract(inputFile, r, outputFile)
+}
+
+// getRevisionFilePath returns path of the extracted revision file.
+func getRevisionFilePath(inputFilePath, outputFolderPath string, number int) string {
+	_, fileName := filepath.Split(inputFilePath)
+	fileNameNoExt := strings.TrimSuffix(fileName, filepath.Ext(fileName))
+
+	return filepath.Join(outputFolderPath, fmt.Sprintf("%s_revision_%d%s", fileNameNoExt, number, filepath.Ext(fileName)))
+}
+
+func init() {
+	RootCmd.AddCommand(revisionsCmd)
+	revisionsCmd.PersistentFlags().StringVar(&revisionsOutputPathFlag, "out", "", "Folder to write the revisions covered by signatures to")
+	revisionsCmd.PersistentFlags().StringVar(&revisionsFormatFlag, "format", "text", "Output format: text or json")
+}
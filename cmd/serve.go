@@ -27,10 +27,7 @@ var servePEMCmd = &cobra.Command{
 		}
 
 		// loading jobs from the db
-		err = signVerifyQueue.LoadFromDB()
-		if err != nil {
-			log.Fatal(err)
-		}
+		loadJobs()
 
 		config := signerConfig{}
 
@@ -41,7 +38,7 @@ var servePEMCmd = &cobra.Command{
 		config.SignData.SetPEM(config.CrtPath, config.KeyPath, config.CrtChainPath)
 
 		// start web api with runners using unnamed signer
-		startWebAPIWithRunnersUnnamedSigner(config.SignData)
+		startWebAPIWithRunnersUnnamedSigner(config.SignData, config.Workers)
 	},
 }
 
@@ -57,10 +54,7 @@ var servePKSC11Cmd = &cobra.Command{
 		}
 
 		// loading jobs from the db
-		err = signVerifyQueue.LoadFromDB()
-		if err != nil {
-			log.Fatal(err)
-		}
+		loadJobs()
 
 		// create signer config
 		config := signerConfig{}
@@ -68,11 +62,11 @@ var servePKSC11Cmd = &cobra.Command{
 		// bind signer flags to config
 		bindSignerFlagsToConfig(cmd, &config)
 
-		// set sign data
-		config.SignData.SetPKSC11(config.LibPath, config.Pass, config.CrtChainPath)
+		// set sign data, every worker requires a separate session of the token
+		config.Workers = config.SignData.SetPKSC11Sessions(config.LibPath, config.Pass, config.CrtChainPath, config.Workers)
 
 		// start web api with runners using unnamed signer
-		startWebAPIWithRunnersUnnamedSigner(config.SignData)
+		startWebAPIWithRunnersUnnamedSigner(config.SignData, config.Workers)
 	},
 }
 
@@ -89,10 +83,7 @@ var serveWithMultipleSignersCmd = &cobra.Command{
 		}
 
 		// loading jobs from the db
-		err = signVerifyQueue.LoadFromDB()
-		if err != nil {
-			log.Fatal(err)
-		}
+		loadJobs()
 
 		// check if the signer names provided
 		if len(signerNames) < 1 {
@@ -113,9 +104,10 @@ var serveWithMultipleSignersCmd = &cobra.Command{
 }
 
 // startWebAPIWithRunnersUnnamedSigner start the web api.
-func startWebAPIWithRunnersUnnamedSigner(signData signer.SignData) {
+func startWebAPIWithRunnersUnnamedSigner(signData signer.SignData, workers int) {
 	id := "signer"
 	signVerifyQueue.AddSignUnit(id, signData)
+	setupWorkers(id, workers)
 	log.Println(signVerifyQueue)
 	startWebAPIWithProcessor([]string{id})
 }
@@ -123,15 +115,23 @@ func startWebAPIWithRunnersUnnamedSigner(signData signer.SignData) {
 // startWebAPIWithProcessor.
 func startWebAPIWithProcessor(allowedSigners []string) {
 	wa := webapi.NewWebAPI(getAddrPort(), signVerifyQueue, allowedSigners, ver, validateSignature)
+	wa.SetAPIClients(getAPIClients())
 
 	// run queue processors
+	setupQueue()
+	setupWebhooks()
 	signVerifyQueue.StartProcessor()
+	startJanitor()
 
 	// run license auto save
 	license.LD.AutoSave()
 
-	// run serve
-	wa.Serve()
+	// run serve until shutdown
+	onShutdown(wa.Shutdown)
+
+	go wa.Serve()
+
+	waitForShutdown()
 }
 
 func init() {
@@ -142,12 +142,14 @@ func init() {
 	parseCommonFlags(servePEMCmd)
 	parsePEMCertificateFlags(servePEMCmd)
 	parseServeFlags(servePEMCmd)
+	parseWorkersFlag(servePEMCmd)
 
 	// add PKSC11 serve command and parse related flags
 	serveCmd.AddCommand(servePKSC11Cmd)
 	parseCommonFlags(servePKSC11Cmd)
 	parsePKSC11CertificateFlags(servePKSC11Cmd)
 	parseServeFlags(servePKSC11Cmd)
+	parseWorkersFlag(servePKSC11Cmd)
 
 	// add serve with multiple signers and parse related flags
 	serveCmd.AddCommand(serveWithMultipleSignersCmd)
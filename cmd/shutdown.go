@@ -0,0 +1,87 @@
+package cmd
+
+import (
+	"context"
+	"os"
+	"os/signal"
+	"sync"
+	"syscall"
+	"time"
+
+	"github.com/digitorus/pdfsigner/license"
+	log "github.com/sirupsen/logrus"
+)
+
+// defaultShutdownTimeout represents the time to finish the requests and the tasks being processed if it's not configured.
+const defaultShutdownTimeout = 30 * time.Second
+
+// servicesCtx is done when the services should stop accepting new files and the background jobs should stop.
+var servicesCtx, stopServices = context.WithCancel(context.Background())
+
+var (
+	shutdownHooksMu sync.Mutex
+	// shutdownHooks represents functions stopping the services, called before the tasks being processed are finished
+	shutdownHooks []func(ctx context.Context) error
+)
+
+// onShutdown adds the function stopping the service on shutdown.
+func onShutdown(f func(ctx context.Context) error) {
+	shutdownHooksMu.Lock()
+	defer shutdownHooksMu.Unlock()
+
+	shutdownHooks = append(shutdownHooks, f)
+}
+
+// waitForShutdown waits for SIGINT or SIGTERM and shuts down gracefully, the second signal terminates immediately.
+func waitForShutdown() {
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	<-ctx.Done()
+	stop()
+
+	shutdown()
+}
+
+// shutdown stops accepting new requests and files, finishes the requests and the tasks being processed
+// within the shutdown timeout and persists the jobs and the license limits.
+func shutdown() {
+	timeout := config.ShutdownTimeout
+	if timeout <= 0 {
+		timeout = defaultShutdownTimeout
+	}
+
+	log.WithField("timeout", timeout).Info("Shutting down...")
+
+	ctx, cancel := context.WithTimeout(context.Background(), timeout)
+	defer cancel()
+
+	// stop accepting new files and the background jobs
+	stopServices()
+
+	// stop accepting new requests and finish the requests being handled
+	shutdownHooksMu.Lock()
+	hooks := shutdownHooks
+	shutdownHooksMu.Unlock()
+
+	for _, f := range hooks {
+		err := f(ctx)
+		if err != nil {
+			log.Errorf("Couldn't stop the service: %s", err)
+		}
+	}
+
+	// finish the tasks being processed and persist the jobs
+	err := signVerifyQueue.Shutdown(ctx)
+	if err != nil {
+		log.Errorf("Couldn't finish the tasks: %s", err)
+	}
+
+	closeStorage()
+
+	// persist the license limits
+	err = license.LD.SaveLimitState()
+	if err != nil {
+		log.Errorf("Couldn't save license limits: %s", err)
+	}
+
+	log.Info("Stopped")
+}
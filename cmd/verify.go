@@ -1,13 +1,20 @@
 package cmd
 
 import (
+	"fmt"
 	"os"
+	"time"
 
 	"github.com/digitorus/pdfsign/verify"
+	"github.com/digitorus/pdfsigner/report"
+	"github.com/digitorus/pdfsigner/revision"
 	log "github.com/sirupsen/logrus"
 	"github.com/spf13/cobra"
 )
 
+// verifyFormatFlag defines the output format of the verification result.
+var verifyFormatFlag string
+
 // verifyCmd represents the verify command.
 var verifyCmd = &cobra.Command{
 	Use:   "verify",
@@ -17,6 +24,10 @@ var verifyCmd = &cobra.Command{
 			log.Fatal("no files provided")
 		}
 
+		if verifyFormatFlag != "text" && verifyFormatFlag != "etsi" {
+			log.Fatal("format is not supported: ", verifyFormatFlag)
+		}
+
 		for _, f := range inputFileNames {
 			input_file, err := os.Open(f)
 			if err != nil {
@@ -24,17 +35,59 @@ var verifyCmd = &cobra.Command{
 			}
 			defer func() { _ = input_file.Close() }()
 
-			_, err = verify.File(input_file)
+			resp, err := verify.File(input_file)
 			if err != nil {
 				log.Println("File", f, "Couldn't be verified", err)
 			} else {
 				log.Println("File", f, "verified successfully")
 			}
 
+			// print modifications made after signing
+			if verifyFormatFlag == "text" && resp != nil {
+				printChangeAnalysis(input_file)
+			}
+
+			// print ETSI validation report
+			if verifyFormatFlag == "etsi" && resp != nil {
+				b, err := report.NewETSIReport(resp, time.Now()).Marshal()
+				if err != nil {
+					log.Fatal(err)
+				}
+
+				fmt.Println(string(b))
+			}
 		}
 	},
 }
 
+// printChangeAnalysis logs the modifications made after signing per revision.
+func printChangeAnalysis(f *os.File) {
+	fileInfo, err := f.Stat()
+	if err != nil {
+		log.Println("Couldn't analyze modifications", err)
+
+		return
+	}
+
+	analysis, err := revision.Analyze(f, fileInfo.Size())
+	if err != nil {
+		log.Println("Couldn't analyze modifications", err)
+
+		return
+	}
+
+	for _, r := range analysis.Revisions {
+		log.Printf("Revision %d (bytes %d-%d) signed by %v: %s", r.Number, r.Offset, r.End, r.Signatures, r.Verdict)
+
+		for _, c := range r.Changes {
+			log.Println("  -", c)
+		}
+	}
+
+	log.Println("Modifications after signing:", analysis.Verdict)
+}
+
 func init() {
 	RootCmd.AddCommand(verifyCmd)
+	verifyCmd.PersistentFlags().StringVar(&verifyFormatFlag, "format", "text", "Output format: text or etsi (ETSI TS 119 102-2 XML validation report)")
 }
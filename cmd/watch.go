@@ -1,9 +1,12 @@
 package cmd
 
 import (
+	"context"
+
 	"github.com/digitorus/pdfsigner/files"
 	"github.com/digitorus/pdfsigner/license"
 	"github.com/digitorus/pdfsigner/signer"
+	"github.com/pkg/errors"
 	log "github.com/sirupsen/logrus"
 	"github.com/spf13/cobra"
 )
@@ -95,15 +98,33 @@ var watchBySignerNameCmd = &cobra.Command{
 	},
 }
 
-// startWatch starts watcher.
+// startWatch starts watcher, on shutdown stops watching and waits for the file being signed.
 func startWatch(signData signer.SignData) {
 	license.LD.AutoSave()
-	files.Watch(inputPathFlag, func(filePath string, left int) {
-		signedFilePath := getOutputFilePathByInputFilePath(filePath, outputPathFlag)
-		if err := signer.SignFile(filePath, signedFilePath, signData, validateSignature); err != nil {
-			log.Errorln(err)
+
+	done := make(chan struct{})
+
+	go func() {
+		defer close(done)
+
+		files.Watch(servicesCtx, inputPathFlag, func(filePath string, left int) {
+			signedFilePath := getOutputFilePathByInputFilePath(filePath, outputPathFlag)
+			if err := signer.SignFile(filePath, signedFilePath, signData, validateSignature); err != nil {
+				log.Errorln(err)
+			}
+		})
+	}()
+
+	onShutdown(func(ctx context.Context) error {
+		select {
+		case <-done:
+			return nil
+		case <-ctx.Done():
+			return errors.Wrap(ctx.Err(), "waiting for the file being signed")
 		}
 	})
+
+	waitForShutdown()
 }
 
 func init() {
@@ -15,6 +15,9 @@ import (
 
 var DB *bolt.DB
 
+// PathEnv represents the environment variable of the path to the db, so several processes could run on the same machine.
+const PathEnv = "PDFSIGNER_DB"
+
 func init() {
 	// get path to executable file
 	runFileFolder, err := utils.GetRunFileFolder()
@@ -30,6 +33,11 @@ func init() {
 		dbFileName = path.Join(runFileFolder, dbFileName)
 	}
 
+	// the db is locked by the process, so the processes running on the same machine use separate files
+	if p := os.Getenv(PathEnv); p != "" {
+		dbFileName = p
+	}
+
 	opts := bolt.DefaultOptions
 	opts.Timeout = 5
 
@@ -87,7 +95,10 @@ func LoadByKey(key string) ([]byte, error) {
 			return nil
 		}
 
-		result = b.Get([]byte(key))
+		// the value is only valid inside the transaction
+		if v := b.Get([]byte(key)); v != nil {
+			result = append([]byte{}, v...)
+		}
 
 		return nil
 	})
@@ -103,7 +114,13 @@ func DeleteByKey(key string) error {
 	err := DB.Update(func(tx *bolt.Tx) error {
 		bucketName := getBucketName(key)
 
-		return tx.Bucket([]byte(bucketName)).Delete([]byte(key))
+		// nothing to delete if the bucket wasn't created yet
+		b := tx.Bucket([]byte(bucketName))
+		if b == nil {
+			return nil
+		}
+
+		return b.Delete([]byte(key))
 	})
 
 	return err
@@ -124,7 +141,8 @@ func BatchLoad(prefix string) (map[string][]byte, error) {
 		c := b.Cursor()
 
 		for k, v := c.First(); k != nil; k, v = c.Next() {
-			result[string(k)] = v
+			// the value is only valid inside the transaction
+			result[string(k)] = append([]byte{}, v...)
 		}
 
 		return nil
@@ -135,3 +153,105 @@ func BatchLoad(prefix string) (map[string][]byte, error) {
 
 	return result, nil
 }
+
+// LoadByPrefix loads the values of the keys with the prefix and returns map.
+func LoadByPrefix(prefix string) (map[string][]byte, error) {
+	result := make(map[string][]byte)
+
+	err := DB.View(func(tx *bolt.Tx) error {
+		b := tx.Bucket([]byte(getBucketName(prefix)))
+		if b == nil {
+			return nil
+		}
+
+		c := b.Cursor()
+
+		for k, v := c.Seek([]byte(prefix)); k != nil && strings.HasPrefix(string(k), prefix); k, v = c.Next() {
+			// the value is only valid inside the transaction
+			result[string(k)] = append([]byte{}, v...)
+		}
+
+		return nil
+	})
+	if err != nil {
+		return result, errors.Wrap(err, "load by prefix")
+	}
+
+	return result, nil
+}
+
+// UpdateBatch saves and deletes the values by keys inside a single transaction.
+func UpdateBatch(values map[string][]byte, deleteKeys []string) error {
+	err := DB.Update(func(tx *bolt.Tx) error {
+		for _, key := range deleteKeys {
+			// nothing to delete if the bucket wasn't created yet
+			b := tx.Bucket([]byte(getBucketName(key)))
+			if b == nil {
+				continue
+			}
+
+			err := b.Delete([]byte(key))
+			if err != nil {
+				return err
+			}
+		}
+
+		for key, value := range values {
+			b, err := tx.CreateBucketIfNotExists([]byte(getBucketName(key)))
+			if err != nil {
+				return err
+			}
+
+			err = b.Put([]byte(key), value)
+			if err != nil {
+				return err
+			}
+		}
+
+		return nil
+	})
+	if err != nil {
+		return errors.Wrap(err, "update batch")
+	}
+
+	return nil
+}
+
+// ScanKeysReverse returns up to limit keys with the prefix in descending order,
+// only the keys before the key to start from are returned if it's provided.
+func ScanKeysReverse(prefix, from string, limit int) ([]string, error) {
+	var keys []string
+
+	// start after the last key with the prefix
+	if from == "" {
+		from = prefix + "\xff"
+	}
+
+	err := DB.View(func(tx *bolt.Tx) error {
+		b := tx.Bucket([]byte(getBucketName(prefix)))
+		if b == nil {
+			return nil
+		}
+
+		c := b.Cursor()
+
+		// the cursor is positioned at the first key after the start
+		k, _ := c.Seek([]byte(from))
+		if k == nil {
+			k, _ = c.Last()
+		} else {
+			k, _ = c.Prev()
+		}
+
+		for ; k != nil && strings.HasPrefix(string(k), prefix) && len(keys) < limit; k, _ = c.Prev() {
+			keys = append(keys, string(k))
+		}
+
+		return nil
+	})
+	if err != nil {
+		return keys, errors.Wrap(err, "scan keys")
+	}
+
+	return keys, nil
+}
@@ -1,6 +1,7 @@
 package files
 
 import (
+	"context"
 	"path"
 	"strings"
 
@@ -10,39 +11,37 @@ import (
 
 type callback func(filePath string, left int)
 
-// Watch watches inside the provided folder and runs callback when event happened.
-func Watch(watchFolder string, cb callback) {
+// Watch watches inside the provided folder and runs callback when event happened, until the context is done.
+// The callback is finished before returning.
+func Watch(ctx context.Context, watchFolder string, cb callback) {
 	watcher, err := fsnotify.NewWatcher()
 	if err != nil {
 		log.Fatal(err)
 	}
 	defer func() { _ = watcher.Close() }()
 
-	done := make(chan bool)
+	err = watcher.Add(watchFolder)
+	if err != nil {
+		log.Fatal(err)
+	}
 
-	go func() {
-		for {
-			select {
-			case event := <-watcher.Events:
-				if event.Op&fsnotify.Write == fsnotify.Write {
-					inputFileName := event.Name
-					inputFileExtension := strings.ToLower(path.Ext(inputFileName))
+	for {
+		select {
+		case event := <-watcher.Events:
+			if event.Op&fsnotify.Write == fsnotify.Write {
+				inputFileName := event.Name
+				inputFileExtension := strings.ToLower(path.Ext(inputFileName))
 
-					if inputFileExtension == ".pdf" {
-						cb(inputFileName, len(watcher.Events))
-					}
+				if inputFileExtension == ".pdf" {
+					cb(inputFileName, len(watcher.Events))
 				}
-
-			case err := <-watcher.Errors:
-				log.Println(err)
 			}
-		}
-	}()
 
-	err = watcher.Add(watchFolder)
-	if err != nil {
-		log.Fatal(err)
-	}
+		case err := <-watcher.Errors:
+			log.Println(err)
 
-	<-done
+		case <-ctx.Done():
+			return
+		}
+	}
 }
@@ -29,6 +29,13 @@ var TotalLimitDuration = "864000h"
 // LD stores all the license related data.
 var LD LicenseData
 
+// StateStore represents the store of the limit state shared by several processes, so the limits are counted once for all of them.
+type StateStore interface {
+	// UpdateLimitState calls the function with the saved state, nil if it's not saved yet, and saves the returned state,
+	// the state isn't changed by other processes until the function returns
+	UpdateLimitState(update func(state []byte) ([]byte, error)) error
+}
+
 // LicenseData represents all the license related data.
 type LicenseData struct {
 	// Name represents the name license assigned to
@@ -48,6 +55,8 @@ type LicenseData struct {
 	cryptoKey [32]byte
 	// lastState is used to check save limits if state is changed
 	lastState []ratelimiter.LimitState
+	// stateStore represents the store of the limit state shared with other processes, nil if the state is not shared
+	stateStore StateStore
 }
 
 // the public key b64 encoded from the private key using: lkgen pub my_private_key_file`.
@@ -201,15 +210,8 @@ func (ld *LicenseData) SaveLimitState() error {
 		return nil
 	}
 
-	// get limit states
-	limitStates := ld.RL.GetState()
-	// marshal limit states
-	limitStatesBytes, err := json.Marshal(limitStates)
-	if err != nil {
-		return err
-	}
 	// encrypt limit states
-	limitsStatesCiphered, err := cryptopasta.Encrypt(limitStatesBytes, &ld.cryptoKey)
+	limitsStatesCiphered, err := ld.encryptLimitState(ld.RL.GetState())
 	if err != nil {
 		return err
 	}
@@ -249,15 +251,7 @@ func (ld LicenseData) loadLimitState() error {
 	}
 
 	// decrypt state
-	limitStatesBytes, err := cryptopasta.Decrypt(limitStatesCiphered, &ld.cryptoKey)
-	if err != nil {
-		return err
-	}
-
-	// unmarshal state
-	var limitStates []ratelimiter.LimitState
-
-	err = json.Unmarshal(limitStatesBytes, &limitStates)
+	limitStates, err := ld.decryptLimitState(limitStatesCiphered)
 	if err != nil {
 		return err
 	}
@@ -275,6 +269,74 @@ func (ld LicenseData) loadLimitState() error {
 	return nil
 }
 
+// encryptLimitState marshals and encrypts the state of the limits.
+func (ld *LicenseData) encryptLimitState(limitStates []ratelimiter.LimitState) ([]byte, error) {
+	limitStatesBytes, err := json.Marshal(limitStates)
+	if err != nil {
+		return nil, err
+	}
+
+	return cryptopasta.Encrypt(limitStatesBytes, &ld.cryptoKey)
+}
+
+// decryptLimitState decrypts and unmarshals the state of the limits.
+func (ld *LicenseData) decryptLimitState(limitStatesCiphered []byte) ([]ratelimiter.LimitState, error) {
+	limitStatesBytes, err := cryptopasta.Decrypt(limitStatesCiphered, &ld.cryptoKey)
+	if err != nil {
+		return nil, err
+	}
+
+	var limitStates []ratelimiter.LimitState
+
+	err = json.Unmarshal(limitStatesBytes, &limitStates)
+	if err != nil {
+		return nil, err
+	}
+
+	return limitStates, nil
+}
+
+// SetStateStore shares the limit state with other processes using the store, so the limits of the license
+// are not multiplied by the number of the processes. The state saved to the local db is used until the shared state is saved.
+func (ld *LicenseData) SetStateStore(s StateStore) {
+	ld.stateStore = s
+}
+
+// allow checks if the work is allowed by the limits, the shared state is updated inside of the transaction of the store.
+func (ld *LicenseData) allow() (bool, *ratelimiter.Limit, error) {
+	if ld.stateStore == nil {
+		allow, limit := ld.RL.Allow()
+
+		return allow, limit, nil
+	}
+
+	var (
+		allow bool
+		limit *ratelimiter.Limit
+	)
+
+	err := ld.stateStore.UpdateLimitState(func(state []byte) ([]byte, error) {
+		// use the state counted by all the processes
+		if state != nil {
+			limitStates, err := ld.decryptLimitState(state)
+			if err != nil {
+				return nil, errors.Wrap(err, "decrypt shared license limits")
+			}
+
+			ld.RL.SetState(limitStates)
+		}
+
+		allow, limit = ld.RL.Allow()
+
+		return ld.encryptLimitState(ld.RL.GetState())
+	})
+	if err != nil {
+		return false, nil, errors.Wrap(err, "update shared license limits")
+	}
+
+	return allow, limit, nil
+}
+
 // AutoSave saves state every second.
 func (ld *LicenseData) AutoSave() {
 	go func(ld *LicenseData) {
@@ -293,7 +355,11 @@ func (ld *LicenseData) Wait() error {
 
 	// check if the work is allowed by license limiters, if not wait
 	for {
-		allow, limit := ld.RL.Allow()
+		allow, limit, err := ld.allow()
+		if err != nil {
+			return err
+		}
+
 		if allow {
 			break
 		} else {
@@ -303,10 +369,11 @@ func (ld *LicenseData) Wait() error {
 			}
 
 			// log sleep time information
-			log.Println(ErrOverLimit, "wait for:", limit.Left())
+			left := ld.RL.Left(limit)
+			log.Println(ErrOverLimit, "wait for:", left)
 
 			// sleep
-			time.Sleep(limit.Left())
+			time.Sleep(left)
 		}
 	}
 
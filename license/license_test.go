@@ -1,6 +1,7 @@
 package license
 
 import (
+	"sync"
 	"testing"
 	"time"
 
@@ -72,3 +73,56 @@ func TestFlow(t *testing.T) {
 	assert.Equal(t, 0, LD.Limits[0].CurCount)
 	assert.Equal(t, 6, LD.Limits[1].CurCount)
 }
+
+// memoryStateStore represents the state store shared by the processes in the tests.
+type memoryStateStore struct {
+	mu    sync.Mutex
+	state []byte
+}
+
+func (s *memoryStateStore) UpdateLimitState(update func(state []byte) ([]byte, error)) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	state, err := update(s.state)
+	if err != nil {
+		return err
+	}
+
+	s.state = state
+
+	return nil
+}
+
+func TestSharedLimitState(t *testing.T) {
+	store := &memoryStateStore{}
+
+	// the processes using the same license
+	var processes []*LicenseData
+
+	for i := 0; i < 2; i++ {
+		ld, err := newExtractLicense([]byte(TestLicense))
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		ld.RL = ratelimiter.NewRateLimiter(ld.Limits...)
+		ld.SetStateStore(store)
+
+		processes = append(processes, &ld)
+	}
+
+	// the limit of 2 works per second is shared by the processes
+	allow, _, err := processes[0].allow()
+	assert.NoError(t, err)
+	assert.True(t, allow)
+
+	allow, _, err = processes[1].allow()
+	assert.NoError(t, err)
+	assert.True(t, allow)
+
+	allow, limit, err := processes[0].allow()
+	assert.NoError(t, err)
+	assert.False(t, allow)
+	assert.Equal(t, "1s", limit.IntervalStr)
+}
@@ -116,8 +116,20 @@ func (rl *RateLimiter) Allow() (bool, *Limit) {
 	return true, nil
 }
 
+// Left returns how much time needed to wait until the limit would allow to run work again,
+// the state of the limit is read under the lock since it's changed by the concurrent workers.
+func (rl *RateLimiter) Left(l *Limit) time.Duration {
+	rl.mu.Lock()
+	defer rl.mu.Unlock()
+
+	return l.Left()
+}
+
 // GetState returns current state of the limits.
 func (rl *RateLimiter) GetState() []LimitState {
+	rl.mu.Lock()
+	defer rl.mu.Unlock()
+
 	var limitStates []LimitState
 
 	for _, l := range rl.limits {
@@ -126,3 +138,13 @@ func (rl *RateLimiter) GetState() []LimitState {
 
 	return limitStates
 }
+
+// SetState replaces the state of the limits, the state is assigned to the limits in the order.
+func (rl *RateLimiter) SetState(states []LimitState) {
+	rl.mu.Lock()
+	defer rl.mu.Unlock()
+
+	for i := 0; i < len(rl.limits) && i < len(states); i++ {
+		rl.limits[i].LimitState = states[i]
+	}
+}
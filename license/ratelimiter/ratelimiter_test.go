@@ -14,6 +14,7 @@ limitations under the License.
 package ratelimiter
 
 import (
+	"sync"
 	"testing"
 	"time"
 
@@ -119,3 +120,33 @@ func TestState(t *testing.T) {
 	state = rl.GetState()
 	assert.Equal(t, 0, state[0].CurCount)
 }
+
+func TestConcurrentWait(t *testing.T) {
+	rl := NewRateLimiter(&Limit{MaxCount: 2, Interval: 10 * time.Millisecond})
+
+	// the workers wait for the limit concurrently, run with -race
+	var wg sync.WaitGroup
+
+	for range 4 {
+		wg.Add(1)
+
+		go func() {
+			defer wg.Done()
+
+			for range 3 {
+				for {
+					allowed, limit := rl.Allow()
+					if allowed {
+						break
+					}
+
+					time.Sleep(rl.Left(limit))
+				}
+
+				_ = rl.GetState()
+			}
+		}()
+	}
+
+	wg.Wait()
+}
@@ -1,6 +1,13 @@
 package priority_queue
 
-import "errors"
+import (
+	"container/heap"
+	"context"
+	"errors"
+	"strings"
+	"sync"
+	"time"
+)
 
 //go:generate stringer -type=Priority
 
@@ -18,91 +25,360 @@ const (
 	HighPriority
 )
 
+// ParsePriority parses the name of the priority: low, medium or high.
+func ParsePriority(name string) (Priority, error) {
+	switch strings.ToLower(name) {
+	case "low":
+		return LowPriority, nil
+	case "medium":
+		return MediumPriority, nil
+	case "high":
+		return HighPriority, nil
+	}
+
+	return UnknownPriority, errors.New("wrong priority name")
+}
+
+// ErrFull is returned when the items couldn't be pushed because the capacity of the queue is reached.
+var ErrFull = errors.New("queue is full")
+
 // Item is used to push to and pop value with priority.
 type Item struct {
 	// Value represents any value
 	Value interface{}
 	// Priority represents priority of the signing reqeust
 	Priority Priority
+	// Deadline represents time the item should be processed before, optional.
+	// Items with earlier deadline are popped first among the items with the same priority
+	Deadline time.Time
+	// Tenant represents the name of the tenant the item belongs to, the tenants share the queue by their weights
+	Tenant string
 }
 
-// PriorityQueue represents priority channels.
+// PriorityQueue represents heap based priority queue, items with the same priority are popped by the earliest deadline
+// and the items without deadline in the order they were pushed. The items of the same priority of different tenants
+// are popped by the weights of the tenants, so the tenant with many items doesn't delay the items of other tenants.
 type PriorityQueue struct {
-	high   chan Item
-	medium chan Item
-	low    chan Item
+	mu sync.Mutex
+	// tenants represents the queued items and the items being processed by the name of the tenant
+	tenants map[string]*tenant
+	// policies represents the weights and the limits of the tenants by name
+	policies map[string]TenantPolicy
+	// size represents number of the queued items of all the tenants
+	size int
+	// pass represents the pass of the last served tenant, the tenants without queued items continue from it
+	pass float64
+	// capacity represents maximum number of the items, the queue is unbounded if it's 0
+	capacity int
+	// aging represents waiting time which raises the priority of the item by one level
+	aging time.Duration
+	// seq represents sequence number of the last pushed item
+	seq uint64
+	// notify is signaled when the items are pushed
+	notify chan struct{}
+	// now returns current time, could be replaced by tests
+	now func() time.Time
 }
 
-func New(size int) *PriorityQueue {
+// New creates priority queue with the capacity, the queue is unbounded if the capacity is 0.
+func New(capacity int) *PriorityQueue {
 	q := PriorityQueue{
-		high:   make(chan Item, size),
-		medium: make(chan Item, size),
-		low:    make(chan Item, size),
+		tenants:  make(map[string]*tenant),
+		policies: make(map[string]TenantPolicy),
+		capacity: capacity,
+		notify:   make(chan struct{}, 1),
+		now:      time.Now,
 	}
 
 	return &q
 }
 
-// Push adds an item to the priority queue.
-func (q *PriorityQueue) Push(i Item) {
-	switch i.Priority {
-	case HighPriority:
-		q.high <- i
-	case MediumPriority:
-		q.medium <- i
-	case LowPriority:
-		q.low <- i
+// SetCapacity sets maximum number of the items, the queue is unbounded if the capacity is 0.
+// Items already in the queue are kept even if they exceed the capacity.
+func (q *PriorityQueue) SetCapacity(capacity int) {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+
+	q.capacity = capacity
+}
+
+// SetAging sets waiting time which raises the priority of the item by one level,
+// so the items with lower priority are not starving. Aging is disabled if it's 0.
+func (q *PriorityQueue) SetAging(aging time.Duration) {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+
+	q.aging = aging
+
+	// reorder items with the new aging
+	for _, t := range q.tenants {
+		for _, e := range t.items {
+			e.level = q.level(e.item.Priority, e.pushedAt)
+		}
+
+		heap.Init(&t.items)
+	}
+}
+
+// Push adds an item to the priority queue, returns ErrFull if the capacity is reached.
+func (q *PriorityQueue) Push(i Item) error {
+	return q.PushBatch([]Item{i})
+}
+
+// PushBatch adds all the items to the priority queue or none of them if the capacity is not enough.
+func (q *PriorityQueue) PushBatch(items []Item) error {
+	q.mu.Lock()
+
+	if q.capacity > 0 && q.size+len(items) > q.capacity {
+		q.mu.Unlock()
+
+		return ErrFull
+	}
+
+	for _, i := range items {
+		q.push(i)
 	}
+	q.mu.Unlock()
+
+	q.signal()
+
+	return nil
 }
 
-// Pop returns appropriate item from the priority queue.
+// Requeue adds an item which was already accepted by the queue before, Ex. retried item, ignoring the capacity.
+func (q *PriorityQueue) Requeue(i Item) {
+	q.mu.Lock()
+	q.push(i)
+	q.mu.Unlock()
+
+	q.signal()
+}
+
+// push adds an item to the heap, the lock should be held.
+func (q *PriorityQueue) push(i Item) {
+	now := q.now()
+	q.seq++
+
+	t := q.tenant(i.Tenant)
+
+	// the tenant without queued items doesn't save up the turns it missed
+	if len(t.items) == 0 && t.pass < q.pass {
+		t.pass = q.pass
+	}
+
+	heap.Push(&t.items, &entry{
+		item:     i,
+		seq:      q.seq,
+		pushedAt: now,
+		level:    q.level(i.Priority, now),
+	})
+	q.size++
+}
+
+// Pop returns appropriate item from the priority queue, waits until the item is available.
 func (q *PriorityQueue) Pop() Item {
+	i, _ := q.PopContext(context.Background())
+
+	return i
+}
+
+// PopContext returns appropriate item from the priority queue, waits until the item is available or the context is done.
+// The items of the tenants processing the maximum number of the items are not popped until Done is called.
+func (q *PriorityQueue) PopContext(ctx context.Context) (Item, error) {
 	for {
+		q.mu.Lock()
+		if t := q.next(); t != nil {
+			e := q.pop(t)
+			left := q.size
+			q.mu.Unlock()
+
+			// wake up other waiting consumers
+			if left > 0 {
+				q.signal()
+			}
+
+			return e.item, nil
+		}
+		q.mu.Unlock()
+
 		select {
-		case Item := <-q.high:
-			return Item
-		default:
-			select {
-			case Item := <-q.medium:
-				return Item
-			case Item := <-q.low:
-				return Item
-			default:
-				select {
-				case Item := <-q.high:
-					return Item
-				case Item := <-q.medium:
-					return Item
-				case Item := <-q.low:
-					return Item
-				}
+		case <-q.notify:
+		case <-ctx.Done():
+			return Item{}, ctx.Err()
+		}
+	}
+}
+
+// Remove removes the items matching the function, returns the number of removed items.
+func (q *PriorityQueue) Remove(match func(Item) bool) int {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+
+	removed := 0
+
+	for name, t := range q.tenants {
+		items := t.items[:0]
+
+		for _, e := range t.items {
+			if !match(e.item) {
+				items = append(items, e)
 			}
 		}
+
+		removed += len(t.items) - len(items)
+
+		// release removed entries
+		for i := len(items); i < len(t.items); i++ {
+			t.items[i] = nil
+		}
+
+		t.items = items
+		heap.Init(&t.items)
+
+		q.releaseTenant(name, t)
+	}
+
+	q.size -= removed
+
+	return removed
+}
+
+// signal notifies waiting consumers without blocking.
+func (q *PriorityQueue) signal() {
+	select {
+	case q.notify <- struct{}{}:
+	default:
 	}
 }
 
+// level calculates the priority level of the item, the items with the highest level are popped first.
+// Every full aging duration the item waited raises the level by one,
+// since all the items age equally the level doesn't need to be recalculated.
+func (q *PriorityQueue) level(p Priority, pushedAt time.Time) int64 {
+	if q.aging <= 0 {
+		return int64(p)
+	}
+
+	return int64(p) - pushedAt.UnixNano()/int64(q.aging)
+}
+
 // LenAll represents lengths of priority channels.
 type LenAll struct {
 	Low    int `json:"low"`
 	Medium int `json:"medium"`
 	High   int `json:"high"`
+	// Tenants represents number of the items by tenant, empty if the queue is empty
+	Tenants map[string]int `json:"tenants,omitempty"`
 }
 
-// Len returns length of the channel by priority.
+// Len returns number of the items by priority.
 func (q *PriorityQueue) Len(p Priority) (int, error) {
+	l := q.LenAll()
+
 	switch p {
 	case LowPriority:
-		return len(q.low), nil
+		return l.Low, nil
 	case MediumPriority:
-		return len(q.medium), nil
+		return l.Medium, nil
 	case HighPriority:
-		return len(q.high), nil
+		return l.High, nil
 	}
 
 	return -1, errors.New("wrong priority name")
 }
 
-// LenAll returns lengths of all priority channels.
+// LenAll returns number of the items of all priorities.
 func (q *PriorityQueue) LenAll() LenAll {
-	return LenAll{len(q.low), len(q.medium), len(q.high)}
+	q.mu.Lock()
+	defer q.mu.Unlock()
+
+	var l LenAll
+
+	for name, t := range q.tenants {
+		for _, e := range t.items {
+			switch e.item.Priority {
+			case LowPriority:
+				l.Low++
+			case MediumPriority:
+				l.Medium++
+			case HighPriority:
+				l.High++
+			}
+		}
+
+		if len(t.items) == 0 {
+			continue
+		}
+
+		if l.Tenants == nil {
+			l.Tenants = make(map[string]int)
+		}
+
+		l.Tenants[name] = len(t.items)
+	}
+
+	return l
+}
+
+// Size returns total number of the items and the capacity of the queue.
+func (q *PriorityQueue) Size() (int, int) {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+
+	return q.size, q.capacity
+}
+
+// entry represents an item in the heap.
+type entry struct {
+	item     Item
+	seq      uint64
+	pushedAt time.Time
+	level    int64
+}
+
+// itemHeap implements heap.Interface.
+type itemHeap []*entry
+
+func (h itemHeap) Len() int { return len(h) }
+
+func (h itemHeap) Less(i, j int) bool {
+	return h[i].before(h[j])
+}
+
+// before checks if the entry should be popped before the other entry.
+func (e *entry) before(o *entry) bool {
+	if e.level != o.level {
+		return e.level > o.level
+	}
+
+	// earliest deadline first, the items without deadline last
+	di, dj := e.item.Deadline, o.item.Deadline
+	if !di.Equal(dj) {
+		switch {
+		case di.IsZero():
+			return false
+		case dj.IsZero():
+			return true
+		}
+
+		return di.Before(dj)
+	}
+
+	return e.seq < o.seq
+}
+
+func (h itemHeap) Swap(i, j int) { h[i], h[j] = h[j], h[i] }
+
+func (h *itemHeap) Push(x interface{}) {
+	*h = append(*h, x.(*entry))
+}
+
+func (h *itemHeap) Pop() interface{} {
+	old := *h
+	n := len(old)
+	e := old[n-1]
+	old[n-1] = nil
+	*h = old[:n-1]
+
+	return e
 }
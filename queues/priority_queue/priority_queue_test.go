@@ -1,7 +1,9 @@
 package priority_queue
 
 import (
+	"context"
 	"testing"
+	"time"
 )
 
 func TestPriorityQueue(t *testing.T) {
@@ -13,7 +15,11 @@ func TestPriorityQueue(t *testing.T) {
 		Value:    10,
 		Priority: HighPriority,
 	}
-	q.Push(i)
+
+	err := q.Push(i)
+	if err != nil {
+		t.Fatal(err)
+	}
 
 	// get item
 	i = q.Pop()
@@ -21,3 +27,240 @@ func TestPriorityQueue(t *testing.T) {
 		t.Fatal("pq not working")
 	}
 }
+
+func TestPriorityQueueOrder(t *testing.T) {
+	q := New(0)
+
+	// push items with different priorities
+	for i, p := range []Priority{LowPriority, HighPriority, MediumPriority, HighPriority, LowPriority} {
+		err := q.Push(Item{Value: i, Priority: p})
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	// higher priority first, the same priority in the order of pushing
+	for _, expected := range []int{1, 3, 2, 0, 4} {
+		if i := q.Pop(); i.Value != expected {
+			t.Fatalf("expected %d, got %v", expected, i.Value)
+		}
+	}
+}
+
+func TestPriorityQueueCapacity(t *testing.T) {
+	q := New(2)
+
+	err := q.PushBatch([]Item{{Value: 1, Priority: LowPriority}, {Value: 2, Priority: LowPriority}})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// reject the item exceeding the capacity
+	err = q.Push(Item{Value: 3, Priority: HighPriority})
+	if err != ErrFull {
+		t.Fatalf("expected ErrFull, got %v", err)
+	}
+
+	// requeue ignores the capacity
+	q.Requeue(Item{Value: 4, Priority: LowPriority})
+
+	if l, c := q.Size(); l != 3 || c != 2 {
+		t.Fatalf("expected 3 items with capacity 2, got %d items with capacity %d", l, c)
+	}
+
+	// reject the batch as a whole
+	q.SetCapacity(4)
+
+	err = q.PushBatch([]Item{{Value: 5, Priority: LowPriority}, {Value: 6, Priority: LowPriority}})
+	if err != ErrFull {
+		t.Fatalf("expected ErrFull, got %v", err)
+	}
+
+	if l, _ := q.Size(); l != 3 {
+		t.Fatalf("expected 3 items, got %d", l)
+	}
+
+	// unbounded
+	q.SetCapacity(0)
+
+	err = q.PushBatch([]Item{{Value: 5, Priority: LowPriority}, {Value: 6, Priority: LowPriority}})
+	if err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestPriorityQueueAging(t *testing.T) {
+	q := New(0)
+
+	// fake the time, aligned to the aging
+	now := time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)
+	q.now = func() time.Time { return now }
+
+	q.SetAging(time.Minute)
+
+	// low priority item waits for more than two levels of aging
+	err := q.Push(Item{Value: "low", Priority: LowPriority})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	now = now.Add(2*time.Minute + time.Second)
+
+	err = q.Push(Item{Value: "high", Priority: HighPriority})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if i := q.Pop(); i.Value != "low" {
+		t.Fatalf("expected aged low priority item, got %v", i.Value)
+	}
+
+	// medium priority item waits less than one level of aging
+	err = q.Push(Item{Value: "medium", Priority: MediumPriority})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	now = now.Add(30 * time.Second)
+
+	err = q.Push(Item{Value: "high2", Priority: HighPriority})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	for _, expected := range []string{"high", "high2", "medium"} {
+		if i := q.Pop(); i.Value != expected {
+			t.Fatalf("expected %s, got %v", expected, i.Value)
+		}
+	}
+
+	// disabling aging restores the order by priority
+	err = q.PushBatch([]Item{{Value: "low", Priority: LowPriority}})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	now = now.Add(time.Hour)
+
+	err = q.Push(Item{Value: "medium", Priority: MediumPriority})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	q.SetAging(0)
+
+	if i := q.Pop(); i.Value != "medium" {
+		t.Fatalf("expected medium priority item, got %v", i.Value)
+	}
+}
+
+func TestPriorityQueuePopWaits(t *testing.T) {
+	q := New(0)
+
+	// pop items concurrently
+	const total = 100
+
+	done := make(chan int, total)
+
+	for i := 0; i < 4; i++ {
+		go func() {
+			for {
+				done <- q.Pop().Value.(int)
+			}
+		}()
+	}
+
+	for i := 0; i < total; i++ {
+		err := q.Push(Item{Value: i, Priority: MediumPriority})
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	// all the items are popped exactly once
+	seen := make(map[int]bool, total)
+
+	for i := 0; i < total; i++ {
+		select {
+		case v := <-done:
+			if seen[v] {
+				t.Fatalf("item %d popped twice", v)
+			}
+
+			seen[v] = true
+		case <-time.After(5 * time.Second):
+			t.Fatal("timeout waiting for the items")
+		}
+	}
+}
+
+func TestPriorityQueueDeadline(t *testing.T) {
+	q := New(0)
+
+	now := time.Now()
+
+	// push items with and without deadlines
+	items := []Item{
+		{Value: "none", Priority: MediumPriority},
+		{Value: "late", Priority: MediumPriority, Deadline: now.Add(time.Hour)},
+		{Value: "low", Priority: LowPriority, Deadline: now.Add(time.Second)},
+		{Value: "early", Priority: MediumPriority, Deadline: now.Add(time.Minute)},
+		{Value: "high", Priority: HighPriority},
+	}
+
+	err := q.PushBatch(items)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// earliest deadline first within the priority
+	for _, expected := range []string{"high", "early", "late", "none", "low"} {
+		if i := q.Pop(); i.Value != expected {
+			t.Fatalf("expected %s, got %v", expected, i.Value)
+		}
+	}
+}
+
+func TestParsePriority(t *testing.T) {
+	for name, expected := range map[string]Priority{"low": LowPriority, "Medium": MediumPriority, "HIGH": HighPriority} {
+		p, err := ParsePriority(name)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		if p != expected {
+			t.Fatalf("expected %s, got %s", expected, p)
+		}
+	}
+
+	if _, err := ParsePriority("urgent"); err == nil {
+		t.Fatal("expected error")
+	}
+}
+
+func TestPriorityQueuePopContext(t *testing.T) {
+	q := New(0)
+
+	ctx, cancel := context.WithCancel(context.Background())
+
+	// stop waiting when the context is cancelled
+	go func() {
+		time.Sleep(10 * time.Millisecond)
+		cancel()
+	}()
+
+	if _, err := q.PopContext(ctx); err != context.Canceled {
+		t.Fatalf("expected context.Canceled, got %v", err)
+	}
+
+	// the item is returned when available
+	err := q.Push(Item{Value: 1, Priority: LowPriority})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	i, err := q.PopContext(context.Background())
+	if err != nil || i.Value != 1 {
+		t.Fatalf("expected item 1, got %v, %v", i.Value, err)
+	}
+}
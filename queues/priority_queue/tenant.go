@@ -0,0 +1,139 @@
+package priority_queue
+
+import (
+	"container/heap"
+	"time"
+)
+
+// TenantPolicy represents the share of the queue used by the tenant.
+type TenantPolicy struct {
+	// Weight represents the share of the popped items of the tenant relative to other tenants, default 1
+	Weight int
+	// MaxInFlight represents maximum number of the popped items of the tenant not done yet, not limited if it's 0
+	MaxInFlight int
+}
+
+// tenant represents the queued items and the items being processed of the tenant.
+type tenant struct {
+	// items represents the heap of the queued items
+	items itemHeap
+	// inFlight represents number of the popped items which are not done yet
+	inFlight int
+	// pass represents the virtual time of the next item of the tenant, the tenant with the lowest pass is served first,
+	// every popped item advances the pass of the tenant inversely to its weight
+	pass float64
+}
+
+// SetTenantPolicy sets the weight and the limit of the items being processed of the tenant,
+// the tenants without the policy have the weight 1 and no limit.
+func (q *PriorityQueue) SetTenantPolicy(name string, p TenantPolicy) {
+	q.mu.Lock()
+	q.policies[name] = p
+	q.mu.Unlock()
+
+	// the limit could be raised
+	q.signal()
+}
+
+// Done marks the popped item as processed, so the next items of its tenant could be popped.
+func (q *PriorityQueue) Done(i Item) {
+	q.mu.Lock()
+
+	t, exists := q.tenants[i.Tenant]
+	if exists && t.inFlight > 0 {
+		t.inFlight--
+		q.releaseTenant(i.Tenant, t)
+	}
+	q.mu.Unlock()
+
+	q.signal()
+}
+
+// tenant returns the tenant by name, creates it if it doesn't exist. The lock should be held.
+func (q *PriorityQueue) tenant(name string) *tenant {
+	t, exists := q.tenants[name]
+	if !exists {
+		t = &tenant{pass: q.pass}
+		q.tenants[name] = t
+	}
+
+	return t
+}
+
+// releaseTenant removes the tenant without queued items and items being processed. The lock should be held.
+func (q *PriorityQueue) releaseTenant(name string, t *tenant) {
+	if len(t.items) == 0 && t.inFlight == 0 {
+		delete(q.tenants, name)
+	}
+}
+
+// next returns the tenant which item should be popped next, nil if there are no items which could be popped.
+// The tenant with the highest level of the next item is served first, the tenant with the lowest pass is served among the tenants
+// of the same level. The lock should be held.
+func (q *PriorityQueue) next() *tenant {
+	var next *tenant
+
+	now := q.now()
+
+	for name, t := range q.tenants {
+		if len(t.items) == 0 {
+			continue
+		}
+
+		// skip the tenant processing the maximum number of the items
+		if limit := q.policies[name].MaxInFlight; limit > 0 && t.inFlight >= limit {
+			continue
+		}
+
+		if next == nil || q.before(t, next, now) {
+			next = t
+		}
+	}
+
+	return next
+}
+
+// before checks if the tenant should be served before the other tenant.
+func (q *PriorityQueue) before(t, o *tenant, now time.Time) bool {
+	e, oe := t.items[0], o.items[0]
+
+	if l, ol := q.tenantLevel(e, now), q.tenantLevel(oe, now); l != ol {
+		return l > ol
+	}
+
+	if t.pass != o.pass {
+		return t.pass < o.pass
+	}
+
+	return e.before(oe)
+}
+
+// tenantLevel returns the level of the item used to choose the tenant, the priority of the item raised by the aging at most by one level.
+// The items of the tenant are ordered by the full aging, but the tenant pushed many items earlier doesn't delay the items
+// of other tenants with the same priority longer than the aging.
+func (q *PriorityQueue) tenantLevel(e *entry, now time.Time) int64 {
+	level := int64(e.item.Priority)
+
+	if q.aging > 0 && now.UnixNano()/int64(q.aging) > e.pushedAt.UnixNano()/int64(q.aging) {
+		level++
+	}
+
+	return level
+}
+
+// pop pops the next item of the tenant and advances the pass of the tenant by its weight. The lock should be held.
+func (q *PriorityQueue) pop(t *tenant) *entry {
+	e := heap.Pop(&t.items).(*entry)
+	q.size--
+
+	weight := q.policies[e.item.Tenant].Weight
+	if weight < 1 {
+		weight = 1
+	}
+
+	q.pass = t.pass
+	t.pass += 1 / float64(weight)
+	t.inFlight++
+
+	return e
+}
@@ -0,0 +1,176 @@
+package priority_queue
+
+import (
+	"context"
+	"strings"
+	"testing"
+	"time"
+)
+
+// popTenants pops the number of the items and returns the tenants of the popped items.
+func popTenants(t *testing.T, q *PriorityQueue, n int) string {
+	t.Helper()
+
+	var tenants []string
+
+	for i := 0; i < n; i++ {
+		tenants = append(tenants, q.Pop().Tenant)
+	}
+
+	return strings.Join(tenants, ",")
+}
+
+func TestPriorityQueueTenants(t *testing.T) {
+	q := New(0)
+
+	// the tenant uploads many items before another tenant
+	for i := 0; i < 10; i++ {
+		err := q.Push(Item{Value: i, Priority: HighPriority, Tenant: "bulk"})
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	err := q.PushBatch([]Item{{Value: 10, Priority: HighPriority, Tenant: "single"}, {Value: 11, Priority: HighPriority, Tenant: "single"}})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	l := q.LenAll()
+	if l.Tenants["bulk"] != 10 || l.Tenants["single"] != 2 {
+		t.Fatalf("expected 10 bulk and 2 single items, got %v", l.Tenants)
+	}
+
+	// the tenants take turns
+	if tenants := popTenants(t, q, 6); tenants != "bulk,single,bulk,single,bulk,bulk" {
+		t.Fatalf("unexpected order of the tenants: %s", tenants)
+	}
+
+	// the tenant becoming active doesn't catch up the turns it missed
+	err = q.PushBatch([]Item{{Value: 12, Priority: HighPriority, Tenant: "single"}, {Value: 13, Priority: HighPriority, Tenant: "single"}})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if tenants := popTenants(t, q, 4); tenants != "single,bulk,single,bulk" {
+		t.Fatalf("unexpected order of the tenants: %s", tenants)
+	}
+
+	// the priority is served before the fairness
+	err = q.Push(Item{Value: 14, Priority: LowPriority, Tenant: "single"})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if tenants := popTenants(t, q, 5); tenants != "bulk,bulk,bulk,bulk,single" {
+		t.Fatalf("unexpected order of the tenants: %s", tenants)
+	}
+
+	if l := q.LenAll(); l.Tenants != nil {
+		t.Fatalf("expected no tenants, got %v", l.Tenants)
+	}
+}
+
+func TestPriorityQueueTenantsAging(t *testing.T) {
+	q := New(0)
+
+	// fake the time, aligned to the aging
+	now := time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)
+	q.now = func() time.Time { return now }
+
+	q.SetAging(time.Minute)
+
+	// the tenant uploads many items several aging periods before another tenant
+	for i := 0; i < 10; i++ {
+		err := q.Push(Item{Value: i, Priority: MediumPriority, Tenant: "bulk"})
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	now = now.Add(3 * time.Minute)
+
+	err := q.Push(Item{Value: 10, Priority: MediumPriority, Tenant: "single"})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// the aged items are served first until the item of another tenant ages as well
+	if tenants := popTenants(t, q, 1); tenants != "bulk" {
+		t.Fatalf("unexpected order of the tenants: %s", tenants)
+	}
+
+	now = now.Add(time.Minute)
+
+	// the tenant gets its turn instead of waiting for the whole backlog
+	if tenants := popTenants(t, q, 3); tenants != "single,bulk,bulk" {
+		t.Fatalf("unexpected order of the tenants: %s", tenants)
+	}
+}
+
+func TestPriorityQueueTenantWeight(t *testing.T) {
+	q := New(0)
+	q.SetTenantPolicy("gold", TenantPolicy{Weight: 2})
+
+	for i := 0; i < 10; i++ {
+		err := q.PushBatch([]Item{{Value: i, Priority: MediumPriority, Tenant: "gold"}, {Value: i, Priority: MediumPriority}})
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	// the tenant with the double weight gets the double share
+	if tenants := popTenants(t, q, 6); tenants != "gold,,gold,,gold,gold" {
+		t.Fatalf("unexpected order of the tenants: %s", tenants)
+	}
+}
+
+func TestPriorityQueueTenantMaxInFlight(t *testing.T) {
+	q := New(0)
+	q.SetTenantPolicy("limited", TenantPolicy{MaxInFlight: 1})
+
+	err := q.PushBatch([]Item{
+		{Value: 1, Priority: HighPriority, Tenant: "limited"},
+		{Value: 2, Priority: HighPriority, Tenant: "limited"},
+		{Value: 3, Priority: LowPriority, Tenant: "other"},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	first := q.Pop()
+	if first.Value != 1 {
+		t.Fatalf("expected 1, got %v", first.Value)
+	}
+
+	// the limited tenant waits even with the higher priority
+	if i := q.Pop(); i.Value != 3 {
+		t.Fatalf("expected 3, got %v", i.Value)
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 50*time.Millisecond)
+	defer cancel()
+
+	_, err = q.PopContext(ctx)
+	if err != context.DeadlineExceeded {
+		t.Fatalf("expected deadline exceeded, got %v", err)
+	}
+
+	// the waiting consumer gets the item when the processed item is done
+	popped := make(chan Item)
+
+	go func() {
+		popped <- q.Pop()
+	}()
+
+	q.Done(first)
+
+	select {
+	case i := <-popped:
+		if i.Value != 2 {
+			t.Fatalf("expected 2, got %v", i.Value)
+		}
+	case <-time.After(time.Second):
+		t.Fatal("item is not popped after done")
+	}
+}
@@ -0,0 +1,281 @@
+package queue
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"crypto/x509"
+	"encoding/asn1"
+	"encoding/hex"
+	"encoding/json"
+	"io"
+	"os"
+	"time"
+
+	"github.com/digitorus/pdf"
+	"github.com/digitorus/pdfsign/revocation"
+	"github.com/digitorus/pdfsign/verify"
+	"github.com/digitorus/pdfsigner/db"
+	"github.com/digitorus/pdfsigner/revision"
+	"github.com/digitorus/pkcs7"
+	"github.com/pkg/errors"
+	log "github.com/sirupsen/logrus"
+)
+
+const dbVerifyCachePrefix = "verifycache_"
+
+// DefaultVerifyCacheProfile is used when the cache profile is not provided.
+const DefaultVerifyCacheProfile = "default"
+
+// VerifyCacheConfig represents the settings of the verification results cache.
+type VerifyCacheConfig struct {
+	// TTL represents how long the results are cached, caching is disabled if it's 0
+	TTL time.Duration
+	// Profile represents the trust and policy profile the results are verified with, part of the cache key
+	Profile string
+}
+
+// verifyCacheEntry represents cached verification result.
+type verifyCacheEntry struct {
+	VerificationData *verify.Response   `json:"verification_data"`
+	ChangeAnalysis   *revision.Analysis `json:"change_analysis,omitempty"`
+	CreatedAt        time.Time          `json:"created_at"`
+	ExpiresAt        time.Time          `json:"expires_at"`
+}
+
+// SetVerifyCache enables caching of verification results.
+func (q *Queue) SetVerifyCache(c VerifyCacheConfig) {
+	if c.Profile == "" {
+		c.Profile = DefaultVerifyCacheProfile
+	}
+
+	q.mu.Lock()
+	q.verifyCache = c
+	q.mu.Unlock()
+}
+
+// verifyTaskCached verifies the task or loads the result from the cache if available.
+func (q *Queue) verifyTaskCached(task Task, verifyConfig JobVerifyConfig) (Task, error) {
+	q.mu.RLock()
+	c := q.verifyCache
+	q.mu.RUnlock()
+
+	// verify without cache if it's disabled
+	if c.TTL <= 0 {
+		return verifyAndAnalyzeTask(task)
+	}
+
+	hash, err := fileHash(task.InputFilePath)
+	if err != nil {
+		return task, err
+	}
+
+	key := dbVerifyCachePrefix + c.Profile + "_" + hash
+
+	// load cached result
+	if !verifyConfig.ForceRefresh {
+		entry, err := loadVerifyCacheEntry(key)
+		if err != nil {
+			log.Warnf("Couldn't load cached verification result: %s", err)
+		}
+
+		if entry != nil {
+			task.VerificationData = entry.VerificationData
+			task.ChangeAnalysis = entry.ChangeAnalysis
+			task.FromCache = true
+
+			return task, nil
+		}
+	}
+
+	task, err = verifyAndAnalyzeTask(task)
+	if err != nil {
+		return task, err
+	}
+
+	// the result is not cached if the CRLs used to verify it are unknown
+	crls, err := embeddedCRLs(task.InputFilePath)
+	if err != nil {
+		log.Warnf("Couldn't read CRLs, verification result is not cached: %s", err)
+
+		return task, nil
+	}
+
+	// cache result
+	now := time.Now()
+	entry := verifyCacheEntry{
+		VerificationData: task.VerificationData,
+		ChangeAnalysis:   task.ChangeAnalysis,
+		CreatedAt:        now,
+		ExpiresAt:        revocationExpiry(task.VerificationData, crls, now.Add(c.TTL)),
+	}
+
+	err = saveVerifyCacheEntry(key, entry)
+	if err != nil {
+		log.Warnf("Couldn't cache verification result: %s", err)
+	}
+
+	return task, nil
+}
+
+// verifyAndAnalyzeTask verifies the task and analyzes modifications made after signing.
+func verifyAndAnalyzeTask(task Task) (Task, error) {
+	verifyResp, err := verifyTask(task)
+	task.VerificationData = verifyResp
+
+	if err != nil {
+		return task, err
+	}
+
+	task.ChangeAnalysis = analyzeTask(task)
+
+	return task, nil
+}
+
+// revocationExpiry returns the earliest next update of the OCSP responses and the CRLs of the certificates
+// if it's before the expiry, the CRL is used for the certificates issued by the issuer of the CRL.
+func revocationExpiry(resp *verify.Response, crls []*x509.RevocationList, expiresAt time.Time) time.Time {
+	if resp == nil {
+		return expiresAt
+	}
+
+	for _, s := range resp.Signers {
+		for _, c := range s.Certificates {
+			if c.OCSPResponse != nil && !c.OCSPResponse.NextUpdate.IsZero() && c.OCSPResponse.NextUpdate.Before(expiresAt) {
+				expiresAt = c.OCSPResponse.NextUpdate
+			}
+
+			if c.Certificate == nil {
+				continue
+			}
+
+			for _, crl := range crls {
+				if crl.NextUpdate.IsZero() || !bytes.Equal(crl.RawIssuer, c.Certificate.RawIssuer) {
+					continue
+				}
+
+				if crl.NextUpdate.Before(expiresAt) {
+					expiresAt = crl.NextUpdate
+				}
+			}
+		}
+	}
+
+	return expiresAt
+}
+
+// oidRevocationInfoArchival represents the signed attribute of the PDF signature containing the embedded revocation data.
+var oidRevocationInfoArchival = asn1.ObjectIdentifier{1, 2, 840, 113583, 1, 1, 8}
+
+// embeddedCRLs returns the CRLs embedded to the signatures of the file, the CRLs which couldn't be parsed are skipped.
+func embeddedCRLs(filePath string) ([]*x509.RevocationList, error) {
+	f, err := os.Open(filePath)
+	if err != nil {
+		return nil, errors.Wrap(err, "open file")
+	}
+	defer func() { _ = f.Close() }()
+
+	finfo, err := f.Stat()
+	if err != nil {
+		return nil, errors.Wrap(err, "stat file")
+	}
+
+	rdr, err := pdf.NewReader(f, finfo.Size())
+	if err != nil {
+		return nil, errors.Wrap(err, "read file")
+	}
+
+	var crls []*x509.RevocationList
+
+	for _, x := range rdr.Xref() {
+		v := rdr.Resolve(x.Ptr(), x.Ptr())
+		if v.Key("Filter").Name() != "Adobe.PPKLite" {
+			continue
+		}
+
+		p7, err := pkcs7.Parse([]byte(v.Key("Contents").RawString()))
+		if err != nil {
+			continue
+		}
+
+		// the CRLs of the signed attribute and of the signed data
+		var raw [][]byte
+
+		var revInfo revocation.InfoArchival
+		if p7.UnmarshalSignedAttribute(oidRevocationInfoArchival, &revInfo) == nil {
+			for _, c := range revInfo.CRL {
+				raw = append(raw, c.FullBytes)
+			}
+		}
+
+		for _, c := range p7.CRLs {
+			b, err := asn1.Marshal(c)
+			if err == nil {
+				raw = append(raw, b)
+			}
+		}
+
+		for _, b := range raw {
+			crl, err := x509.ParseRevocationList(b)
+			if err == nil {
+				crls = append(crls, crl)
+			}
+		}
+	}
+
+	return crls, nil
+}
+
+// loadVerifyCacheEntry loads not expired cache entry, expired entries are deleted.
+func loadVerifyCacheEntry(key string) (*verifyCacheEntry, error) {
+	b, err := db.LoadByKey(key)
+	if err != nil || b == nil {
+		return nil, err
+	}
+
+	var entry verifyCacheEntry
+
+	err = json.Unmarshal(b, &entry)
+	if err != nil {
+		return nil, errors.Wrap(err, "unmarshal cache entry")
+	}
+
+	if !time.Now().Before(entry.ExpiresAt) {
+		return nil, db.DeleteByKey(key)
+	}
+
+	// restore public keys of the certificates
+	err = restoreCertificates(entry.VerificationData)
+	if err != nil {
+		return nil, err
+	}
+
+	return &entry, nil
+}
+
+// saveVerifyCacheEntry saves the cache entry.
+func saveVerifyCacheEntry(key string, entry verifyCacheEntry) error {
+	b, err := marshalWithoutPublicKeys(entry)
+	if err != nil {
+		return err
+	}
+
+	return db.SaveByKey(key, b)
+}
+
+// fileHash returns hex encoded SHA-256 of the file.
+func fileHash(filePath string) (string, error) {
+	f, err := os.Open(filePath)
+	if err != nil {
+		return "", errors.Wrap(err, "open file")
+	}
+	defer func() { _ = f.Close() }()
+
+	h := sha256.New()
+
+	_, err = io.Copy(h, f)
+	if err != nil {
+		return "", errors.Wrap(err, "hash file")
+	}
+
+	return hex.EncodeToString(h.Sum(nil)), nil
+}
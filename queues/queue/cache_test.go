@@ -0,0 +1,92 @@
+package queue
+
+import (
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"math/big"
+	"testing"
+	"time"
+
+	"github.com/digitorus/pdfsign/verify"
+	"github.com/stretchr/testify/assert"
+	"golang.org/x/crypto/ocsp"
+)
+
+// newTestCRL creates the certificate issued by the CA with the name and the CRL of the CA with the next update.
+func newTestCRL(t *testing.T, caName string, nextUpdate time.Time) (*x509.Certificate, *x509.RevocationList) {
+	t.Helper()
+
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	assert.NoError(t, err)
+
+	caTemplate := &x509.Certificate{
+		SerialNumber:          big.NewInt(1),
+		Subject:               pkix.Name{CommonName: caName},
+		NotBefore:             time.Now().Add(-time.Hour),
+		NotAfter:              time.Now().Add(time.Hour),
+		IsCA:                  true,
+		BasicConstraintsValid: true,
+		KeyUsage:              x509.KeyUsageCertSign | x509.KeyUsageCRLSign,
+	}
+
+	der, err := x509.CreateCertificate(rand.Reader, caTemplate, caTemplate, &key.PublicKey, key)
+	assert.NoError(t, err)
+
+	ca, err := x509.ParseCertificate(der)
+	assert.NoError(t, err)
+
+	der, err = x509.CreateCertificate(rand.Reader, &x509.Certificate{
+		SerialNumber: big.NewInt(2),
+		Subject:      pkix.Name{CommonName: "Test signer"},
+		NotBefore:    time.Now().Add(-time.Hour),
+		NotAfter:     time.Now().Add(time.Hour),
+	}, ca, &key.PublicKey, key)
+	assert.NoError(t, err)
+
+	cert, err := x509.ParseCertificate(der)
+	assert.NoError(t, err)
+
+	der, err = x509.CreateRevocationList(rand.Reader, &x509.RevocationList{
+		Number:     big.NewInt(1),
+		ThisUpdate: time.Now().Add(-time.Hour),
+		NextUpdate: nextUpdate,
+	}, ca, key)
+	assert.NoError(t, err)
+
+	crl, err := x509.ParseRevocationList(der)
+	assert.NoError(t, err)
+
+	return cert, crl
+}
+
+func TestRevocationExpiry(t *testing.T) {
+	now := time.Now().UTC().Truncate(time.Second)
+	expiresAt := now.Add(24 * time.Hour)
+
+	cert, crl := newTestCRL(t, "Test CA", now.Add(time.Hour))
+	_, otherCRL := newTestCRL(t, "Other CA", now.Add(time.Minute))
+
+	resp := &verify.Response{Signers: []verify.Signer{{Certificates: []verify.Certificate{{Certificate: cert}}}}}
+
+	// the CRL of the issuer of the certificate limits the expiry, the CRL of another issuer is ignored
+	assert.Equal(t, now.Add(time.Hour), revocationExpiry(resp, []*x509.RevocationList{crl, otherCRL}, expiresAt))
+
+	// the earliest next update is used
+	resp.Signers[0].Certificates[0].OCSPResponse = &ocsp.Response{NextUpdate: now.Add(30 * time.Minute)}
+	assert.Equal(t, now.Add(30*time.Minute), revocationExpiry(resp, []*x509.RevocationList{crl}, expiresAt))
+
+	// the revocation data updated after the expiry doesn't change it
+	assert.Equal(t, now.Add(time.Minute), revocationExpiry(resp, []*x509.RevocationList{crl}, now.Add(time.Minute)))
+	assert.Equal(t, expiresAt, revocationExpiry(nil, []*x509.RevocationList{crl}, expiresAt))
+}
+
+func TestEmbeddedCRLs(t *testing.T) {
+	_, err := embeddedCRLs("../../testfiles/SampleSignedPDFDocument.pdf")
+	assert.NoError(t, err)
+
+	_, err = embeddedCRLs("../../testfiles/missing.pdf")
+	assert.Error(t, err)
+}
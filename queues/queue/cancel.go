@@ -0,0 +1,163 @@
+package queue
+
+import (
+	"os"
+	"sync/atomic"
+
+	"github.com/digitorus/pdfsigner/queues/priority_queue"
+	"github.com/pkg/errors"
+)
+
+// StatusCancelled represents a task cancelled before it was processed.
+var StatusCancelled = "Cancelled"
+
+// CancelJob cancels all the pending and scheduled tasks of the job.
+func (q *Queue) CancelJob(jobID string) error {
+	_, err := q.cancelTasks(jobID, "")
+
+	return err
+}
+
+// CancelTask cancels the pending or scheduled task of the job.
+func (q *Queue) CancelTask(jobID, taskID string) error {
+	cancelled, err := q.cancelTasks(jobID, taskID)
+	if err != nil {
+		return err
+	}
+
+	if cancelled == 0 {
+		return errors.New("task is not pending")
+	}
+
+	return nil
+}
+
+// cancelTasks marks pending and scheduled tasks of the job as cancelled, only the task with the id if it's provided.
+// Cancelled tasks are removed from the queues and their temporary files are removed,
+// the tasks being processed are finished and their results are discarded.
+func (q *Queue) cancelTasks(jobID, taskID string) (int, error) {
+	q.mu.Lock()
+
+	// the processed job is loaded to cancel the tasks being processed
+	job, err := q.loadJob(jobID)
+	if err != nil {
+		q.mu.Unlock()
+
+		return 0, err
+	}
+
+	// check if the task is in the job
+	if _, exists := job.TasksMap[taskID]; taskID != "" && !exists {
+		q.mu.Unlock()
+
+		return 0, errors.New("task is not found")
+	}
+
+	var (
+		cancelled = make(map[string]Task)
+		removeNow []Task
+		unitNames = make(map[string]struct{})
+	)
+
+	for id, t := range job.TasksMap {
+		// the duplicates waiting for the result of the task are cancelled with it
+		if (t.Status != StatusPending && t.Status != StatusScheduled) || (taskID != "" && id != taskID && t.DuplicateOf != taskID) {
+			continue
+		}
+
+		t.Status = StatusCancelled
+		t.Steps = t.cancelledSteps()
+		job.TasksMap[id] = t
+		atomic.AddUint32(&job.TotalProcesedTasks, 1)
+
+		cancelled[id] = t
+		unitNames[t.UnitName] = struct{}{}
+
+		// the files of the tasks being processed are removed when they're done
+		if _, processing := q.processing[id]; !processing {
+			removeNow = append(removeNow, t)
+		}
+	}
+
+	if len(cancelled) == 0 {
+		q.mu.Unlock()
+
+		return 0, nil
+	}
+
+	job.updateCompletedAt()
+
+	tasks := make([]Task, 0, len(cancelled))
+	for _, t := range cancelled {
+		tasks = append(tasks, t)
+	}
+
+	events := newJobEvents(job, tasks...)
+
+	var units []*unit
+
+	for name := range unitNames {
+		if u, exists := q.units[name]; exists {
+			units = append(units, u)
+		}
+	}
+	q.mu.Unlock()
+
+	// remove cancelled tasks from the queues, the tasks waiting for retry are skipped when they're queued
+	for _, u := range units {
+		u.pq.Remove(func(i priority_queue.Item) bool {
+			_, exists := cancelled[i.Value.(Task).ID]
+
+			return exists
+		})
+	}
+
+	for _, t := range removeNow {
+		removeTaskFiles(t)
+	}
+
+	// only the cancelled tasks are saved, since other tasks could be saved by the workers sharing the store
+	taskIDs := make([]string, 0, len(cancelled))
+	for id := range cancelled {
+		taskIDs = append(taskIDs, id)
+	}
+
+	err = q.saveTasks(jobID, taskIDs...)
+
+	// notify waiting for the jobs after the tasks are saved
+	q.notifyJobsUpdated()
+
+	if err != nil {
+		return len(cancelled), err
+	}
+
+	q.publish(events...)
+
+	return len(cancelled), nil
+}
+
+// finishProcessing stops tracking the processed task and checks if the task was cancelled
+// or the job was deleted while it was processed, the lock should be held.
+func (q *Queue) finishProcessing(task Task) bool {
+	delete(q.processing, task.ID)
+
+	job, exists := q.jobs[task.JobID]
+	if !exists {
+		return true
+	}
+
+	return job.TasksMap[task.ID].Status == StatusCancelled
+}
+
+// removeTaskFiles removes the intermediate files of the pipeline and the input and output files of the task if they're temporary.
+func removeTaskFiles(task Task) {
+	// the intermediate files of the pipeline are always temporary
+	removeStepFiles(task)
+
+	if !task.Temporary {
+		return
+	}
+
+	_ = os.Remove(task.InputFilePath)
+	_ = os.Remove(task.OutputFilePath)
+}
@@ -0,0 +1,103 @@
+package queue
+
+import (
+	"bytes"
+	"crypto/x509"
+	"encoding/json"
+
+	"github.com/digitorus/pdfsign/verify"
+	"github.com/pkg/errors"
+)
+
+// marshalWithoutPublicKeys marshals the value without public keys of the certificates,
+// they couldn't be unmarshaled and are restored from the raw certificates instead.
+func marshalWithoutPublicKeys(v interface{}) ([]byte, error) {
+	b, err := json.Marshal(v)
+	if err != nil {
+		return nil, err
+	}
+
+	var decoded interface{}
+
+	d := json.NewDecoder(bytes.NewReader(b))
+	d.UseNumber()
+
+	err = d.Decode(&decoded)
+	if err != nil {
+		return nil, err
+	}
+
+	return json.Marshal(removeKey(decoded, "PublicKey"))
+}
+
+// removeKey removes the key from the decoded json objects recursively.
+func removeKey(v interface{}, key string) interface{} {
+	switch t := v.(type) {
+	case map[string]interface{}:
+		delete(t, key)
+
+		for k := range t {
+			t[k] = removeKey(t[k], key)
+		}
+	case []interface{}:
+		for i := range t {
+			t[i] = removeKey(t[i], key)
+		}
+	}
+
+	return v
+}
+
+// restoreCertificates parses the raw certificates of the verification response.
+func restoreCertificates(resp *verify.Response) error {
+	if resp == nil {
+		return nil
+	}
+
+	for i := range resp.Signers {
+		s := &resp.Signers[i]
+
+		for j := range s.Certificates {
+			c := &s.Certificates[j]
+
+			err := restoreCertificate(&c.Certificate)
+			if err != nil {
+				return err
+			}
+
+			if c.OCSPResponse != nil {
+				err = restoreCertificate(&c.OCSPResponse.Certificate)
+				if err != nil {
+					return err
+				}
+			}
+		}
+
+		if s.TimeStamp != nil {
+			for k := range s.TimeStamp.Certificates {
+				err := restoreCertificate(&s.TimeStamp.Certificates[k])
+				if err != nil {
+					return err
+				}
+			}
+		}
+	}
+
+	return nil
+}
+
+// restoreCertificate parses the certificate from the raw data.
+func restoreCertificate(c **x509.Certificate) error {
+	if *c == nil || len((*c).Raw) == 0 {
+		return nil
+	}
+
+	cert, err := x509.ParseCertificate((*c).Raw)
+	if err != nil {
+		return errors.Wrap(err, "parse cached certificate")
+	}
+
+	*c = cert
+
+	return nil
+}
@@ -0,0 +1,102 @@
+package queue
+
+import (
+	"sync/atomic"
+
+	"github.com/pkg/errors"
+)
+
+// SetDeduplication enables processing the files with the same content once per job,
+// the result is reused by the other tasks of the job. The tasks of the pipeline jobs are not deduplicated.
+func (q *Queue) SetDeduplication(enabled bool) {
+	q.mu.Lock()
+	q.deduplicate = enabled
+	q.mu.Unlock()
+}
+
+// hashTasks sets the content hash of the tasks if the deduplication is enabled.
+func (q *Queue) hashTasks(jobID string, tasks []Task) error {
+	q.mu.RLock()
+	enabled := q.deduplicate
+	job, exists := q.jobs[jobID]
+	pipeline := exists && job.Pipeline != ""
+	q.mu.RUnlock()
+
+	if !enabled || pipeline {
+		return nil
+	}
+
+	for i, t := range tasks {
+		hash, err := fileHash(t.InputFilePath)
+		if err != nil {
+			return errors.Wrapf(err, "hash %s", t.OriginalFileName)
+		}
+
+		tasks[i].ContentHash = hash
+	}
+
+	return nil
+}
+
+// originalTaskID returns the id of the task of the job with the same content waiting to be processed,
+// empty id is returned if there is no such task.
+func (j *Job) originalTaskID(task Task) string {
+	if task.ContentHash == "" {
+		return ""
+	}
+
+	for id, t := range j.TasksMap {
+		if id != task.ID && t.ContentHash == task.ContentHash && t.DuplicateOf == "" && (t.Status == StatusPending || t.Status == StatusScheduled) {
+			return id
+		}
+	}
+
+	return ""
+}
+
+// isWaitingDuplicate checks if the task is waiting for the result of the task with the same content.
+func (j *Job) isWaitingDuplicate(task Task) bool {
+	if task.DuplicateOf == "" || task.Status != StatusPending {
+		return false
+	}
+
+	original, exists := j.TasksMap[task.DuplicateOf]
+
+	return exists && (original.Status == StatusPending || original.Status == StatusScheduled)
+}
+
+// resolveDuplicates sets the result of the processed task to the tasks of the job waiting for it and returns them,
+// the signed file is copied to the output of every duplicate. The lock should be held.
+func (q *Queue) resolveDuplicates(job *Job, task Task, signed bool) []Task {
+	var duplicates []Task
+
+	for id, d := range job.TasksMap {
+		if d.DuplicateOf != task.ID || d.Status != StatusPending {
+			continue
+		}
+
+		d.Status = task.Status
+		d.Error = task.Error
+		d.VerificationData = task.VerificationData
+		d.ChangeAnalysis = task.ChangeAnalysis
+		d.FromCache = task.FromCache
+		d.DeadlineMissed = task.DeadlineMissed
+		d.copyMetadata(task)
+
+		// the output of the duplicate could be downloaded and removed on it's own
+		if signed && task.Status == StatusCompleted {
+			err := copyFile(task.OutputFilePath, d.OutputFilePath)
+			if err != nil {
+				d.Status = StatusFailed
+				d.Error = errors.Wrap(err, "copy signed file").Error()
+			}
+		}
+
+		job.TasksMap[id] = d
+		atomic.AddUint32(&job.TotalProcesedTasks, 1)
+
+		duplicates = append(duplicates, d)
+	}
+
+	return duplicates
+}
@@ -0,0 +1,104 @@
+package queue
+
+import (
+	"io"
+	"path/filepath"
+	"testing"
+
+	"github.com/digitorus/pdfsign/sign"
+	"github.com/digitorus/pdfsigner/license"
+	"github.com/digitorus/pdfsigner/queues/priority_queue"
+	"github.com/digitorus/pdfsigner/signer"
+	"github.com/sirupsen/logrus"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestDeduplication(t *testing.T) {
+	logrus.SetOutput(io.Discard)
+
+	err := license.Initialize([]byte(license.TestLicense))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	d := signer.SignData{
+		Signature: sign.SignDataSignature{
+			CertType:   sign.CertificationSignature,
+			DocMDPPerm: sign.AllowFillingExistingFormFieldsAndSignaturesPerms,
+		},
+	}
+	d.SetPEM("../../testfiles/test.crt", "../../testfiles/test.pem", "")
+
+	qs := NewQueue()
+	qs.AddSignUnit("simple", d)
+	qs.SetDeduplication(true)
+
+	out := t.TempDir()
+
+	jobID := qs.AddSignJob(JobSignConfig{})
+
+	originalID, err := qs.AddTask("simple", jobID, "a.pdf", "../../testfiles/testfile12.pdf", filepath.Join(out, "a.pdf"), priority_queue.HighPriority)
+	assert.NoError(t, err)
+
+	duplicateID, err := qs.AddTask("simple", jobID, "b.pdf", "../../testfiles/testfile12.pdf", filepath.Join(out, "b.pdf"), priority_queue.HighPriority)
+	assert.NoError(t, err)
+
+	otherID, err := qs.AddTask("simple", jobID, "c.pdf", "../../testfiles/testfile20.pdf", filepath.Join(out, "c.pdf"), priority_queue.HighPriority)
+	assert.NoError(t, err)
+
+	// the duplicate is not queued
+	size, err := qs.GetQueueSizeByUnitName("simple")
+	assert.NoError(t, err)
+	assert.Equal(t, 2, size.High)
+
+	job, err := qs.GetJobByID(jobID)
+	assert.NoError(t, err)
+	assert.Equal(t, originalID, job.TasksMap[duplicateID].DuplicateOf)
+	assert.Equal(t, job.TasksMap[originalID].ContentHash, job.TasksMap[duplicateID].ContentHash)
+	assert.Empty(t, job.TasksMap[otherID].DuplicateOf)
+
+	// the waiting duplicate is not queued after the restart
+	assert.NoError(t, qs.SaveToDB(jobID))
+
+	loaded := NewQueue()
+	loaded.AddSignUnit("simple", d)
+	assert.NoError(t, loaded.LoadFromDB())
+	loaded.requeuePendingTasks()
+
+	size, err = loaded.GetQueueSizeByUnitName("simple")
+	assert.NoError(t, err)
+	assert.Equal(t, 2, size.High)
+
+	// the file is signed once and the result is reused
+	assert.NoError(t, qs.processNextTask("simple"))
+	assert.NoError(t, qs.processNextTask("simple"))
+
+	job, err = qs.GetJobByID(jobID)
+	assert.NoError(t, err)
+	assert.True(t, job.IsCompleted())
+
+	for _, id := range []string{originalID, duplicateID, otherID} {
+		assert.Equal(t, StatusCompleted, job.TasksMap[id].Status, job.TasksMap[id].Error)
+		assert.FileExists(t, job.TasksMap[id].OutputFilePath)
+	}
+
+	assert.Empty(t, job.TasksMap[duplicateID].Attempts)
+
+	// the duplicates are cancelled with the task
+	jobID = qs.AddSignJob(JobSignConfig{})
+
+	originalID, err = qs.AddTask("simple", jobID, "a.pdf", "../../testfiles/testfile12.pdf", filepath.Join(out, "a2.pdf"), priority_queue.HighPriority)
+	assert.NoError(t, err)
+
+	duplicateID, err = qs.AddTask("simple", jobID, "b.pdf", "../../testfiles/testfile12.pdf", filepath.Join(out, "b2.pdf"), priority_queue.HighPriority)
+	assert.NoError(t, err)
+
+	assert.NoError(t, qs.CancelTask(jobID, originalID))
+
+	job, err = qs.GetJobByID(jobID)
+	assert.NoError(t, err)
+	assert.True(t, job.IsCompleted())
+	assert.Equal(t, StatusCancelled, job.TasksMap[duplicateID].Status)
+
+	assert.NoError(t, qs.DeleteFromDB(jobID))
+}
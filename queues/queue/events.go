@@ -0,0 +1,157 @@
+package queue
+
+import (
+	"sync"
+	"sync/atomic"
+	"time"
+
+	log "github.com/sirupsen/logrus"
+)
+
+const (
+	// EventTaskStarted is published when the worker starts processing the task.
+	EventTaskStarted = "task.started"
+	// EventTaskUpdated is published when the status of the task is changed, including the failed attempt which is retried.
+	EventTaskUpdated = "task.updated"
+	// EventJobCompleted is published when all the tasks of the job are processed or cancelled.
+	EventJobCompleted = "job.completed"
+)
+
+// Event represents the change of the job published to the subscribers.
+type Event struct {
+	// Type represents the type of the event
+	Type string
+	// Time represents time of the event
+	Time time.Time
+	// Job represents the job after the change, TasksMap is provided only with EventJobCompleted
+	Job Job
+	// Task represents the changed task, it's provided only with the task events
+	Task Task
+	// Processed represents number of the processed tasks of the job
+	Processed int
+	// Total represents number of all the tasks of the job
+	Total int
+}
+
+// EventHandler is called for every published event, it's called synchronously so it shouldn't block.
+type EventHandler func(e Event)
+
+// subscriber represents the handler subscribed to the events.
+type subscriber struct {
+	id      uint64
+	handler EventHandler
+}
+
+// Subscribe adds the handler called for every published event, the returned function removes the handler.
+func (q *Queue) Subscribe(h EventHandler) (unsubscribe func()) {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+
+	q.lastSubscriberID++
+	id := q.lastSubscriberID
+
+	q.subscribers = append(q.subscribers, subscriber{id: id, handler: h})
+
+	return func() {
+		q.mu.Lock()
+		defer q.mu.Unlock()
+
+		for i, s := range q.subscribers {
+			if s.id == id {
+				q.subscribers = append(q.subscribers[:i:i], q.subscribers[i+1:]...)
+
+				break
+			}
+		}
+	}
+}
+
+// SubscribeJob returns the channel receiving the events of the job, the returned function stops the subscription.
+// The channel is closed when the buffer is full, so the events including the completion of the job are not lost silently,
+// the subscriber should read the job and subscribe again.
+func (q *Queue) SubscribeJob(jobID string, buffer int) (<-chan Event, func()) {
+	events := make(chan Event, buffer)
+
+	// the events could be published concurrently
+	var (
+		mu     sync.Mutex
+		closed bool
+	)
+
+	unsubscribe := q.Subscribe(func(e Event) {
+		if e.Job.ID != jobID {
+			return
+		}
+
+		mu.Lock()
+		defer mu.Unlock()
+
+		if closed {
+			return
+		}
+
+		select {
+		case events <- e:
+		default:
+			log.WithFields(log.Fields{
+				"jobID": jobID,
+				"event": e.Type,
+			}).Warn("Closing events of the slow subscriber")
+
+			closed = true
+			close(events)
+		}
+	})
+
+	return events, unsubscribe
+}
+
+// newTaskEvent creates the event of the task, the lock should be held.
+func newTaskEvent(eventType string, job *Job, task Task) Event {
+	j := *job
+	j.TasksMap = nil
+
+	return Event{
+		Type:      eventType,
+		Time:      now(),
+		Job:       j,
+		Task:      task,
+		Processed: int(atomic.LoadUint32(&job.TotalProcesedTasks)),
+		Total:     len(job.TasksMap),
+	}
+}
+
+// newJobEvents creates the events of the updated tasks and the completion of the job if it's completed,
+// the lock should be held.
+func newJobEvents(job *Job, tasks ...Task) []Event {
+	events := make([]Event, 0, len(tasks)+1)
+
+	for _, t := range tasks {
+		events = append(events, newTaskEvent(EventTaskUpdated, job, t))
+	}
+
+	if job.IsCompleted() {
+		events = append(events, Event{
+			Type:      EventJobCompleted,
+			Time:      now(),
+			Job:       job.copy(),
+			Processed: len(job.TasksMap),
+			Total:     len(job.TasksMap),
+		})
+	}
+
+	return events
+}
+
+// publish calls the subscribers with the events, the lock shouldn't be held.
+func (q *Queue) publish(events ...Event) {
+	q.mu.RLock()
+	subscribers := q.subscribers
+	q.mu.RUnlock()
+
+	for _, e := range events {
+		for _, s := range subscribers {
+			s.handler(e)
+		}
+	}
+}
@@ -0,0 +1,113 @@
+package queue
+
+import (
+	"io"
+	"testing"
+
+	"github.com/digitorus/pdfsigner/queues/priority_queue"
+	"github.com/sirupsen/logrus"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestEvents(t *testing.T) {
+	logrus.SetOutput(io.Discard)
+
+	qs := NewQueue()
+	qs.AddVerifyUnit()
+
+	jobID := qs.AddVerifyJob(JobVerifyConfig{})
+	otherJobID := qs.AddVerifyJob(JobVerifyConfig{})
+
+	events, unsubscribe := qs.SubscribeJob(jobID, 10)
+
+	// count the events of all the jobs
+	var all int
+
+	unsubscribeAll := qs.Subscribe(func(e Event) { all++ })
+
+	for _, id := range []string{jobID, otherJobID} {
+		_, err := qs.AddTask(VerificationUnitName, id, "SampleSignedPDFDocument.pdf", "../../testfiles/SampleSignedPDFDocument.pdf", "", priority_queue.HighPriority)
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	_, err := qs.AddTask(VerificationUnitName, jobID, "malformed.pdf", "../../testfiles/malformed.pdf", "", priority_queue.LowPriority)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// process the tasks of both jobs
+	for i := 0; i < 3; i++ {
+		assert.NoError(t, qs.processNextTask(VerificationUnitName))
+	}
+
+	unsubscribe()
+	unsubscribeAll()
+
+	// only the events of the job are received
+	var types []string
+
+	for len(events) > 0 {
+		e := <-events
+		types = append(types, e.Type)
+
+		assert.Equal(t, jobID, e.Job.ID)
+		assert.Equal(t, 2, e.Total)
+
+		switch e.Type {
+		case EventTaskStarted:
+			assert.Equal(t, StatusPending, e.Task.Status)
+		case EventTaskUpdated:
+			assert.NotEqual(t, StatusPending, e.Task.Status)
+		case EventJobCompleted:
+			assert.Equal(t, 2, e.Processed)
+			assert.Len(t, e.Job.TasksMap, 2)
+		}
+	}
+
+	assert.Equal(t, []string{EventTaskStarted, EventTaskUpdated, EventTaskStarted, EventTaskUpdated, EventJobCompleted}, types)
+	assert.Equal(t, 8, all)
+
+	// unsubscribed handlers are not called anymore
+	_, err = qs.AddTask(VerificationUnitName, otherJobID, "SampleSignedPDFDocument.pdf", "../../testfiles/SampleSignedPDFDocument.pdf", "", priority_queue.HighPriority)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	assert.NoError(t, qs.processNextTask(VerificationUnitName))
+	assert.Equal(t, 8, all)
+	assert.Len(t, events, 0)
+}
+
+func TestSubscribeJobOverflow(t *testing.T) {
+	logrus.SetOutput(io.Discard)
+
+	qs := NewQueue()
+	qs.AddVerifyUnit()
+
+	jobID := qs.AddVerifyJob(JobVerifyConfig{})
+
+	events, unsubscribe := qs.SubscribeJob(jobID, 1)
+	defer unsubscribe()
+
+	_, err := qs.AddTask(VerificationUnitName, jobID, "SampleSignedPDFDocument.pdf", "../../testfiles/SampleSignedPDFDocument.pdf", "", priority_queue.HighPriority)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	assert.NoError(t, qs.processNextTask(VerificationUnitName))
+
+	// the buffered event is received and the channel is closed instead of dropping the rest
+	e, ok := <-events
+	assert.True(t, ok)
+	assert.Equal(t, EventTaskStarted, e.Type)
+
+	_, ok = <-events
+	assert.False(t, ok)
+
+	// the job is completed, the subscriber reads it again
+	job, err := qs.GetJobByID(jobID)
+	assert.NoError(t, err)
+	assert.True(t, job.IsCompleted())
+}
@@ -0,0 +1,165 @@
+package queue
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"time"
+
+	"github.com/digitorus/pdfsigner/db"
+	"github.com/pkg/errors"
+)
+
+const dbIdempotencyPrefix = "idempotency_"
+
+// DefaultIdempotencyWindow is used when the idempotency window is not provided.
+const DefaultIdempotencyWindow = 24 * time.Hour
+
+// IdempotencyStore represents the store keeping the idempotency keys, so the keys are shared by the nodes sharing the store.
+// The keys of the queue with the store without the support are kept in the local db.
+type IdempotencyStore interface {
+	// LoadIdempotencyKey returns the id of the job mapped to the hashed key, empty id is returned if the key is unknown or expired at the time
+	LoadIdempotencyKey(key string, at time.Time) (string, error)
+	// SaveIdempotencyKey maps the hashed key to the job until the expiration time
+	SaveIdempotencyKey(key, jobID string, expiresAt time.Time) error
+	// PurgeIdempotencyKeys deletes the keys expired at the time and returns their number
+	PurgeIdempotencyKeys(at time.Time) (int, error)
+}
+
+// idempotencyEntry represents the job added with the idempotency key.
+type idempotencyEntry struct {
+	JobID     string    `json:"job_id"`
+	ExpiresAt time.Time `json:"expires_at"`
+}
+
+// SetIdempotencyWindow sets how long the idempotency keys are mapped to the jobs, the default window is used if it's 0.
+func (q *Queue) SetIdempotencyWindow(window time.Duration) error {
+	if window < 0 {
+		return errors.New("idempotency window should be positive")
+	}
+
+	q.mu.Lock()
+	defer q.mu.Unlock()
+
+	q.idempotencyWindow = window
+
+	return nil
+}
+
+// IdempotentJobID returns the id of the job added with the idempotency key within the window,
+// empty id is returned if the key is unknown, expired or the job was deleted.
+func (q *Queue) IdempotentJobID(key string) (string, error) {
+	jobID, err := q.loadIdempotencyKey(key)
+	if err != nil || jobID == "" {
+		return "", err
+	}
+
+	// the key could be reused if the job was deleted
+	q.mu.RLock()
+	_, exists := q.jobs[jobID]
+	q.mu.RUnlock()
+
+	if !exists {
+		job, err := q.store.LoadJob(jobID)
+		if err != nil || job == nil {
+			return "", err
+		}
+	}
+
+	return jobID, nil
+}
+
+// loadIdempotencyKey returns the id of the job mapped to the idempotency key, empty id is returned if the key is unknown or expired.
+func (q *Queue) loadIdempotencyKey(key string) (string, error) {
+	if s, ok := q.store.(IdempotencyStore); ok {
+		return s.LoadIdempotencyKey(hashIdempotencyKey(key), time.Now())
+	}
+
+	dbKey := idempotencyDBKey(key)
+
+	b, err := db.LoadByKey(dbKey)
+	if err != nil || b == nil {
+		return "", err
+	}
+
+	var entry idempotencyEntry
+
+	err = json.Unmarshal(b, &entry)
+	if err != nil {
+		return "", errors.Wrap(err, "unmarshal idempotency key")
+	}
+
+	if !time.Now().Before(entry.ExpiresAt) {
+		return "", db.DeleteByKey(dbKey)
+	}
+
+	return entry.JobID, nil
+}
+
+// SetIdempotencyKey maps the idempotency key to the job for the idempotency window.
+func (q *Queue) SetIdempotencyKey(key, jobID string) error {
+	q.mu.RLock()
+	window := q.idempotencyWindow
+	q.mu.RUnlock()
+
+	if window == 0 {
+		window = DefaultIdempotencyWindow
+	}
+
+	expiresAt := now().Add(window)
+
+	if s, ok := q.store.(IdempotencyStore); ok {
+		return s.SaveIdempotencyKey(hashIdempotencyKey(key), jobID, expiresAt)
+	}
+
+	b, err := json.Marshal(idempotencyEntry{JobID: jobID, ExpiresAt: expiresAt})
+	if err != nil {
+		return errors.Wrap(err, "marshal idempotency key")
+	}
+
+	return db.SaveByKey(idempotencyDBKey(key), b)
+}
+
+// purgeIdempotencyKeys deletes the expired idempotency keys and returns their number.
+func (q *Queue) purgeIdempotencyKeys() (int, error) {
+	if s, ok := q.store.(IdempotencyStore); ok {
+		return s.PurgeIdempotencyKeys(time.Now())
+	}
+
+	entries, err := db.BatchLoad(dbIdempotencyPrefix)
+	if err != nil {
+		return 0, errors.Wrap(err, "load idempotency keys")
+	}
+
+	var deleted int
+
+	for dbKey, b := range entries {
+		var entry idempotencyEntry
+
+		// the broken entries couldn't be used anyway
+		if json.Unmarshal(b, &entry) == nil && time.Now().Before(entry.ExpiresAt) {
+			continue
+		}
+
+		err := db.DeleteByKey(dbKey)
+		if err != nil {
+			return deleted, errors.Wrap(err, "delete idempotency key")
+		}
+
+		deleted++
+	}
+
+	return deleted, nil
+}
+
+// idempotencyDBKey returns the db key of the idempotency key, the key is hashed to limit the length of the client provided value.
+func idempotencyDBKey(key string) string {
+	return dbIdempotencyPrefix + hashIdempotencyKey(key)
+}
+
+// hashIdempotencyKey returns the hash of the idempotency key.
+func hashIdempotencyKey(key string) string {
+	h := sha256.Sum256([]byte(key))
+
+	return hex.EncodeToString(h[:])
+}
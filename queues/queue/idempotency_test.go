@@ -0,0 +1,52 @@
+package queue
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestIdempotencyKeys(t *testing.T) {
+	qs := NewQueue()
+	qs.AddVerifyUnit()
+
+	assert.Error(t, qs.SetIdempotencyWindow(-time.Second))
+
+	jobID := qs.AddVerifyJob(JobVerifyConfig{})
+
+	// unknown key
+	id, err := qs.IdempotentJobID("verify:client:unknown")
+	assert.NoError(t, err)
+	assert.Empty(t, id)
+
+	assert.NoError(t, qs.SetIdempotencyKey("verify:client:key", jobID))
+
+	id, err = qs.IdempotentJobID("verify:client:key")
+	assert.NoError(t, err)
+	assert.Equal(t, jobID, id)
+
+	// the key expires after the window
+	assert.NoError(t, qs.SetIdempotencyWindow(time.Nanosecond))
+	assert.NoError(t, qs.SetIdempotencyKey("verify:client:expired", jobID))
+	time.Sleep(time.Millisecond)
+
+	id, err = qs.IdempotentJobID("verify:client:expired")
+	assert.NoError(t, err)
+	assert.Empty(t, id)
+
+	// the expired keys are deleted
+	assert.NoError(t, qs.SetIdempotencyKey("verify:client:purged", jobID))
+	time.Sleep(time.Millisecond)
+
+	deleted, err := qs.purgeIdempotencyKeys()
+	assert.NoError(t, err)
+	assert.Equal(t, 1, deleted)
+
+	// the key of the deleted job is not used
+	assert.NoError(t, qs.DeleteJob(jobID))
+
+	id, err = qs.IdempotentJobID("verify:client:key")
+	assert.NoError(t, err)
+	assert.Empty(t, id)
+}
@@ -0,0 +1,326 @@
+package queue
+
+import (
+	"encoding/json"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/digitorus/pdfsigner/db"
+	"github.com/pkg/errors"
+)
+
+const (
+	dbJobIndexPrefix     = "jobindex_"
+	dbJobIndexKeysPrefix = "jobindexkeys_"
+)
+
+const (
+	// DefaultJobsLimit is used when the limit of the listed jobs is not provided.
+	DefaultJobsLimit = 50
+	// MaxJobsLimit represents maximum number of the jobs listed at once.
+	MaxJobsLimit = 1000
+)
+
+// jobIndexTimeFormat represents the format of the creation time inside the index keys, sorted as the time.
+const jobIndexTimeFormat = "20060102T150405.000000000Z"
+
+// jobIndexScanSize represents the number of the index keys read at once while the jobs are listed.
+const jobIndexScanSize = 256
+
+// Fields of the job index.
+const (
+	jobIndexAll    = "all"
+	jobIndexType   = "type"
+	jobIndexClient = "client"
+	jobIndexUnit   = "unit"
+	jobIndexStatus = "status"
+	jobIndexFile   = "file"
+)
+
+// JobFilter represents the conditions of the listed jobs, the conditions which are not provided are not checked.
+type JobFilter struct {
+	// Type represents the type of the job, sign or verify
+	Type string
+	// Unit represents the name of the unit processing any task of the job
+	Unit string
+	// Status represents the status of any task of the job
+	Status string
+	// Client represents the name of the web api client added the job
+	Client string
+	// FileName represents the original file name of any task of the job, compared case insensitively
+	FileName string
+	// CreatedAfter represents the time the job was created at or after
+	CreatedAfter time.Time
+	// CreatedBefore represents the time the job was created before
+	CreatedBefore time.Time
+	// Limit represents the maximum number of the listed jobs, DefaultJobsLimit is used if it's 0
+	Limit int
+	// Cursor represents the position after the last job of the previous page
+	Cursor string
+}
+
+// indexEntry represents the field and the value the job is indexed by.
+type indexEntry struct {
+	field string
+	value string
+}
+
+// ListJobs returns the jobs matching the filter from the newest to the oldest and the cursor of the next page,
+// the cursor is empty if it's the last page. The jobs are found in the store without loading all of them.
+func (q *Queue) ListJobs(f JobFilter) ([]Job, string, error) {
+	if f.Limit == 0 {
+		f.Limit = DefaultJobsLimit
+	}
+
+	if f.Limit < 0 || f.Limit > MaxJobsLimit {
+		return nil, "", errors.Errorf("limit should be between 1 and %d", MaxJobsLimit)
+	}
+
+	if f.Type != "" && f.Type != JobTypeSign && f.Type != JobTypeVerify {
+		return nil, "", errors.New("type should be sign or verify")
+	}
+
+	if f.Status != "" && !ValidStatus(f.Status) {
+		return nil, "", errors.New("status is not correct")
+	}
+
+	if f.Cursor != "" {
+		if _, err := decodeJobCursor(f.Cursor); err != nil {
+			return nil, "", err
+		}
+	}
+
+	// the jobs saved before the unit was renamed are indexed by the alias of the unit
+	if f.Unit != "" {
+		if names := q.unitNames(f.Unit); len(names) > 1 {
+			return q.listJobsOfUnits(f, names)
+		}
+	}
+
+	return q.store.ListJobs(f)
+}
+
+// listJobsOfUnits returns the jobs of any of the units from the newest to the oldest and the cursor of the next page.
+func (q *Queue) listJobsOfUnits(f JobFilter, unitNames []string) ([]Job, string, error) {
+	var (
+		jobs []Job
+		more bool
+	)
+
+	seen := map[string]bool{}
+
+	for _, name := range unitNames {
+		uf := f
+		uf.Unit = name
+
+		unitJobs, cursor, err := q.store.ListJobs(uf)
+		if err != nil {
+			return nil, "", err
+		}
+
+		for _, j := range unitJobs {
+			if !seen[j.ID] {
+				seen[j.ID] = true
+				jobs = append(jobs, j)
+			}
+		}
+
+		more = more || cursor != ""
+	}
+
+	sort.Slice(jobs, func(i, j int) bool {
+		return jobs[i].indexPosition() > jobs[j].indexPosition()
+	})
+
+	if len(jobs) > f.Limit {
+		jobs = jobs[:f.Limit]
+		more = true
+	}
+
+	if !more || len(jobs) == 0 {
+		return jobs, "", nil
+	}
+
+	return jobs, encodeJobCursor(jobs[len(jobs)-1].indexPosition()), nil
+}
+
+// LoadJobFromDB loads the job from the store to the queue without loading other jobs.
+func (q *Queue) LoadJobFromDB(jobID string) error {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+
+	_, err := q.loadJob(jobID)
+
+	return err
+}
+
+// indexEntry returns the index of the most selective condition of the filter, the index of all the jobs if there are no conditions.
+func (f JobFilter) indexEntry() indexEntry {
+	switch {
+	case f.FileName != "":
+		return indexEntry{jobIndexFile, strings.ToLower(f.FileName)}
+	case f.Client != "":
+		return indexEntry{jobIndexClient, f.Client}
+	case f.Unit != "":
+		return indexEntry{jobIndexUnit, f.Unit}
+	case f.Status != "":
+		return indexEntry{jobIndexStatus, f.Status}
+	case f.Type != "":
+		return indexEntry{jobIndexType, f.Type}
+	}
+
+	return indexEntry{field: jobIndexAll}
+}
+
+// matches checks if the job meets all the conditions of the filter.
+func (j *Job) matches(f JobFilter) bool {
+	if !f.CreatedAfter.IsZero() && j.CreatedAt.Before(f.CreatedAfter) {
+		return false
+	}
+
+	if !f.CreatedBefore.IsZero() && !j.CreatedAt.Before(f.CreatedBefore) {
+		return false
+	}
+
+	entries := map[indexEntry]bool{}
+	for _, e := range j.indexEntries() {
+		entries[e] = true
+	}
+
+	for _, e := range []indexEntry{
+		{jobIndexType, f.Type},
+		{jobIndexClient, f.Client},
+		{jobIndexUnit, f.Unit},
+		{jobIndexStatus, f.Status},
+		{jobIndexFile, strings.ToLower(f.FileName)},
+	} {
+		if e.value != "" && !entries[e] {
+			return false
+		}
+	}
+
+	return true
+}
+
+// JobType returns the type of the job, the type of the jobs saved before it was tracked is determined by the units of the tasks.
+func (j *Job) JobType() string {
+	if j.Type != "" {
+		return j.Type
+	}
+
+	for _, t := range j.TasksMap {
+		if t.UnitName == VerificationUnitName && t.Steps == nil {
+			return JobTypeVerify
+		}
+	}
+
+	return JobTypeSign
+}
+
+// indexEntries returns the fields and the values the job is indexed by.
+func (j *Job) indexEntries() []indexEntry {
+	entries := []indexEntry{{field: jobIndexAll}, {jobIndexType, j.JobType()}}
+
+	seen := map[indexEntry]bool{}
+	add := func(field, value string) {
+		e := indexEntry{field, value}
+		if value == "" || seen[e] {
+			return
+		}
+
+		seen[e] = true
+		entries = append(entries, e)
+	}
+
+	add(jobIndexClient, j.Client)
+
+	for _, t := range j.TasksMap {
+		add(jobIndexUnit, t.UnitName)
+
+		for _, s := range t.Steps {
+			add(jobIndexUnit, s.UnitName)
+		}
+
+		add(jobIndexStatus, t.Status)
+		add(jobIndexFile, strings.ToLower(t.OriginalFileName))
+	}
+
+	return entries
+}
+
+// indexKeys returns the keys of the index entries of the job.
+func (j *Job) indexKeys() []string {
+	position := j.indexPosition()
+
+	var keys []string
+	for _, e := range j.indexEntries() {
+		keys = append(keys, jobIndexKeyPrefix(e)+position)
+	}
+
+	return keys
+}
+
+// indexPosition returns the position of the job inside the index, the creation time and the id of the job.
+func (j *Job) indexPosition() string {
+	return formatIndexTime(j.CreatedAt) + "_" + j.ID
+}
+
+// updateJobIndex adds the index keys of the job to the values to save and returns the outdated keys to delete.
+func updateJobIndex(j *Job, values map[string][]byte) ([]string, error) {
+	keys := j.indexKeys()
+
+	b, err := json.Marshal(keys)
+	if err != nil {
+		return nil, errors.Wrap(err, "marshal job index keys")
+	}
+
+	values[dbJobIndexKeysPrefix+j.ID] = b
+
+	for _, k := range keys {
+		values[k] = []byte{}
+	}
+
+	oldKeys, err := loadJobIndexKeys(j.ID)
+	if err != nil {
+		return nil, err
+	}
+
+	var deleteKeys []string
+
+	for _, k := range oldKeys {
+		if _, exists := values[k]; !exists {
+			deleteKeys = append(deleteKeys, k)
+		}
+	}
+
+	return deleteKeys, nil
+}
+
+// loadJobIndexKeys loads the keys the job is indexed with, nil is returned if the job is not indexed.
+func loadJobIndexKeys(jobID string) ([]string, error) {
+	b, err := db.LoadByKey(dbJobIndexKeysPrefix + jobID)
+	if err != nil || b == nil {
+		return nil, err
+	}
+
+	var keys []string
+
+	err = json.Unmarshal(b, &keys)
+	if err != nil {
+		return nil, errors.Wrap(err, "unmarshal job index keys")
+	}
+
+	return keys, nil
+}
+
+// jobIndexKeyPrefix returns the prefix of the keys of the index entry, the value is separated by the zero byte
+// so the prefix of the value doesn't match the longer values.
+func jobIndexKeyPrefix(e indexEntry) string {
+	return dbJobIndexPrefix + e.field + "_" + strings.ReplaceAll(e.value, "\x00", "") + "\x00"
+}
+
+// formatIndexTime formats the time for the index keys.
+func formatIndexTime(t time.Time) string {
+	return t.UTC().Format(jobIndexTimeFormat)
+}
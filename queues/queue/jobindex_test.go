@@ -0,0 +1,176 @@
+package queue
+
+import (
+	"encoding/json"
+	"io"
+	"testing"
+	"time"
+
+	"github.com/digitorus/pdfsigner/db"
+	"github.com/digitorus/pdfsigner/queues/priority_queue"
+	"github.com/sirupsen/logrus"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestListJobs(t *testing.T) {
+	logrus.SetOutput(io.Discard)
+
+	qs := NewQueue()
+	qs.AddVerifyUnit()
+
+	createdAfter := now()
+
+	// add the jobs of the client
+	var jobIDs []string
+
+	for _, fileName := range []string{"Contract.pdf", "invoice.pdf", "contract.pdf", "report.pdf", "invoice.pdf"} {
+		jobID := qs.AddVerifyJob(JobVerifyConfig{})
+		assert.NoError(t, qs.SetJobClient(jobID, "jobindex"))
+
+		_, err := qs.AddTask(VerificationUnitName, jobID, fileName, "../../testfiles/SampleSignedPDFDocument.pdf", "", priority_queue.HighPriority)
+		assert.NoError(t, err)
+
+		// the jobs are sorted by the creation time
+		time.Sleep(time.Millisecond)
+
+		assert.NoError(t, qs.SaveToDB(jobID))
+		jobIDs = append(jobIDs, jobID)
+	}
+
+	ids := func(jobs []Job) []string {
+		var res []string
+		for _, j := range jobs {
+			res = append(res, j.ID)
+		}
+
+		return res
+	}
+
+	// the jobs are listed from the newest to the oldest
+	jobs, cursor, err := qs.ListJobs(JobFilter{Client: "jobindex"})
+	assert.NoError(t, err)
+	assert.Empty(t, cursor)
+	assert.Len(t, jobs, 5)
+	assert.Equal(t, jobIDs[0], jobs[4].ID)
+	assert.Equal(t, JobTypeVerify, jobs[0].JobType())
+
+	// paginate with the cursor
+	var pages []string
+
+	cursor = ""
+
+	for {
+		jobs, next, err := qs.ListJobs(JobFilter{Client: "jobindex", Limit: 2, Cursor: cursor})
+		assert.NoError(t, err)
+		assert.LessOrEqual(t, len(jobs), 2)
+
+		pages = append(pages, ids(jobs)...)
+
+		if next == "" {
+			break
+		}
+
+		cursor = next
+	}
+
+	assert.Equal(t, []string{jobIDs[4], jobIDs[3], jobIDs[2], jobIDs[1], jobIDs[0]}, pages)
+
+	// filter by the file name case insensitively and other conditions
+	jobs, _, err = qs.ListJobs(JobFilter{FileName: "CONTRACT.pdf", Client: "jobindex"})
+	assert.NoError(t, err)
+	assert.ElementsMatch(t, []string{jobIDs[0], jobIDs[2]}, ids(jobs))
+
+	jobs, _, err = qs.ListJobs(JobFilter{FileName: "invoice.pdf", Type: JobTypeSign})
+	assert.NoError(t, err)
+	assert.Empty(t, jobs)
+
+	jobs, _, err = qs.ListJobs(JobFilter{Type: JobTypeVerify, Unit: VerificationUnitName, Status: StatusPending, CreatedAfter: createdAfter})
+	assert.NoError(t, err)
+	assert.ElementsMatch(t, jobIDs, ids(jobs))
+
+	// filter by the creation time
+	job, err := qs.GetJobByID(jobIDs[2])
+	assert.NoError(t, err)
+
+	jobs, _, err = qs.ListJobs(JobFilter{Client: "jobindex", CreatedBefore: job.CreatedAt})
+	assert.NoError(t, err)
+	assert.ElementsMatch(t, []string{jobIDs[0], jobIDs[1]}, ids(jobs))
+
+	jobs, _, err = qs.ListJobs(JobFilter{Client: "jobindex", CreatedAfter: job.CreatedAt})
+	assert.NoError(t, err)
+	assert.ElementsMatch(t, []string{jobIDs[2], jobIDs[3], jobIDs[4]}, ids(jobs))
+
+	// the index is updated when the job is saved
+	assert.NoError(t, qs.processNextTask(VerificationUnitName))
+
+	jobs, _, err = qs.ListJobs(JobFilter{Client: "jobindex", Status: StatusCompleted})
+	assert.NoError(t, err)
+	assert.Len(t, jobs, 1)
+
+	jobs, _, err = qs.ListJobs(JobFilter{Client: "jobindex", Status: StatusPending})
+	assert.NoError(t, err)
+	assert.Len(t, jobs, 4)
+
+	// the jobs are listed from the db without the queue
+	loaded := NewQueue()
+
+	jobs, _, err = loaded.ListJobs(JobFilter{Client: "jobindex", FileName: "report.pdf"})
+	assert.NoError(t, err)
+	assert.Equal(t, []string{jobIDs[3]}, ids(jobs))
+
+	// the deleted job is removed from the index
+	assert.NoError(t, qs.DeleteJob(jobIDs[3]))
+
+	jobs, _, err = loaded.ListJobs(JobFilter{Client: "jobindex", FileName: "report.pdf"})
+	assert.NoError(t, err)
+	assert.Empty(t, jobs)
+
+	// the jobs saved in the previous format with the tasks and without the index are saved again when they're loaded
+	job, err = qs.GetJobByID(jobIDs[4])
+	assert.NoError(t, err)
+
+	legacy, err := json.Marshal(job)
+	assert.NoError(t, err)
+
+	keys, err := loadJobIndexKeys(jobIDs[4])
+	assert.NoError(t, err)
+
+	tasks, err := db.LoadByPrefix(jobTaskKeyPrefix(jobIDs[4]))
+	assert.NoError(t, err)
+	assert.Len(t, tasks, 1)
+
+	for k := range tasks {
+		keys = append(keys, k)
+	}
+
+	keys = append(keys, dbJobIndexKeysPrefix+jobIDs[4], dbUnfinishedJobPrefix+jobIDs[4], dbJobStoreVersionKey)
+	assert.NoError(t, db.UpdateBatch(map[string][]byte{dbJobPrefix + jobIDs[4]: legacy}, keys))
+
+	jobs, _, err = loaded.ListJobs(JobFilter{Client: "jobindex"})
+	assert.NoError(t, err)
+	assert.Len(t, jobs, 3)
+
+	assert.NoError(t, loaded.LoadFromDB())
+
+	jobs, _, err = loaded.ListJobs(JobFilter{Client: "jobindex"})
+	assert.NoError(t, err)
+	assert.Len(t, jobs, 4)
+
+	loaded.mu.RLock()
+	assert.Len(t, loaded.jobs[jobIDs[4]].TasksMap, 1)
+	loaded.mu.RUnlock()
+
+	tasks, err = db.LoadByPrefix(jobTaskKeyPrefix(jobIDs[4]))
+	assert.NoError(t, err)
+	assert.Len(t, tasks, 1)
+
+	// reject wrong filter
+	for _, f := range []JobFilter{{Limit: MaxJobsLimit + 1}, {Type: "print"}, {Status: "Unknown"}, {Cursor: "wrong"}} {
+		_, _, err := qs.ListJobs(f)
+		assert.Error(t, err)
+	}
+
+	for _, id := range []string{jobIDs[0], jobIDs[1], jobIDs[2], jobIDs[4]} {
+		assert.NoError(t, qs.DeleteJob(id))
+	}
+}
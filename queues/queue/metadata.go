@@ -0,0 +1,107 @@
+package queue
+
+import (
+	"os"
+	"time"
+
+	"github.com/digitorus/pdfsigner/signer"
+	"github.com/pkg/errors"
+	log "github.com/sirupsen/logrus"
+)
+
+// startAttempt records the start of the processing of the task and the digest of the input file.
+func (t *Task) startAttempt(startedAt time.Time) {
+	if t.StartedAt.IsZero() {
+		t.StartedAt = startedAt
+	}
+
+	if t.InputSHA256 != "" {
+		return
+	}
+
+	// the content hash of the deduplicated task is the same digest
+	if t.ContentHash != "" {
+		t.InputSHA256 = t.ContentHash
+
+		return
+	}
+
+	hash, err := fileHash(t.InputFilePath)
+	if err != nil {
+		log.WithField("taskID", t.ID).Warnf("Couldn't hash input file: %s", err)
+
+		return
+	}
+
+	t.InputSHA256 = hash
+}
+
+// finishAttempt records the processing time of the attempt, the processed task gets the digest and the size of the output file.
+func (t *Task) finishAttempt(attempt Attempt) {
+	t.Duration += attempt.FinishedAt.Sub(attempt.StartedAt)
+
+	// the task is retried or processed by the next step of the pipeline
+	if t.Status == StatusPending {
+		return
+	}
+
+	t.FinishedAt = attempt.FinishedAt
+
+	if t.Status != StatusCompleted || t.OutputFilePath == "" {
+		return
+	}
+
+	hash, size, err := fileDigest(t.OutputFilePath)
+	if err != nil {
+		log.WithField("taskID", t.ID).Warnf("Couldn't hash output file: %s", err)
+
+		return
+	}
+
+	t.OutputSHA256 = hash
+	t.OutputSize = size
+}
+
+// addSignature records the details of the signature added to the file,
+// the timestamp of the pipeline step keeps the details of the signature of the previous step.
+func (t *Task) addSignature(res signer.Result) {
+	if !res.SigningTime.IsZero() {
+		t.SigningTime = res.SigningTime.UTC()
+	}
+
+	if res.CertificateFingerprint != "" {
+		t.CertificateFingerprint = res.CertificateFingerprint
+	}
+
+	if !res.TimestampTime.IsZero() {
+		t.TimestampTime = res.TimestampTime.UTC()
+	}
+}
+
+// copyMetadata copies the details of the processing to the duplicate of the task.
+func (t *Task) copyMetadata(original Task) {
+	t.StartedAt = original.StartedAt
+	t.FinishedAt = original.FinishedAt
+	t.Duration = original.Duration
+	t.InputSHA256 = original.InputSHA256
+	t.OutputSHA256 = original.OutputSHA256
+	t.OutputSize = original.OutputSize
+	t.CertificateFingerprint = original.CertificateFingerprint
+	t.SigningTime = original.SigningTime
+	t.TimestampTime = original.TimestampTime
+}
+
+// fileDigest returns hex encoded SHA-256 and the size of the file.
+func fileDigest(filePath string) (string, int64, error) {
+	info, err := os.Stat(filePath)
+	if err != nil {
+		return "", 0, errors.Wrap(err, "stat file")
+	}
+
+	hash, err := fileHash(filePath)
+	if err != nil {
+		return "", 0, err
+	}
+
+	return hash, info.Size(), nil
+}
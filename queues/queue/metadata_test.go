@@ -0,0 +1,64 @@
+package queue
+
+import (
+	"context"
+	"io"
+	"testing"
+	"time"
+
+	"github.com/digitorus/pdfsigner/queues/priority_queue"
+	"github.com/sirupsen/logrus"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestTaskMetadata(t *testing.T) {
+	logrus.SetOutput(io.Discard)
+
+	qs := NewQueue()
+	qs.AddVerifyUnit()
+	qs.SetDeduplication(true)
+
+	jobID := qs.AddVerifyJob(JobVerifyConfig{})
+
+	// the duplicate gets the details of the processed task
+	for i := 0; i < 2; i++ {
+		_, err := qs.AddTask(VerificationUnitName, jobID, "SampleSignedPDFDocument.pdf", "../../testfiles/SampleSignedPDFDocument.pdf", "", priority_queue.HighPriority)
+		assert.NoError(t, err)
+	}
+
+	hash, err := fileHash("../../testfiles/SampleSignedPDFDocument.pdf")
+	assert.NoError(t, err)
+
+	qs.StartProcessor()
+
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+
+	job, err := qs.WaitForJob(ctx, jobID)
+	assert.NoError(t, err)
+
+	var original Task
+
+	for _, task := range job.TasksMap {
+		if task.DuplicateOf == "" {
+			original = task
+		}
+	}
+
+	assert.Equal(t, hash, original.InputSHA256)
+	assert.False(t, original.QueuedAt.IsZero())
+	assert.False(t, original.StartedAt.Before(original.QueuedAt))
+	assert.False(t, original.FinishedAt.Before(original.StartedAt))
+	assert.Equal(t, original.FinishedAt.Sub(original.StartedAt), original.Duration)
+
+	// the verified file doesn't have the output
+	assert.Empty(t, original.OutputSHA256)
+	assert.Zero(t, original.OutputSize)
+
+	for _, task := range job.TasksMap {
+		assert.Equal(t, StatusCompleted, task.Status, task.Error)
+		assert.Equal(t, original.InputSHA256, task.InputSHA256)
+		assert.Equal(t, original.StartedAt, task.StartedAt)
+		assert.Equal(t, original.FinishedAt, task.FinishedAt)
+	}
+}
@@ -0,0 +1,492 @@
+package queue
+
+import (
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"time"
+
+	"github.com/digitorus/pdfsign/sign"
+	"github.com/digitorus/pdfsign/verify"
+	"github.com/digitorus/pdfsigner/revision"
+	"github.com/digitorus/pdfsigner/signer"
+	"github.com/pkg/errors"
+)
+
+const (
+	// StepSign represents the step signing the file with the signer.
+	StepSign = "sign"
+	// StepTimestamp represents the step adding the document timestamp of the TSA.
+	StepTimestamp = "timestamp"
+	// StepVerify represents the step verifying the file against the policy.
+	StepVerify = "verify"
+	// StepDeliver represents the step copying the file to the folder.
+	StepDeliver = "deliver"
+)
+
+// Pipeline represents the ordered steps the files of the job are processed with, the output of every step is the input of the next one.
+type Pipeline struct {
+	// Name represents the name of the pipeline referenced by the jobs
+	Name string
+	// Steps represents the steps of the pipeline
+	Steps []PipelineStep
+}
+
+// PipelineStep represents a single step of the pipeline.
+type PipelineStep struct {
+	// Type represents the type of the step: sign, timestamp, verify or deliver
+	Type string
+	// Signer represents the name of the signing unit of the sign step
+	Signer string
+	// CertType overrides the certificate type of the signer, Ex. approval signature for countersigning, optional
+	CertType sign.CertType
+	// TSA represents the Time Stamping Authority of the timestamp step
+	TSA sign.TSA
+	// Policy represents the policy the file is verified against by the verify step
+	Policy VerifyPolicy
+	// Out represents the folder the file is copied to by the deliver step
+	Out string
+}
+
+// unitName returns the name of the unit processing the step, the steps other than signing are processed by the verification unit.
+func (s PipelineStep) unitName() string {
+	if s.Type == StepSign {
+		return s.Signer
+	}
+
+	return VerificationUnitName
+}
+
+// producesFile checks if the step creates a new version of the file.
+func (s PipelineStep) producesFile() bool {
+	return s.Type == StepSign || s.Type == StepTimestamp
+}
+
+// VerifyPolicy represents the requirements the file should meet to pass the verify step.
+type VerifyPolicy struct {
+	// Name represents the name of the policy
+	Name string
+	// MinSignatures represents minimum number of the valid signatures
+	MinSignatures int
+	// RequireTrustedIssuer requires the certificates of all the signatures to be issued by the trusted authority
+	RequireTrustedIssuer bool
+	// RejectChanges rejects the files modified after signing in a way not permitted by the signatures
+	RejectChanges bool
+}
+
+// check checks if the verification result meets the policy.
+func (p VerifyPolicy) check(resp *verify.Response, analysis *revision.Analysis) error {
+	if resp == nil {
+		return errors.New("policy check: no verification result")
+	}
+
+	if resp.Error != "" {
+		return errors.Errorf("policy check: %s", resp.Error)
+	}
+
+	for _, s := range resp.Signers {
+		if !s.ValidSignature {
+			return errors.Errorf("policy check: signature of %q is not valid", s.Name)
+		}
+
+		if s.RevokedCertificate {
+			return errors.Errorf("policy check: certificate of %q is revoked", s.Name)
+		}
+
+		if p.RequireTrustedIssuer && !s.TrustedIssuer {
+			return errors.Errorf("policy check: certificate of %q is not issued by trusted authority", s.Name)
+		}
+	}
+
+	if len(resp.Signers) < p.MinSignatures {
+		return errors.Errorf("policy check: %d signatures required, found %d", p.MinSignatures, len(resp.Signers))
+	}
+
+	if p.RejectChanges && analysis != nil && analysis.Verdict == revision.VerdictNotPermitted {
+		return errors.New("policy check: the file was modified after signing")
+	}
+
+	return nil
+}
+
+// StepResult represents the status of the step of the pipeline processing the task.
+type StepResult struct {
+	// Type represents the type of the step
+	Type string `json:"type"`
+	// UnitName represents the name of the unit processing the step
+	UnitName string `json:"unit_name"`
+	// Status represents the status of the step: Pending, Completed, Failed, DeadLetter or Cancelled
+	Status string `json:"status"`
+	// OutputFilePath represents the intermediate file created by the step
+	OutputFilePath string `json:"output_file_path,omitempty"`
+	// StartedAt represents time the last attempt of the step started
+	StartedAt time.Time `json:"started_at"`
+	// FinishedAt represents time the last attempt of the step finished
+	FinishedAt time.Time `json:"finished_at"`
+	// Error represents error of the last attempt of the step
+	Error string `json:"error,omitempty"`
+}
+
+// AddPipeline validates the pipeline and adds it to the pipelines the jobs could be processed with,
+// the units of the steps should be added before. The units of the queue sharing the store could be run by other workers,
+// so only the units added to the queue are checked.
+func (q *Queue) AddPipeline(p Pipeline) error {
+	if p.Name == "" {
+		return errors.New("pipeline name is empty")
+	}
+
+	if len(p.Steps) == 0 {
+		return errors.Errorf("pipeline %s: no steps provided", p.Name)
+	}
+
+	q.mu.Lock()
+	defer q.mu.Unlock()
+
+	for i, s := range p.Steps {
+		switch s.Type {
+		case StepSign:
+			if u, exists := q.units[s.Signer]; (!exists && q.shared == nil) || (exists && !u.isSigningUnit) {
+				return errors.Errorf("pipeline %s: step %d: signer %q is not found", p.Name, i+1, s.Signer)
+			}
+		case StepTimestamp:
+			if s.TSA.URL == "" {
+				return errors.Errorf("pipeline %s: step %d: TSA url is not provided", p.Name, i+1)
+			}
+		case StepVerify:
+		case StepDeliver:
+			if s.Out == "" {
+				return errors.Errorf("pipeline %s: step %d: output folder is not provided", p.Name, i+1)
+			}
+		default:
+			return errors.Errorf("pipeline %s: step %d: unknown step type %q", p.Name, i+1, s.Type)
+		}
+
+		if _, exists := q.units[s.unitName()]; !exists && q.shared == nil {
+			return errors.Errorf("pipeline %s: step %d: unit %q is not in map", p.Name, i+1, s.unitName())
+		}
+	}
+
+	q.pipelines[p.Name] = p
+
+	return nil
+}
+
+// AddPipelineJob adds sign job processed by the pipeline to the jobs map, the tasks are queued to the unit of the first step.
+func (q *Queue) AddPipelineJob(pipelineName string, signConfig JobSignConfig) (string, error) {
+	q.mu.RLock()
+	_, exists := q.pipelines[pipelineName]
+	q.mu.RUnlock()
+
+	if !exists {
+		return "", errors.Errorf("pipeline %q is not found", pipelineName)
+	}
+
+	j := q.addJob(JobTypeSign)
+
+	q.mu.Lock()
+	j.SignConfig = signConfig
+	j.Pipeline = pipelineName
+	q.mu.Unlock()
+
+	return j.ID, nil
+}
+
+// taskUnitName returns the unit the new tasks of the job are queued to, the unit of the first step for the pipeline jobs,
+// the write lock should be held.
+func (q *Queue) taskUnitName(jobID, unitName string) (string, error) {
+	job, err := q.loadJob(jobID)
+	if err != nil {
+		return "", err
+	}
+
+	if job.Pipeline != "" {
+		p, exists := q.pipelines[job.Pipeline]
+		if !exists {
+			return "", errors.Errorf("pipeline %q is not found", job.Pipeline)
+		}
+
+		unitName = p.Steps[0].unitName()
+	}
+
+	if _, exists := q.units[unitName]; !exists {
+		return "", errors.New("unit is not in map")
+	}
+
+	return unitName, nil
+}
+
+// newStepResults creates pending steps of the task, the intermediate files are created in the temporary folder.
+func (p Pipeline) newStepResults(taskID string) []StepResult {
+	steps := make([]StepResult, 0, len(p.Steps))
+
+	for i, s := range p.Steps {
+		r := StepResult{Type: s.Type, UnitName: s.unitName(), Status: StatusPending}
+		if s.producesFile() {
+			r.OutputFilePath = filepath.Join(os.TempDir(), fmt.Sprintf("%s_%s_step%d", TempFilePrefix, taskID, i+1))
+		}
+
+		steps = append(steps, r)
+	}
+
+	return steps
+}
+
+// isPipelineTask checks if the task is processed by the pipeline.
+func (t Task) isPipelineTask() bool {
+	return len(t.Steps) > 0
+}
+
+// currentStep returns the index of the first step which is not completed.
+func (t Task) currentStep() int {
+	for i, s := range t.Steps {
+		if s.Status != StatusCompleted {
+			return i
+		}
+	}
+
+	return len(t.Steps)
+}
+
+// stepInput returns the file processed by the step, the latest file created by the previous steps or the input file.
+func (t Task) stepInput(step int) string {
+	for i := step - 1; i >= 0; i-- {
+		if t.Steps[i].OutputFilePath != "" {
+			return t.Steps[i].OutputFilePath
+		}
+	}
+
+	return t.InputFilePath
+}
+
+// currentInput returns the file the task is processed with.
+func (t Task) currentInput() string {
+	if !t.isPipelineTask() {
+		return t.InputFilePath
+	}
+
+	return t.stepInput(t.currentStep())
+}
+
+// processStep processes the current step of the pipeline task with the unit, the result of the last step is moved to the output file.
+func (q *Queue) processStep(task Task, job *Job, u *unit) (Task, error) {
+	q.mu.RLock()
+	p, exists := q.pipelines[job.Pipeline]
+	q.mu.RUnlock()
+
+	if !exists {
+		return task, errors.Errorf("pipeline %q doesn't exist anymore", job.Pipeline)
+	}
+
+	if len(p.Steps) != len(task.Steps) {
+		return task, errors.Errorf("pipeline %q was changed", job.Pipeline)
+	}
+
+	// copy the steps since the task shares them with the tasks map
+	task.Steps = append([]StepResult(nil), task.Steps...)
+
+	i := task.currentStep()
+	step := p.Steps[i]
+	input := task.stepInput(i)
+	output := task.Steps[i].OutputFilePath
+
+	task.Steps[i].Status = StatusPending
+	task.Steps[i].StartedAt = now()
+
+	var (
+		res signer.Result
+		err error
+	)
+
+	switch step.Type {
+	case StepSign:
+		signData := u.signData
+		if step.CertType != 0 {
+			signData.Signature.CertType = step.CertType
+		}
+
+		res, err = signTask(input, output, job.SignConfig, signData)
+	case StepTimestamp:
+		res, err = signer.TimestampFileResult(input, output, step.TSA)
+	case StepVerify:
+		task, err = q.verifyStep(task, input, job.VerifyConfig, step.Policy)
+	case StepDeliver:
+		err = copyFile(input, filepath.Join(step.Out, task.fileName()))
+	default:
+		err = errors.Errorf("unknown step type %q", step.Type)
+	}
+
+	// keep the result of the last step
+	if err == nil && i == len(task.Steps)-1 && task.OutputFilePath != "" {
+		err = copyFile(task.stepInput(len(task.Steps)), task.OutputFilePath)
+	}
+
+	task.Steps[i].FinishedAt = now()
+	task.Steps[i].Error = ""
+
+	if err != nil {
+		task.Steps[i].Error = err.Error()
+	} else {
+		task.addSignature(res)
+	}
+
+	return task, err
+}
+
+// verifyStep verifies the file by the verification unit and checks the result by the policy,
+// the verification data is added to the task.
+func (q *Queue) verifyStep(task Task, input string, verifyConfig JobVerifyConfig, policy VerifyPolicy) (Task, error) {
+	v := task
+	v.InputFilePath = input
+
+	v, err := q.verifyTaskCached(v, verifyConfig)
+	if err != nil {
+		return task, err
+	}
+
+	task.VerificationData = v.VerificationData
+	task.ChangeAnalysis = v.ChangeAnalysis
+	task.FromCache = v.FromCache
+
+	return task, policy.check(task.VerificationData, task.ChangeAnalysis)
+}
+
+// advancePipeline updates the current step of the pipeline task by the status of the processed task and returns the unit of the next step
+// if the step is completed and it's not the last one, the task stays pending until all the steps are completed.
+// The intermediate files are removed when the task is completed or failed, nil is returned for the tasks without pipeline.
+func (q *Queue) advancePipeline(task *Task) *unit {
+	i := task.currentStep()
+	if i == len(task.Steps) {
+		return nil
+	}
+
+	switch task.Status {
+	case StatusPending:
+		// the step is retried
+		return nil
+	case StatusCompleted:
+		task.Steps[i].Status = StatusCompleted
+	case StatusDeadLetter:
+		// keep the intermediate files to process the step again if the task is requeued
+		task.Steps[i].Status = StatusDeadLetter
+
+		return nil
+	default:
+		task.Steps[i].Status = task.Status
+		removeStepFiles(*task)
+
+		return nil
+	}
+
+	if i == len(task.Steps)-1 {
+		removeStepFiles(*task)
+
+		return nil
+	}
+
+	// pass the task to the unit of the next step
+	q.mu.RLock()
+	u, exists := q.units[task.Steps[i+1].UnitName]
+	q.mu.RUnlock()
+
+	// the next step is processed by the worker of the unit sharing the store
+	if !exists && q.shared != nil {
+		task.Status = StatusPending
+		task.UnitName = task.Steps[i+1].UnitName
+		task.FailedAttempts = 0
+
+		return nil
+	}
+
+	if !exists {
+		task.Status = StatusFailed
+		task.Error = errors.Errorf("unit %q of the step %d doesn't exist anymore", task.Steps[i+1].UnitName, i+2).Error()
+		task.Steps[i+1].Status = StatusFailed
+		task.Steps[i+1].Error = task.Error
+		removeStepFiles(*task)
+
+		return nil
+	}
+
+	task.Status = StatusPending
+	task.UnitName = u.name
+	task.FailedAttempts = 0
+
+	return u
+}
+
+// cancelledSteps returns the steps of the task with the steps which are not processed yet marked as cancelled.
+func (t Task) cancelledSteps() []StepResult {
+	if t.Steps == nil {
+		return nil
+	}
+
+	steps := make([]StepResult, len(t.Steps))
+
+	for i, s := range t.Steps {
+		if s.Status == StatusPending || s.Status == StatusDeadLetter {
+			s.Status = StatusCancelled
+		}
+
+		steps[i] = s
+	}
+
+	return steps
+}
+
+// fileName returns the name of the file delivered by the task, the name is prefixed with the id of the task,
+// so the files of the jobs with the same names don't overwrite each other, Ex. "bc5g4tl2m9sn837gm010_contract.pdf".
+func (t Task) fileName() string {
+	name := filepath.Base(t.OutputFilePath)
+	if t.OriginalFileName != "" {
+		name = filepath.Base(t.OriginalFileName)
+	}
+
+	return t.ID + "_" + name
+}
+
+// removeStepFiles removes the intermediate files of the pipeline.
+func removeStepFiles(task Task) {
+	for _, s := range task.Steps {
+		if s.OutputFilePath != "" {
+			_ = os.Remove(s.OutputFilePath)
+		}
+	}
+}
+
+// copyFile copies the file through the temporary file next to the destination, so the destination is never partially written.
+func copyFile(src, dst string) error {
+	in, err := os.Open(src)
+	if err != nil {
+		return err
+	}
+	defer func() { _ = in.Close() }()
+
+	out, err := os.CreateTemp(filepath.Dir(dst), "."+filepath.Base(dst)+".*.tmp")
+	if err != nil {
+		return err
+	}
+
+	// remove the temporary file if it's not renamed to the destination
+	defer func() {
+		_ = out.Close()
+		_ = os.Remove(out.Name())
+	}()
+
+	_, err = io.Copy(out, in)
+	if err != nil {
+		return err
+	}
+
+	err = out.Chmod(0o644)
+	if err != nil {
+		return err
+	}
+
+	err = out.Close()
+	if err != nil {
+		return err
+	}
+
+	return os.Rename(out.Name(), dst)
+}
@@ -0,0 +1,203 @@
+package queue
+
+import (
+	"crypto"
+	"encoding/asn1"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/digitorus/pdfsign/sign"
+	"github.com/digitorus/pdfsigner/license"
+	"github.com/digitorus/pdfsigner/queues/priority_queue"
+	"github.com/digitorus/pdfsigner/signer"
+	"github.com/digitorus/timestamp"
+	"github.com/sirupsen/logrus"
+	"github.com/stretchr/testify/assert"
+)
+
+// newTestTSA creates Time Stamping Authority signing the timestamps with the test certificate.
+func newTestTSA(t *testing.T, d signer.SignData) *httptest.Server {
+	return httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		body, err := io.ReadAll(r.Body)
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+
+			return
+		}
+
+		req, err := timestamp.ParseRequest(body)
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+
+			return
+		}
+
+		ts := timestamp.Timestamp{
+			HashAlgorithm:     req.HashAlgorithm,
+			HashedMessage:     req.HashedMessage,
+			Time:              time.Now(),
+			Nonce:             req.Nonce,
+			Policy:            asn1.ObjectIdentifier{2, 4, 5, 6},
+			AddTSACertificate: req.Certificates,
+		}
+
+		resp, err := ts.CreateResponseWithOpts(d.Certificate, d.Signer, crypto.SHA256)
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+
+			return
+		}
+
+		w.Header().Set("Content-Type", "application/timestamp-reply")
+		_, _ = w.Write(resp)
+	}))
+}
+
+func TestPipeline(t *testing.T) {
+	logrus.SetOutput(io.Discard)
+
+	err := license.Initialize([]byte(license.TestLicense))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	d := signer.SignData{
+		Signature: sign.SignDataSignature{
+			CertType:   sign.CertificationSignature,
+			DocMDPPerm: sign.AllowFillingExistingFormFieldsAndSignaturesPerms,
+		},
+	}
+	d.SetPEM("../../testfiles/test.crt", "../../testfiles/test.pem", "")
+
+	tsa := newTestTSA(t, d)
+	defer tsa.Close()
+
+	qs := NewQueue()
+	qs.AddSignUnit("author", d)
+	qs.AddSignUnit("approver", d)
+	qs.AddVerifyUnit()
+
+	out := t.TempDir()
+	delivered := t.TempDir()
+
+	// the units of the steps should exist
+	assert.Error(t, qs.AddPipeline(Pipeline{Name: "wrong", Steps: []PipelineStep{{Type: StepSign, Signer: "unknown"}}}))
+	assert.Error(t, qs.AddPipeline(Pipeline{Name: "wrong", Steps: []PipelineStep{{Type: StepDeliver}}}))
+	assert.Error(t, qs.AddPipeline(Pipeline{Name: "wrong", Steps: []PipelineStep{{Type: "print"}}}))
+	assert.Error(t, qs.AddPipeline(Pipeline{Name: "empty"}))
+
+	assert.NoError(t, qs.AddPipeline(Pipeline{
+		Name: "approve",
+		Steps: []PipelineStep{
+			{Type: StepSign, Signer: "author"},
+			{Type: StepSign, Signer: "approver", CertType: sign.ApprovalSignature},
+			{Type: StepVerify, Policy: VerifyPolicy{Name: "two", MinSignatures: 2}},
+			{Type: StepTimestamp, TSA: sign.TSA{URL: tsa.URL}},
+			{Type: StepDeliver, Out: delivered},
+		},
+	}))
+
+	assert.NoError(t, qs.AddPipeline(Pipeline{
+		Name: "strict",
+		Steps: []PipelineStep{
+			{Type: StepSign, Signer: "author"},
+			{Type: StepVerify, Policy: VerifyPolicy{Name: "four", MinSignatures: 4}},
+			{Type: StepDeliver, Out: delivered},
+		},
+	}))
+
+	_, err = qs.AddPipelineJob("unknown", JobSignConfig{})
+	assert.Error(t, err)
+
+	jobID, err := qs.AddPipelineJob("approve", JobSignConfig{})
+	assert.NoError(t, err)
+
+	// the unit name is ignored, the task is queued to the unit of the first step
+	taskID, err := qs.AddTask("", jobID, "contract.pdf", "../../testfiles/testfile12.pdf", filepath.Join(out, "contract_signed.pdf"), priority_queue.HighPriority)
+	assert.NoError(t, err)
+
+	failedJobID, err := qs.AddPipelineJob("strict", JobSignConfig{})
+	assert.NoError(t, err)
+
+	failedTaskID, err := qs.AddTask("", failedJobID, "draft.pdf", "../../testfiles/testfile12.pdf", filepath.Join(out, "draft_signed.pdf"), priority_queue.HighPriority)
+	assert.NoError(t, err)
+
+	// process the steps by the units
+	for _, unitName := range []string{"author", "author", "approver", VerificationUnitName, VerificationUnitName, VerificationUnitName, VerificationUnitName} {
+		assert.NoError(t, qs.processNextTask(unitName))
+	}
+
+	job, err := qs.GetJobByID(jobID)
+	assert.NoError(t, err)
+	assert.True(t, job.IsCompleted())
+
+	task := job.TasksMap[taskID]
+	assert.Equal(t, StatusCompleted, task.Status, task.Error)
+
+	if assert.Len(t, task.Steps, 5) {
+		for _, s := range task.Steps {
+			assert.Equal(t, StatusCompleted, s.Status, s.Error)
+			assert.False(t, s.FinishedAt.Before(s.StartedAt))
+
+			// the intermediate files are removed
+			if s.OutputFilePath != "" {
+				assert.NoFileExists(t, s.OutputFilePath)
+			}
+		}
+
+		assert.Equal(t, "approver", task.Steps[1].UnitName)
+	}
+
+	// the signatures of both signers are verified
+	if assert.NotNil(t, task.VerificationData) {
+		assert.Len(t, task.VerificationData.Signers, 2)
+	}
+
+	// the document timestamp is added after the verification
+	signed, err := os.ReadFile(filepath.Join(out, "contract_signed.pdf"))
+	assert.NoError(t, err)
+	assert.Contains(t, string(signed), "/ETSI.RFC3161")
+
+	assert.FileExists(t, filepath.Join(out, "contract_signed.pdf"))
+	assert.FileExists(t, filepath.Join(delivered, taskID+"_contract.pdf"))
+
+	// the files of the tasks with the same names are delivered separately
+	assert.NotEqual(t, Task{ID: "task1", OriginalFileName: "contract.pdf"}.fileName(), Task{ID: "task2", OriginalFileName: "contract.pdf"}.fileName())
+
+	// the file not meeting the policy is not delivered
+	job, err = qs.GetJobByID(failedJobID)
+	assert.NoError(t, err)
+
+	task = job.TasksMap[failedTaskID]
+	assert.Equal(t, StatusFailed, task.Status)
+	assert.Contains(t, task.Error, "policy check")
+
+	if assert.Len(t, task.Steps, 3) {
+		assert.Equal(t, StatusCompleted, task.Steps[0].Status)
+		assert.Equal(t, StatusFailed, task.Steps[1].Status)
+		assert.Equal(t, StatusPending, task.Steps[2].Status)
+		assert.NoFileExists(t, task.Steps[0].OutputFilePath)
+	}
+
+	assert.NoFileExists(t, filepath.Join(out, "draft_signed.pdf"))
+	assert.NoFileExists(t, filepath.Join(delivered, failedTaskID+"_draft.pdf"))
+
+	// the steps are persisted
+	assert.NoError(t, qs.SaveToDB(jobID))
+
+	loaded := NewQueue()
+	assert.NoError(t, loaded.LoadFromDB())
+
+	loadedJob, err := loaded.GetJobByID(jobID)
+	assert.NoError(t, err)
+	assert.Equal(t, "approve", loadedJob.Pipeline)
+	assert.Equal(t, job.TasksMap[failedTaskID].Steps, task.Steps)
+	assert.Len(t, loadedJob.TasksMap[taskID].Steps, 5)
+
+	_ = os.Remove(filepath.Join(out, "contract_signed.pdf"))
+}
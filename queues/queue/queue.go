@@ -1,17 +1,18 @@
 package queue
 
 import (
-	"encoding/json"
+	"context"
 	"fmt"
 	"os"
 	"strings"
 	"sync"
 	"sync/atomic"
+	"time"
 
 	"github.com/digitorus/pdfsign/sign"
 	"github.com/digitorus/pdfsign/verify"
-	"github.com/digitorus/pdfsigner/db"
 	"github.com/digitorus/pdfsigner/queues/priority_queue"
+	"github.com/digitorus/pdfsigner/revision"
 	"github.com/digitorus/pdfsigner/signer"
 	"github.com/google/uuid"
 	"github.com/pkg/errors"
@@ -34,6 +35,52 @@ type Queue struct {
 	units map[string]*unit // units represent all the units by name of the signer
 	jobs  map[string]*Job  // jobs represents jobs by id of the job
 	mu    sync.RWMutex
+	// unitAliases represents the units by the names their tasks were saved with before the units were renamed
+	unitAliases map[string]string
+	// updated is closed and replaced every time a task is processed
+	updated chan struct{}
+	// verifyCache represents settings of the verification results cache
+	verifyCache VerifyCacheConfig
+	// loadedJobs represents ids of the jobs loaded from the db which pending tasks should be queued again
+	loadedJobs []string
+	// capacity represents maximum number of the queued tasks of every unit, the queues are unbounded if it's 0
+	capacity int
+	// aging represents waiting time which raises the priority of the queued task by one level
+	aging time.Duration
+	// tenants represents the shares of the units used by the tenants by name
+	tenants map[string]priority_queue.TenantPolicy
+	// processing represents ids of the tasks being processed
+	processing map[string]struct{}
+	// retention represents how long the processed jobs and their files are kept
+	retention RetentionPolicy
+	// subscribers represents handlers of the published events
+	subscribers []subscriber
+	// lastSubscriberID represents id of the last added subscriber
+	lastSubscriberID uint64
+	// stopCtx is done when the workers should stop taking the tasks
+	stopCtx context.Context
+	// stopWorkers stops the workers taking the tasks
+	stopWorkers context.CancelFunc
+	// workers represents running workers
+	workers sync.WaitGroup
+	// abandoned is set when the shutdown timed out, the results of the tasks still being processed are discarded
+	abandoned bool
+	// saving represents the workers saving the results of the tasks
+	saving sync.WaitGroup
+	// scheduled represents the tasks waiting for the not before time
+	scheduled scheduledHeap
+	// scheduleWake wakes up the scheduler when the task is scheduled
+	scheduleWake chan struct{}
+	// pipelines represents the pipelines the jobs could be processed with by name
+	pipelines map[string]Pipeline
+	// idempotencyWindow represents how long the idempotency keys are mapped to the jobs
+	idempotencyWindow time.Duration
+	// deduplicate represents if the files with the same content are processed once per job
+	deduplicate bool
+	// store represents the storage of the jobs and the tasks
+	store Store
+	// shared represents the state of the queue sharing the store with other nodes, nil if the store is not shared
+	shared *sharedQueue
 }
 
 // unit represents queue unit which could be a signer or verifier.
@@ -46,6 +93,14 @@ type unit struct {
 	isSigningUnit bool
 	// signData represents sign data and it's used for signing unit
 	signData signer.SignData
+	// workers represents the number of the tasks processed concurrently
+	workers int
+	// stats represents processing statistics of the unit
+	stats unitStats
+	// retryPolicy represents retry settings of the failed tasks
+	retryPolicy RetryPolicy
+	// ownCapacity represents if the capacity of the unit is set for the unit instead of the queue
+	ownCapacity bool
 }
 
 // Job represents a job for sign queue, stores tasks and sign data to override units initial sign data.
@@ -58,6 +113,54 @@ type Job struct {
 	TotalProcesedTasks uint32 `json:"total_proceeds_tasks"`
 	// JobSignConfig represents additional sign data added by request to override signer initial sign data
 	SignConfig JobSignConfig `json:"sign_data"`
+	// VerifyConfig represents verification options added by request
+	VerifyConfig JobVerifyConfig `json:"verify_config"`
+	// Webhooks represents urls notified when the tasks of the job are processed
+	Webhooks []string `json:"webhooks,omitempty"`
+	// Type represents the type of the job, sign or verify
+	Type string `json:"type,omitempty"`
+	// Client represents the name of the web api client added the job, optional
+	Client string `json:"client,omitempty"`
+	// Pipeline represents the name of the pipeline the tasks are processed with, optional
+	Pipeline string `json:"pipeline,omitempty"`
+	// CreatedAt represents time the job was created
+	CreatedAt time.Time `json:"created_at"`
+	// CompletedAt represents time all the tasks of the job were processed
+	CompletedAt time.Time `json:"completed_at"`
+}
+
+const (
+	// JobTypeSign represents the job signing the files.
+	JobTypeSign = "sign"
+	// JobTypeVerify represents the job verifying the files.
+	JobTypeVerify = "verify"
+)
+
+// copy returns a copy of the job with it's own tasks map, so it could be used while the tasks are processed.
+func (j *Job) copy() Job {
+	c := *j
+	c.TasksMap = make(map[string]Task, len(j.TasksMap))
+
+	for id, t := range j.TasksMap {
+		c.TasksMap[id] = t
+	}
+
+	return c
+}
+
+// IsCompleted checks if all the tasks of the job are processed.
+func (j *Job) IsCompleted() bool {
+	return len(j.TasksMap) > 0 && len(j.TasksMap) == int(atomic.LoadUint32(&j.TotalProcesedTasks))
+}
+
+// updateCompletedAt sets the completion time when the job gets completed and resets it if the job is processed again.
+func (j *Job) updateCompletedAt() {
+	switch {
+	case !j.IsCompleted():
+		j.CompletedAt = time.Time{}
+	case j.CompletedAt.IsZero():
+		j.CompletedAt = now()
+	}
 }
 
 type JobSignConfig struct {
@@ -73,6 +176,12 @@ type JobSignConfig struct {
 	ValidateSignature bool `json:"verify_after_sign"`
 }
 
+// JobVerifyConfig represents verification options of the job.
+type JobVerifyConfig struct {
+	// ForceRefresh allows to skip cached verification results
+	ForceRefresh bool `json:"force_refresh"`
+}
+
 // Task represents a single unit of work(file).
 type Task struct {
 	// ID represents id of the task
@@ -85,24 +194,75 @@ type Task struct {
 	InputFilePath string `json:"input_file_path"`
 	// OutputFilePath represents path to the processed file
 	OutputFilePath string `json:"output_file_path"`
+	// UnitName represents the name of the unit processing the task
+	UnitName string `json:"unit_name"`
+	// Priority represents priority of the task in the unit queue
+	Priority priority_queue.Priority `json:"priority"`
+	// Deadline represents time the task should be processed before, optional
+	Deadline time.Time `json:"deadline"`
+	// DeadlineMissed represents if the task was processed after the deadline
+	DeadlineMissed bool `json:"deadline_missed,omitempty"`
+	// NotBefore represents time the task is queued at, the task is scheduled until then, optional
+	NotBefore time.Time `json:"not_before"`
 	// Status represents the status of the task. Pending, Failed, Completed.
 	Status string `json:"status"`
 	// VerificationData represents data of the verification
 	VerificationData *verify.Response `json:"verification_data,omitempty"`
+	// ChangeAnalysis represents modifications made after signing and if they're permitted
+	ChangeAnalysis *revision.Analysis `json:"change_analysis,omitempty"`
+	// FromCache represents if the verification result was loaded from the cache
+	FromCache bool `json:"from_cache,omitempty"`
+	// Attempts represents history of the attempts to process the task
+	Attempts []Attempt `json:"attempts,omitempty"`
+	// FailedAttempts represents failed attempts since the task was queued, used by the retry policy
+	FailedAttempts int `json:"failed_attempts,omitempty"`
+	// QueuedAt represents time the task was added to the job
+	QueuedAt time.Time `json:"queued_at"`
+	// StartedAt represents time the first attempt to process the task started
+	StartedAt time.Time `json:"started_at"`
+	// FinishedAt represents time the task got the final status
+	FinishedAt time.Time `json:"finished_at"`
+	// Duration represents processing time of all the attempts
+	Duration time.Duration `json:"duration"`
+	// InputSHA256 represents hex encoded SHA-256 of the input file
+	InputSHA256 string `json:"input_sha256,omitempty"`
+	// OutputSHA256 represents hex encoded SHA-256 of the processed file
+	OutputSHA256 string `json:"output_sha256,omitempty"`
+	// OutputSize represents size of the processed file in bytes
+	OutputSize int64 `json:"output_size,omitempty"`
+	// CertificateFingerprint represents hex encoded SHA-256 of the certificate the file was signed with
+	CertificateFingerprint string `json:"certificate_fingerprint,omitempty"`
+	// SigningTime represents time written into the signature
+	SigningTime time.Time `json:"signing_time"`
+	// TimestampTime represents time of the timestamp of the TSA if the signature contains it
+	TimestampTime time.Time `json:"timestamp_time"`
+	// DownloadedAt represents time the signed file was downloaded last time
+	DownloadedAt time.Time `json:"downloaded_at"`
+	// Temporary represents if the input and output files are temporary and removed with the task
+	Temporary bool `json:"temporary,omitempty"`
+	// ContentHash represents hex encoded SHA-256 of the input file if the deduplication is enabled
+	ContentHash string `json:"content_hash,omitempty"`
+	// DuplicateOf represents id of the task of the job with the same content which result is reused
+	DuplicateOf string `json:"duplicate_of,omitempty"`
+	// Steps represents the status of the steps of the pipeline processing the task
+	Steps []StepResult `json:"steps,omitempty"`
 	// Error represents error if the task failed
 	Error string `json:"error,omitempty"`
 }
 
+// MissedDeadline checks if the task was processed after the deadline or it's still pending when the deadline passed.
+func (t Task) MissedDeadline() bool {
+	if t.DeadlineMissed {
+		return true
+	}
+
+	return (t.Status == StatusPending || t.Status == StatusScheduled) && !t.Deadline.IsZero() && time.Now().After(t.Deadline)
+}
+
 // and only tasks with specific status if status is provided.
 func (j *Job) GetTasks(status string) ([]Task, error) {
-	// determine status to search with
-	switch status {
-	case StatusCompleted:
-	case StatusFailed:
-	case StatusPending:
-	case "":
-	default:
-		// fail if the status is not in the list
+	// fail if the status is not in the list
+	if status != "" && !ValidStatus(status) {
 		return []Task{}, errors.New("status is not correct")
 	}
 
@@ -118,41 +278,66 @@ func (j *Job) GetTasks(status string) ([]Task, error) {
 	return tasks, nil
 }
 
+// ValidStatus checks if the status is one of the statuses of the tasks.
+func ValidStatus(status string) bool {
+	switch status {
+	case StatusCompleted, StatusFailed, StatusPending, StatusDeadLetter, StatusCancelled, StatusScheduled:
+		return true
+	}
+
+	return false
+}
+
 // NewQueue creates new sign queue.
 func NewQueue() *Queue {
+	stopCtx, stopWorkers := context.WithCancel(context.Background())
+
 	return &Queue{
-		units: make(map[string]*unit, 1),
-		jobs:  make(map[string]*Job, 1),
+		units:        make(map[string]*unit, 1),
+		unitAliases:  make(map[string]string),
+		jobs:         make(map[string]*Job, 1),
+		updated:      make(chan struct{}),
+		processing:   make(map[string]struct{}),
+		stopCtx:      stopCtx,
+		stopWorkers:  stopWorkers,
+		scheduleWake: make(chan struct{}, 1),
+		pipelines:    make(map[string]Pipeline),
+		tenants:      make(map[string]priority_queue.TenantPolicy),
+		store:        NewBoltStore(),
 	}
 }
 
-// addUnit adds unit to units map.
+// addUnit adds unit to units map, returns the existing unit if it's already added. The lock should be held.
 func (q *Queue) addUnit(unitName string) *unit {
 	// skip if already setup
-	q.mu.RLock()
-	if _, exists := q.units[unitName]; exists {
-		q.mu.RUnlock()
-
-		return nil
+	if u, exists := q.units[unitName]; exists {
+		return u
 	}
-	q.mu.RUnlock()
 
 	// create signer
 	u := unit{
-		name: unitName,
-		pq:   priority_queue.New(10),
+		name:    unitName,
+		pq:      priority_queue.New(q.capacity),
+		workers: 1,
+	}
+	u.pq.SetAging(q.aging)
+
+	for name, p := range q.tenants {
+		u.pq.SetTenantPolicy(name, p)
 	}
 
 	// assign signer to units map
-	q.mu.Lock()
 	q.units[unitName] = &u
-	q.mu.Unlock()
 
 	return &u
 }
 
-// AddSignUnit adds signer unit to units map.
+// AddSignUnit adds signer unit to units map, the sign data of the existing unit is replaced.
+// Several units could use the same sign data, Ex. the services sharing the signer, every unit has own queue, workers and statistics.
 func (q *Queue) AddSignUnit(unitName string, signData signer.SignData) {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+
 	u := q.addUnit(unitName)
 	// set sign data if provided
 	u.signData = signData
@@ -161,18 +346,168 @@ func (q *Queue) AddSignUnit(unitName string, signData signer.SignData) {
 
 // AddVerifyUnit adds verify unit to units map.
 func (q *Queue) AddVerifyUnit() {
+	q.mu.Lock()
 	q.addUnit(VerificationUnitName)
+	q.mu.Unlock()
+}
+
+// SetUnitAlias sets the name the tasks of the unit were saved with before the unit was renamed,
+// Ex. the signer used by the service. The tasks saved with the alias are processed by the unit if there is no unit with the alias name,
+// the first unit keeps the alias if several units are renamed from the same name.
+func (q *Queue) SetUnitAlias(alias, unitName string) error {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+
+	if _, exists := q.units[unitName]; !exists {
+		return errors.New("unit is not in map")
+	}
+
+	if _, exists := q.unitAliases[alias]; !exists {
+		q.unitAliases[alias] = unitName
+	}
+
+	return nil
+}
+
+// getUnit returns the unit by name or by the alias of the unit if there is no unit with the name. The lock should be held.
+func (q *Queue) getUnit(unitName string) (*unit, bool) {
+	if u, exists := q.units[unitName]; exists {
+		return u, true
+	}
+
+	u, exists := q.units[q.unitAliases[unitName]]
+
+	return u, exists
+}
+
+// unitNames returns the name of the unit and the aliases of the unit which are not the names of other units.
+func (q *Queue) unitNames(unitName string) []string {
+	q.mu.RLock()
+	defer q.mu.RUnlock()
+
+	names := []string{unitName}
+
+	for alias, name := range q.unitAliases {
+		if _, exists := q.units[alias]; name == unitName && !exists {
+			names = append(names, alias)
+		}
+	}
+
+	return names
+}
+
+// SetUnitWorkers sets the number of the tasks processed concurrently by the unit.
+func (q *Queue) SetUnitWorkers(unitName string, workers int) error {
+	if workers < 1 {
+		return errors.New("workers should be at least 1")
+	}
+
+	q.mu.Lock()
+	defer q.mu.Unlock()
+
+	// check if the unit is in the map
+	u, exists := q.units[unitName]
+	if !exists {
+		return errors.New("unit is not in map")
+	}
+
+	u.workers = workers
+
+	return nil
+}
+
+// SetCapacity sets maximum number of the queued tasks of every unit, the queues are unbounded if it's 0.
+// Tasks added to the full queue are rejected with priority_queue.ErrFull.
+func (q *Queue) SetCapacity(capacity int) error {
+	if capacity < 0 {
+		return errors.New("capacity should be positive")
+	}
+
+	q.mu.Lock()
+	defer q.mu.Unlock()
+
+	q.capacity = capacity
+	for _, u := range q.units {
+		if !u.ownCapacity {
+			u.pq.SetCapacity(capacity)
+		}
+	}
+
+	return nil
+}
+
+// SetUnitCapacity sets maximum number of the queued tasks of the unit instead of the capacity of the queue, the queue of the unit is unbounded if it's 0.
+func (q *Queue) SetUnitCapacity(unitName string, capacity int) error {
+	if capacity < 0 {
+		return errors.New("capacity should be positive")
+	}
+
+	q.mu.Lock()
+	defer q.mu.Unlock()
+
+	// check if the unit is in the map
+	u, exists := q.units[unitName]
+	if !exists {
+		return errors.New("unit is not in map")
+	}
+
+	u.ownCapacity = true
+	u.pq.SetCapacity(capacity)
+
+	return nil
+}
+
+// SetAging sets waiting time which raises the priority of the queued task by one level,
+// so low priority tasks are not starving while higher priority tasks keep coming. Aging is disabled if it's 0.
+func (q *Queue) SetAging(aging time.Duration) error {
+	if aging < 0 {
+		return errors.New("aging should be positive")
+	}
+
+	q.mu.Lock()
+	defer q.mu.Unlock()
+
+	q.aging = aging
+	for _, u := range q.units {
+		u.pq.SetAging(aging)
+	}
+
+	return nil
+}
+
+// SetTenantPolicy sets the weight and the maximum number of the tasks being processed of the tenant by every unit.
+// The tasks of the tenants with the same priority are taken by the weights of the tenants, the tenant of the job is the web api client added the job.
+func (q *Queue) SetTenantPolicy(tenant string, p priority_queue.TenantPolicy) error {
+	if p.Weight < 0 {
+		return errors.New("weight should be positive")
+	}
+
+	if p.MaxInFlight < 0 {
+		return errors.New("max in flight should be positive")
+	}
+
+	q.mu.Lock()
+	defer q.mu.Unlock()
+
+	q.tenants[tenant] = p
+	for _, u := range q.units {
+		u.pq.SetTenantPolicy(tenant, p)
+	}
+
+	return nil
 }
 
 // addJob adds job to the jobs map.
-func (q *Queue) addJob() *Job {
+func (q *Queue) addJob(jobType string) *Job {
 	// generate unique id
 	id := generateID()
 
 	// create job
 	j := Job{
-		ID:       id,
-		TasksMap: make(map[string]Task, 1),
+		ID:        id,
+		Type:      jobType,
+		TasksMap:  make(map[string]Task, 1),
+		CreatedAt: now(),
 	}
 
 	// add job to the jobs map
@@ -185,52 +520,114 @@ func (q *Queue) addJob() *Job {
 
 // AddSignJob adds sign job to the jobs map.
 func (q *Queue) AddSignJob(signConfig JobSignConfig) string {
-	j := q.addJob()
+	j := q.addJob(JobTypeSign)
+
+	q.mu.Lock()
 	j.SignConfig = signConfig
+	q.mu.Unlock()
 
 	return j.ID
 }
 
-// AddVerifyJob adds sign job to the jobs map.
-func (q *Queue) AddVerifyJob() string {
-	j := q.addJob()
+// SetJobWebhooks sets urls notified when the tasks of the job are processed.
+func (q *Queue) SetJobWebhooks(jobID string, urls []string) error {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+
+	job, err := q.loadJob(jobID)
+	if err != nil {
+		return err
+	}
+
+	job.Webhooks = urls
+
+	return nil
+}
+
+// SetJobClient sets the name of the web api client added the job.
+func (q *Queue) SetJobClient(jobID, client string) error {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+
+	job, err := q.loadJob(jobID)
+	if err != nil {
+		return err
+	}
+
+	job.Client = client
+
+	return nil
+}
+
+// AddVerifyJob adds verify job to the jobs map.
+func (q *Queue) AddVerifyJob(verifyConfig JobVerifyConfig) string {
+	j := q.addJob(JobTypeVerify)
+
+	q.mu.Lock()
+	j.VerifyConfig = verifyConfig
+	q.mu.Unlock()
 
 	return j.ID
 }
 
-// DeleteJob deletes job from the jobs and database.
+// DeleteJob cancels pending tasks of the job and deletes job from the jobs and database, the temporary files of the tasks are removed.
 func (q *Queue) DeleteJob(jobID string) error {
-	err := q.DeleteFromDB(jobID)
+	err := q.CancelJob(jobID)
 	if err != nil {
 		return err
 	}
 
+	// the cancelled job could be released from the queue
 	q.mu.Lock()
+	job, err := q.loadJob(jobID)
+	if err != nil {
+		q.mu.Unlock()
+
+		return err
+	}
+
 	delete(q.jobs, jobID)
+
+	// the files of the tasks being processed are removed when they're done
+	var tasks []Task
+
+	for _, t := range job.TasksMap {
+		if _, processing := q.processing[t.ID]; !processing {
+			tasks = append(tasks, t)
+		}
+	}
 	q.mu.Unlock()
 
+	err = q.DeleteFromDB(jobID)
+	if err != nil {
+		return err
+	}
+
+	for _, t := range tasks {
+		removeTaskFiles(t)
+	}
+
 	return nil
 }
 
 // AddTask adds task to the specific job by job id.
 func (q *Queue) AddTask(unitName, jobID, originalFileName, inputFilePath, outputFilePath string, priority priority_queue.Priority) (string, error) {
-	q.mu.RLock()
-
-	// check if the unit is in the map
-	if _, exists := q.units[unitName]; !exists {
-		q.mu.RUnlock()
+	return q.AddScheduledTask(unitName, jobID, originalFileName, inputFilePath, outputFilePath, priority, time.Time{})
+}
 
-		return "", errors.New("unit is not in map")
-	}
-	// check if the job is in the map
-	if _, exists := q.jobs[jobID]; !exists {
-		q.mu.RUnlock()
+// AddScheduledTask adds task to the specific job by job id, the task is scheduled until the not before time.
+// The tasks of the pipeline jobs are added to the unit of the first step of the pipeline.
+func (q *Queue) AddScheduledTask(unitName, jobID, originalFileName, inputFilePath, outputFilePath string, priority priority_queue.Priority, notBefore time.Time) (string, error) {
+	// check if the job and the unit are in the map
+	q.mu.Lock()
+	unitName, err := q.taskUnitName(jobID, unitName)
+	q.mu.Unlock()
 
-		return "", errors.New("job doesn't exists")
+	if err != nil {
+		return "", err
 	}
-	q.mu.RUnlock()
 
-	task, err := q.addTask(unitName, jobID, originalFileName, inputFilePath, outputFilePath, priority)
+	task, err := q.addTask(unitName, jobID, originalFileName, inputFilePath, outputFilePath, priority, notBefore)
 	if err != nil {
 		return "", err
 	}
@@ -238,67 +635,144 @@ func (q *Queue) AddTask(unitName, jobID, originalFileName, inputFilePath, output
 	return task.ID, nil
 }
 
-func (q *Queue) addTask(unitName, jobID, originalFileName, inputFilePath, outputFilePath string, priority priority_queue.Priority) (Task, error) {
-	// generate unique task id
-	id := generateID()
+func (q *Queue) addTask(unitName, jobID, originalFileName, inputFilePath, outputFilePath string, priority priority_queue.Priority, notBefore time.Time) (Task, error) {
+	t := newTask(unitName, jobID, originalFileName, inputFilePath, outputFilePath, priority)
+	t.NotBefore = notBefore
 
-	// create task
-	t := Task{
-		ID:               id,
+	err := q.addTasks(unitName, jobID, []Task{t})
+	if err != nil {
+		return Task{}, err
+	}
+
+	return t, nil
+}
+
+// newTask creates pending task.
+func newTask(unitName, jobID, originalFileName, inputFilePath, outputFilePath string, priority priority_queue.Priority) Task {
+	return Task{
+		ID:               generateID(),
 		InputFilePath:    inputFilePath,
 		OutputFilePath:   outputFilePath,
 		JobID:            jobID,
 		Status:           StatusPending,
 		OriginalFileName: originalFileName,
+		UnitName:         unitName,
+		Priority:         priority,
+		QueuedAt:         now(),
 	}
+}
 
-	// create queue item
-	i := priority_queue.Item{
-		Value:    t,
-		Priority: priority,
+// addTasks adds all the tasks to the job and the queue of the unit or none of them if the queue is full,
+// the tasks with the not before time in the future are scheduled instead of queued.
+func (q *Queue) addTasks(unitName, jobID string, tasks []Task) error {
+	// hash the files to find the duplicates
+	err := q.hashTasks(jobID, tasks)
+	if err != nil {
+		return err
 	}
 
-	// add task to tasks map
+	// create queue items
+	items := make([]priority_queue.Item, 0, len(tasks))
+
+	// add tasks to tasks map before they could be processed
 	q.mu.Lock()
-	q.jobs[jobID].TasksMap[t.ID] = t
 
-	// add item to queue
-	q.units[unitName].pq.Push(i)
-	q.mu.Unlock()
+	job, err := q.loadJob(jobID)
+	if err != nil {
+		q.mu.Unlock()
 
-	return t, nil
-}
+		return err
+	}
 
-func (q *Queue) AddBatchPersistentTasks(unitName, jobID string, fileNames map[string]string, priority priority_queue.Priority) error {
-	// check if the unit is in the map
-	q.mu.RLock()
-	if _, exists := q.units[unitName]; !exists {
-		q.mu.RUnlock()
+	taskIDs := make([]string, 0, len(tasks))
 
-		return errors.New("unit is not in map")
-	}
-	// check if the job is in the map
-	_, exists := q.jobs[jobID]
-	if !exists {
-		q.mu.RUnlock()
+	for i, t := range tasks {
+		taskIDs = append(taskIDs, t.ID)
+
+		// track the steps of the pipeline
+		if p, exists := q.pipelines[job.Pipeline]; exists {
+			t.Steps = p.newStepResults(t.ID)
+			tasks[i] = t
+		}
+
+		// the duplicate isn't queued, it gets the result of the task with the same content
+		if originalID := job.originalTaskID(t); originalID != "" {
+			t.DuplicateOf = originalID
+			tasks[i] = t
+			job.TasksMap[t.ID] = t
+
+			continue
+		}
+
+		if t.isScheduled() {
+			t.Status = StatusScheduled
+			job.TasksMap[t.ID] = t
+
+			// the scheduled tasks of the shared store are claimed by the workers when they're due
+			if q.shared == nil {
+				q.schedule(t)
+			}
+
+			continue
+		}
+
+		job.TasksMap[t.ID] = t
 
-		return errors.New("job doesn't exists")
+		// the tasks of the shared store are claimed by the workers
+		if q.shared == nil {
+			items = append(items, taskItem(job, t))
+		}
 	}
-	q.mu.RUnlock()
 
-	for tempFileName, originalFileName := range fileNames {
-		_, err := q.addTask(unitName, jobID, originalFileName, tempFileName, tempFileName+"_signed", priority)
+	job.updateCompletedAt()
+
+	u := q.units[unitName]
+	q.mu.Unlock()
+
+	// add items to queue
+	if len(items) > 0 {
+		err = u.pq.PushBatch(items)
 		if err != nil {
-			return err
+			// remove rejected tasks
+			q.mu.Lock()
+			for _, t := range tasks {
+				delete(job.TasksMap, t.ID)
+			}
+			job.updateCompletedAt()
+			q.mu.Unlock()
+
+			return errors.Wrapf(err, "queue %s", unitName)
 		}
 	}
 
-	err := q.SaveToDB(jobID)
+	// save the tasks before they're processed, so they're not lost if the application crashes
+	return q.saveTasks(jobID, taskIDs...)
+}
+
+// AddBatchPersistentTasks adds all the temporary files as the tasks of the job with the priority, optional deadline
+// and optional not before time, the tasks are saved to the store.
+// The tasks of the pipeline jobs are added to the unit of the first step of the pipeline.
+func (q *Queue) AddBatchPersistentTasks(unitName, jobID string, fileNames map[string]string, priority priority_queue.Priority, deadline, notBefore time.Time) error {
+	// check if the job and the unit are in the map
+	q.mu.Lock()
+	unitName, err := q.taskUnitName(jobID, unitName)
+	q.mu.Unlock()
+
 	if err != nil {
 		return err
 	}
 
-	return nil
+	tasks := make([]Task, 0, len(fileNames))
+	for tempFileName, originalFileName := range fileNames {
+		t := newTask(unitName, jobID, originalFileName, tempFileName, tempFileName+"_signed", priority)
+		t.Deadline = deadline
+		t.NotBefore = notBefore
+		t.Temporary = true
+		tasks = append(tasks, t)
+	}
+
+	// add all the tasks or reject the batch
+	return q.addTasks(unitName, jobID, tasks)
 }
 
 // processNextTask signs task available for signing.
@@ -315,91 +789,297 @@ func (q *Queue) processNextTask(unitName string) error {
 
 	// get queue
 	queue := q.units[unitName]
+	retryPolicy := unit.retryPolicy
 	q.mu.RUnlock()
 
-	// get item
-	item := queue.pq.Pop()
+	// get item, stop waiting when the workers are stopped
+	item, err := queue.pq.PopContext(q.stopCtx)
+	if err != nil {
+		return err
+	}
+
+	// the next task of the tenant could be taken when the task is finished
+	defer queue.pq.Done(item)
+
 	task := item.Value.(Task)
 
-	// get job
-	q.mu.RLock()
+	// check the lease before the task is processed, the task could be cancelled or claimed by another worker
+	if q.shared != nil {
+		err := q.renewLeases(task.ID)
+		if err != nil {
+			log.WithField("taskID", task.ID).Warnf("Couldn't check lease: %s", err)
+		}
+	}
+
+	// get job, skip the task if it was cancelled or the job was deleted
+	q.mu.Lock()
 
 	job, exists := q.jobs[task.JobID]
-	if !exists {
-		q.mu.RUnlock()
+	if !exists || job.TasksMap[task.ID].Status != StatusPending || !q.holdsLease(task.ID) {
+		q.mu.Unlock()
 
-		return errors.New("signer is not in map")
+		log.WithFields(log.Fields{
+			"jobID":  task.JobID,
+			"taskID": task.ID,
+		}).Debug("Skipping cancelled task")
+
+		return nil
 	}
-	q.mu.RUnlock()
 
-	// process verify or sign task
-	var err error
+	q.processing[task.ID] = struct{}{}
+	started := newTaskEvent(EventTaskStarted, job, task)
+	q.mu.Unlock()
+
+	q.publish(started)
 
-	var verifyResp *verify.Response
+	// process verify or sign task
+	attempt := Attempt{StartedAt: now()}
+	task.startAttempt(attempt.StartedAt)
+	done := unit.stats.start()
 
-	if unit.isSigningUnit {
+	switch {
+	case task.isPipelineTask():
+		// process the current step of the pipeline
+		task, err = q.processStep(task, job, unit)
+	case unit.isSigningUnit:
 		// sign task
-		err = signTask(task, job.SignConfig, unit.signData)
-	} else {
-		// verify task
-		verifyResp, err = verifyTask(task)
-		task.VerificationData = verifyResp
+		var res signer.Result
+
+		res, err = signTask(task.InputFilePath, task.OutputFilePath, job.SignConfig, unit.signData)
+		if err == nil {
+			task.addSignature(res)
+		}
+	default:
+		// verify task, use cached result if available
+		task, err = q.verifyTaskCached(task, job.VerifyConfig)
 	}
 
+	done(err)
+
+	// record attempt
+	attempt.FinishedAt = now()
+
 	// process error
 	if err != nil {
-		// set status
-		task.Status = StatusFailed
+		attempt.Error = err.Error()
+		attempt.ErrorClass = ClassifyError(err)
+		task.FailedAttempts++
+
+		// set status depending on the retry policy
+		task.Status = retryPolicy.failedStatus(attempt.ErrorClass, task.FailedAttempts)
 		task.Error = err.Error()
 	} else {
 		// set status
 		task.Status = StatusCompleted
+		task.Error = ""
+	}
+
+	task.Attempts = append(task.Attempts, attempt)
+
+	// pass the task to the unit of the next step of the pipeline
+	next := q.advancePipeline(&task)
+	task.finishAttempt(attempt)
+
+	// report processing after the deadline, the retried task could still meet it
+	if task.Status != StatusPending && !task.Deadline.IsZero() && attempt.FinishedAt.After(task.Deadline) {
+		task.DeadlineMissed = true
+
+		log.WithFields(log.Fields{
+			"jobID":    task.JobID,
+			"taskID":   task.ID,
+			"deadline": task.Deadline,
+		}).Warn("Task missed the deadline")
 	}
 
-	// update tasks map
 	q.mu.Lock()
+
+	// discard the result of the task finished after the shutdown timed out, the store could be already closed,
+	// the task is saved as pending and processed again after the restart
+	if q.abandoned {
+		delete(q.processing, task.ID)
+		q.mu.Unlock()
+
+		log.WithFields(log.Fields{
+			"jobID":  task.JobID,
+			"taskID": task.ID,
+		}).Warn("Discarding result of the task finished after the shutdown timeout")
+
+		return nil
+	}
+
+	// the shutdown waits until the result is saved
+	q.saving.Add(1)
+	defer q.saving.Done()
+
+	// discard the result of the task claimed by another worker after the lease expired, the files are used by the worker
+	if !q.holdsLease(task.ID) {
+		delete(q.processing, task.ID)
+		q.releaseJob(task.JobID)
+		q.mu.Unlock()
+
+		log.WithFields(log.Fields{
+			"jobID":  task.JobID,
+			"taskID": task.ID,
+		}).Warn("Discarding result of the task without lease")
+
+		return nil
+	}
+
+	// discard the result of the task cancelled while it was processed
+	if q.finishProcessing(task) {
+		q.releaseJob(task.JobID)
+		q.mu.Unlock()
+
+		removeTaskFiles(task)
+
+		return nil
+	}
+
+	// retry failed task after the backoff or process the next step of the pipeline
+	if task.Status == StatusPending {
+		job.TasksMap[task.ID] = task
+		events := newJobEvents(job, task)
+
+		// the next step of the pipeline is processed by another worker sharing the store
+		handedOver := q.shared != nil && next == nil && task.UnitName != unitName
+		if q.shared != nil {
+			if handedOver {
+				delete(q.shared.leased, task.ID)
+			} else {
+				q.shared.leased[task.ID] = leasedTask{jobID: job.ID, unitName: task.UnitName}
+			}
+		}
+		q.mu.Unlock()
+
+		q.publish(events...)
+
+		switch {
+		case next != nil:
+			// the task was accepted before, so it's queued regardless of the capacity
+			next.pq.Requeue(taskItem(job, task))
+		case !handedOver:
+			q.scheduleRetry(unit, taskItem(job, task), retryPolicy.backoff(task.FailedAttempts))
+		}
+
+		err := q.saveTasks(job.ID, task.ID)
+		if err != nil || !handedOver {
+			return err
+		}
+
+		return errors.Wrap(q.shared.store.ReleaseLeases(q.shared.worker, []string{task.ID}), "release lease")
+	}
+
+	// update tasks map
 	job.TasksMap[task.ID] = task
 
 	// increment total processed tasks
 	atomic.AddUint32(&job.TotalProcesedTasks, 1)
+
+	// reuse the result for the tasks with the same content
+	duplicates := q.resolveDuplicates(job, task, unit.isSigningUnit)
+
+	job.updateCompletedAt()
+	events := newJobEvents(job, append([]Task{task}, duplicates...)...)
+
+	taskIDs := []string{task.ID}
+	for _, d := range duplicates {
+		taskIDs = append(taskIDs, d.ID)
+	}
+
+	// the lease of the processed task is released when it's saved
+	if q.shared != nil {
+		delete(q.shared.leased, task.ID)
+	}
 	q.mu.Unlock()
 
-	if len(job.TasksMap) == int(job.TotalProcesedTasks) {
-		err := q.SaveToDB(job.ID)
-		if err != nil {
-			return err
-		}
+	// save every processed task, so the progress is not lost if the application crashes
+	err = q.saveTasks(job.ID, taskIDs...)
+
+	// notify waiting for the jobs after the tasks are saved
+	q.notifyJobsUpdated()
+
+	if err != nil {
+		return err
+	}
+
+	// the job could be completed by other workers sharing the store, so the events are created by the saved job
+	if q.shared != nil {
+		q.mu.RLock()
+		events = newJobEvents(job, append([]Task{task}, duplicates...)...)
+		q.mu.RUnlock()
 	}
 
+	q.publish(events...)
+
 	return nil
 }
 
+// GetJobByID returns the job of the queue, the processed job is loaded from the store.
 func (q *Queue) GetJobByID(jobID string) (Job, error) {
-	q.mu.RLock()
-	defer q.mu.RUnlock()
+	return q.findJob(jobID)
+}
 
-	// check if the job is in the map
-	if _, exists := q.jobs[jobID]; !exists {
-		return Job{}, errors.New("job doesn't exists")
+// WaitForJob waits until all the tasks of the job are processed or the context is done.
+func (q *Queue) WaitForJob(ctx context.Context, jobID string) (Job, error) {
+	for {
+		q.mu.RLock()
+
+		// the processed job could be released from the queue
+		job, exists := q.jobs[jobID]
+		if !exists {
+			q.mu.RUnlock()
+
+			j, err := q.findJob(jobID)
+			if err != nil || j.IsCompleted() || q.shared == nil {
+				return j, err
+			}
+
+			// the jobs of the shared store are processed by the workers, so the store is checked until the job is completed
+			select {
+			case <-time.After(sharedPollInterval):
+			case <-ctx.Done():
+				return Job{}, ctx.Err()
+			}
+
+			continue
+		}
+
+		if job.IsCompleted() {
+			j := job.copy()
+			q.mu.RUnlock()
+
+			return j, nil
+		}
+
+		updated := q.updated
+		q.mu.RUnlock()
+
+		select {
+		case <-updated:
+		case <-ctx.Done():
+			return Job{}, ctx.Err()
+		}
 	}
+}
 
-	return *q.jobs[jobID], nil
+// notifyJobsUpdated wakes up waiting for the jobs, the waiting are notified after the jobs are saved
+// since the processed jobs are loaded from the store.
+func (q *Queue) notifyJobsUpdated() {
+	q.mu.Lock()
+	close(q.updated)
+	q.updated = make(chan struct{})
+	q.mu.Unlock()
 }
 
 // GetCompletedTask returns the file path if the task is completed.
 func (q *Queue) GetCompletedTask(jobID, taskID string) (Task, error) {
-	q.mu.RLock()
-	defer q.mu.RUnlock()
-
-	var task Task
-
-	// check if the job is in the map
-	if _, exists := q.jobs[jobID]; !exists {
-		return task, errors.New("job doesn't exists")
+	job, err := q.findJob(jobID)
+	if err != nil {
+		return Task{}, err
 	}
 
 	// get task
-	task, ok := q.jobs[jobID].TasksMap[taskID]
+	task, ok := job.TasksMap[taskID]
 	if !ok {
 		return task, errors.New("task is not found")
 	}
@@ -410,59 +1090,79 @@ func (q *Queue) GetCompletedTask(jobID, taskID string) (Task, error) {
 	}
 
 	// check if the stask is failed
-	if task.Status == StatusFailed {
+	if task.Status == StatusFailed || task.Status == StatusDeadLetter {
 		return task, errors.New(fmt.Sprintf("task failed with error %v", task.Error))
 	}
 
+	// check if the task is cancelled
+	if task.Status == StatusCancelled {
+		return task, errors.New("task is cancelled")
+	}
+
 	return task, nil
 }
 
 // GetQueueSizeByUnitName returns lengths of the channels of all the priorities for the specific signer.
 func (q *Queue) GetQueueSizeByUnitName(signerName string) (priority_queue.LenAll, error) {
 	q.mu.RLock()
-	defer q.mu.RUnlock()
+	u, exists := q.units[signerName]
+	q.mu.RUnlock()
 
 	// check if the signer is in the map
-	if _, exists := q.units[signerName]; !exists {
+	if !exists {
 		return priority_queue.LenAll{}, errors.New("signer is not in map")
 	}
 
-	return q.units[signerName].pq.LenAll(), nil
+	// the tasks of the shared store are waiting in the store
+	if q.shared != nil {
+		return q.shared.store.QueueSize(signerName)
+	}
+
+	return u.pq.LenAll(), nil
 }
 
-// signTask merges job and signer signdata.
-func signTask(task Task, jobSignConfig JobSignConfig, signerSignData signer.SignData) error {
+// signTask merges job and signer signdata and signs the input file, returns the details of the signature.
+func signTask(inputFilePath, outputFilePath string, jobSignConfig JobSignConfig, signerSignData signer.SignData) (signer.Result, error) {
 	// get signer sign data
 	signData := signer.SignData(signerSignData)
 
-	// merge request sign data and signer sign data
-	switch {
-	case jobSignConfig.Name != "":
+	// merge request sign data and signer sign data, every provided field overrides the signer
+	if jobSignConfig.Name != "" {
 		signData.Signature.Info.Name = jobSignConfig.Name
-	case jobSignConfig.Location != "":
+	}
+
+	if jobSignConfig.Location != "" {
 		signData.Signature.Info.Location = jobSignConfig.Location
-	case jobSignConfig.Reason != "":
+	}
+
+	if jobSignConfig.Reason != "" {
 		signData.Signature.Info.Reason = jobSignConfig.Reason
-	case jobSignConfig.ContactInfo != "":
+	}
+
+	if jobSignConfig.ContactInfo != "" {
 		signData.Signature.Info.ContactInfo = jobSignConfig.ContactInfo
-	case jobSignConfig.CertType != 0:
+	}
+
+	if jobSignConfig.CertType != 0 {
 		signData.Signature.CertType = jobSignConfig.CertType
-	case jobSignConfig.DocMDPPerms != 0:
+	}
+
+	if jobSignConfig.DocMDPPerms != 0 {
 		signData.Signature.DocMDPPerm = jobSignConfig.DocMDPPerms
 	}
 
-	err := signer.SignFile(task.InputFilePath, task.OutputFilePath, signData, jobSignConfig.ValidateSignature)
+	res, err := signer.SignFileResult(inputFilePath, outputFilePath, signData, jobSignConfig.ValidateSignature)
 	if err != nil {
 		log.WithFields(log.Fields{
-			"inputFile":  task.InputFilePath,
-			"outputFile": task.OutputFilePath,
+			"inputFile":  inputFilePath,
+			"outputFile": outputFilePath,
 			"signData":   signData,
 		}).Warnf("Couldn't sign file: %s", err)
 
-		return err
+		return res, err
 	}
 
-	return nil
+	return res, nil
 }
 
 func verifyTask(task Task) (resp *verify.Response, err error) {
@@ -480,91 +1180,293 @@ func verifyTask(task Task) (resp *verify.Response, err error) {
 	return resp, nil
 }
 
-// StartProcessor starts separate go routine for each signer which signs associated job tasks when they appear.
+// analyzeTask detects modifications made after signing, failures are logged since they don't affect the verification.
+func analyzeTask(task Task) *revision.Analysis {
+	inputFile, err := os.Open(task.InputFilePath)
+	if err != nil {
+		log.Warnf("Couldn't analyze file: %s", err)
+
+		return nil
+	}
+	defer func() { _ = inputFile.Close() }()
+
+	fileInfo, err := inputFile.Stat()
+	if err != nil {
+		log.Warnf("Couldn't analyze file: %s", err)
+
+		return nil
+	}
+
+	analysis, err := revision.Analyze(inputFile, fileInfo.Size())
+	if err != nil {
+		log.WithField("inputFile", task.InputFilePath).Warnf("Couldn't analyze file: %s", err)
+
+		return nil
+	}
+
+	return analysis
+}
+
+// StartProcessor starts separate go routines for each signer which sign associated job tasks when they appear,
+// the number of the go routines is defined by the workers of the unit.
+// Pending tasks of the jobs loaded from the db are queued again and the scheduled tasks are queued when they're due.
+// The worker sharing the store claims the pending and the due scheduled tasks of the units from the store instead.
 func (q *Queue) StartProcessor() {
-	// run separate go routine for each signer
+	q.startWorkers()
+
+	if q.shared != nil {
+		q.startClaiming()
+
+		return
+	}
+
+	go q.runScheduler()
+
+	// queue pending tasks in background since pushing blocks while the queue is full
+	go q.requeuePendingTasks()
+}
+
+// startWorkers starts the go routines of the units.
+func (q *Queue) startWorkers() {
+	q.mu.RLock()
+	defer q.mu.RUnlock()
+
+	// run separate go routines for each signer
 	for _, s := range q.units {
-		go func(name string) {
-			for {
-				// sign next task available for signing
-				err := q.processNextTask(name)
-				if err != nil {
-					log.Printf("couldn't sign file: %v, %+v", name, err)
+		s.stats.reset()
+
+		for i := 0; i < s.workers; i++ {
+			q.workers.Add(1)
+
+			go func(name string) {
+				defer q.workers.Done()
+
+				// take the tasks until the workers are stopped
+				for q.stopCtx.Err() == nil {
+					// sign next task available for signing
+					err := q.processNextTask(name)
+					if err != nil && q.stopCtx.Err() == nil {
+						log.Printf("couldn't sign file: %v, %+v", name, err)
+					}
 				}
-			}
-		}(s.name)
+			}(s.name)
+		}
 	}
 }
 
-const dbJobPrefix = "job_"
-
+// SaveToDB saves the job with all the tasks to the store and releases the job if it's processed.
 func (q *Queue) SaveToDB(jobID string) error {
 	q.mu.RLock()
-	defer q.mu.RUnlock()
 
-	// check if the job is in the map
+	// the released job is already saved
 	job, exists := q.jobs[jobID]
 	if !exists {
-		return errors.New("job doesn't exists")
-	}
+		q.mu.RUnlock()
+
+		_, err := q.findJob(jobID)
 
-	// save job
-	marshaledJob, err := json.Marshal(job)
-	if err != nil {
 		return err
 	}
 
-	err = db.SaveByKey(dbJobPrefix+jobID, marshaledJob)
+	err := q.store.SaveJob(job)
+	q.mu.RUnlock()
+
 	if err != nil {
 		return err
 	}
 
+	q.mu.Lock()
+	q.releaseJob(jobID)
+	q.mu.Unlock()
+
 	return nil
 }
 
+// LoadFromDB loads the unfinished jobs from the store, the processed jobs are loaded when they're requested.
 func (q *Queue) LoadFromDB() error {
 	log.Info("Loading jobs from the db...")
 
-	dbJobs, err := db.BatchLoad(dbJobPrefix)
+	jobs, err := q.store.LoadUnfinishedJobs()
 	if err != nil {
 		return errors.Wrap(err, "loading jobs from the db")
 	}
 
 	// load jobs and tasks
-	for _, dbJob := range dbJobs {
-		// load job
-		var job Job
+	for _, job := range jobs {
+		q.mu.Lock()
+		q.jobs[job.ID] = job
+		q.loadedJobs = append(q.loadedJobs, job.ID)
 
-		err := json.Unmarshal(dbJob, &job)
-		if err != nil {
-			return errors.Wrap(err, "unmarshal job")
+		// schedule the tasks again, the due tasks are queued when the processor starts
+		for _, t := range job.TasksMap {
+			if t.Status == StatusScheduled {
+				q.schedule(t)
+			}
 		}
+		q.mu.Unlock()
+	}
 
-		q.mu.Lock()
-		q.jobs[job.ID] = &job
+	return nil
+}
+
+// ResumeJob loads the job from the db and queues the pending tasks of the job again, the units of the tasks should be added before.
+// Unlike LoadFromDB, the unfinished jobs of other units are not loaded, so the tasks added to the job later are not queued twice.
+func (q *Queue) ResumeJob(jobID string) error {
+	q.mu.Lock()
+
+	job, err := q.loadJob(jobID)
+	if err != nil {
 		q.mu.Unlock()
+
+		return err
+	}
+
+	q.loadedJobs = append(q.loadedJobs, job.ID)
+
+	// schedule the tasks again, the due tasks are queued when the processor starts
+	for _, t := range job.TasksMap {
+		if t.Status == StatusScheduled {
+			q.schedule(t)
+		}
 	}
+	q.mu.Unlock()
+
+	q.requeuePendingTasks()
 
 	return nil
 }
 
-func (q *Queue) DeleteFromDB(jobID string) error {
-	q.mu.RLock()
-	defer q.mu.RUnlock()
+// requeuePendingTasks pushes pending tasks of the jobs loaded from the db to the queues of their units,
+// tasks which couldn't be processed anymore are marked as failed.
+func (q *Queue) requeuePendingTasks() {
+	var items []unitItem
+
+	failedJobs := map[string]bool{}
+
+	q.mu.Lock()
+	for _, jobID := range q.loadedJobs {
+		job, exists := q.jobs[jobID]
+		if !exists {
+			continue
+		}
+
+		for id, task := range job.TasksMap {
+			// the duplicates get the result of the task with the same content
+			if task.Status != StatusPending || job.isWaitingDuplicate(task) {
+				continue
+			}
+
+			// find unit of the task
+			u, err := q.pendingTaskUnit(task)
+			if err != nil {
+				log.WithFields(log.Fields{
+					"jobID":  jobID,
+					"taskID": id,
+				}).Warnf("Couldn't queue pending task: %s", err)
+
+				task.Status = StatusFailed
+				task.Error = err.Error()
+				job.TasksMap[id] = task
+				atomic.AddUint32(&job.TotalProcesedTasks, 1)
+				failedJobs[jobID] = true
+
+				continue
+			}
+
+			// the task saved with the alias of the unit is processed as the task of the unit
+			if task.UnitName != u.name {
+				task.UnitName = u.name
+				job.TasksMap[id] = task
+			}
+
+			items = append(items, unitItem{unit: u, item: taskItem(job, task)})
+		}
+	}
+
+	q.loadedJobs = nil
+	q.mu.Unlock()
+
+	// save failed tasks
+	for jobID := range failedJobs {
+		err := q.SaveToDB(jobID)
+		if err != nil {
+			log.Errorf("Couldn't save job %s: %s", jobID, err)
+		}
+	}
+
+	// notify waiting for the jobs
+	if len(failedJobs) > 0 {
+		q.notifyJobsUpdated()
+	}
+
+	if len(items) > 0 {
+		log.Infof("Queuing %d pending tasks...", len(items))
+	}
+
+	for _, i := range items {
+		i.unit.pq.Requeue(i.item)
+	}
+}
 
-	// check if the job is in the map
-	_, exists := q.jobs[jobID]
+// unitItem represents queue item of the unit.
+type unitItem struct {
+	unit *unit
+	item priority_queue.Item
+}
+
+// pendingTaskUnit returns the unit of the pending task if the task could be processed.
+func (q *Queue) pendingTaskUnit(task Task) (*unit, error) {
+	if task.UnitName == "" {
+		return nil, errors.New("couldn't resume task after restart: unit of the task is unknown")
+	}
+
+	u, exists := q.getUnit(task.UnitName)
 	if !exists {
-		return errors.New("job doesn't exists")
+		return nil, errors.Errorf("couldn't resume task after restart: unit %q doesn't exist anymore", task.UnitName)
 	}
 
-	// delete job
-	err := db.DeleteByKey(dbJobPrefix + jobID)
+	_, err := os.Stat(task.currentInput())
 	if err != nil {
-		return err
+		return nil, errors.Errorf("couldn't resume task after restart: input file %q doesn't exist anymore", task.OriginalFileName)
 	}
 
-	return nil
+	return u, nil
+}
+
+// taskPriority returns priority of the task, tasks persisted without priority are queued with low priority.
+func taskPriority(task Task) priority_queue.Priority {
+	if task.Priority == priority_queue.UnknownPriority {
+		return priority_queue.LowPriority
+	}
+
+	return task.Priority
+}
+
+// DefaultTenant represents the tenant of the jobs added without the web api client.
+const DefaultTenant = "default"
+
+// tenant returns the tenant sharing the units with other tenants, the web api client added the job.
+func (j *Job) tenant() string {
+	if j.Client == "" {
+		return DefaultTenant
+	}
+
+	return j.Client
+}
+
+// taskItem creates queue item of the task.
+func taskItem(job *Job, task Task) priority_queue.Item {
+	return priority_queue.Item{Value: task, Priority: taskPriority(task), Deadline: task.Deadline, Tenant: job.tenant()}
+}
+
+// DeleteFromDB deletes the job with the tasks from the store.
+func (q *Queue) DeleteFromDB(jobID string) error {
+	return q.store.DeleteJob(jobID)
+}
+
+// now returns the current time in UTC without monotonic clock reading, the same as it's loaded from the db.
+func now() time.Time {
+	return time.Now().UTC().Round(0)
 }
 
 func generateID() string {
@@ -1,13 +1,20 @@
 package queue
 
 import (
+	"context"
 	"io"
+	"net"
+	"os"
+	"path/filepath"
 	"testing"
+	"time"
 
 	"github.com/digitorus/pdfsign/sign"
+	"github.com/digitorus/pdfsigner/db"
 	"github.com/digitorus/pdfsigner/license"
 	"github.com/digitorus/pdfsigner/queues/priority_queue"
 	"github.com/digitorus/pdfsigner/signer"
+	"github.com/pkg/errors"
 	"github.com/sirupsen/logrus"
 	"github.com/stretchr/testify/assert"
 )
@@ -64,6 +71,11 @@ func TestQSignersMap(t *testing.T) {
 		t.Fatal(err)
 	}
 
+	job, err = qs.GetJobByID(jobID)
+	if err != nil {
+		t.Fatal(err)
+	}
+
 	assert.Len(t, job.TasksMap, 1)
 
 	// sign job
@@ -91,6 +103,11 @@ func TestQSignersMap(t *testing.T) {
 		t.Fatal(err)
 	}
 
+	job, err = qs.GetJobByID(jobID)
+	if err != nil {
+		t.Fatal(err)
+	}
+
 	assert.Len(t, job.TasksMap, 2)
 	// sign job
 	assert.NoError(t, qs.processNextTask("simple"))
@@ -121,3 +138,780 @@ func TestQSignersMap(t *testing.T) {
 	assert.Error(t, err)
 	assert.Nil(t, jobFromDB.TasksMap)
 }
+
+func TestWaitForJob(t *testing.T) {
+	logrus.SetOutput(io.Discard)
+
+	qs := NewQueue()
+	qs.AddVerifyUnit()
+
+	jobID := qs.AddVerifyJob(JobVerifyConfig{})
+
+	_, err := qs.AddTask(VerificationUnitName, jobID, "SampleSignedPDFDocument.pdf", "../../testfiles/SampleSignedPDFDocument.pdf", "", priority_queue.HighPriority)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// test deadline
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Millisecond)
+	defer cancel()
+
+	_, err = qs.WaitForJob(ctx, jobID)
+	assert.ErrorIs(t, err, context.DeadlineExceeded)
+
+	// test processed job
+	go func() { _ = qs.processNextTask(VerificationUnitName) }()
+
+	job, err := qs.WaitForJob(context.Background(), jobID)
+	assert.NoError(t, err)
+	assert.True(t, job.IsCompleted())
+}
+
+func TestVerifyCache(t *testing.T) {
+	logrus.SetOutput(io.Discard)
+
+	err := license.Initialize([]byte(license.TestLicense))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// the file signed without the revocation data
+	d := signer.SignData{Signature: sign.SignDataSignature{Info: sign.SignDataSignatureInfo{Name: "Tim"}}}
+	d.SetPEM("../../testfiles/test.crt", "../../testfiles/test.pem", "")
+
+	inputFilePath := filepath.Join(t.TempDir(), "signed.pdf")
+
+	err = signer.SignFile("../../testfiles/testfile20.pdf", inputFilePath, d, false)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	qs := NewQueue()
+	qs.AddVerifyUnit()
+	qs.SetVerifyCache(VerifyCacheConfig{TTL: time.Hour, Profile: "test"})
+
+	verifyFile := func(inputFilePath string, verifyConfig JobVerifyConfig) Task {
+		jobID := qs.AddVerifyJob(verifyConfig)
+
+		taskID, err := qs.AddTask(VerificationUnitName, jobID, filepath.Base(inputFilePath), inputFilePath, "", priority_queue.HighPriority)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		assert.NoError(t, qs.processNextTask(VerificationUnitName))
+
+		task, err := qs.GetCompletedTask(jobID, taskID)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		return task
+	}
+
+	verify := func(verifyConfig JobVerifyConfig) Task {
+		return verifyFile(inputFilePath, verifyConfig)
+	}
+
+	// the result verified with the expired CRL is not cached
+	const expiredCRLFilePath = "../../testfiles/SampleSignedPDFDocument.pdf"
+
+	assert.False(t, verifyFile(expiredCRLFilePath, JobVerifyConfig{}).FromCache)
+	assert.False(t, verifyFile(expiredCRLFilePath, JobVerifyConfig{}).FromCache)
+
+	// verify and cache result
+	task := verify(JobVerifyConfig{})
+	assert.False(t, task.FromCache)
+	assert.NotNil(t, task.VerificationData)
+
+	// load result from the cache
+	cachedTask := verify(JobVerifyConfig{})
+	assert.True(t, cachedTask.FromCache)
+	assert.Equal(t, len(task.VerificationData.Signers), len(cachedTask.VerificationData.Signers))
+	assert.NotNil(t, cachedTask.VerificationData.Signers[0].Certificates[0].Certificate.PublicKey)
+
+	// force refresh
+	task = verify(JobVerifyConfig{ForceRefresh: true})
+	assert.False(t, task.FromCache)
+
+	// expired entry is removed
+	key := dbVerifyCachePrefix + "test_expired"
+	assert.NoError(t, saveVerifyCacheEntry(key, verifyCacheEntry{ExpiresAt: time.Now().Add(-time.Minute)}))
+
+	entry, err := loadVerifyCacheEntry(key)
+	assert.NoError(t, err)
+	assert.Nil(t, entry)
+
+	b, err := db.LoadByKey(key)
+	assert.NoError(t, err)
+	assert.Nil(t, b)
+}
+
+func TestUnitWorkers(t *testing.T) {
+	logrus.SetOutput(io.Discard)
+
+	qs := NewQueue()
+	qs.AddVerifyUnit()
+
+	assert.Error(t, qs.SetUnitWorkers(VerificationUnitName, 0))
+	assert.Error(t, qs.SetUnitWorkers("notexisting", 2))
+	assert.NoError(t, qs.SetUnitWorkers(VerificationUnitName, 4))
+
+	qs.StartProcessor()
+
+	// verify multiple files concurrently
+	jobID := qs.AddVerifyJob(JobVerifyConfig{})
+
+	for i := 0; i < 8; i++ {
+		_, err := qs.AddTask(VerificationUnitName, jobID, "SampleSignedPDFDocument.pdf", "../../testfiles/SampleSignedPDFDocument.pdf", "", priority_queue.HighPriority)
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 30*time.Second)
+	defer cancel()
+
+	job, err := qs.WaitForJob(ctx, jobID)
+	assert.NoError(t, err)
+	assert.Len(t, job.TasksMap, 8)
+
+	// check statistics
+	stats, err := qs.GetUnitStats(VerificationUnitName)
+	assert.NoError(t, err)
+	assert.Equal(t, 4, stats.Workers)
+	assert.Equal(t, uint64(8), stats.Processed)
+	assert.Equal(t, uint64(0), stats.Failed)
+	assert.Greater(t, stats.TasksPerMinute, 0.0)
+}
+
+func TestRequeuePendingTasks(t *testing.T) {
+	logrus.SetOutput(io.Discard)
+
+	// copy input file which is removed before restart
+	removedFilePath := filepath.Join(t.TempDir(), "removed.pdf")
+
+	b, err := os.ReadFile("../../testfiles/SampleSignedPDFDocument.pdf")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	err = os.WriteFile(removedFilePath, b, 0o600)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// add pending tasks without processing
+	qs := NewQueue()
+	qs.AddVerifyUnit()
+	qs.AddSignUnit("removed", signer.SignData{})
+
+	verifyJobID := qs.AddVerifyJob(JobVerifyConfig{})
+
+	verifyTaskID, err := qs.AddTask(VerificationUnitName, verifyJobID, "SampleSignedPDFDocument.pdf", "../../testfiles/SampleSignedPDFDocument.pdf", "", priority_queue.HighPriority)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	removedFileTaskID, err := qs.AddTask(VerificationUnitName, verifyJobID, "removed.pdf", removedFilePath, "", priority_queue.LowPriority)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	signJobID := qs.AddSignJob(JobSignConfig{})
+
+	signTaskID, err := qs.AddTask("removed", signJobID, "testfile12.pdf", "../../testfiles/testfile12.pdf", "", priority_queue.HighPriority)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	assert.NoError(t, qs.SaveToDB(verifyJobID))
+	assert.NoError(t, qs.SaveToDB(signJobID))
+	assert.NoError(t, os.Remove(removedFilePath))
+
+	// restart without the signer unit
+	qs = NewQueue()
+	qs.AddVerifyUnit()
+	assert.NoError(t, qs.LoadFromDB())
+	qs.StartProcessor()
+
+	ctx, cancel := context.WithTimeout(context.Background(), 30*time.Second)
+	defer cancel()
+
+	job, err := qs.WaitForJob(ctx, verifyJobID)
+	assert.NoError(t, err)
+	assert.Equal(t, StatusCompleted, job.TasksMap[verifyTaskID].Status, job.TasksMap[verifyTaskID].Error)
+	assert.Equal(t, StatusFailed, job.TasksMap[removedFileTaskID].Status)
+	assert.Contains(t, job.TasksMap[removedFileTaskID].Error, "input file")
+
+	job, err = qs.WaitForJob(ctx, signJobID)
+	assert.NoError(t, err)
+	assert.Equal(t, StatusFailed, job.TasksMap[signTaskID].Status)
+	assert.Contains(t, job.TasksMap[signTaskID].Error, `unit "removed" doesn't exist anymore`)
+
+	// failed tasks are saved
+	qs = NewQueue()
+	assert.NoError(t, qs.LoadFromDB())
+
+	job, err = qs.GetJobByID(signJobID)
+	assert.NoError(t, err)
+	assert.Equal(t, StatusFailed, job.TasksMap[signTaskID].Status)
+}
+
+func TestRequeueRenamedUnitTasks(t *testing.T) {
+	logrus.SetOutput(io.Discard)
+
+	// add pending task of the unit named as the signer
+	qs := NewQueue()
+	qs.AddSignUnit("renamed", signer.SignData{})
+
+	oldJobID := qs.AddSignJob(JobSignConfig{})
+
+	taskID, err := qs.AddTask("renamed", oldJobID, "testfile12.pdf", "../../testfiles/testfile12.pdf", "", priority_queue.HighPriority)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	assert.NoError(t, qs.SaveToDB(oldJobID))
+
+	// restart with the unit of the service using the signer
+	qs = NewQueue()
+	qs.AddSignUnit("service:renamed", signer.SignData{})
+	assert.Error(t, qs.SetUnitAlias("renamed", "notexisting"))
+	assert.NoError(t, qs.SetUnitAlias("renamed", "service:renamed"))
+	assert.NoError(t, qs.LoadFromDB())
+	qs.requeuePendingTasks()
+
+	size, err := qs.GetQueueSizeByUnitName("service:renamed")
+	assert.NoError(t, err)
+	assert.Equal(t, 1, size.High)
+
+	job, err := qs.GetJobByID(oldJobID)
+	assert.NoError(t, err)
+	assert.Equal(t, StatusPending, job.TasksMap[taskID].Status, job.TasksMap[taskID].Error)
+	assert.Equal(t, "service:renamed", job.TasksMap[taskID].UnitName)
+
+	newJobID := qs.AddSignJob(JobSignConfig{})
+
+	_, err = qs.AddTask("service:renamed", newJobID, "testfile12.pdf", "../../testfiles/testfile12.pdf", "", priority_queue.HighPriority)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	assert.NoError(t, qs.SaveToDB(newJobID))
+
+	// the jobs saved with the old name are listed as the jobs of the unit
+	jobs, cursor, err := qs.ListJobs(JobFilter{Unit: "service:renamed", Limit: 1})
+	assert.NoError(t, err)
+	assert.Len(t, jobs, 1)
+	assert.Equal(t, newJobID, jobs[0].ID)
+	assert.NotEmpty(t, cursor)
+
+	jobs, cursor, err = qs.ListJobs(JobFilter{Unit: "service:renamed", Limit: 1, Cursor: cursor})
+	assert.NoError(t, err)
+	assert.Len(t, jobs, 1)
+	assert.Equal(t, oldJobID, jobs[0].ID)
+	assert.Empty(t, cursor)
+}
+
+func TestResumeJob(t *testing.T) {
+	logrus.SetOutput(io.Discard)
+
+	// add pending tasks of two jobs without processing
+	qs := NewQueue()
+	qs.AddVerifyUnit()
+
+	var jobIDs, taskIDs []string
+
+	for i := 0; i < 2; i++ {
+		jobID := qs.AddVerifyJob(JobVerifyConfig{})
+
+		taskID, err := qs.AddTask(VerificationUnitName, jobID, "SampleSignedPDFDocument.pdf", "../../testfiles/SampleSignedPDFDocument.pdf", "", priority_queue.HighPriority)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		jobIDs = append(jobIDs, jobID)
+		taskIDs = append(taskIDs, taskID)
+	}
+
+	// restart resuming only the first job
+	qs = NewQueue()
+	qs.AddVerifyUnit()
+	assert.Error(t, qs.ResumeJob("missing"))
+	assert.NoError(t, qs.ResumeJob(jobIDs[0]))
+	qs.StartProcessor()
+
+	ctx, cancel := context.WithTimeout(context.Background(), 30*time.Second)
+	defer cancel()
+
+	job, err := qs.WaitForJob(ctx, jobIDs[0])
+	assert.NoError(t, err)
+	assert.Equal(t, StatusCompleted, job.TasksMap[taskIDs[0]].Status, job.TasksMap[taskIDs[0]].Error)
+
+	// the task of the job which isn't resumed stays pending
+	job, err = qs.GetJobByID(jobIDs[1])
+	assert.NoError(t, err)
+	assert.Equal(t, StatusPending, job.TasksMap[taskIDs[1]].Status)
+
+	// the pending job isn't loaded by other tests
+	assert.NoError(t, qs.DeleteJob(jobIDs[1]))
+}
+
+func TestRetryPolicy(t *testing.T) {
+	logrus.SetOutput(io.Discard)
+
+	// classify errors
+	assert.Equal(t, ErrorClassTSA, ClassifyError(errors.Wrap(&signer.ServiceError{Service: signer.ServiceTSA, StatusCode: 503, Temporary: true, Err: errors.New("unavailable")}, "sign")))
+	assert.Equal(t, ErrorClassOther, ClassifyError(&signer.ServiceError{Service: signer.ServiceTSA, StatusCode: 401, Err: errors.New("unauthorized")}))
+	assert.Equal(t, ErrorClassOCSP, ClassifyError(&signer.ServiceError{Service: signer.ServiceOCSP, Temporary: true, Err: errors.New("connection refused")}))
+	assert.Equal(t, ErrorClassHSM, ClassifyError(&signer.ServiceError{Service: signer.ServiceHSM, Temporary: true, Err: errors.New("CKR_DEVICE_REMOVED")}))
+	assert.Equal(t, ErrorClassNetwork, ClassifyError(errors.Wrap(context.DeadlineExceeded, "request")))
+	assert.Equal(t, ErrorClassNetwork, ClassifyError(&net.OpError{Op: "dial", Err: errors.New("connection refused")}))
+	assert.Equal(t, ErrorClassOther, ClassifyError(errors.New("get timestamp: connection timeout")))
+	assert.Equal(t, ErrorClassOther, ClassifyError(errors.New("malformed pdf")))
+
+	// determine status
+	p := RetryPolicy{MaxAttempts: 3, Backoff: time.Second, MaxBackoff: 3 * time.Second}
+	assert.Equal(t, StatusPending, p.failedStatus(ErrorClassTSA, 2))
+	assert.Equal(t, StatusDeadLetter, p.failedStatus(ErrorClassTSA, 3))
+	assert.Equal(t, StatusFailed, p.failedStatus(ErrorClassOther, 1))
+	assert.Equal(t, StatusFailed, RetryPolicy{}.failedStatus(ErrorClassTSA, 1))
+
+	// calculate backoff
+	assert.Equal(t, time.Second, p.backoff(1))
+	assert.Equal(t, 2*time.Second, p.backoff(2))
+	assert.Equal(t, 3*time.Second, p.backoff(3))
+
+	// retry until dead lettered
+	qs := NewQueue()
+	qs.AddVerifyUnit()
+
+	assert.Error(t, qs.SetUnitRetryPolicy(VerificationUnitName, RetryPolicy{Retryable: []string{"unknown"}}))
+	assert.NoError(t, qs.SetUnitRetryPolicy(VerificationUnitName, RetryPolicy{
+		MaxAttempts: 2,
+		Backoff:     time.Millisecond,
+		Retryable:   []string{ErrorClassOther},
+	}))
+
+	qs.StartProcessor()
+
+	inputFilePath := filepath.Join(t.TempDir(), "later.pdf")
+	jobID := qs.AddVerifyJob(JobVerifyConfig{})
+
+	taskID, err := qs.AddTask(VerificationUnitName, jobID, "later.pdf", inputFilePath, "", priority_queue.HighPriority)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 30*time.Second)
+	defer cancel()
+
+	job, err := qs.WaitForJob(ctx, jobID)
+	assert.NoError(t, err)
+	assert.Equal(t, StatusDeadLetter, job.TasksMap[taskID].Status)
+	assert.Len(t, job.TasksMap[taskID].Attempts, 2)
+	assert.Equal(t, ErrorClassOther, job.TasksMap[taskID].Attempts[0].ErrorClass)
+
+	deadLetter, err := qs.GetDeadLetterTasks(VerificationUnitName, "")
+	assert.NoError(t, err)
+	assert.Contains(t, taskIDs(deadLetter), taskID)
+
+	deadLetter, err = qs.GetDeadLetterTasks("notexisting", "")
+	assert.NoError(t, err)
+	assert.Empty(t, deadLetter)
+
+	// the tasks of the jobs of other clients are not listed
+	deadLetter, err = qs.GetDeadLetterTasks(VerificationUnitName, "notexisting")
+	assert.NoError(t, err)
+	assert.Empty(t, deadLetter)
+
+	// requeue after the problem is fixed
+	b, err := os.ReadFile("../../testfiles/SampleSignedPDFDocument.pdf")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	err = os.WriteFile(inputFilePath, b, 0o600)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	assert.NoError(t, qs.RequeueTask(jobID, taskID))
+	assert.Error(t, qs.RequeueTask(jobID, taskID))
+
+	job, err = qs.WaitForJob(ctx, jobID)
+	assert.NoError(t, err)
+	assert.Equal(t, StatusCompleted, job.TasksMap[taskID].Status, job.TasksMap[taskID].Error)
+	assert.Len(t, job.TasksMap[taskID].Attempts, 3)
+
+	deadLetter, err = qs.GetDeadLetterTasks("", "")
+	assert.NoError(t, err)
+	assert.NotContains(t, taskIDs(deadLetter), taskID)
+}
+
+// taskIDs returns the ids of the tasks.
+func taskIDs(tasks []Task) []string {
+	ids := make([]string, 0, len(tasks))
+	for _, t := range tasks {
+		ids = append(ids, t.ID)
+	}
+
+	return ids
+}
+
+func TestQueueCapacity(t *testing.T) {
+	logrus.SetOutput(io.Discard)
+
+	qs := NewQueue()
+	qs.AddVerifyUnit()
+
+	assert.Error(t, qs.SetCapacity(-1))
+	assert.NoError(t, qs.SetCapacity(2))
+
+	// reject the batch exceeding the capacity as a whole
+	jobID := qs.AddVerifyJob(JobVerifyConfig{})
+	err := qs.AddBatchPersistentTasks(VerificationUnitName, jobID, map[string]string{
+		"file1": "file1.pdf",
+		"file2": "file2.pdf",
+		"file3": "file3.pdf",
+	}, priority_queue.MediumPriority, time.Time{}, time.Time{})
+	assert.True(t, errors.Is(err, priority_queue.ErrFull), err)
+
+	job, err := qs.GetJobByID(jobID)
+	assert.NoError(t, err)
+	assert.Len(t, job.TasksMap, 0)
+
+	// accept the batch fitting into the queue
+	_, err = qs.AddTask(VerificationUnitName, jobID, "file1.pdf", "file1", "", priority_queue.HighPriority)
+	assert.NoError(t, err)
+	_, err = qs.AddTask(VerificationUnitName, jobID, "file2.pdf", "file2", "", priority_queue.HighPriority)
+	assert.NoError(t, err)
+
+	_, err = qs.AddTask(VerificationUnitName, jobID, "file3.pdf", "file3", "", priority_queue.HighPriority)
+	assert.True(t, errors.Is(err, priority_queue.ErrFull), err)
+
+	size, err := qs.GetQueueSizeByUnitName(VerificationUnitName)
+	assert.NoError(t, err)
+	assert.Equal(t, 2, size.High)
+}
+
+func TestSharedSignUnits(t *testing.T) {
+	logrus.SetOutput(io.Discard)
+
+	qs := NewQueue()
+
+	// the services share the sign data of the signer
+	d := signer.SignData{}
+	qs.AddSignUnit("watch:simple", d)
+	qs.AddSignUnit("serve:simple", d)
+
+	// adding the unit again keeps the unit
+	qs.AddSignUnit("watch:simple", d)
+
+	assert.Error(t, qs.SetUnitCapacity("missing", 1))
+	assert.NoError(t, qs.SetUnitCapacity("watch:simple", 1))
+
+	// the capacity of the queue doesn't override the capacity of the unit
+	assert.NoError(t, qs.SetCapacity(3))
+
+	jobID := qs.AddSignJob(JobSignConfig{})
+
+	_, err := qs.AddTask("watch:simple", jobID, "file1.pdf", "file1", "", priority_queue.LowPriority)
+	assert.NoError(t, err)
+
+	_, err = qs.AddTask("watch:simple", jobID, "file2.pdf", "file2", "", priority_queue.LowPriority)
+	assert.True(t, errors.Is(err, priority_queue.ErrFull), err)
+
+	// the full queue of the service doesn't block another service
+	for i := 0; i < 3; i++ {
+		_, err = qs.AddTask("serve:simple", jobID, "file.pdf", "file", "", priority_queue.HighPriority)
+		assert.NoError(t, err)
+	}
+
+	watchSize, err := qs.GetQueueSizeByUnitName("watch:simple")
+	assert.NoError(t, err)
+	assert.Equal(t, 1, watchSize.Low)
+	assert.Equal(t, 0, watchSize.High)
+
+	serveSize, err := qs.GetQueueSizeByUnitName("serve:simple")
+	assert.NoError(t, err)
+	assert.Equal(t, 0, serveSize.Low)
+	assert.Equal(t, 3, serveSize.High)
+}
+
+func TestTaskDeadline(t *testing.T) {
+	logrus.SetOutput(io.Discard)
+
+	qs := NewQueue()
+	qs.AddVerifyUnit()
+
+	files := map[string]string{"../../testfiles/SampleSignedPDFDocument.pdf": "SampleSignedPDFDocument.pdf"}
+
+	// add job with the deadline passing before it's processed
+	missedJobID := qs.AddVerifyJob(JobVerifyConfig{})
+	assert.NoError(t, qs.AddBatchPersistentTasks(VerificationUnitName, missedJobID, files, priority_queue.LowPriority, time.Now().Add(10*time.Millisecond), time.Time{}))
+
+	// add job with the deadline far in the future
+	metJobID := qs.AddVerifyJob(JobVerifyConfig{})
+	assert.NoError(t, qs.AddBatchPersistentTasks(VerificationUnitName, metJobID, files, priority_queue.LowPriority, time.Now().Add(time.Hour), time.Time{}))
+
+	time.Sleep(20 * time.Millisecond)
+
+	// pending task misses the deadline once it passes
+	job, err := qs.GetJobByID(missedJobID)
+	assert.NoError(t, err)
+
+	for _, task := range job.TasksMap {
+		assert.False(t, task.DeadlineMissed)
+		assert.True(t, task.MissedDeadline())
+	}
+
+	qs.StartProcessor()
+
+	ctx, cancel := context.WithTimeout(context.Background(), 30*time.Second)
+	defer cancel()
+
+	job, err = qs.WaitForJob(ctx, missedJobID)
+	assert.NoError(t, err)
+
+	for _, task := range job.TasksMap {
+		assert.Equal(t, StatusCompleted, task.Status, task.Error)
+		assert.True(t, task.DeadlineMissed)
+	}
+
+	job, err = qs.WaitForJob(ctx, metJobID)
+	assert.NoError(t, err)
+
+	for _, task := range job.TasksMap {
+		assert.Equal(t, StatusCompleted, task.Status, task.Error)
+		assert.False(t, task.MissedDeadline())
+	}
+}
+
+func TestTenants(t *testing.T) {
+	logrus.SetOutput(io.Discard)
+
+	qs := NewQueue()
+	qs.AddVerifyUnit()
+	assert.NoError(t, qs.SetTenantPolicy("bulk", priority_queue.TenantPolicy{Weight: 1, MaxInFlight: 1}))
+	assert.Error(t, qs.SetTenantPolicy("bulk", priority_queue.TenantPolicy{Weight: -1}))
+
+	// the client uploads many files before the job of another client
+	bulkJobID := qs.AddVerifyJob(JobVerifyConfig{})
+	assert.NoError(t, qs.SetJobClient(bulkJobID, "bulk"))
+
+	for i := 0; i < 6; i++ {
+		_, err := qs.AddTask(VerificationUnitName, bulkJobID, "file.pdf", "../../testfiles/SampleSignedPDFDocument.pdf", "", priority_queue.HighPriority)
+		assert.NoError(t, err)
+	}
+
+	singleJobID := qs.AddVerifyJob(JobVerifyConfig{})
+	_, err := qs.AddTask(VerificationUnitName, singleJobID, "file.pdf", "../../testfiles/SampleSignedPDFDocument.pdf", "", priority_queue.HighPriority)
+	assert.NoError(t, err)
+
+	size, err := qs.GetQueueSizeByUnitName(VerificationUnitName)
+	assert.NoError(t, err)
+	assert.Equal(t, map[string]int{"bulk": 6, DefaultTenant: 1}, size.Tenants)
+
+	started := make(chan string, 7)
+
+	qs.Subscribe(func(e Event) {
+		if e.Type == EventTaskStarted {
+			started <- e.Job.ID
+		}
+	})
+
+	qs.StartProcessor()
+
+	ctx, cancel := context.WithTimeout(context.Background(), 30*time.Second)
+	defer cancel()
+
+	_, err = qs.WaitForJob(ctx, bulkJobID)
+	assert.NoError(t, err)
+
+	// the job of another client doesn't wait for all the files of the bulk job
+	assert.Equal(t, bulkJobID, <-started)
+	assert.Equal(t, singleJobID, <-started)
+}
+
+func TestCancelJob(t *testing.T) {
+	logrus.SetOutput(io.Discard)
+
+	b, err := os.ReadFile("../../testfiles/SampleSignedPDFDocument.pdf")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// add temporary files without processing
+	dir := t.TempDir()
+	files := map[string]string{}
+
+	for _, name := range []string{"file1", "file2", "file3"} {
+		path := filepath.Join(dir, name)
+		assert.NoError(t, os.WriteFile(path, b, 0o600))
+
+		files[path] = name + ".pdf"
+	}
+
+	qs := NewQueue()
+	qs.AddVerifyUnit()
+
+	jobID := qs.AddVerifyJob(JobVerifyConfig{})
+	assert.NoError(t, qs.AddBatchPersistentTasks(VerificationUnitName, jobID, files, priority_queue.MediumPriority, time.Time{}, time.Time{}))
+
+	job, err := qs.GetJobByID(jobID)
+	assert.NoError(t, err)
+
+	var tasks []Task
+	for _, task := range job.TasksMap {
+		tasks = append(tasks, task)
+	}
+
+	// cancel single task
+	assert.NoError(t, qs.CancelTask(jobID, tasks[0].ID))
+	assert.Error(t, qs.CancelTask(jobID, tasks[0].ID))
+	assert.Error(t, qs.CancelTask(jobID, "notexisting"))
+	assert.NoFileExists(t, tasks[0].InputFilePath)
+	assert.FileExists(t, tasks[1].InputFilePath)
+
+	size, err := qs.GetQueueSizeByUnitName(VerificationUnitName)
+	assert.NoError(t, err)
+	assert.Equal(t, 2, size.Medium)
+
+	// cancel the rest of the tasks
+	assert.NoError(t, qs.CancelJob(jobID))
+	assert.Error(t, qs.CancelJob("notexisting"))
+
+	size, err = qs.GetQueueSizeByUnitName(VerificationUnitName)
+	assert.NoError(t, err)
+	assert.Equal(t, 0, size.Medium)
+
+	job, err = qs.GetJobByID(jobID)
+	assert.NoError(t, err)
+	assert.True(t, job.IsCompleted())
+
+	for _, task := range job.TasksMap {
+		assert.Equal(t, StatusCancelled, task.Status)
+		assert.NoFileExists(t, task.InputFilePath)
+	}
+
+	_, err = qs.GetCompletedTask(jobID, tasks[1].ID)
+	assert.Error(t, err)
+
+	// the cancelled task queued again, Ex. after the retry backoff, is skipped
+	qs.units[VerificationUnitName].pq.Requeue(taskItem(&Job{}, tasks[1]))
+	qs.StartProcessor()
+
+	time.Sleep(100 * time.Millisecond)
+
+	stats, err := qs.GetUnitStats(VerificationUnitName)
+	assert.NoError(t, err)
+	assert.Equal(t, uint64(0), stats.Processed)
+
+	job, err = qs.GetJobByID(jobID)
+	assert.NoError(t, err)
+	assert.Equal(t, StatusCancelled, job.TasksMap[tasks[1].ID].Status)
+
+	// delete job
+	assert.NoError(t, qs.DeleteJob(jobID))
+
+	_, err = qs.GetJobByID(jobID)
+	assert.Error(t, err)
+}
+
+func TestCollectGarbage(t *testing.T) {
+	logrus.SetOutput(io.Discard)
+
+	// use separate temporary folder for the orphaned files
+	t.Setenv("TMPDIR", t.TempDir())
+
+	// use separate store, the garbage is collected from all the saved jobs
+	store, err := NewSQLiteStore(filepath.Join(t.TempDir(), "jobs.db"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer func() { _ = store.Close() }()
+
+	qs := NewQueue()
+	qs.SetStore(store)
+
+	// addJob adds job with single temporary file of 1KB
+	addJob := func(status string, completedAt, downloadedAt time.Time) (string, Task) {
+		f, err := os.CreateTemp("", TempFilePrefix)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		_, err = f.Write(make([]byte, 1024))
+		assert.NoError(t, err)
+		assert.NoError(t, f.Close())
+
+		j := qs.addJob(JobTypeSign)
+		task := Task{
+			ID:             generateID(),
+			JobID:          j.ID,
+			InputFilePath:  f.Name(),
+			OutputFilePath: f.Name() + "_signed",
+			UnitName:       "signer",
+			Status:         status,
+			DownloadedAt:   downloadedAt,
+			Temporary:      true,
+		}
+		j.TasksMap[task.ID] = task
+
+		if status != StatusPending {
+			j.TotalProcesedTasks = 1
+			j.CompletedAt = completedAt
+		}
+
+		assert.NoError(t, qs.SaveToDB(j.ID))
+
+		return j.ID, task
+	}
+
+	completedJobID, completedTask := addJob(StatusCompleted, time.Now().Add(-2*time.Hour), time.Time{})
+	downloadedJobID, _ := addJob(StatusCompleted, time.Now().Add(-10*time.Minute), time.Now().Add(-5*time.Minute))
+	oldJobID, _ := addJob(StatusCompleted, time.Now().Add(-20*time.Minute), time.Time{})
+	newJobID, _ := addJob(StatusFailed, time.Now().Add(-time.Minute), time.Time{})
+	pendingJobID, pendingTask := addJob(StatusPending, time.Time{}, time.Time{})
+
+	// add orphaned files
+	orphanedFilePath := filepath.Join(os.TempDir(), TempFilePrefix+"orphaned")
+	assert.NoError(t, os.WriteFile(orphanedFilePath, make([]byte, 1024), 0o600))
+	assert.NoError(t, os.Chtimes(orphanedFilePath, time.Now().Add(-2*time.Hour), time.Now().Add(-2*time.Hour)))
+
+	uploadingFilePath := filepath.Join(os.TempDir(), TempFilePrefix+"uploading")
+	assert.NoError(t, os.WriteFile(uploadingFilePath, make([]byte, 1024), 0o600))
+
+	// delete expired jobs and the oldest job exceeding the storage
+	assert.Error(t, qs.SetRetentionPolicy(RetentionPolicy{AfterCompletion: -time.Hour}))
+	assert.NoError(t, qs.SetRetentionPolicy(RetentionPolicy{
+		AfterCompletion: time.Hour,
+		AfterDownload:   time.Minute,
+		MaxStorage:      2048,
+	}))
+
+	stats, err := qs.CollectGarbage()
+	assert.NoError(t, err)
+	assert.Equal(t, GarbageStats{Jobs: 3, Files: 4, Bytes: 4096}, stats)
+
+	for _, jobID := range []string{completedJobID, downloadedJobID, oldJobID} {
+		_, err := qs.GetJobByID(jobID)
+		assert.Error(t, err, jobID)
+	}
+
+	for _, jobID := range []string{newJobID, pendingJobID} {
+		_, err := qs.GetJobByID(jobID)
+		assert.NoError(t, err, jobID)
+	}
+
+	assert.NoFileExists(t, completedTask.InputFilePath)
+	assert.FileExists(t, pendingTask.InputFilePath)
+	assert.NoFileExists(t, orphanedFilePath)
+	assert.FileExists(t, uploadingFilePath)
+
+	// nothing left to collect
+	stats, err = qs.CollectGarbage()
+	assert.NoError(t, err)
+	assert.Equal(t, GarbageStats{}, stats)
+}
@@ -0,0 +1,290 @@
+package queue
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"sort"
+	"time"
+
+	"github.com/pkg/errors"
+	log "github.com/sirupsen/logrus"
+)
+
+// TempFilePrefix represents the prefix of the temporary files of the uploaded and signed documents.
+const TempFilePrefix = "pdfsigner_cache"
+
+// orphanedFileAge represents the age of the temporary file not used by any job to be removed,
+// the younger files could be the uploads of the jobs being created.
+const orphanedFileAge = time.Hour
+
+// RetentionPolicy represents how long the processed jobs and their files are kept.
+type RetentionPolicy struct {
+	// AfterCompletion represents how long the job is kept after all the tasks are processed, kept forever if it's 0
+	AfterCompletion time.Duration
+	// AfterDownload represents how long the job is kept after all the signed files are downloaded, kept forever if it's 0
+	AfterDownload time.Duration
+	// MaxStorage represents maximum size of the temporary files in bytes,
+	// the oldest processed jobs are deleted to fit the files, not limited if it's 0
+	MaxStorage int64
+}
+
+// GarbageStats represents the results of the garbage collection.
+type GarbageStats struct {
+	// Jobs represents the number of the deleted jobs
+	Jobs int `json:"jobs"`
+	// Files represents the number of the removed files
+	Files int `json:"files"`
+	// Bytes represents the size of the removed files
+	Bytes int64 `json:"bytes"`
+}
+
+// SetRetentionPolicy sets how long the processed jobs and their files are kept.
+func (q *Queue) SetRetentionPolicy(policy RetentionPolicy) error {
+	if policy.AfterCompletion < 0 || policy.AfterDownload < 0 || policy.MaxStorage < 0 {
+		return errors.New("retention should be positive")
+	}
+
+	q.mu.Lock()
+	defer q.mu.Unlock()
+
+	q.retention = policy
+
+	return nil
+}
+
+// StartJanitor collects the garbage every interval until the context is done.
+func (q *Queue) StartJanitor(ctx context.Context, interval time.Duration) {
+	go func() {
+		ticker := time.NewTicker(interval)
+		defer ticker.Stop()
+
+		for {
+			select {
+			case <-ctx.Done():
+				return
+			case <-ticker.C:
+				stats, err := q.CollectGarbage()
+				if err != nil {
+					log.Errorf("Couldn't collect garbage: %s", err)
+				}
+
+				if stats.Jobs > 0 || stats.Files > 0 {
+					log.WithFields(log.Fields{
+						"jobs":  stats.Jobs,
+						"files": stats.Files,
+						"bytes": stats.Bytes,
+					}).Info("Collected garbage")
+				}
+
+				_, err = q.purgeIdempotencyKeys()
+				if err != nil {
+					log.Errorf("Couldn't delete expired idempotency keys: %s", err)
+				}
+			}
+		}
+	}()
+}
+
+// MarkTaskDownloaded records the download of the signed file of the task.
+func (q *Queue) MarkTaskDownloaded(jobID, taskID string) error {
+	q.mu.Lock()
+
+	// the processed job is loaded since it could be released from the queue
+	job, err := q.loadJob(jobID)
+	if err != nil {
+		q.mu.Unlock()
+
+		return err
+	}
+
+	// get task
+	task, exists := job.TasksMap[taskID]
+	if !exists {
+		q.mu.Unlock()
+
+		return errors.New("task is not found")
+	}
+
+	task.DownloadedAt = now()
+	job.TasksMap[taskID] = task
+	q.mu.Unlock()
+
+	return q.saveTasks(jobID, taskID)
+}
+
+// jobUsage represents the storage used by the processed job.
+type jobUsage struct {
+	id          string
+	completedAt time.Time
+	files       int
+	bytes       int64
+}
+
+// CollectGarbage deletes the processed jobs expired by the retention policy with their files
+// and removes the temporary files not used by any job.
+func (q *Queue) CollectGarbage() (GarbageStats, error) {
+	var stats GarbageStats
+
+	q.mu.RLock()
+	policy := q.retention
+	q.mu.RUnlock()
+
+	var (
+		usages     []jobUsage
+		expired    []jobUsage
+		totalBytes int64
+		usedFiles  = make(map[string]struct{})
+		t          = time.Now()
+	)
+
+	// check the files of all the saved jobs page by page, the jobs are deleted after they're listed
+	err := q.forEachJob(JobFilter{}, func(j Job) error {
+		usage := jobUsage{id: j.ID, completedAt: j.CompletedAt}
+
+		for _, task := range j.TasksMap {
+			usedFiles[task.InputFilePath] = struct{}{}
+			usedFiles[task.OutputFilePath] = struct{}{}
+
+			for _, s := range task.Steps {
+				usedFiles[s.OutputFilePath] = struct{}{}
+			}
+
+			if !task.Temporary {
+				continue
+			}
+
+			for _, path := range []string{task.InputFilePath, task.OutputFilePath} {
+				if info, err := os.Stat(path); err == nil {
+					usage.files++
+					usage.bytes += info.Size()
+				}
+			}
+		}
+
+		totalBytes += usage.bytes
+
+		// pending jobs are never deleted
+		if !j.IsCompleted() {
+			return nil
+		}
+
+		if policy.isExpired(j, t) {
+			expired = append(expired, usage)
+
+			return nil
+		}
+
+		usages = append(usages, usage)
+
+		return nil
+	})
+	if err != nil {
+		return stats, err
+	}
+
+	for _, usage := range expired {
+		err := q.deleteExpiredJob(usage, &stats)
+		if err != nil {
+			return stats, err
+		}
+
+		totalBytes -= usage.bytes
+	}
+
+	// delete the oldest processed jobs exceeding the maximum storage
+	if policy.MaxStorage > 0 && totalBytes > policy.MaxStorage {
+		sort.Slice(usages, func(i, j int) bool {
+			return usages[i].completedAt.Before(usages[j].completedAt)
+		})
+
+		for _, usage := range usages {
+			if totalBytes <= policy.MaxStorage {
+				break
+			}
+
+			err := q.deleteExpiredJob(usage, &stats)
+			if err != nil {
+				return stats, err
+			}
+
+			totalBytes -= usage.bytes
+		}
+	}
+
+	// remove temporary files not used by any job
+	paths, err := filepath.Glob(filepath.Join(os.TempDir(), TempFilePrefix+"*"))
+	if err != nil {
+		return stats, err
+	}
+
+	for _, path := range paths {
+		if _, used := usedFiles[path]; used {
+			continue
+		}
+
+		info, err := os.Stat(path)
+		if err != nil || info.IsDir() || t.Sub(info.ModTime()) < orphanedFileAge {
+			continue
+		}
+
+		if err := os.Remove(path); err == nil {
+			stats.Files++
+			stats.Bytes += info.Size()
+		}
+	}
+
+	return stats, nil
+}
+
+// deleteExpiredJob deletes the job with the files and adds it to the stats.
+func (q *Queue) deleteExpiredJob(usage jobUsage, stats *GarbageStats) error {
+	err := q.DeleteJob(usage.id)
+	if err != nil {
+		return errors.Wrapf(err, "delete job %s", usage.id)
+	}
+
+	stats.Jobs++
+	stats.Files += usage.files
+	stats.Bytes += usage.bytes
+
+	return nil
+}
+
+// isExpired checks if the processed job is expired by the policy.
+func (p RetentionPolicy) isExpired(j Job, t time.Time) bool {
+	if p.AfterCompletion > 0 && !j.CompletedAt.IsZero() && t.Sub(j.CompletedAt) > p.AfterCompletion {
+		return true
+	}
+
+	if p.AfterDownload > 0 {
+		downloadedAt := lastDownload(j)
+		if !downloadedAt.IsZero() && t.Sub(downloadedAt) > p.AfterDownload {
+			return true
+		}
+	}
+
+	return false
+}
+
+// lastDownload returns the time of the last download if all the signed files of the job were downloaded.
+func lastDownload(j Job) time.Time {
+	var last time.Time
+
+	for _, t := range j.TasksMap {
+		// only the signed files are downloaded
+		if t.Status != StatusCompleted || t.UnitName == VerificationUnitName {
+			continue
+		}
+
+		if t.DownloadedAt.IsZero() {
+			return time.Time{}
+		}
+
+		if t.DownloadedAt.After(last) {
+			last = t.DownloadedAt
+		}
+	}
+
+	return last
+}
@@ -0,0 +1,276 @@
+package queue
+
+import (
+	"context"
+	"math"
+	"net"
+	"sync/atomic"
+	"time"
+
+	"github.com/digitorus/pdfsigner/queues/priority_queue"
+	"github.com/digitorus/pdfsigner/signer"
+	"github.com/pkg/errors"
+	log "github.com/sirupsen/logrus"
+)
+
+// StatusDeadLetter represents a task failed with retryable error after all the attempts.
+var StatusDeadLetter = "DeadLetter"
+
+const (
+	// ErrorClassTSA represents temporary errors of the Time Stamping Authority.
+	ErrorClassTSA = signer.ServiceTSA
+	// ErrorClassOCSP represents temporary errors of the OCSP responders.
+	ErrorClassOCSP = signer.ServiceOCSP
+	// ErrorClassCRL represents temporary errors of the CRL distribution points.
+	ErrorClassCRL = signer.ServiceCRL
+	// ErrorClassHSM represents temporary errors of the PKCS11 tokens.
+	ErrorClassHSM = signer.ServiceHSM
+	// ErrorClassNetwork represents network errors and timeouts.
+	ErrorClassNetwork = "network"
+	// ErrorClassOther represents permanent and unknown errors, Ex. malformed documents.
+	ErrorClassOther = "other"
+)
+
+// DefaultRetryableErrors represents error classes retried if the retry policy doesn't define them.
+var DefaultRetryableErrors = []string{ErrorClassTSA, ErrorClassOCSP, ErrorClassCRL, ErrorClassHSM, ErrorClassNetwork}
+
+// defaultMaxBackoff represents maximum delay between the attempts if the retry policy doesn't define it.
+const defaultMaxBackoff = 10 * time.Minute
+
+// RetryPolicy represents retry settings of the unit.
+type RetryPolicy struct {
+	// MaxAttempts represents maximum number of the attempts, tasks are not retried if it's less than 2
+	MaxAttempts int
+	// Backoff represents delay before the first retry, the delay is doubled after every attempt
+	Backoff time.Duration
+	// MaxBackoff represents maximum delay between the attempts
+	MaxBackoff time.Duration
+	// Retryable represents error classes which are retried
+	Retryable []string
+}
+
+// Attempt represents a single attempt to process the task.
+type Attempt struct {
+	StartedAt  time.Time `json:"started_at"`
+	FinishedAt time.Time `json:"finished_at"`
+	Error      string    `json:"error,omitempty"`
+	ErrorClass string    `json:"error_class,omitempty"`
+}
+
+// SetUnitRetryPolicy sets the retry policy of the unit.
+func (q *Queue) SetUnitRetryPolicy(unitName string, policy RetryPolicy) error {
+	if policy.Backoff < 0 || policy.MaxBackoff < 0 {
+		return errors.New("backoff should be positive")
+	}
+
+	for _, class := range policy.Retryable {
+		if !isErrorClass(class) {
+			return errors.Errorf("unknown error class: %s", class)
+		}
+	}
+
+	q.mu.Lock()
+	defer q.mu.Unlock()
+
+	// check if the unit is in the map
+	u, exists := q.units[unitName]
+	if !exists {
+		return errors.New("unit is not in map")
+	}
+
+	u.retryPolicy = policy
+
+	return nil
+}
+
+// isRetryable checks if the error class is retried by the policy.
+func (p RetryPolicy) isRetryable(class string) bool {
+	retryable := p.Retryable
+	if len(retryable) == 0 {
+		retryable = DefaultRetryableErrors
+	}
+
+	for _, r := range retryable {
+		if r == class {
+			return true
+		}
+	}
+
+	return false
+}
+
+// backoff returns delay before the next attempt.
+func (p RetryPolicy) backoff(failedAttempts int) time.Duration {
+	maxBackoff := p.MaxBackoff
+	if maxBackoff == 0 {
+		maxBackoff = defaultMaxBackoff
+	}
+
+	backoff := float64(p.Backoff) * math.Pow(2, float64(failedAttempts-1))
+	if backoff > float64(maxBackoff) {
+		return maxBackoff
+	}
+
+	return time.Duration(backoff)
+}
+
+// failedStatus determines the status of the failed task, the task is retried if the status is pending.
+func (p RetryPolicy) failedStatus(class string, failedAttempts int) string {
+	// keep failing immediately if the retries are disabled
+	if p.MaxAttempts < 2 || !p.isRetryable(class) {
+		return StatusFailed
+	}
+
+	if failedAttempts < p.MaxAttempts {
+		return StatusPending
+	}
+
+	return StatusDeadLetter
+}
+
+// ClassifyError determines the class of the error to decide if the task should be retried.
+// The errors are classified by type, the failures of the services are classified by the service
+// only if they are temporary, all unknown errors are permanent.
+func ClassifyError(err error) string {
+	if err == nil {
+		return ""
+	}
+
+	// check failures of the TSA, OCSP responder, CRL distribution point and HSM
+	var serviceErr *signer.ServiceError
+	if errors.As(err, &serviceErr) {
+		if serviceErr.Temporary {
+			return serviceErr.Service
+		}
+
+		return ErrorClassOther
+	}
+
+	// check network errors
+	var (
+		netErr net.Error
+		opErr  *net.OpError
+		dnsErr *net.DNSError
+	)
+
+	if errors.As(err, &opErr) || errors.As(err, &dnsErr) || (errors.As(err, &netErr) && netErr.Timeout()) || errors.Is(err, context.DeadlineExceeded) {
+		return ErrorClassNetwork
+	}
+
+	return ErrorClassOther
+}
+
+// isErrorClass checks if the error class exists.
+func isErrorClass(class string) bool {
+	switch class {
+	case ErrorClassTSA, ErrorClassOCSP, ErrorClassCRL, ErrorClassHSM, ErrorClassNetwork, ErrorClassOther:
+		return true
+	}
+
+	return false
+}
+
+// scheduleRetry pushes the item of the task to the queue of the unit after the backoff.
+func (q *Queue) scheduleRetry(u *unit, item priority_queue.Item, backoff time.Duration) {
+	task := item.Value.(Task)
+
+	log.WithFields(log.Fields{
+		"jobID":   task.JobID,
+		"taskID":  task.ID,
+		"attempt": len(task.Attempts),
+		"backoff": backoff,
+	}).Infof("Retrying task: %s", task.Error)
+
+	time.AfterFunc(backoff, func() {
+		u.pq.Requeue(item)
+	})
+}
+
+// GetDeadLetterTasks returns dead lettered tasks, only tasks of the unit if the unit name is provided
+// and only tasks of the jobs added by the client if the client name is provided.
+// The jobs with the dead lettered tasks are found in the store.
+func (q *Queue) GetDeadLetterTasks(unitName, clientName string) ([]Task, error) {
+	var tasks []Task
+
+	// the tasks saved with the aliases of the unit are the tasks of the unit
+	names := map[string]bool{}
+	for _, name := range q.unitNames(unitName) {
+		names[name] = true
+	}
+
+	err := q.forEachJob(JobFilter{Status: StatusDeadLetter, Unit: unitName, Client: clientName}, func(j Job) error {
+		for _, t := range j.TasksMap {
+			if t.Status == StatusDeadLetter && (unitName == "" || names[t.UnitName]) {
+				tasks = append(tasks, t)
+			}
+		}
+
+		return nil
+	})
+
+	return tasks, err
+}
+
+// RequeueTask puts dead lettered task back to the queue of the unit.
+func (q *Queue) RequeueTask(jobID, taskID string) error {
+	q.mu.Lock()
+
+	// the dead lettered job is loaded since it could be released from the queue
+	job, err := q.loadJob(jobID)
+	if err != nil {
+		q.mu.Unlock()
+
+		return err
+	}
+
+	// get task
+	task, exists := job.TasksMap[taskID]
+	if !exists {
+		q.mu.Unlock()
+
+		return errors.New("task is not found")
+	}
+
+	if task.Status != StatusDeadLetter {
+		q.mu.Unlock()
+
+		return errors.New("task is not dead lettered")
+	}
+
+	// the task of the shared store is claimed by the workers of the unit
+	u, exists := q.getUnit(task.UnitName)
+	if !exists && q.shared == nil {
+		q.mu.Unlock()
+
+		return errors.Errorf("unit %q doesn't exist anymore", task.UnitName)
+	}
+
+	// the task saved with the alias of the unit is processed as the task of the unit
+	if exists {
+		task.UnitName = u.name
+	}
+
+	// reset the task to be processed again with all the attempts of the retry policy
+	task.Status = StatusPending
+	task.Error = ""
+	task.FailedAttempts = 0
+	task.FinishedAt = time.Time{}
+	job.TasksMap[taskID] = task
+	atomic.AddUint32(&job.TotalProcesedTasks, ^uint32(0))
+	job.updateCompletedAt()
+	events := newJobEvents(job, task)
+	q.mu.Unlock()
+
+	err = q.saveTasks(jobID, taskID)
+	if err != nil {
+		return err
+	}
+
+	q.publish(events...)
+
+	if q.shared == nil {
+		u.pq.Requeue(taskItem(job, task))
+	}
+
+	return nil
+}
@@ -0,0 +1,168 @@
+package queue
+
+import (
+	"container/heap"
+	"sync/atomic"
+	"time"
+
+	"github.com/pkg/errors"
+	log "github.com/sirupsen/logrus"
+)
+
+// StatusScheduled represents a task waiting for the not before time to be queued.
+var StatusScheduled = "Scheduled"
+
+// maxSchedulerSleep represents maximum time the scheduler waits without checking the due tasks.
+const maxSchedulerSleep = time.Hour
+
+// scheduledTask represents the task waiting in the scheduled state.
+type scheduledTask struct {
+	notBefore time.Time
+	jobID     string
+	taskID    string
+}
+
+// scheduledHeap implements heap.Interface ordering the tasks by the not before time.
+type scheduledHeap []scheduledTask
+
+func (h scheduledHeap) Len() int { return len(h) }
+
+func (h scheduledHeap) Less(i, j int) bool { return h[i].notBefore.Before(h[j].notBefore) }
+
+func (h scheduledHeap) Swap(i, j int) { h[i], h[j] = h[j], h[i] }
+
+func (h *scheduledHeap) Push(x interface{}) {
+	*h = append(*h, x.(scheduledTask))
+}
+
+func (h *scheduledHeap) Pop() interface{} {
+	old := *h
+	n := len(old)
+	s := old[n-1]
+	*h = old[:n-1]
+
+	return s
+}
+
+// isScheduled checks if the task should wait for the not before time.
+func (t Task) isScheduled() bool {
+	return !t.NotBefore.IsZero() && t.NotBefore.After(now())
+}
+
+// schedule adds the task to the scheduled tasks and wakes up the scheduler, the lock should be held.
+func (q *Queue) schedule(task Task) {
+	heap.Push(&q.scheduled, scheduledTask{notBefore: task.NotBefore, jobID: task.JobID, taskID: task.ID})
+
+	select {
+	case q.scheduleWake <- struct{}{}:
+	default:
+	}
+}
+
+// runScheduler queues the scheduled tasks when they're due until the workers are stopped.
+func (q *Queue) runScheduler() {
+	timer := time.NewTimer(0)
+	defer timer.Stop()
+
+	for {
+		select {
+		case <-timer.C:
+		case <-q.scheduleWake:
+		case <-q.stopCtx.Done():
+			return
+		}
+
+		// sleep until the next task is due
+		sleep := maxSchedulerSleep
+
+		next := q.queueDueTasks()
+		if !next.IsZero() && time.Until(next) < sleep {
+			sleep = time.Until(next)
+		}
+
+		timer.Reset(sleep)
+	}
+}
+
+// queueDueTasks moves the scheduled tasks which are due to the queues of their units,
+// returns the not before time of the next scheduled task or zero time if there are no scheduled tasks.
+func (q *Queue) queueDueTasks() time.Time {
+	var (
+		items     []unitItem
+		events    []Event
+		savedJobs = map[string]bool{}
+	)
+
+	q.mu.Lock()
+
+	for len(q.scheduled) > 0 && !q.scheduled[0].notBefore.After(now()) {
+		s := heap.Pop(&q.scheduled).(scheduledTask)
+
+		// skip the tasks cancelled or deleted while they were scheduled
+		job, exists := q.jobs[s.jobID]
+		if !exists {
+			continue
+		}
+
+		task, exists := job.TasksMap[s.taskID]
+		if !exists || task.Status != StatusScheduled {
+			continue
+		}
+
+		savedJobs[job.ID] = true
+
+		// fail the task if the unit was removed after the restart
+		u, exists := q.getUnit(task.UnitName)
+		if !exists {
+			task.Status = StatusFailed
+			task.Error = errors.Errorf("couldn't queue scheduled task: unit %q doesn't exist anymore", task.UnitName).Error()
+			job.TasksMap[task.ID] = task
+			atomic.AddUint32(&job.TotalProcesedTasks, 1)
+			job.updateCompletedAt()
+
+			events = append(events, newJobEvents(job, task)...)
+
+			continue
+		}
+
+		task.Status = StatusPending
+		task.UnitName = u.name
+		job.TasksMap[task.ID] = task
+
+		items = append(items, unitItem{unit: u, item: taskItem(job, task)})
+		events = append(events, newJobEvents(job, task)...)
+	}
+
+	var next time.Time
+	if len(q.scheduled) > 0 {
+		next = q.scheduled[0].notBefore
+	}
+
+	q.mu.Unlock()
+
+	// save the status of the tasks
+	for jobID := range savedJobs {
+		err := q.SaveToDB(jobID)
+		if err != nil {
+			log.Errorf("Couldn't save job %s: %s", jobID, err)
+		}
+	}
+
+	// notify waiting for the jobs
+	if len(events) > 0 {
+		q.notifyJobsUpdated()
+	}
+
+	if len(items) > 0 {
+		log.Infof("Queuing %d scheduled tasks...", len(items))
+	}
+
+	q.publish(events...)
+
+	// the scheduled tasks were accepted before, so they're queued regardless of the capacity
+	for _, i := range items {
+		i.unit.pq.Requeue(i.item)
+	}
+
+	return next
+}
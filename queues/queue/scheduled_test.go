@@ -0,0 +1,69 @@
+package queue
+
+import (
+	"context"
+	"io"
+	"testing"
+	"time"
+
+	"github.com/digitorus/pdfsigner/queues/priority_queue"
+	"github.com/sirupsen/logrus"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestScheduledTasks(t *testing.T) {
+	logrus.SetOutput(io.Discard)
+
+	qs := NewQueue()
+	qs.AddVerifyUnit()
+
+	jobID := qs.AddVerifyJob(JobVerifyConfig{})
+	notBefore := time.Now().Add(200 * time.Millisecond)
+
+	// add the task scheduled shortly, the task scheduled later and the task due already
+	scheduledID, err := qs.AddScheduledTask(VerificationUnitName, jobID, "SampleSignedPDFDocument.pdf", "../../testfiles/SampleSignedPDFDocument.pdf", "", priority_queue.HighPriority, notBefore)
+	assert.NoError(t, err)
+
+	laterID, err := qs.AddScheduledTask(VerificationUnitName, jobID, "SampleSignedPDFDocument.pdf", "../../testfiles/SampleSignedPDFDocument.pdf", "", priority_queue.HighPriority, time.Now().Add(time.Hour))
+	assert.NoError(t, err)
+
+	dueID, err := qs.AddScheduledTask(VerificationUnitName, jobID, "SampleSignedPDFDocument.pdf", "../../testfiles/SampleSignedPDFDocument.pdf", "", priority_queue.HighPriority, time.Now().Add(-time.Minute))
+	assert.NoError(t, err)
+
+	job, err := qs.GetJobByID(jobID)
+	assert.NoError(t, err)
+	assert.Equal(t, StatusScheduled, job.TasksMap[scheduledID].Status)
+	assert.Equal(t, StatusScheduled, job.TasksMap[laterID].Status)
+	assert.Equal(t, StatusPending, job.TasksMap[dueID].Status)
+
+	// only the due task is queued
+	size, err := qs.GetQueueSizeByUnitName(VerificationUnitName)
+	assert.NoError(t, err)
+	assert.Equal(t, 1, size.High)
+
+	// cancel the scheduled task
+	assert.NoError(t, qs.CancelTask(jobID, laterID))
+	assert.NoError(t, qs.SaveToDB(jobID))
+
+	// the scheduled task is queued when it's due after the restart
+	loaded := NewQueue()
+	loaded.AddVerifyUnit()
+	assert.NoError(t, loaded.LoadFromDB())
+
+	loaded.StartProcessor()
+
+	ctx, cancel := context.WithTimeout(context.Background(), 30*time.Second)
+	defer cancel()
+
+	defer func() { _ = loaded.Shutdown(ctx) }()
+
+	job, err = loaded.WaitForJob(ctx, jobID)
+	assert.NoError(t, err)
+	assert.Equal(t, StatusCompleted, job.TasksMap[scheduledID].Status)
+	assert.Equal(t, StatusCompleted, job.TasksMap[dueID].Status)
+	assert.Equal(t, StatusCancelled, job.TasksMap[laterID].Status)
+
+	if assert.Len(t, job.TasksMap[scheduledID].Attempts, 1) {
+		assert.False(t, job.TasksMap[scheduledID].Attempts[0].StartedAt.Before(notBefore.Truncate(time.Millisecond)))
+	}
+}
@@ -0,0 +1,399 @@
+package queue
+
+import (
+	"context"
+	"sync/atomic"
+	"time"
+
+	"github.com/digitorus/pdfsigner/queues/priority_queue"
+	"github.com/pkg/errors"
+	log "github.com/sirupsen/logrus"
+)
+
+// LeaseStore represents the store shared by several nodes of the queue. The tasks are claimed by the workers with the leases
+// renewed while the tasks are processed, the tasks of the crashed workers are claimed again when the leases expire.
+type LeaseStore interface {
+	Store
+	// ClaimTasks leases up to the limit of the pending tasks and the due scheduled tasks of the unit to the worker until the time
+	ClaimTasks(worker, unitName string, limit int, until time.Time) ([]Task, error)
+	// RenewLeases extends the leases of the tasks held by the worker and returns the ids of the tasks which are not leased to it anymore
+	RenewLeases(worker string, taskIDs []string, until time.Time) ([]string, error)
+	// ReleaseLeases releases the leases of the tasks held by the worker
+	ReleaseLeases(worker string, taskIDs []string) error
+	// QueueSize returns the number of the tasks of the unit waiting to be claimed by the priority
+	QueueSize(unitName string) (priority_queue.LenAll, error)
+	// ClaimJobCompletion marks the completion of the completed job as notified and returns true if it wasn't notified before
+	ClaimJobCompletion(jobID string) (bool, error)
+}
+
+// DefaultLease represents how long the claimed task is leased to the worker if the lease is not set.
+const DefaultLease = 30 * time.Second
+
+// sharedPollInterval represents how often the workers claim the tasks and the waiting for the jobs check the store.
+var sharedPollInterval = 500 * time.Millisecond
+
+// sharedQueue represents the state of the queue sharing the store with other nodes.
+type sharedQueue struct {
+	// store represents the store shared by the nodes
+	store LeaseStore
+	// worker represents id of the worker claiming the tasks, the tasks are not claimed if it's empty
+	worker string
+	// lease represents how long the claimed tasks are leased to the worker
+	lease time.Duration
+	// leased represents the tasks leased to the worker by id of the task
+	leased map[string]leasedTask
+	// heartbeatCtx is done when the leases shouldn't be renewed anymore
+	heartbeatCtx context.Context
+	// stopHeartbeat stops renewing the leases
+	stopHeartbeat context.CancelFunc
+}
+
+// leasedTask represents the task leased to the worker.
+type leasedTask struct {
+	jobID    string
+	unitName string
+}
+
+// SetShared makes the queue a node sharing the store with other nodes, the store should support the leases and it should be set before.
+// The worker with the id claims the tasks of its units from the store instead of processing the tasks added to the queue,
+// the node without the worker id only adds the tasks to the store and reads the jobs processed by the workers.
+func (q *Queue) SetShared(worker string, lease time.Duration) error {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+
+	store, ok := q.store.(LeaseStore)
+	if !ok {
+		return errors.New("store doesn't support leases of the tasks")
+	}
+
+	if lease < 0 {
+		return errors.New("lease should be positive")
+	}
+
+	if lease == 0 {
+		lease = DefaultLease
+	}
+
+	heartbeatCtx, stopHeartbeat := context.WithCancel(context.Background())
+
+	q.shared = &sharedQueue{
+		store:         store,
+		worker:        worker,
+		lease:         lease,
+		leased:        make(map[string]leasedTask),
+		heartbeatCtx:  heartbeatCtx,
+		stopHeartbeat: stopHeartbeat,
+	}
+
+	return nil
+}
+
+// ClaimJobCompletion checks if the completion of the job should be notified by the node. The last tasks of the job
+// of the shared store could be saved by several nodes at the same time, so the completion is notified by the node claiming it first.
+// The completion is always notified by the queue without the shared store.
+func (q *Queue) ClaimJobCompletion(jobID string) (bool, error) {
+	if q.shared == nil {
+		return true, nil
+	}
+
+	return q.shared.store.ClaimJobCompletion(jobID)
+}
+
+// holdsLease checks if the task is leased to the worker, the tasks of the queue without the shared store are always held.
+// The lock should be held.
+func (q *Queue) holdsLease(taskID string) bool {
+	if q.shared == nil {
+		return true
+	}
+
+	_, leased := q.shared.leased[taskID]
+
+	return leased
+}
+
+// leasedTasks returns the number of the tasks of the unit leased to the worker, the lock should be held.
+func (s *sharedQueue) leasedTasks(unitName string) int {
+	n := 0
+
+	for _, l := range s.leased {
+		if l.unitName == unitName {
+			n++
+		}
+	}
+
+	return n
+}
+
+// countProcessedTasks sets the number of the processed tasks of the job by the statuses of the tasks.
+func (j *Job) countProcessedTasks() {
+	var processed uint32
+
+	for _, t := range j.TasksMap {
+		if t.Status != StatusPending && t.Status != StatusScheduled {
+			processed++
+		}
+	}
+
+	atomic.StoreUint32(&j.TotalProcesedTasks, processed)
+}
+
+// refreshJob updates the job of the queue by the saved job, since other tasks of the job could be processed by other workers.
+// The tasks leased to the worker are kept, the lock should be held.
+func (q *Queue) refreshJob(job, saved *Job) {
+	for id, t := range saved.TasksMap {
+		if _, leased := q.shared.leased[id]; !leased {
+			job.TasksMap[id] = t
+		}
+	}
+
+	job.countProcessedTasks()
+	job.CompletedAt = saved.CompletedAt
+	job.updateCompletedAt()
+}
+
+// startClaiming starts the go routines claiming the tasks of the units from the shared store and renewing the leases.
+func (q *Queue) startClaiming() {
+	q.mu.RLock()
+	defer q.mu.RUnlock()
+
+	for _, u := range q.units {
+		q.workers.Add(1)
+
+		go func(u *unit) {
+			defer q.workers.Done()
+
+			q.runClaimer(u)
+		}(u)
+	}
+
+	// the leases are renewed until the tasks being processed are finished
+	go q.runHeartbeat()
+}
+
+// runClaimer claims the tasks of the unit until the workers are stopped.
+func (q *Queue) runClaimer(u *unit) {
+	ticker := time.NewTicker(sharedPollInterval)
+	defer ticker.Stop()
+
+	for {
+		err := q.claimTasks(u)
+		if err != nil && q.stopCtx.Err() == nil {
+			log.Errorf("Couldn't claim tasks of %s: %s", u.name, err)
+		}
+
+		select {
+		case <-ticker.C:
+		case <-q.stopCtx.Done():
+			return
+		}
+	}
+}
+
+// claimTasks claims the tasks of the unit for the free workers and queues them.
+func (q *Queue) claimTasks(u *unit) error {
+	q.mu.RLock()
+	free := u.workers - q.shared.leasedTasks(u.name)
+	q.mu.RUnlock()
+
+	if free <= 0 {
+		return nil
+	}
+
+	tasks, err := q.shared.store.ClaimTasks(q.shared.worker, u.name, free, time.Now().Add(q.shared.lease))
+	if err != nil {
+		return errors.Wrap(err, "claim tasks")
+	}
+
+	for _, t := range tasks {
+		err := q.queueClaimedTask(u, t)
+		if err == nil {
+			continue
+		}
+
+		log.WithFields(log.Fields{
+			"jobID":  t.JobID,
+			"taskID": t.ID,
+		}).Warnf("Couldn't queue claimed task: %s", err)
+
+		// the task could be claimed by other workers
+		err = q.shared.store.ReleaseLeases(q.shared.worker, []string{t.ID})
+		if err != nil {
+			return errors.Wrap(err, "release lease")
+		}
+	}
+
+	return nil
+}
+
+// queueClaimedTask adds the job of the claimed task to the queue and pushes the task to the queue of the unit,
+// the due scheduled task becomes pending.
+func (q *Queue) queueClaimedTask(u *unit, claimed Task) error {
+	// the job is loaded with the write lock held, so the job isn't updated by the older saved job
+	q.mu.Lock()
+
+	saved, err := q.shared.store.LoadJob(claimed.JobID)
+	if err != nil {
+		q.mu.Unlock()
+
+		return errors.Wrap(err, "load job")
+	}
+
+	if saved == nil {
+		q.mu.Unlock()
+
+		return errors.New("job doesn't exists")
+	}
+
+	job, exists := q.jobs[saved.ID]
+	if exists {
+		q.refreshJob(job, saved)
+	} else {
+		job = saved
+		q.jobs[job.ID] = job
+	}
+
+	task, exists := job.TasksMap[claimed.ID]
+	if !exists || (task.Status != StatusPending && task.Status != StatusScheduled) {
+		q.releaseJob(job.ID)
+		q.mu.Unlock()
+
+		return errors.New("task is not pending")
+	}
+
+	q.shared.leased[task.ID] = leasedTask{jobID: job.ID, unitName: u.name}
+
+	var events []Event
+
+	scheduled := task.Status == StatusScheduled
+	if scheduled {
+		task.Status = StatusPending
+		job.TasksMap[task.ID] = task
+		events = newJobEvents(job, task)
+	}
+	q.mu.Unlock()
+
+	// the task is processed even if the status is not saved, the status is saved with the result
+	if scheduled {
+		err := q.saveTasks(job.ID, task.ID)
+		if err != nil {
+			log.Errorf("Couldn't save job %s: %s", job.ID, err)
+		}
+
+		q.publish(events...)
+	}
+
+	// the claimed task is queued regardless of the capacity
+	u.pq.Requeue(taskItem(job, task))
+
+	return nil
+}
+
+// runHeartbeat renews the leases of the tasks held by the worker until the leases are released.
+func (q *Queue) runHeartbeat() {
+	ticker := time.NewTicker(q.shared.lease / 3)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ticker.C:
+		case <-q.shared.heartbeatCtx.Done():
+			return
+		}
+
+		q.mu.RLock()
+		taskIDs := make([]string, 0, len(q.shared.leased))
+		for id := range q.shared.leased {
+			taskIDs = append(taskIDs, id)
+		}
+		q.mu.RUnlock()
+
+		if len(taskIDs) == 0 {
+			continue
+		}
+
+		err := q.renewLeases(taskIDs...)
+		if err != nil {
+			log.Errorf("Couldn't renew leases: %s", err)
+		}
+	}
+}
+
+// renewLeases extends the leases of the tasks and drops the tasks which are not leased to the worker anymore.
+func (q *Queue) renewLeases(taskIDs ...string) error {
+	lost, err := q.shared.store.RenewLeases(q.shared.worker, taskIDs, time.Now().Add(q.shared.lease))
+	if err != nil {
+		return errors.Wrap(err, "renew leases")
+	}
+
+	if len(lost) > 0 {
+		q.dropLeases(lost)
+	}
+
+	return nil
+}
+
+// dropLeases stops tracking the tasks which are not leased to the worker anymore, the tasks could be cancelled
+// or claimed by another worker after the lease expired. The queued tasks are removed and the results of the tasks being processed are discarded.
+func (q *Queue) dropLeases(taskIDs []string) {
+	var (
+		lost  = make(map[string]struct{}, len(taskIDs))
+		units = make(map[*unit]struct{})
+	)
+
+	q.mu.Lock()
+
+	for _, id := range taskIDs {
+		l, leased := q.shared.leased[id]
+		if !leased {
+			continue
+		}
+
+		delete(q.shared.leased, id)
+		lost[id] = struct{}{}
+
+		if u, exists := q.units[l.unitName]; exists {
+			units[u] = struct{}{}
+		}
+
+		q.releaseJob(l.jobID)
+	}
+	q.mu.Unlock()
+
+	for u := range units {
+		u.pq.Remove(func(i priority_queue.Item) bool {
+			_, exists := lost[i.Value.(Task).ID]
+
+			return exists
+		})
+	}
+
+	if len(lost) > 0 {
+		log.WithField("tasks", len(lost)).Warn("Leases of the tasks are lost")
+	}
+}
+
+// releaseLeases stops renewing the leases and releases the leases of the tasks which are not processed,
+// so they're claimed by other workers without waiting for the leases to expire.
+func (q *Queue) releaseLeases() error {
+	if q.shared == nil || q.shared.worker == "" {
+		return nil
+	}
+
+	q.shared.stopHeartbeat()
+
+	q.mu.Lock()
+	taskIDs := make([]string, 0, len(q.shared.leased))
+	for id := range q.shared.leased {
+		if _, processing := q.processing[id]; !processing {
+			taskIDs = append(taskIDs, id)
+			delete(q.shared.leased, id)
+		}
+	}
+	q.mu.Unlock()
+
+	if len(taskIDs) == 0 {
+		return nil
+	}
+
+	return errors.Wrap(q.shared.store.ReleaseLeases(q.shared.worker, taskIDs), "release leases")
+}
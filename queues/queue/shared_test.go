@@ -0,0 +1,237 @@
+package queue
+
+import (
+	"context"
+	"io"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/digitorus/pdfsigner/queues/priority_queue"
+	"github.com/sirupsen/logrus"
+	"github.com/stretchr/testify/assert"
+)
+
+// newSharedQueue creates the queue of the node using the separate connection to the shared SQLite database like another process.
+func newSharedQueue(t *testing.T, path, worker string, lease time.Duration) *Queue {
+	t.Helper()
+
+	store, err := NewSQLiteStore(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	t.Cleanup(func() { _ = store.Close() })
+
+	qs := NewQueue()
+	qs.SetStore(store)
+	qs.AddVerifyUnit()
+
+	err = qs.SetShared(worker, lease)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	return qs
+}
+
+func TestLeases(t *testing.T) {
+	logrus.SetOutput(io.Discard)
+
+	path := filepath.Join(t.TempDir(), "jobs.db")
+	api := newSharedQueue(t, path, "", 0)
+
+	jobID := api.AddVerifyJob(JobVerifyConfig{})
+
+	for i := 0; i < 2; i++ {
+		_, err := api.AddTask(VerificationUnitName, jobID, "file.pdf", "../../testfiles/SampleSignedPDFDocument.pdf", "", priority_queue.HighPriority)
+		assert.NoError(t, err)
+	}
+
+	// the tasks are waiting in the store
+	size, err := api.GetQueueSizeByUnitName(VerificationUnitName)
+	assert.NoError(t, err)
+	assert.Equal(t, 2, size.High)
+	assert.Equal(t, map[string]int{DefaultTenant: 2}, size.Tenants)
+
+	api.mu.RLock()
+	assert.Empty(t, api.jobs)
+	api.mu.RUnlock()
+
+	store, err := NewSQLiteStore(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer func() { _ = store.Close() }()
+
+	// the first worker crashes after the task is claimed
+	crashed, err := store.ClaimTasks("first", VerificationUnitName, 1, time.Now().Add(100*time.Millisecond))
+	assert.NoError(t, err)
+	assert.Len(t, crashed, 1)
+
+	// the leased task is not claimed by other workers
+	claimed, err := store.ClaimTasks("second", VerificationUnitName, 2, time.Now().Add(time.Minute))
+	assert.NoError(t, err)
+	assert.Len(t, claimed, 1)
+	assert.NotEqual(t, crashed[0].ID, claimed[0].ID)
+
+	lost, err := store.RenewLeases("second", []string{claimed[0].ID}, time.Now().Add(time.Minute))
+	assert.NoError(t, err)
+	assert.Empty(t, lost)
+
+	// the task of the crashed worker is claimed again after the lease expired
+	time.Sleep(150 * time.Millisecond)
+
+	reclaimed, err := store.ClaimTasks("second", VerificationUnitName, 2, time.Now().Add(time.Minute))
+	assert.NoError(t, err)
+	assert.Len(t, reclaimed, 1)
+	assert.Equal(t, crashed[0].ID, reclaimed[0].ID)
+
+	lost, err = store.RenewLeases("first", []string{crashed[0].ID}, time.Now().Add(time.Minute))
+	assert.NoError(t, err)
+	assert.Equal(t, []string{crashed[0].ID}, lost)
+
+	// the released tasks are claimed by other workers
+	assert.NoError(t, store.ReleaseLeases("second", []string{claimed[0].ID, reclaimed[0].ID}))
+
+	size, err = api.GetQueueSizeByUnitName(VerificationUnitName)
+	assert.NoError(t, err)
+	assert.Equal(t, 2, size.High)
+
+	// the cancelled task is not leased anymore
+	claimed, err = store.ClaimTasks("second", VerificationUnitName, 1, time.Now().Add(time.Minute))
+	assert.NoError(t, err)
+	assert.NoError(t, api.CancelTask(jobID, claimed[0].ID))
+
+	lost, err = store.RenewLeases("second", []string{claimed[0].ID}, time.Now().Add(time.Minute))
+	assert.NoError(t, err)
+	assert.Equal(t, []string{claimed[0].ID}, lost)
+}
+
+func TestSharedWorkers(t *testing.T) {
+	logrus.SetOutput(io.Discard)
+
+	interval := sharedPollInterval
+	sharedPollInterval = 10 * time.Millisecond
+
+	defer func() { sharedPollInterval = interval }()
+
+	path := filepath.Join(t.TempDir(), "jobs.db")
+	api := newSharedQueue(t, path, "", 0)
+
+	var jobIDs []string
+
+	for i := 0; i < 3; i++ {
+		jobID := api.AddVerifyJob(JobVerifyConfig{})
+
+		for j := 0; j < 2; j++ {
+			_, err := api.AddTask(VerificationUnitName, jobID, "file.pdf", "../../testfiles/SampleSignedPDFDocument.pdf", "", priority_queue.HighPriority)
+			assert.NoError(t, err)
+		}
+
+		jobIDs = append(jobIDs, jobID)
+	}
+
+	// the scheduled task is claimed when it's due
+	scheduledJobID := api.AddVerifyJob(JobVerifyConfig{})
+	_, err := api.AddScheduledTask(VerificationUnitName, scheduledJobID, "file.pdf", "../../testfiles/SampleSignedPDFDocument.pdf", "", priority_queue.HighPriority, now().Add(200*time.Millisecond))
+	assert.NoError(t, err)
+
+	jobIDs = append(jobIDs, scheduledJobID)
+
+	// the workers of separate processes share the tasks
+	completed := make(chan string, len(jobIDs)*2)
+
+	for _, worker := range []string{"first", "second"} {
+		w := newSharedQueue(t, path, worker, time.Second)
+		assert.NoError(t, w.SetUnitWorkers(VerificationUnitName, 2))
+
+		w.Subscribe(func(e Event) {
+			if e.Type != EventJobCompleted {
+				return
+			}
+
+			claimed, err := w.ClaimJobCompletion(e.Job.ID)
+			assert.NoError(t, err)
+
+			if claimed {
+				completed <- e.Job.ID
+			}
+		})
+
+		w.StartProcessor()
+
+		defer func() {
+			assert.NoError(t, w.Shutdown(context.Background()))
+		}()
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+
+	for _, jobID := range jobIDs {
+		job, err := api.WaitForJob(ctx, jobID)
+		assert.NoError(t, err)
+		assert.True(t, job.IsCompleted())
+		assert.False(t, job.CompletedAt.IsZero())
+
+		// every task is processed once
+		for _, task := range job.TasksMap {
+			assert.Equal(t, StatusCompleted, task.Status)
+			assert.Len(t, task.Attempts, 1)
+		}
+	}
+
+	// the completion of every job is claimed once by the workers
+	notified := make(map[string]int)
+
+	for range jobIDs {
+		select {
+		case jobID := <-completed:
+			notified[jobID]++
+		case <-ctx.Done():
+			t.Fatal("job completion is not published")
+		}
+	}
+
+	for _, jobID := range jobIDs {
+		assert.Equal(t, 1, notified[jobID])
+	}
+
+	claimed, err := api.ClaimJobCompletion(jobIDs[0])
+	assert.NoError(t, err)
+	assert.False(t, claimed)
+
+	size, err := api.GetQueueSizeByUnitName(VerificationUnitName)
+	assert.NoError(t, err)
+	assert.Equal(t, priority_queue.LenAll{}, size)
+}
+
+func TestSharedIdempotencyKeys(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "jobs.db")
+	first := newSharedQueue(t, path, "", 0)
+	second := newSharedQueue(t, path, "", 0)
+
+	jobID := first.AddVerifyJob(JobVerifyConfig{})
+	_, err := first.AddTask(VerificationUnitName, jobID, "file.pdf", "../../testfiles/SampleSignedPDFDocument.pdf", "", priority_queue.HighPriority)
+	assert.NoError(t, err)
+	assert.NoError(t, first.SetIdempotencyKey("verify:client:key", jobID))
+
+	// the key is found by another node
+	id, err := second.IdempotentJobID("verify:client:key")
+	assert.NoError(t, err)
+	assert.Equal(t, jobID, id)
+
+	// the expired keys are deleted by any node
+	assert.NoError(t, first.SetIdempotencyWindow(time.Nanosecond))
+	assert.NoError(t, first.SetIdempotencyKey("verify:client:expired", jobID))
+	time.Sleep(time.Millisecond)
+
+	id, err = second.IdempotentJobID("verify:client:expired")
+	assert.NoError(t, err)
+	assert.Empty(t, id)
+
+	deleted, err := second.purgeIdempotencyKeys()
+	assert.NoError(t, err)
+	assert.Equal(t, 1, deleted)
+}
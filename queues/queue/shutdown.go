@@ -0,0 +1,83 @@
+package queue
+
+import (
+	"context"
+
+	"github.com/pkg/errors"
+	log "github.com/sirupsen/logrus"
+)
+
+// Shutdown stops the workers taking the tasks, waits until the tasks being processed are finished or the context is done
+// and saves all the jobs to the db, so the pending tasks are queued again when the jobs are loaded after the restart.
+// The worker sharing the store releases the leases of the tasks which are not processed instead, every task is already saved.
+// If the context is done first, the results of the tasks still being processed are discarded and never saved,
+// so the store could be closed, such tasks stay pending and are processed again after the restart.
+func (q *Queue) Shutdown(ctx context.Context) error {
+	q.stopWorkers()
+
+	// wait for the tasks being processed
+	done := make(chan struct{})
+
+	go func() {
+		q.workers.Wait()
+		close(done)
+	}()
+
+	var waitErr error
+
+	select {
+	case <-done:
+	case <-ctx.Done():
+		// the workers can't be interrupted while signing, so their results are abandoned
+		q.mu.Lock()
+		q.abandoned = true
+		processing := len(q.processing)
+		q.mu.Unlock()
+
+		// wait for the results being saved before the timeout
+		q.saving.Wait()
+
+		waitErr = errors.Wrapf(ctx.Err(), "%d tasks are not finished", processing)
+	}
+
+	// the unprocessed tasks are claimed by other workers
+	if q.shared != nil {
+		err := q.releaseLeases()
+		if err != nil {
+			return err
+		}
+
+		return waitErr
+	}
+
+	// save the jobs even if the tasks are not finished, unfinished tasks stay pending
+	err := q.saveAllToDB()
+	if err != nil {
+		return err
+	}
+
+	return waitErr
+}
+
+// saveAllToDB saves all the jobs of the queue to the store.
+func (q *Queue) saveAllToDB() error {
+	// save consistent state of the jobs
+	q.mu.RLock()
+	defer q.mu.RUnlock()
+
+	for id, job := range q.jobs {
+		// the jobs without tasks are not saved
+		if len(job.TasksMap) == 0 {
+			continue
+		}
+
+		err := q.store.SaveJob(job)
+		if err != nil {
+			return errors.Wrapf(err, "saving job %s", id)
+		}
+	}
+
+	log.WithField("jobs", len(q.jobs)).Debug("Saved jobs")
+
+	return nil
+}
@@ -0,0 +1,131 @@
+package queue
+
+import (
+	"context"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/digitorus/pdfsign/sign"
+	"github.com/digitorus/pdfsigner/license"
+	"github.com/digitorus/pdfsigner/queues/priority_queue"
+	"github.com/sirupsen/logrus"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestShutdown(t *testing.T) {
+	logrus.SetOutput(io.Discard)
+
+	qs := NewQueue()
+	qs.AddVerifyUnit()
+	qs.StartProcessor()
+
+	jobID := qs.AddVerifyJob(JobVerifyConfig{})
+
+	for i := 0; i < 4; i++ {
+		_, err := qs.AddTask(VerificationUnitName, jobID, "SampleSignedPDFDocument.pdf", "../../testfiles/SampleSignedPDFDocument.pdf", "", priority_queue.HighPriority)
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 30*time.Second)
+	defer cancel()
+
+	// the tasks being processed are finished
+	assert.NoError(t, qs.Shutdown(ctx))
+	assert.Len(t, qs.processing, 0)
+
+	job, err := qs.GetJobByID(jobID)
+	assert.NoError(t, err)
+
+	// the tasks are not taken after shutdown
+	_, err = qs.AddTask(VerificationUnitName, jobID, "SampleSignedPDFDocument.pdf", "../../testfiles/SampleSignedPDFDocument.pdf", "", priority_queue.HighPriority)
+	assert.NoError(t, err)
+
+	time.Sleep(50 * time.Millisecond)
+
+	stopped, err := qs.GetJobByID(jobID)
+	assert.NoError(t, err)
+	assert.Equal(t, job.TotalProcesedTasks, stopped.TotalProcesedTasks)
+
+	// the state of the job is saved to be continued after the restart
+	loaded := NewQueue()
+	assert.NoError(t, loaded.LoadFromDB())
+
+	loadedJob, err := loaded.GetJobByID(jobID)
+	assert.NoError(t, err)
+	assert.Equal(t, job.TotalProcesedTasks, loadedJob.TotalProcesedTasks)
+
+	for id, task := range job.TasksMap {
+		assert.Equal(t, task.Status, loadedJob.TasksMap[id].Status)
+	}
+}
+
+func TestShutdownTimeout(t *testing.T) {
+	logrus.SetOutput(io.Discard)
+
+	err := license.Initialize([]byte(license.TestLicense))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// the TSA doesn't respond until it's released
+	release := make(chan struct{})
+	tsa := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		<-release
+		http.Error(w, "unavailable", http.StatusServiceUnavailable)
+	}))
+	defer tsa.Close()
+
+	qs := NewQueue()
+	qs.AddVerifyUnit()
+	assert.NoError(t, qs.AddPipeline(Pipeline{Name: "stamp", Steps: []PipelineStep{{Type: StepTimestamp, TSA: sign.TSA{URL: tsa.URL}}}}))
+	qs.StartProcessor()
+
+	jobID, err := qs.AddPipelineJob("stamp", JobSignConfig{})
+	assert.NoError(t, err)
+
+	taskID, err := qs.AddTask("", jobID, "testfile12.pdf", "../../testfiles/testfile12.pdf", "", priority_queue.HighPriority)
+	assert.NoError(t, err)
+
+	assert.Eventually(t, func() bool {
+		qs.mu.RLock()
+		defer qs.mu.RUnlock()
+
+		return len(qs.processing) == 1
+	}, 5*time.Second, 10*time.Millisecond)
+
+	ctx, cancel := context.WithTimeout(context.Background(), 50*time.Millisecond)
+	defer cancel()
+
+	// the task is saved as pending
+	assert.Error(t, qs.Shutdown(ctx))
+
+	loaded := NewQueue()
+	assert.NoError(t, loaded.LoadFromDB())
+
+	loadedJob, err := loaded.GetJobByID(jobID)
+	assert.NoError(t, err)
+	assert.Equal(t, StatusPending, loadedJob.TasksMap[taskID].Status)
+
+	// the result of the task finished after the timeout is discarded
+	close(release)
+
+	assert.Eventually(t, func() bool {
+		qs.mu.RLock()
+		defer qs.mu.RUnlock()
+
+		return len(qs.processing) == 0
+	}, 5*time.Second, 10*time.Millisecond)
+
+	job, err := qs.GetJobByID(jobID)
+	assert.NoError(t, err)
+	assert.Equal(t, StatusPending, job.TasksMap[taskID].Status)
+	assert.Empty(t, job.TasksMap[taskID].Attempts)
+
+	// the pending job isn't loaded by other tests
+	assert.NoError(t, loaded.DeleteJob(jobID))
+}
@@ -0,0 +1,115 @@
+package queue
+
+import (
+	"sync"
+	"time"
+
+	"github.com/pkg/errors"
+)
+
+// UnitStats represents processing statistics of the unit used to size the workers.
+type UnitStats struct {
+	// Name represents the name of the unit
+	Name string `json:"name"`
+	// Workers represents the number of the tasks processed concurrently
+	Workers int `json:"workers"`
+	// Active represents the number of the tasks being processed
+	Active int `json:"active"`
+	// Processed represents the number of the processed tasks since the processor started
+	Processed uint64 `json:"processed"`
+	// Failed represents the number of the failed tasks since the processor started
+	Failed uint64 `json:"failed"`
+	// AverageTaskSeconds represents average processing time of the task
+	AverageTaskSeconds float64 `json:"average_task_seconds"`
+	// TasksPerMinute represents throughput of the unit since the processor started
+	TasksPerMinute float64 `json:"tasks_per_minute"`
+	// Utilization represents the share of the time workers were busy, from 0 to 1
+	Utilization float64 `json:"utilization"`
+	// Since represents the time the processor started
+	Since time.Time `json:"since"`
+}
+
+// unitStats collects processing statistics of the unit.
+type unitStats struct {
+	mu        sync.Mutex
+	since     time.Time
+	active    int
+	processed uint64
+	failed    uint64
+	busy      time.Duration
+}
+
+// reset resets the statistics when the processor starts.
+func (s *unitStats) reset() {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.since = time.Now()
+	s.active = 0
+	s.processed = 0
+	s.failed = 0
+	s.busy = 0
+}
+
+// start registers started task and returns function to register it's result.
+func (s *unitStats) start() func(err error) {
+	started := time.Now()
+
+	s.mu.Lock()
+	s.active++
+	s.mu.Unlock()
+
+	return func(err error) {
+		s.mu.Lock()
+		defer s.mu.Unlock()
+
+		s.active--
+		s.processed++
+		s.busy += time.Since(started)
+
+		if err != nil {
+			s.failed++
+		}
+	}
+}
+
+// GetUnitStats returns processing statistics of the unit.
+func (q *Queue) GetUnitStats(unitName string) (UnitStats, error) {
+	q.mu.RLock()
+
+	// check if the unit is in the map
+	u, exists := q.units[unitName]
+	if !exists {
+		q.mu.RUnlock()
+
+		return UnitStats{}, errors.New("unit is not in map")
+	}
+
+	workers := u.workers
+	q.mu.RUnlock()
+
+	u.stats.mu.Lock()
+	defer u.stats.mu.Unlock()
+
+	stats := UnitStats{
+		Name:      u.name,
+		Workers:   workers,
+		Active:    u.stats.active,
+		Processed: u.stats.processed,
+		Failed:    u.stats.failed,
+		Since:     u.stats.since,
+	}
+
+	if stats.Processed > 0 {
+		stats.AverageTaskSeconds = u.stats.busy.Seconds() / float64(stats.Processed)
+	}
+
+	// calculate throughput if the processor is started
+	if !stats.Since.IsZero() {
+		elapsed := time.Since(stats.Since)
+		stats.TasksPerMinute = float64(stats.Processed) / elapsed.Minutes()
+		stats.Utilization = u.stats.busy.Seconds() / (elapsed.Seconds() * float64(workers))
+	}
+
+	return stats, nil
+}
@@ -0,0 +1,526 @@
+package queue
+
+import (
+	"encoding/base64"
+	"encoding/json"
+	"strings"
+
+	"github.com/digitorus/pdfsigner/db"
+	"github.com/pkg/errors"
+)
+
+// Store represents the storage of the jobs and the tasks of the queue.
+// The queue keeps only unfinished jobs in memory, the processed jobs are loaded from the store when they're requested.
+type Store interface {
+	// SaveJob saves the job with all the tasks
+	SaveJob(job *Job) error
+	// SaveTasks saves the job and the changed tasks of the job in a single transaction
+	SaveTasks(job *Job, taskIDs []string) error
+	// LoadJob loads the job with the tasks, nil is returned if the job doesn't exist
+	LoadJob(jobID string) (*Job, error)
+	// LoadUnfinishedJobs loads the jobs with the tasks which are not processed yet
+	LoadUnfinishedJobs() ([]*Job, error)
+	// ListJobs returns the jobs matching the validated filter from the newest to the oldest and the cursor of the next page
+	ListJobs(f JobFilter) ([]Job, string, error)
+	// DeleteJob deletes the job with the tasks
+	DeleteJob(jobID string) error
+	// Close closes the store
+	Close() error
+}
+
+// SetStore sets the store of the jobs and the tasks, the bolt store is used by default.
+// The store should be set before the jobs are loaded or added.
+func (q *Queue) SetStore(s Store) {
+	q.mu.Lock()
+	q.store = s
+	q.mu.Unlock()
+}
+
+// loadJob returns the job of the queue or loads it from the store to the queue, the write lock should be held.
+func (q *Queue) loadJob(jobID string) (*Job, error) {
+	if job, exists := q.jobs[jobID]; exists {
+		return job, nil
+	}
+
+	job, err := q.store.LoadJob(jobID)
+	if err != nil {
+		return nil, errors.Wrap(err, "load job")
+	}
+
+	if job == nil {
+		return nil, errors.New("job doesn't exists")
+	}
+
+	q.jobs[jobID] = job
+
+	return job, nil
+}
+
+// findJob returns a copy of the job of the queue or the job loaded from the store without adding it to the queue.
+func (q *Queue) findJob(jobID string) (Job, error) {
+	q.mu.RLock()
+	if job, exists := q.jobs[jobID]; exists {
+		j := job.copy()
+		q.mu.RUnlock()
+
+		return j, nil
+	}
+	q.mu.RUnlock()
+
+	job, err := q.store.LoadJob(jobID)
+	if err != nil {
+		return Job{}, errors.Wrap(err, "load job")
+	}
+
+	if job == nil {
+		return Job{}, errors.New("job doesn't exists")
+	}
+
+	return *job, nil
+}
+
+// saveTasks saves the changed tasks of the job and releases the job if it's processed.
+func (q *Queue) saveTasks(jobID string, taskIDs ...string) error {
+	if q.shared != nil {
+		return q.saveSharedTasks(jobID, taskIDs)
+	}
+
+	q.mu.RLock()
+
+	// check if the job is in the map
+	job, exists := q.jobs[jobID]
+	if !exists {
+		q.mu.RUnlock()
+
+		return errors.New("job doesn't exists")
+	}
+
+	err := q.store.SaveTasks(job, taskIDs)
+	q.mu.RUnlock()
+
+	if err != nil {
+		return errors.Wrapf(err, "save job %s", jobID)
+	}
+
+	q.mu.Lock()
+	q.releaseJob(jobID)
+	q.mu.Unlock()
+
+	return nil
+}
+
+// saveSharedTasks saves the changed tasks of the job and updates the job by the saved job, since other tasks of the job
+// could be saved by other nodes sharing the store. The job is saved and loaded with the write lock held,
+// so the job isn't updated by the older saved job loaded by another go routine.
+func (q *Queue) saveSharedTasks(jobID string, taskIDs []string) error {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+
+	// check if the job is in the map
+	job, exists := q.jobs[jobID]
+	if !exists {
+		return errors.New("job doesn't exists")
+	}
+
+	err := q.store.SaveTasks(job, taskIDs)
+	if err != nil {
+		return errors.Wrapf(err, "save job %s", jobID)
+	}
+
+	saved, err := q.store.LoadJob(jobID)
+	if err != nil {
+		return errors.Wrapf(err, "load job %s", jobID)
+	}
+
+	if saved != nil {
+		q.refreshJob(job, saved)
+	}
+
+	q.releaseJob(jobID)
+
+	return nil
+}
+
+// releaseJob removes the processed job from the queue when none of the tasks are processed anymore,
+// so the history doesn't have to fit in memory. The job of the shared store is removed when none of the tasks are leased,
+// since the tasks are processed by other nodes. The job should be saved and the write lock should be held.
+func (q *Queue) releaseJob(jobID string) {
+	job, exists := q.jobs[jobID]
+	if !exists || (q.shared == nil && !job.IsCompleted()) {
+		return
+	}
+
+	for id := range job.TasksMap {
+		if _, processing := q.processing[id]; processing {
+			return
+		}
+
+		if q.shared != nil && q.holdsLease(id) {
+			return
+		}
+	}
+
+	delete(q.jobs, jobID)
+}
+
+// forEachJob calls the function for every saved job matching the filter from the newest to the oldest,
+// the jobs are loaded page by page.
+func (q *Queue) forEachJob(f JobFilter, fn func(j Job) error) error {
+	f.Limit = MaxJobsLimit
+
+	for {
+		jobs, cursor, err := q.ListJobs(f)
+		if err != nil {
+			return err
+		}
+
+		for _, j := range jobs {
+			err := fn(j)
+			if err != nil {
+				return err
+			}
+		}
+
+		if cursor == "" {
+			return nil
+		}
+
+		f.Cursor = cursor
+	}
+}
+
+const (
+	dbJobPrefix = "job_"
+	// dbJobTaskPrefix represents the prefix of the tasks saved separately from the jobs, Ex. jobtask_<job id>_<task id>
+	dbJobTaskPrefix = "jobtask_"
+	// dbUnfinishedJobPrefix represents the prefix of the index of the unfinished jobs
+	dbUnfinishedJobPrefix = "jobunfinished_"
+	// dbJobStoreVersionKey represents the key of the format of the saved jobs
+	dbJobStoreVersionKey = "jobstore_version"
+)
+
+// boltStoreVersion represents the format of the saved jobs, the tasks are saved separately and the unfinished jobs are indexed.
+const boltStoreVersion = "2"
+
+// BoltStore represents the store saving the jobs to the bolt db shared by the application,
+// every task is saved as a separate value, the jobs are indexed to be listed and the unfinished jobs are indexed to be loaded.
+type BoltStore struct{}
+
+// NewBoltStore creates the store saving the jobs to the bolt db.
+func NewBoltStore() *BoltStore {
+	return &BoltStore{}
+}
+
+// SaveJob saves the job with all the tasks and the index, the tasks removed from the job are deleted.
+func (s *BoltStore) SaveJob(job *Job) error {
+	taskIDs := make([]string, 0, len(job.TasksMap))
+	for id := range job.TasksMap {
+		taskIDs = append(taskIDs, id)
+	}
+
+	values, deleteKeys, err := boltJobValues(job, taskIDs)
+	if err != nil {
+		return err
+	}
+
+	savedTasks, err := db.LoadByPrefix(jobTaskKeyPrefix(job.ID))
+	if err != nil {
+		return err
+	}
+
+	for k := range savedTasks {
+		if _, exists := values[k]; !exists {
+			deleteKeys = append(deleteKeys, k)
+		}
+	}
+
+	return db.UpdateBatch(values, deleteKeys)
+}
+
+// SaveTasks saves the job without the tasks, the changed tasks and the index in a single transaction.
+func (s *BoltStore) SaveTasks(job *Job, taskIDs []string) error {
+	values, deleteKeys, err := boltJobValues(job, taskIDs)
+	if err != nil {
+		return err
+	}
+
+	return db.UpdateBatch(values, deleteKeys)
+}
+
+// boltJobValues returns the job without the tasks, the tasks with the ids and the index of the job to save
+// and the outdated keys of the index to delete.
+func boltJobValues(job *Job, taskIDs []string) (map[string][]byte, []string, error) {
+	// the tasks are saved as separate values
+	j := *job
+	j.TasksMap = nil
+
+	marshaledJob, err := json.Marshal(j)
+	if err != nil {
+		return nil, nil, errors.Wrap(err, "marshal job")
+	}
+
+	values := map[string][]byte{dbJobPrefix + job.ID: marshaledJob}
+
+	for _, id := range taskIDs {
+		t, exists := job.TasksMap[id]
+		if !exists {
+			continue
+		}
+
+		b, err := marshalWithoutPublicKeys(t)
+		if err != nil {
+			return nil, nil, errors.Wrap(err, "marshal task")
+		}
+
+		values[jobTaskKeyPrefix(job.ID)+id] = b
+	}
+
+	// index the job to list the jobs without loading all of them
+	deleteKeys, err := updateJobIndex(job, values)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	// index the unfinished job to load it without loading all the jobs
+	if job.IsCompleted() {
+		deleteKeys = append(deleteKeys, dbUnfinishedJobPrefix+job.ID)
+	} else {
+		values[dbUnfinishedJobPrefix+job.ID] = []byte{}
+	}
+
+	return values, deleteKeys, nil
+}
+
+// jobTaskKeyPrefix returns the prefix of the keys of the tasks of the job.
+func jobTaskKeyPrefix(jobID string) string {
+	return dbJobTaskPrefix + jobID + "_"
+}
+
+// LoadJob loads the job with the tasks, nil is returned if the job doesn't exist.
+func (s *BoltStore) LoadJob(jobID string) (*Job, error) {
+	b, err := db.LoadByKey(dbJobPrefix + jobID)
+	if err != nil || b == nil {
+		return nil, err
+	}
+
+	return unmarshalJob(b)
+}
+
+// LoadUnfinishedJobs loads the jobs found by the index of the unfinished jobs,
+// the jobs saved in the previous format are saved again before they're loaded.
+func (s *BoltStore) LoadUnfinishedJobs() ([]*Job, error) {
+	version, err := db.LoadByKey(dbJobStoreVersionKey)
+	if err != nil {
+		return nil, err
+	}
+
+	if string(version) != boltStoreVersion {
+		err := s.migrate()
+		if err != nil {
+			return nil, errors.Wrap(err, "migrate jobs")
+		}
+	}
+
+	unfinished, err := db.LoadByPrefix(dbUnfinishedJobPrefix)
+	if err != nil {
+		return nil, errors.Wrap(err, "loading jobs from the db")
+	}
+
+	var jobs []*Job
+
+	for k := range unfinished {
+		job, err := s.LoadJob(strings.TrimPrefix(k, dbUnfinishedJobPrefix))
+		if err != nil {
+			return nil, err
+		}
+
+		if job != nil && !job.IsCompleted() {
+			jobs = append(jobs, job)
+		}
+	}
+
+	return jobs, nil
+}
+
+// migrate saves every job in the current format, the tasks of the jobs saved before are saved with the job
+// and the jobs saved before the jobs were indexed are indexed.
+func (s *BoltStore) migrate() error {
+	dbJobs, err := db.BatchLoad(dbJobPrefix)
+	if err != nil {
+		return errors.Wrap(err, "loading jobs from the db")
+	}
+
+	for _, b := range dbJobs {
+		job, err := unmarshalJob(b)
+		if err != nil {
+			return err
+		}
+
+		err = s.SaveJob(job)
+		if err != nil {
+			return errors.Wrapf(err, "save job %s", job.ID)
+		}
+	}
+
+	return db.SaveByKey(dbJobStoreVersionKey, []byte(boltStoreVersion))
+}
+
+// ListJobs returns the jobs found by the index of the most selective condition of the filter.
+func (s *BoltStore) ListJobs(f JobFilter) ([]Job, string, error) {
+	prefix := jobIndexKeyPrefix(f.indexEntry())
+
+	var from string
+
+	if f.Cursor != "" {
+		position, err := decodeJobCursor(f.Cursor)
+		if err != nil {
+			return nil, "", err
+		}
+
+		from = prefix + position
+	}
+
+	// start from the upper bound of the creation time
+	if !f.CreatedBefore.IsZero() {
+		before := prefix + formatIndexTime(f.CreatedBefore)
+		if from == "" || before < from {
+			from = before
+		}
+	}
+
+	var createdAfter string
+	if !f.CreatedAfter.IsZero() {
+		createdAfter = formatIndexTime(f.CreatedAfter)
+	}
+
+	var (
+		jobs     []Job
+		position string
+	)
+
+	for {
+		keys, err := db.ScanKeysReverse(prefix, from, jobIndexScanSize)
+		if err != nil {
+			return nil, "", err
+		}
+
+		for _, k := range keys {
+			p := strings.TrimPrefix(k, prefix)
+
+			// the keys are sorted by the creation time
+			created, jobID := p[:len(jobIndexTimeFormat)], p[len(jobIndexTimeFormat)+1:]
+			if created < createdAfter {
+				return jobs, "", nil
+			}
+
+			job, err := s.LoadJob(jobID)
+			if err != nil {
+				return nil, "", err
+			}
+
+			// skip the job deleted after it was found or not matching other conditions
+			if job == nil || !job.matches(f) {
+				continue
+			}
+
+			// there are more jobs after the page
+			if len(jobs) == f.Limit {
+				return jobs, encodeJobCursor(position), nil
+			}
+
+			jobs = append(jobs, *job)
+			position = p
+		}
+
+		if len(keys) < jobIndexScanSize {
+			return jobs, "", nil
+		}
+
+		from = keys[len(keys)-1]
+	}
+}
+
+// DeleteJob deletes the job with the index.
+func (s *BoltStore) DeleteJob(jobID string) error {
+	keys, err := loadJobIndexKeys(jobID)
+	if err != nil {
+		return err
+	}
+
+	tasks, err := db.LoadByPrefix(jobTaskKeyPrefix(jobID))
+	if err != nil {
+		return err
+	}
+
+	for k := range tasks {
+		keys = append(keys, k)
+	}
+
+	keys = append(keys, dbJobPrefix+jobID, dbJobIndexKeysPrefix+jobID, dbUnfinishedJobPrefix+jobID)
+
+	return db.UpdateBatch(nil, keys)
+}
+
+// Close does nothing since the bolt db is shared by the application.
+func (s *BoltStore) Close() error {
+	return nil
+}
+
+// unmarshalJob unmarshals the saved job and loads the tasks saved separately,
+// the tasks of the jobs saved in the previous format are saved with the job.
+func unmarshalJob(b []byte) (*Job, error) {
+	var job Job
+
+	err := json.Unmarshal(b, &job)
+	if err != nil {
+		return nil, errors.Wrap(err, "unmarshal job")
+	}
+
+	dbTasks, err := db.LoadByPrefix(jobTaskKeyPrefix(job.ID))
+	if err != nil {
+		return nil, errors.Wrap(err, "load tasks")
+	}
+
+	if job.TasksMap == nil {
+		job.TasksMap = make(map[string]Task, len(dbTasks))
+	}
+
+	for _, b := range dbTasks {
+		var t Task
+
+		err := json.Unmarshal(b, &t)
+		if err != nil {
+			return nil, errors.Wrap(err, "unmarshal task")
+		}
+
+		job.TasksMap[t.ID] = t
+	}
+
+	// restore public keys of the verification data
+	for _, t := range job.TasksMap {
+		err := restoreCertificates(t.VerificationData)
+		if err != nil {
+			return nil, errors.Wrap(err, "restore job certificates")
+		}
+	}
+
+	// jobs saved before the completion time was tracked expire since they're loaded
+	job.updateCompletedAt()
+
+	return &job, nil
+}
+
+// encodeJobCursor encodes the position of the last listed job, the creation time and the id of the job.
+func encodeJobCursor(position string) string {
+	return base64.RawURLEncoding.EncodeToString([]byte(position))
+}
+
+// decodeJobCursor decodes the position of the last listed job.
+func decodeJobCursor(cursor string) (string, error) {
+	position, err := base64.RawURLEncoding.DecodeString(cursor)
+	if err != nil || len(position) <= len(jobIndexTimeFormat)+1 || position[len(jobIndexTimeFormat)] != '_' {
+		return "", errors.New("cursor is not correct")
+	}
+
+	return string(position), nil
+}
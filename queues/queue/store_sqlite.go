@@ -0,0 +1,732 @@
+package queue
+
+import (
+	"database/sql"
+	"encoding/json"
+	"fmt"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/digitorus/pdfsigner/queues/priority_queue"
+	// register the sqlite3 driver
+	_ "github.com/mattn/go-sqlite3"
+	"github.com/pkg/errors"
+)
+
+// sqliteSchema creates the tables of the jobs and the tasks with the indexes used to list the jobs.
+const sqliteSchema = `
+CREATE TABLE IF NOT EXISTS jobs (
+	id TEXT PRIMARY KEY,
+	type TEXT NOT NULL,
+	client TEXT NOT NULL,
+	created_at TEXT NOT NULL,
+	completed INTEGER NOT NULL,
+	data BLOB NOT NULL
+);
+CREATE INDEX IF NOT EXISTS jobs_created_at ON jobs (created_at, id);
+CREATE INDEX IF NOT EXISTS jobs_type ON jobs (type, created_at, id);
+CREATE INDEX IF NOT EXISTS jobs_client ON jobs (client, created_at, id);
+CREATE INDEX IF NOT EXISTS jobs_completed ON jobs (completed);
+CREATE TABLE IF NOT EXISTS tasks (
+	id TEXT PRIMARY KEY,
+	job_id TEXT NOT NULL REFERENCES jobs (id) ON DELETE CASCADE,
+	status TEXT NOT NULL,
+	units TEXT NOT NULL,
+	file_name TEXT NOT NULL,
+	data BLOB NOT NULL
+);
+CREATE INDEX IF NOT EXISTS tasks_job_id ON tasks (job_id);
+CREATE INDEX IF NOT EXISTS tasks_status ON tasks (status, job_id);
+CREATE INDEX IF NOT EXISTS tasks_file_name ON tasks (file_name, job_id);
+`
+
+// sqliteLeaseSchema adds the columns used by the workers to claim the tasks and the completion time of the jobs
+// maintained by the database, since the tasks of the job could be saved by several workers.
+// The columns of the tasks saved before are filled from the saved tasks.
+const sqliteLeaseSchema = `
+ALTER TABLE jobs ADD COLUMN completed_at TEXT NOT NULL DEFAULT '';
+ALTER TABLE tasks ADD COLUMN unit_name TEXT NOT NULL DEFAULT '';
+ALTER TABLE tasks ADD COLUMN priority INTEGER NOT NULL DEFAULT 0;
+ALTER TABLE tasks ADD COLUMN not_before INTEGER NOT NULL DEFAULT 0;
+ALTER TABLE tasks ADD COLUMN duplicate_of TEXT NOT NULL DEFAULT '';
+ALTER TABLE tasks ADD COLUMN lease_owner TEXT NOT NULL DEFAULT '';
+ALTER TABLE tasks ADD COLUMN lease_expires_at INTEGER NOT NULL DEFAULT 0;
+UPDATE tasks SET
+	unit_name = coalesce(json_extract(data, '$.unit_name'), ''),
+	priority = coalesce(json_extract(data, '$.priority'), 0),
+	not_before = coalesce(CAST(strftime('%s', json_extract(data, '$.not_before')) AS INTEGER), 0) * 1000000000,
+	duplicate_of = coalesce(json_extract(data, '$.duplicate_of'), '');
+CREATE INDEX IF NOT EXISTS tasks_claim ON tasks (unit_name, status, priority);
+`
+
+// sqliteSharedStateSchema adds the state shared by the nodes besides the jobs: the flag of the sent completion notification,
+// the idempotency keys and the encrypted state of the license limits. The completion of the jobs saved before is treated as notified.
+const sqliteSharedStateSchema = `
+ALTER TABLE jobs ADD COLUMN completion_notified INTEGER NOT NULL DEFAULT 0;
+UPDATE jobs SET completion_notified = completed;
+CREATE TABLE IF NOT EXISTS idempotency_keys (
+	key TEXT PRIMARY KEY,
+	job_id TEXT NOT NULL,
+	expires_at INTEGER NOT NULL
+);
+CREATE TABLE IF NOT EXISTS license_state (
+	id INTEGER PRIMARY KEY CHECK (id = 1),
+	data BLOB NOT NULL
+);
+`
+
+// sqliteMigrations represents the changes of the schema applied in order, the version of the schema is the number of the applied changes.
+var sqliteMigrations = []string{sqliteSchema, sqliteLeaseSchema, sqliteSharedStateSchema}
+
+// sqliteClaimable represents the condition of the tasks which could be claimed by the worker,
+// the duplicates get the result of the task with the same content.
+const sqliteClaimable = `duplicate_of = '' AND (status = 'Pending' OR (status = 'Scheduled' AND not_before <= ?)) AND (lease_owner = '' OR lease_expires_at < ?)`
+
+// SQLiteStore represents the store saving the jobs to the embedded SQLite database,
+// every task is saved as a separate row, so the changed tasks are saved without the whole job.
+type SQLiteStore struct {
+	db *sql.DB
+}
+
+// NewSQLiteStore opens the SQLite database of the jobs, the database is created if it doesn't exist.
+func NewSQLiteStore(path string) (*SQLiteStore, error) {
+	// the write ahead log is synced on every commit, so the saved tasks survive the crash,
+	// the transactions take the write lock when they begin, so the processes sharing the database wait for each other
+	d, err := sql.Open("sqlite3", "file:"+path+"?_journal_mode=WAL&_synchronous=FULL&_foreign_keys=on&_busy_timeout=5000&_txlock=immediate")
+	if err != nil {
+		return nil, errors.Wrap(err, "open sqlite store")
+	}
+
+	// the writes are serialized by the single connection
+	d.SetMaxOpenConns(1)
+
+	s := &SQLiteStore{db: d}
+
+	err = s.migrate()
+	if err != nil {
+		_ = d.Close()
+
+		return nil, errors.Wrap(err, "create sqlite store")
+	}
+
+	return s, nil
+}
+
+// migrate applies the changes of the schema which are not applied yet, every change is applied in a separate transaction
+// and the version is checked inside of it, so the processes opening the database at the same time apply it once.
+func (s *SQLiteStore) migrate() error {
+	for {
+		applied := false
+
+		err := s.update(func(tx *sql.Tx) error {
+			var version int
+
+			err := tx.QueryRow("PRAGMA user_version").Scan(&version)
+			if err != nil || version >= len(sqliteMigrations) {
+				return err
+			}
+
+			_, err = tx.Exec(sqliteMigrations[version])
+			if err != nil {
+				return errors.Wrapf(err, "migrate to version %d", version+1)
+			}
+
+			_, err = tx.Exec(fmt.Sprintf("PRAGMA user_version = %d", version+1))
+			applied = true
+
+			return err
+		})
+		if err != nil || !applied {
+			return err
+		}
+	}
+}
+
+// SaveJob saves the job and replaces all the tasks of the job.
+func (s *SQLiteStore) SaveJob(job *Job) error {
+	taskIDs := make([]string, 0, len(job.TasksMap))
+	for id := range job.TasksMap {
+		taskIDs = append(taskIDs, id)
+	}
+
+	return s.update(func(tx *sql.Tx) error {
+		_, err := tx.Exec("DELETE FROM tasks WHERE job_id = ?", job.ID)
+		if err != nil {
+			return err
+		}
+
+		return saveSQLiteJob(tx, job, taskIDs)
+	})
+}
+
+// SaveTasks saves the job and the tasks with the ids in a single transaction.
+func (s *SQLiteStore) SaveTasks(job *Job, taskIDs []string) error {
+	return s.update(func(tx *sql.Tx) error {
+		return saveSQLiteJob(tx, job, taskIDs)
+	})
+}
+
+// LoadJob loads the job with the tasks, nil is returned if the job doesn't exist.
+func (s *SQLiteStore) LoadJob(jobID string) (*Job, error) {
+	var r sqliteJobRow
+
+	err := s.db.QueryRow("SELECT data, completed_at FROM jobs WHERE id = ?", jobID).Scan(&r.data, &r.completedAt)
+	if errors.Is(err, sql.ErrNoRows) {
+		return nil, nil
+	}
+
+	if err != nil {
+		return nil, errors.Wrap(err, "load job")
+	}
+
+	return s.loadTasks(r)
+}
+
+// LoadUnfinishedJobs loads the jobs which are not processed yet.
+func (s *SQLiteStore) LoadUnfinishedJobs() ([]*Job, error) {
+	rows, err := s.queryJobs("SELECT data, completed_at FROM jobs WHERE completed = 0")
+	if err != nil {
+		return nil, err
+	}
+
+	jobs := make([]*Job, 0, len(rows))
+
+	for _, r := range rows {
+		job, err := s.loadTasks(r)
+		if err != nil {
+			return nil, err
+		}
+
+		jobs = append(jobs, job)
+	}
+
+	return jobs, nil
+}
+
+// ListJobs returns the jobs matching the conditions of the filter, the conditions on the tasks are checked by the subqueries.
+func (s *SQLiteStore) ListJobs(f JobFilter) ([]Job, string, error) {
+	var (
+		conditions []string
+		args       []interface{}
+	)
+
+	where := func(condition string, values ...interface{}) {
+		conditions = append(conditions, condition)
+		args = append(args, values...)
+	}
+
+	if f.Type != "" {
+		where("j.type = ?", f.Type)
+	}
+
+	if f.Client != "" {
+		where("j.client = ?", f.Client)
+	}
+
+	if !f.CreatedAfter.IsZero() {
+		where("j.created_at >= ?", formatIndexTime(f.CreatedAfter))
+	}
+
+	if !f.CreatedBefore.IsZero() {
+		where("j.created_at < ?", formatIndexTime(f.CreatedBefore))
+	}
+
+	if f.Cursor != "" {
+		position, err := decodeJobCursor(f.Cursor)
+		if err != nil {
+			return nil, "", err
+		}
+
+		created, jobID := position[:len(jobIndexTimeFormat)], position[len(jobIndexTimeFormat)+1:]
+		where("(j.created_at < ? OR (j.created_at = ? AND j.id < ?))", created, created, jobID)
+	}
+
+	if f.Status != "" {
+		where("EXISTS (SELECT 1 FROM tasks t WHERE t.job_id = j.id AND t.status = ?)", f.Status)
+	}
+
+	if f.Unit != "" {
+		where("EXISTS (SELECT 1 FROM tasks t WHERE t.job_id = j.id AND instr(t.units, ?) > 0)", "|"+f.Unit+"|")
+	}
+
+	if f.FileName != "" {
+		where("EXISTS (SELECT 1 FROM tasks t WHERE t.job_id = j.id AND t.file_name = ?)", strings.ToLower(f.FileName))
+	}
+
+	query := "SELECT j.data, j.completed_at FROM jobs j"
+	if len(conditions) > 0 {
+		query += " WHERE " + strings.Join(conditions, " AND ")
+	}
+
+	// get one more job to know if there is the next page
+	query += " ORDER BY j.created_at DESC, j.id DESC LIMIT ?"
+	args = append(args, f.Limit+1)
+
+	rows, err := s.queryJobs(query, args...)
+	if err != nil {
+		return nil, "", err
+	}
+
+	var (
+		jobs       []Job
+		nextCursor string
+	)
+
+	for i, r := range rows {
+		if i == f.Limit {
+			last := jobs[len(jobs)-1]
+			nextCursor = encodeJobCursor(last.indexPosition())
+
+			break
+		}
+
+		job, err := s.loadTasks(r)
+		if err != nil {
+			return nil, "", err
+		}
+
+		jobs = append(jobs, *job)
+	}
+
+	return jobs, nextCursor, nil
+}
+
+// DeleteJob deletes the job with the tasks.
+func (s *SQLiteStore) DeleteJob(jobID string) error {
+	return s.update(func(tx *sql.Tx) error {
+		_, err := tx.Exec("DELETE FROM jobs WHERE id = ?", jobID)
+
+		return err
+	})
+}
+
+// Close closes the database.
+func (s *SQLiteStore) Close() error {
+	return s.db.Close()
+}
+
+// update runs the function in the transaction, the transaction is rolled back if the function fails.
+func (s *SQLiteStore) update(fn func(tx *sql.Tx) error) error {
+	tx, err := s.db.Begin()
+	if err != nil {
+		return errors.Wrap(err, "begin transaction")
+	}
+
+	err = fn(tx)
+	if err != nil {
+		_ = tx.Rollback()
+
+		return err
+	}
+
+	return errors.Wrap(tx.Commit(), "commit transaction")
+}
+
+// sqliteJobRow represents the job row without the tasks.
+type sqliteJobRow struct {
+	data        []byte
+	completedAt string
+}
+
+// queryJobs reads all the rows of the jobs before the tasks are loaded, since the single connection is used.
+func (s *SQLiteStore) queryJobs(query string, args ...interface{}) ([]sqliteJobRow, error) {
+	rows, err := s.db.Query(query, args...)
+	if err != nil {
+		return nil, errors.Wrap(err, "query jobs")
+	}
+	defer func() { _ = rows.Close() }()
+
+	var res []sqliteJobRow
+
+	for rows.Next() {
+		var r sqliteJobRow
+
+		err := rows.Scan(&r.data, &r.completedAt)
+		if err != nil {
+			return nil, errors.Wrap(err, "scan job")
+		}
+
+		res = append(res, r)
+	}
+
+	return res, errors.Wrap(rows.Err(), "query jobs")
+}
+
+// loadTasks unmarshals the job and loads the tasks of the job.
+func (s *SQLiteStore) loadTasks(r sqliteJobRow) (*Job, error) {
+	var job Job
+
+	err := json.Unmarshal(r.data, &job)
+	if err != nil {
+		return nil, errors.Wrap(err, "unmarshal job")
+	}
+
+	rows, err := s.db.Query("SELECT data FROM tasks WHERE job_id = ?", job.ID)
+	if err != nil {
+		return nil, errors.Wrap(err, "load tasks")
+	}
+	defer func() { _ = rows.Close() }()
+
+	job.TasksMap = make(map[string]Task)
+
+	for rows.Next() {
+		var b []byte
+
+		err := rows.Scan(&b)
+		if err != nil {
+			return nil, errors.Wrap(err, "scan task")
+		}
+
+		var t Task
+
+		err = json.Unmarshal(b, &t)
+		if err != nil {
+			return nil, errors.Wrap(err, "unmarshal task")
+		}
+
+		// restore public keys of the verification data
+		err = restoreCertificates(t.VerificationData)
+		if err != nil {
+			return nil, errors.Wrap(err, "restore task certificates")
+		}
+
+		job.TasksMap[t.ID] = t
+	}
+
+	if err := rows.Err(); err != nil {
+		return nil, errors.Wrap(err, "load tasks")
+	}
+
+	// the tasks of the job could be saved by several workers, so the progress is counted by the saved tasks
+	job.countProcessedTasks()
+
+	if r.completedAt != "" {
+		job.CompletedAt, err = time.Parse(time.RFC3339Nano, r.completedAt)
+		if err != nil {
+			return nil, errors.Wrap(err, "parse completion time")
+		}
+	}
+
+	// the jobs saved before the completion time was saved to the column
+	job.updateCompletedAt()
+
+	return &job, nil
+}
+
+// saveSQLiteJob saves the job row and the rows of the tasks with the ids.
+func saveSQLiteJob(tx *sql.Tx, job *Job, taskIDs []string) error {
+	// the tasks are saved as separate rows
+	j := *job
+	j.TasksMap = nil
+
+	data, err := json.Marshal(j)
+	if err != nil {
+		return errors.Wrap(err, "marshal job")
+	}
+
+	_, err = tx.Exec(`INSERT INTO jobs (id, type, client, created_at, completed, data) VALUES (?, ?, ?, ?, ?, ?)
+		ON CONFLICT (id) DO UPDATE SET type = excluded.type, client = excluded.client, completed = excluded.completed, data = excluded.data`,
+		job.ID, job.JobType(), job.Client, formatIndexTime(job.CreatedAt), job.IsCompleted(), data)
+	if err != nil {
+		return errors.Wrap(err, "save job")
+	}
+
+	for _, id := range taskIDs {
+		t, exists := job.TasksMap[id]
+		if !exists {
+			continue
+		}
+
+		data, err := marshalWithoutPublicKeys(t)
+		if err != nil {
+			return errors.Wrap(err, "marshal task")
+		}
+
+		var notBefore int64
+		if !t.NotBefore.IsZero() {
+			notBefore = t.NotBefore.UnixNano()
+		}
+
+		// the lease of the processed task is released
+		_, err = tx.Exec(`INSERT INTO tasks (id, job_id, status, units, file_name, data, unit_name, priority, not_before, duplicate_of) VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?, ?)
+			ON CONFLICT (id) DO UPDATE SET status = excluded.status, units = excluded.units, file_name = excluded.file_name, data = excluded.data,
+				unit_name = excluded.unit_name, priority = excluded.priority, not_before = excluded.not_before, duplicate_of = excluded.duplicate_of,
+				lease_owner = CASE WHEN excluded.status IN ('Pending', 'Scheduled') THEN lease_owner ELSE '' END`,
+			t.ID, job.ID, t.Status, taskUnits(t), strings.ToLower(t.OriginalFileName), data, t.UnitName, taskPriority(t), notBefore, t.DuplicateOf)
+		if err != nil {
+			return errors.Wrap(err, "save task")
+		}
+	}
+
+	// the job is completed by the saved tasks, since other tasks of the job could be saved by other workers
+	completedAt := job.CompletedAt
+	if completedAt.IsZero() {
+		completedAt = now()
+	}
+
+	_, err = tx.Exec(`UPDATE jobs SET completed = EXISTS (SELECT 1 FROM tasks WHERE job_id = ?1)
+			AND NOT EXISTS (SELECT 1 FROM tasks WHERE job_id = ?1 AND status IN ('Pending', 'Scheduled'))
+		WHERE id = ?1`, job.ID)
+	if err != nil {
+		return errors.Wrap(err, "save job completion")
+	}
+
+	// the completion of the job is notified again when the job is completed after the requeued task
+	_, err = tx.Exec(`UPDATE jobs SET completed_at = CASE WHEN completed = 0 THEN '' WHEN completed_at = '' THEN ?2 ELSE completed_at END,
+			completion_notified = CASE WHEN completed = 0 THEN 0 ELSE completion_notified END
+		WHERE id = ?1`, job.ID, completedAt.Format(time.RFC3339Nano))
+
+	return errors.Wrap(err, "save job completion")
+}
+
+// taskUnits returns the names of the units processing the task and the steps of the pipeline separated by "|",
+// so the unit could be found with the separators around the name.
+func taskUnits(t Task) string {
+	units := map[string]struct{}{t.UnitName: {}}
+	for _, s := range t.Steps {
+		units[s.UnitName] = struct{}{}
+	}
+
+	names := make([]string, 0, len(units))
+	for name := range units {
+		names = append(names, name)
+	}
+
+	sort.Strings(names)
+
+	return "|" + strings.Join(names, "|") + "|"
+}
+
+// ClaimTasks leases the pending tasks of the unit and the due scheduled tasks to the worker until the time,
+// the tasks are claimed by the priority and the order they were added. The tasks with the expired leases are claimed again.
+func (s *SQLiteStore) ClaimTasks(worker, unitName string, limit int, until time.Time) ([]Task, error) {
+	var tasks []Task
+
+	err := s.update(func(tx *sql.Tx) error {
+		current := time.Now().UnixNano()
+
+		rows, err := tx.Query("SELECT data FROM tasks WHERE unit_name = ? AND "+sqliteClaimable+" ORDER BY priority DESC, rowid LIMIT ?",
+			unitName, current, current, limit)
+		if err != nil {
+			return errors.Wrap(err, "query tasks")
+		}
+
+		// read all the tasks before they're leased, since the single connection is used
+		for rows.Next() {
+			var b []byte
+
+			err := rows.Scan(&b)
+			if err != nil {
+				_ = rows.Close()
+
+				return errors.Wrap(err, "scan task")
+			}
+
+			var t Task
+
+			err = json.Unmarshal(b, &t)
+			if err != nil {
+				_ = rows.Close()
+
+				return errors.Wrap(err, "unmarshal task")
+			}
+
+			tasks = append(tasks, t)
+		}
+
+		_ = rows.Close()
+
+		if err := rows.Err(); err != nil {
+			return errors.Wrap(err, "query tasks")
+		}
+
+		for _, t := range tasks {
+			_, err := tx.Exec("UPDATE tasks SET lease_owner = ?, lease_expires_at = ? WHERE id = ?", worker, until.UnixNano(), t.ID)
+			if err != nil {
+				return errors.Wrap(err, "lease task")
+			}
+		}
+
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	return tasks, nil
+}
+
+// RenewLeases extends the leases of the tasks held by the worker until the time and returns the ids of the tasks
+// which are not leased to the worker anymore, the tasks could be cancelled or claimed by another worker after the lease expired.
+func (s *SQLiteStore) RenewLeases(worker string, taskIDs []string, until time.Time) ([]string, error) {
+	var lost []string
+
+	err := s.update(func(tx *sql.Tx) error {
+		lost = nil
+
+		for _, id := range taskIDs {
+			res, err := tx.Exec("UPDATE tasks SET lease_expires_at = ? WHERE id = ? AND lease_owner = ? AND status IN ('Pending', 'Scheduled')",
+				until.UnixNano(), id, worker)
+			if err != nil {
+				return errors.Wrap(err, "renew lease")
+			}
+
+			n, err := res.RowsAffected()
+			if err != nil {
+				return errors.Wrap(err, "renew lease")
+			}
+
+			if n == 0 {
+				lost = append(lost, id)
+			}
+		}
+
+		return nil
+	})
+
+	return lost, err
+}
+
+// ReleaseLeases releases the leases of the tasks held by the worker, so the tasks could be claimed by other workers.
+func (s *SQLiteStore) ReleaseLeases(worker string, taskIDs []string) error {
+	return s.update(func(tx *sql.Tx) error {
+		for _, id := range taskIDs {
+			_, err := tx.Exec("UPDATE tasks SET lease_owner = '', lease_expires_at = 0 WHERE id = ? AND lease_owner = ?", id, worker)
+			if err != nil {
+				return errors.Wrap(err, "release lease")
+			}
+		}
+
+		return nil
+	})
+}
+
+// QueueSize returns the number of the tasks of the unit waiting to be claimed by the priority and by the tenant.
+func (s *SQLiteStore) QueueSize(unitName string) (priority_queue.LenAll, error) {
+	var size priority_queue.LenAll
+
+	current := time.Now().UnixNano()
+
+	rows, err := s.db.Query("SELECT tasks.priority, COALESCE(NULLIF(j.client, ''), ?), COUNT(*) FROM tasks JOIN jobs j ON j.id = tasks.job_id"+
+		" WHERE tasks.unit_name = ? AND "+sqliteClaimable+" GROUP BY 1, 2",
+		DefaultTenant, unitName, current, current)
+	if err != nil {
+		return size, errors.Wrap(err, "query queue size")
+	}
+	defer func() { _ = rows.Close() }()
+
+	for rows.Next() {
+		var (
+			priority priority_queue.Priority
+			tenant   string
+			count    int
+		)
+
+		err := rows.Scan(&priority, &tenant, &count)
+		if err != nil {
+			return size, errors.Wrap(err, "scan queue size")
+		}
+
+		if size.Tenants == nil {
+			size.Tenants = make(map[string]int)
+		}
+
+		size.Tenants[tenant] += count
+
+		switch priority {
+		case priority_queue.HighPriority:
+			size.High += count
+		case priority_queue.MediumPriority:
+			size.Medium += count
+		default:
+			size.Low += count
+		}
+	}
+
+	return size, errors.Wrap(rows.Err(), "query queue size")
+}
+
+// ClaimJobCompletion marks the completion of the job as notified and returns true if it wasn't notified before,
+// so the completion of the job processed by several workers is notified once.
+func (s *SQLiteStore) ClaimJobCompletion(jobID string) (bool, error) {
+	var claimed bool
+
+	err := s.update(func(tx *sql.Tx) error {
+		res, err := tx.Exec("UPDATE jobs SET completion_notified = 1 WHERE id = ? AND completed = 1 AND completion_notified = 0", jobID)
+		if err != nil {
+			return errors.Wrap(err, "claim job completion")
+		}
+
+		n, err := res.RowsAffected()
+		claimed = n == 1
+
+		return errors.Wrap(err, "claim job completion")
+	})
+
+	return claimed, err
+}
+
+// LoadIdempotencyKey returns the id of the job mapped to the hashed idempotency key,
+// empty id is returned if the key is unknown or expired at the time.
+func (s *SQLiteStore) LoadIdempotencyKey(key string, at time.Time) (string, error) {
+	var jobID string
+
+	err := s.db.QueryRow("SELECT job_id FROM idempotency_keys WHERE key = ? AND expires_at > ?", key, at.UnixNano()).Scan(&jobID)
+	if errors.Is(err, sql.ErrNoRows) {
+		return "", nil
+	}
+
+	return jobID, errors.Wrap(err, "load idempotency key")
+}
+
+// SaveIdempotencyKey maps the hashed idempotency key to the job until the expiration time.
+func (s *SQLiteStore) SaveIdempotencyKey(key, jobID string, expiresAt time.Time) error {
+	return s.update(func(tx *sql.Tx) error {
+		_, err := tx.Exec(`INSERT INTO idempotency_keys (key, job_id, expires_at) VALUES (?, ?, ?)
+			ON CONFLICT (key) DO UPDATE SET job_id = excluded.job_id, expires_at = excluded.expires_at`, key, jobID, expiresAt.UnixNano())
+
+		return errors.Wrap(err, "save idempotency key")
+	})
+}
+
+// PurgeIdempotencyKeys deletes the idempotency keys expired at the time and returns their number.
+func (s *SQLiteStore) PurgeIdempotencyKeys(at time.Time) (int, error) {
+	var deleted int64
+
+	err := s.update(func(tx *sql.Tx) error {
+		res, err := tx.Exec("DELETE FROM idempotency_keys WHERE expires_at <= ?", at.UnixNano())
+		if err != nil {
+			return errors.Wrap(err, "delete idempotency keys")
+		}
+
+		deleted, err = res.RowsAffected()
+
+		return errors.Wrap(err, "delete idempotency keys")
+	})
+
+	return int(deleted), err
+}
+
+// UpdateLimitState calls the function with the saved state of the license limits, nil if it's not saved yet,
+// and saves the returned state. The state isn't changed by other processes sharing the database until the function returns,
+// so the limits are counted once for all of them.
+func (s *SQLiteStore) UpdateLimitState(update func(state []byte) ([]byte, error)) error {
+	return s.update(func(tx *sql.Tx) error {
+		var state []byte
+
+		err := tx.QueryRow("SELECT data FROM license_state WHERE id = 1").Scan(&state)
+		if err != nil && !errors.Is(err, sql.ErrNoRows) {
+			return errors.Wrap(err, "load license state")
+		}
+
+		state, err = update(state)
+		if err != nil {
+			return err
+		}
+
+		_, err = tx.Exec("INSERT INTO license_state (id, data) VALUES (1, ?) ON CONFLICT (id) DO UPDATE SET data = excluded.data", state)
+
+		return errors.Wrap(err, "save license state")
+	})
+}
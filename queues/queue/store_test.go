@@ -0,0 +1,158 @@
+package queue
+
+import (
+	"context"
+	"io"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/digitorus/pdfsigner/queues/priority_queue"
+	"github.com/sirupsen/logrus"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestStores(t *testing.T) {
+	logrus.SetOutput(io.Discard)
+
+	sqlitePath := filepath.Join(t.TempDir(), "jobs.db")
+
+	for name, open := range map[string]func() (Store, error){
+		"bolt": func() (Store, error) {
+			return NewBoltStore(), nil
+		},
+		"sqlite": func() (Store, error) {
+			return NewSQLiteStore(sqlitePath)
+		},
+	} {
+		t.Run(name, func(t *testing.T) {
+			store, err := open()
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			qs := NewQueue()
+			qs.SetStore(store)
+			qs.AddVerifyUnit()
+
+			// the jobs of the store are separated from the jobs of other tests by the client
+			client := generateID()
+
+			var jobIDs []string
+
+			for _, fileName := range []string{"Contract.pdf", "invoice.pdf"} {
+				jobID := qs.AddVerifyJob(JobVerifyConfig{})
+				assert.NoError(t, qs.SetJobClient(jobID, client))
+
+				_, err := qs.AddTask(VerificationUnitName, jobID, fileName, "../../testfiles/SampleSignedPDFDocument.pdf", "", priority_queue.HighPriority)
+				assert.NoError(t, err)
+
+				_, err = qs.AddTask(VerificationUnitName, jobID, "second.pdf", "../../testfiles/SampleSignedPDFDocument.pdf", "", priority_queue.HighPriority)
+				assert.NoError(t, err)
+
+				// the jobs are sorted by the creation time
+				time.Sleep(time.Millisecond)
+
+				jobIDs = append(jobIDs, jobID)
+			}
+
+			// the added tasks are saved before they're processed
+			saved, err := store.LoadJob(jobIDs[0])
+			assert.NoError(t, err)
+			assert.Len(t, saved.TasksMap, 2)
+
+			// every processed task is saved
+			assert.NoError(t, qs.processNextTask(VerificationUnitName))
+
+			saved, err = store.LoadJob(jobIDs[0])
+			assert.NoError(t, err)
+
+			tasks, err := saved.GetTasks(StatusCompleted)
+			assert.NoError(t, err)
+			assert.Len(t, tasks, 1)
+
+			// the progress is restored after the restart without saving the jobs
+			if s, ok := store.(*SQLiteStore); ok {
+				assert.NoError(t, s.Close())
+
+				store, err = open()
+				if err != nil {
+					t.Fatal(err)
+				}
+			}
+			defer func() { _ = store.Close() }()
+
+			loaded := NewQueue()
+			loaded.SetStore(store)
+			loaded.AddVerifyUnit()
+			assert.NoError(t, loaded.LoadFromDB())
+
+			job, err := loaded.GetJobByID(jobIDs[0])
+			assert.NoError(t, err)
+
+			tasks, err = job.GetTasks(StatusPending)
+			assert.NoError(t, err)
+			assert.Len(t, tasks, 1)
+
+			loaded.StartProcessor()
+
+			defer func() {
+				assert.NoError(t, loaded.Shutdown(context.Background()))
+			}()
+
+			for _, jobID := range jobIDs {
+				job, err := loaded.WaitForJob(context.Background(), jobID)
+				assert.NoError(t, err)
+				assert.True(t, job.IsCompleted())
+			}
+
+			// the processed jobs are released from the queue when they're saved and loaded from the store
+			assert.Eventually(t, func() bool {
+				loaded.mu.RLock()
+				defer loaded.mu.RUnlock()
+
+				_, exists := loaded.jobs[jobIDs[0]]
+
+				return !exists
+			}, time.Second, 10*time.Millisecond)
+
+			job, err = loaded.GetJobByID(jobIDs[0])
+			assert.NoError(t, err)
+			assert.False(t, job.CompletedAt.IsZero())
+
+			task, err := loaded.GetCompletedTask(jobIDs[0], tasks[0].ID)
+			assert.NoError(t, err)
+			assert.Equal(t, StatusCompleted, task.Status)
+
+			// list the jobs by the conditions on the tasks
+			jobs, _, err := loaded.ListJobs(JobFilter{Client: client, FileName: "contract.PDF", Status: StatusCompleted, Unit: VerificationUnitName})
+			assert.NoError(t, err)
+			assert.Len(t, jobs, 1)
+			assert.Equal(t, jobIDs[0], jobs[0].ID)
+
+			jobs, _, err = loaded.ListJobs(JobFilter{Client: client, Type: JobTypeSign})
+			assert.NoError(t, err)
+			assert.Empty(t, jobs)
+
+			// paginate from the newest to the oldest
+			jobs, cursor, err := loaded.ListJobs(JobFilter{Client: client, Limit: 1})
+			assert.NoError(t, err)
+			assert.Equal(t, jobIDs[1], jobs[0].ID)
+			assert.NotEmpty(t, cursor)
+
+			jobs, cursor, err = loaded.ListJobs(JobFilter{Client: client, Limit: 1, Cursor: cursor})
+			assert.NoError(t, err)
+			assert.Equal(t, jobIDs[0], jobs[0].ID)
+			assert.Empty(t, cursor)
+
+			// the released job could be deleted
+			for _, jobID := range jobIDs {
+				assert.NoError(t, loaded.DeleteJob(jobID))
+
+				saved, err := store.LoadJob(jobID)
+				assert.NoError(t, err)
+				assert.Nil(t, saved)
+			}
+		})
+	}
+}
@@ -0,0 +1,293 @@
+package report
+
+import (
+	"crypto/sha256"
+	"crypto/x509"
+	"encoding/base64"
+	"encoding/hex"
+	"encoding/xml"
+	"fmt"
+	"time"
+
+	"github.com/digitorus/pdfsign/verify"
+)
+
+// ContentTypeXML is the content type used for ETSI validation reports.
+const ContentTypeXML = "application/xml"
+
+// namespace is the ETSI TS 119 102-2 validation report namespace.
+const namespace = "http://uri.etsi.org/19102/v1.2.1#"
+
+// main indications as defined by ETSI TS 119 102-1 and used by ETSI TS 119 102-2.
+const (
+	MainIndicationTotalPassed   = "urn:etsi:019102:mainindication:total-passed"
+	MainIndicationTotalFailed   = "urn:etsi:019102:mainindication:total-failed"
+	MainIndicationIndeterminate = "urn:etsi:019102:mainindication:indeterminate"
+)
+
+// sub indications used by the mapping of the verification result.
+const (
+	SubIndicationSigCryptoFailure        = "urn:etsi:019102:subindication:SIG_CRYPTO_FAILURE"
+	SubIndicationRevoked                 = "urn:etsi:019102:subindication:REVOKED"
+	SubIndicationNoCertificateChainFound = "urn:etsi:019102:subindication:NO_CERTIFICATE_CHAIN_FOUND"
+)
+
+// validation object types.
+const (
+	ObjectTypeCertificate  = "urn:etsi:019102:validationObject:certificate"
+	ObjectTypeOCSPResponse = "urn:etsi:019102:validationObject:OCSPResponse"
+	ObjectTypeTimestamp    = "urn:etsi:019102:validationObject:timestamp"
+)
+
+// ValidationReport represents the ETSI TS 119 102-2 validation report root element.
+type ValidationReport struct {
+	XMLName                    xml.Name                    `xml:"ValidationReport"`
+	Xmlns                      string                      `xml:"xmlns,attr"`
+	SignatureValidationReports []SignatureValidationReport `xml:"SignatureValidationReport"`
+	SignatureValidationObjects *SignatureValidationObjects `xml:"SignatureValidationObjects,omitempty"`
+	SignatureValidator         SignatureValidator          `xml:"SignatureValidator"`
+}
+
+// SignatureValidationReport represents the validation report of a single signature.
+type SignatureValidationReport struct {
+	SignatureIdentifier       SignatureIdentifier       `xml:"SignatureIdentifier"`
+	ValidationTimeInfo        ValidationTimeInfo        `xml:"ValidationTimeInfo"`
+	SignatureAttributes       *SignatureAttributes      `xml:"SignatureAttributes,omitempty"`
+	SignerInformation         *SignerInformation        `xml:"SignerInformation,omitempty"`
+	SignatureValidationStatus SignatureValidationStatus `xml:"SignatureValidationStatus"`
+}
+
+// SignatureIdentifier identifies the signature the report is about.
+type SignatureIdentifier struct {
+	ID           string `xml:"id,attr"`
+	HashOnly     bool   `xml:"HashOnly"`
+	DocHashOnly  bool   `xml:"DocHashOnly"`
+	DAIdentifier string `xml:"DAIdentifier,omitempty"`
+}
+
+// ValidationTimeInfo contains the time the validation was performed.
+type ValidationTimeInfo struct {
+	ValidationTime time.Time `xml:"ValidationTime"`
+}
+
+// SignatureAttributes contains the signed and unsigned attributes of the signature.
+type SignatureAttributes struct {
+	SignatureTimeStamp *AttributeTimestamp `xml:"SignatureTimeStamp,omitempty"`
+	Reason             string              `xml:"Reason,omitempty"`
+	Location           string              `xml:"Location,omitempty"`
+	ContactInfo        string              `xml:"ContactInfo,omitempty"`
+}
+
+// AttributeTimestamp references a timestamp validation object.
+type AttributeTimestamp struct {
+	Time        time.Time   `xml:"TimeStampValue"`
+	VOReference VOReference `xml:"AttributeObject"`
+}
+
+// SignerInformation describes the signer of the signature.
+type SignerInformation struct {
+	SignerCertificate VOReference `xml:"SignerCertificate"`
+	Signer            string      `xml:"Signer,omitempty"`
+}
+
+// VOReference references a validation object by id.
+type VOReference struct {
+	VOReference string `xml:"VOReference,attr"`
+}
+
+// SignatureValidationStatus contains the result of the signature validation.
+type SignatureValidationStatus struct {
+	MainIndication string   `xml:"MainIndication"`
+	SubIndication  []string `xml:"SubIndication,omitempty"`
+}
+
+// SignatureValidationObjects contains objects used during validation.
+type SignatureValidationObjects struct {
+	ValidationObjects []ValidationObject `xml:"ValidationObject"`
+}
+
+// ValidationObject represents a certificate, OCSP response or timestamp used during validation.
+type ValidationObject struct {
+	ID                             string                         `xml:"id,attr"`
+	ObjectType                     string                         `xml:"ObjectType"`
+	ValidationObjectRepresentation ValidationObjectRepresentation `xml:"ValidationObjectRepresentation"`
+}
+
+// ValidationObjectRepresentation contains the base64 encoded object or it's digest.
+type ValidationObjectRepresentation struct {
+	Base64            string             `xml:"base64,omitempty"`
+	DigestAlgAndValue *DigestAlgAndValue `xml:"DigestAlgAndValue,omitempty"`
+}
+
+// DigestAlgAndValue contains digest algorithm and value.
+type DigestAlgAndValue struct {
+	DigestMethod string `xml:"DigestMethod"`
+	DigestValue  string `xml:"DigestValue"`
+}
+
+// SignatureValidator identifies the validator that produced the report.
+type SignatureValidator struct {
+	DigitalID DigitalID `xml:"DigitalId"`
+}
+
+// DigitalID represents the identity of the validator.
+type DigitalID struct {
+	X509SubjectName string `xml:"X509SubjectName"`
+}
+
+// validatorName is used as the identity of the validator.
+const validatorName = "PDFSigner"
+
+// NewETSIReport maps the verification result to the ETSI validation report structure.
+func NewETSIReport(resp *verify.Response, validationTime time.Time) *ValidationReport {
+	r := &ValidationReport{
+		Xmlns:              namespace,
+		SignatureValidator: SignatureValidator{DigitalID{X509SubjectName: validatorName}},
+	}
+
+	if resp == nil {
+		return r
+	}
+
+	objects := validationObjects{ids: map[string]string{}}
+
+	for i, s := range resp.Signers {
+		svr := SignatureValidationReport{
+			SignatureIdentifier: SignatureIdentifier{
+				ID:           fmt.Sprintf("S-%d", i+1),
+				DAIdentifier: resp.DocumentInfo.Hash,
+			},
+			ValidationTimeInfo:        ValidationTimeInfo{ValidationTime: validationTime.UTC()},
+			SignatureValidationStatus: signatureStatus(s),
+		}
+
+		// signature attributes
+		if s.Reason != "" || s.Location != "" || s.ContactInfo != "" || s.TimeStamp != nil {
+			svr.SignatureAttributes = &SignatureAttributes{
+				Reason:      s.Reason,
+				Location:    s.Location,
+				ContactInfo: s.ContactInfo,
+			}
+		}
+
+		// add certificates and OCSP responses as validation objects
+		for _, c := range s.Certificates {
+			if c.Certificate == nil {
+				continue
+			}
+
+			objects.add(ObjectTypeCertificate, c.Certificate.Raw)
+
+			if c.OCSPResponse != nil {
+				objects.add(ObjectTypeOCSPResponse, c.OCSPResponse.Raw)
+			}
+		}
+
+		// add timestamp as validation object
+		if s.TimeStamp != nil {
+			id := objects.add(ObjectTypeTimestamp, s.TimeStamp.RawToken)
+			svr.SignatureAttributes.SignatureTimeStamp = &AttributeTimestamp{
+				Time:        s.TimeStamp.Time.UTC(),
+				VOReference: VOReference{id},
+			}
+		}
+
+		// signer information
+		if cert := signerCertificate(s); cert != nil {
+			name := s.Name
+			if name == "" {
+				name = cert.Subject.String()
+			}
+
+			svr.SignerInformation = &SignerInformation{
+				SignerCertificate: VOReference{objects.ids[string(cert.Raw)]},
+				Signer:            name,
+			}
+		}
+
+		r.SignatureValidationReports = append(r.SignatureValidationReports, svr)
+	}
+
+	if len(objects.list) > 0 {
+		r.SignatureValidationObjects = &SignatureValidationObjects{ValidationObjects: objects.list}
+	}
+
+	return r
+}
+
+// Marshal returns the XML encoded report including the XML header.
+func (r *ValidationReport) Marshal() ([]byte, error) {
+	b, err := xml.MarshalIndent(r, "", "  ")
+	if err != nil {
+		return nil, err
+	}
+
+	return append([]byte(xml.Header), b...), nil
+}
+
+// signatureStatus determines main and sub indication of the signature.
+func signatureStatus(s verify.Signer) SignatureValidationStatus {
+	switch {
+	case !s.ValidSignature:
+		return SignatureValidationStatus{MainIndicationTotalFailed, []string{SubIndicationSigCryptoFailure}}
+	case s.RevokedCertificate:
+		return SignatureValidationStatus{MainIndicationTotalFailed, []string{SubIndicationRevoked}}
+	case !s.TrustedIssuer:
+		return SignatureValidationStatus{MainIndicationIndeterminate, []string{SubIndicationNoCertificateChainFound}}
+	}
+
+	return SignatureValidationStatus{MainIndication: MainIndicationTotalPassed}
+}
+
+// signerCertificate returns the end entity certificate of the signer.
+func signerCertificate(s verify.Signer) *x509.Certificate {
+	var first *x509.Certificate
+
+	for _, c := range s.Certificates {
+		if c.Certificate == nil {
+			continue
+		}
+
+		if first == nil {
+			first = c.Certificate
+		}
+
+		if !c.Certificate.IsCA {
+			return c.Certificate
+		}
+	}
+
+	return first
+}
+
+// validationObjects collects unique validation objects.
+type validationObjects struct {
+	list []ValidationObject
+	// ids represents validation object ids by raw content
+	ids map[string]string
+}
+
+// add adds the object if not yet added and returns it's id.
+func (o *validationObjects) add(objectType string, raw []byte) string {
+	if id, exists := o.ids[string(raw)]; exists {
+		return id
+	}
+
+	digest := sha256.Sum256(raw)
+	id := "VO-" + hex.EncodeToString(digest[:8])
+
+	vo := ValidationObject{ID: id, ObjectType: objectType}
+	if len(raw) > 0 {
+		vo.ValidationObjectRepresentation.Base64 = base64.StdEncoding.EncodeToString(raw)
+	} else {
+		vo.ValidationObjectRepresentation.DigestAlgAndValue = &DigestAlgAndValue{
+			DigestMethod: "http://www.w3.org/2001/04/xmlenc#sha256",
+			DigestValue:  base64.StdEncoding.EncodeToString(digest[:]),
+		}
+	}
+
+	o.list = append(o.list, vo)
+	o.ids[string(raw)] = id
+
+	return id
+}
@@ -0,0 +1,54 @@
+package report
+
+import (
+	"encoding/xml"
+	"os"
+	"testing"
+	"time"
+
+	"github.com/digitorus/pdfsign/verify"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestETSIReport(t *testing.T) {
+	f, err := os.Open("../testfiles/SampleSignedPDFDocument.pdf")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer func() { _ = f.Close() }()
+
+	resp, err := verify.File(f)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	r := NewETSIReport(resp, time.Now())
+	assert.Len(t, r.SignatureValidationReports, len(resp.Signers))
+
+	for _, svr := range r.SignatureValidationReports {
+		assert.NotEmpty(t, svr.SignatureValidationStatus.MainIndication)
+		assert.NotNil(t, svr.SignerInformation)
+		assert.NotEmpty(t, svr.SignerInformation.SignerCertificate.VOReference)
+	}
+
+	assert.NotNil(t, r.SignatureValidationObjects)
+
+	// marshal and unmarshal report
+	b, err := r.Marshal()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var decoded ValidationReport
+
+	assert.NoError(t, xml.Unmarshal(b, &decoded))
+	assert.Equal(t, len(r.SignatureValidationReports), len(decoded.SignatureValidationReports))
+	assert.Equal(t, namespace, decoded.XMLName.Space)
+}
+
+func TestSignatureStatus(t *testing.T) {
+	assert.Equal(t, MainIndicationTotalFailed, signatureStatus(verify.Signer{}).MainIndication)
+	assert.Equal(t, []string{SubIndicationRevoked}, signatureStatus(verify.Signer{ValidSignature: true, RevokedCertificate: true}).SubIndication)
+	assert.Equal(t, MainIndicationIndeterminate, signatureStatus(verify.Signer{ValidSignature: true}).MainIndication)
+	assert.Equal(t, MainIndicationTotalPassed, signatureStatus(verify.Signer{ValidSignature: true, TrustedIssuer: true}).MainIndication)
+}
@@ -0,0 +1,419 @@
+package revision
+
+import (
+	"crypto/sha256"
+	"fmt"
+	"io"
+	"sort"
+	"strings"
+
+	"github.com/digitorus/pdf"
+	"github.com/pkg/errors"
+)
+
+// change types.
+const (
+	ChangePageAdded          = "page_added"
+	ChangePageRemoved        = "page_removed"
+	ChangeContentModified    = "content_modified"
+	ChangeAnnotationAdded    = "annotation_added"
+	ChangeAnnotationRemoved  = "annotation_removed"
+	ChangeAnnotationModified = "annotation_modified"
+	ChangeFormFieldAdded     = "form_field_added"
+	ChangeFormFieldRemoved   = "form_field_removed"
+	ChangeFormFieldFilled    = "form_field_filled"
+	ChangeSignatureAdded     = "signature_added"
+)
+
+// verdicts.
+const (
+	VerdictPermitted    = "permitted"
+	VerdictNotPermitted = "not_permitted"
+)
+
+// Analysis represents the modifications made after signing.
+type Analysis struct {
+	// Revisions represents the changes per revision
+	Revisions []RevisionChanges `json:"revisions"`
+	// Verdict represents the verdict for all the changes made after the first signature
+	Verdict string `json:"verdict"`
+}
+
+// RevisionChanges represents the changes of a single revision compared to the previous revision.
+type RevisionChanges struct {
+	Revision
+	// Signatures represents the names of the signatures covering this revision
+	Signatures []string `json:"signatures,omitempty"`
+	// Changes represents the changes made in this revision
+	Changes []Change `json:"changes,omitempty"`
+	// Verdict represents the verdict for the changes made in this revision
+	Verdict string `json:"verdict"`
+}
+
+// Change represents a single modification.
+type Change struct {
+	// Type represents the type of the change
+	Type string `json:"type"`
+	// Page represents the page number, if the change is related to a page
+	Page int `json:"page,omitempty"`
+	// Object represents the field name or the annotation subtype
+	Object string `json:"object,omitempty"`
+	// Permitted represents if the change is allowed by DocMDP and FieldMDP permissions
+	Permitted bool `json:"permitted"`
+	// Reason represents why the change is not permitted
+	Reason string `json:"reason,omitempty"`
+}
+
+// Analyze detects and describes the modifications made after the document was signed.
+func Analyze(file io.ReaderAt, size int64) (*Analysis, error) {
+	revisions, err := Revisions(file, size)
+	if err != nil {
+		return nil, err
+	}
+
+	signatures, err := Signatures(file, size, revisions)
+	if err != nil {
+		return nil, err
+	}
+
+	a := &Analysis{Verdict: VerdictPermitted}
+
+	var prev *snapshot
+
+	for _, r := range revisions {
+		rc := RevisionChanges{Revision: r, Verdict: VerdictPermitted}
+
+		for _, s := range signatures {
+			if s.Revision == r.Number {
+				rc.Signatures = append(rc.Signatures, s.Name)
+			}
+		}
+
+		cur, err := takeSnapshot(io.NewSectionReader(file, 0, r.End), r.End)
+		if err != nil {
+			return nil, errors.Wrapf(err, "revision %d", r.Number)
+		}
+
+		if prev != nil {
+			rc.Changes = compare(prev, cur)
+
+			// only the changes made after signing are checked against the permissions
+			applied := appliedSignatures(signatures, r.Number)
+			for i := range rc.Changes {
+				checkPermission(&rc.Changes[i], applied)
+
+				if !rc.Changes[i].Permitted {
+					rc.Verdict = VerdictNotPermitted
+					a.Verdict = VerdictNotPermitted
+				}
+			}
+		}
+
+		a.Revisions = append(a.Revisions, rc)
+		prev = cur
+	}
+
+	return a, nil
+}
+
+// appliedSignatures returns the signatures made before the revision.
+func appliedSignatures(signatures []Signature, revision int) []Signature {
+	var applied []Signature
+
+	for _, s := range signatures {
+		if s.Revision > 0 && s.Revision < revision {
+			applied = append(applied, s)
+		}
+	}
+
+	return applied
+}
+
+// checkPermission checks the change against DocMDP and FieldMDP permissions of the applied signatures.
+func checkPermission(c *Change, applied []Signature) {
+	c.Permitted = true
+
+	for _, s := range applied {
+		// FieldMDP locks modifications of the listed fields
+		if (c.Type == ChangeFormFieldFilled || c.Type == ChangeFormFieldRemoved) && s.FieldMDP.Locks(c.Object) {
+			c.Permitted = false
+			c.Reason = fmt.Sprintf("field is locked by FieldMDP of signature %q", s.Name)
+
+			return
+		}
+
+		if s.DocMDP == 0 {
+			continue
+		}
+
+		var allowed bool
+
+		switch c.Type {
+		case ChangeFormFieldFilled, ChangeSignatureAdded:
+			allowed = s.DocMDP >= 2
+		case ChangeAnnotationAdded, ChangeAnnotationRemoved, ChangeAnnotationModified:
+			allowed = s.DocMDP >= 3
+		}
+
+		if !allowed {
+			c.Permitted = false
+			c.Reason = fmt.Sprintf("not allowed by DocMDP permissions %d of signature %q", s.DocMDP, s.Name)
+
+			return
+		}
+	}
+}
+
+// snapshot represents the state of the document relevant for change detection.
+type snapshot struct {
+	pages []pageSnapshot
+	// fields represents form field values by fully qualified name
+	fields map[string]fieldSnapshot
+}
+
+type pageSnapshot struct {
+	// content represents digest of the page content streams
+	content string
+	// annotations represents digests of the annotations by object id
+	annotations map[uint32]annotationSnapshot
+}
+
+type annotationSnapshot struct {
+	subtype string
+	digest  string
+}
+
+type fieldSnapshot struct {
+	fieldType string
+	value     string
+}
+
+// takeSnapshot reads the document state.
+func takeSnapshot(file io.ReaderAt, size int64) (s *snapshot, err error) {
+	defer func() {
+		if r := recover(); r != nil {
+			err = fmt.Errorf("failed to read document (%v)", r)
+		}
+	}()
+
+	rdr, err := pdf.NewReader(file, size)
+	if err != nil {
+		return nil, err
+	}
+
+	s = &snapshot{fields: map[string]fieldSnapshot{}}
+
+	for i := 1; i <= rdr.NumPage(); i++ {
+		p := rdr.Page(i)
+
+		ps := pageSnapshot{
+			content:     contentDigest(p.V.Key("Contents")),
+			annotations: map[uint32]annotationSnapshot{},
+		}
+
+		annots := p.V.Key("Annots")
+		for j := 0; j < annots.Len(); j++ {
+			a := annots.Index(j)
+
+			// widgets are handled as form fields
+			if a.Key("Subtype").Name() == "Widget" {
+				continue
+			}
+
+			ps.annotations[objectID(a)] = annotationSnapshot{
+				subtype: a.Key("Subtype").Name(),
+				digest:  a.String(),
+			}
+		}
+
+		s.pages = append(s.pages, ps)
+	}
+
+	fields := rdr.Trailer().Key("Root").Key("AcroForm").Key("Fields")
+	for i := 0; i < fields.Len(); i++ {
+		walkFields(fields.Index(i), "", "", s.fields)
+	}
+
+	return s, nil
+}
+
+// walkFields collects fully qualified field names and values.
+func walkFields(v pdf.Value, parentName, parentType string, fields map[string]fieldSnapshot) {
+	name := v.Key("T").Text()
+	if parentName != "" && name != "" {
+		name = parentName + "." + name
+	} else if name == "" {
+		name = parentName
+	}
+
+	// field type is inheritable
+	fieldType := v.Key("FT").Name()
+	if fieldType == "" {
+		fieldType = parentType
+	}
+
+	kids := v.Key("Kids")
+	if kids.Len() > 0 {
+		for i := 0; i < kids.Len(); i++ {
+			walkFields(kids.Index(i), name, fieldType, fields)
+		}
+
+		return
+	}
+
+	fs := fieldSnapshot{fieldType: fieldType}
+
+	value := v.Key("V")
+	switch value.Kind() {
+	case pdf.Null:
+	case pdf.String:
+		fs.value = value.Text()
+	case pdf.Name:
+		fs.value = value.Name()
+	case pdf.Dict:
+		// signature value, use object id to detect new signatures
+		fs.value = fmt.Sprintf("%d", objectID(value))
+	default:
+		fs.value = value.String()
+	}
+
+	fields[name] = fs
+}
+
+// objectID returns the id of the indirect object the value belongs to.
+func objectID(v pdf.Value) uint32 {
+	ptr := v.GetPtr()
+
+	return ptr.GetID()
+}
+
+// contentDigest returns digest of the decoded page content streams.
+func contentDigest(contents pdf.Value) string {
+	h := sha256.New()
+
+	streams := []pdf.Value{contents}
+	if contents.Kind() == pdf.Array {
+		streams = nil
+		for i := 0; i < contents.Len(); i++ {
+			streams = append(streams, contents.Index(i))
+		}
+	}
+
+	for _, strm := range streams {
+		rc := strm.Reader()
+		_, _ = io.Copy(h, rc)
+		_ = rc.Close()
+	}
+
+	return fmt.Sprintf("%x", h.Sum(nil))
+}
+
+// compare returns the changes between two snapshots.
+func compare(prev, cur *snapshot) []Change {
+	var changes []Change
+
+	for i := range cur.pages {
+		page := i + 1
+
+		if i >= len(prev.pages) {
+			changes = append(changes, Change{Type: ChangePageAdded, Page: page})
+
+			continue
+		}
+
+		if prev.pages[i].content != cur.pages[i].content {
+			changes = append(changes, Change{Type: ChangeContentModified, Page: page})
+		}
+
+		// compare annotations in a stable order
+		for _, id := range annotationIDs(cur.pages[i].annotations) {
+			a := cur.pages[i].annotations[id]
+			prevAnnotation, exists := prev.pages[i].annotations[id]
+
+			switch {
+			case !exists:
+				changes = append(changes, Change{Type: ChangeAnnotationAdded, Page: page, Object: a.subtype})
+			case prevAnnotation.digest != a.digest:
+				changes = append(changes, Change{Type: ChangeAnnotationModified, Page: page, Object: a.subtype})
+			}
+		}
+
+		for _, id := range annotationIDs(prev.pages[i].annotations) {
+			if _, exists := cur.pages[i].annotations[id]; !exists {
+				changes = append(changes, Change{Type: ChangeAnnotationRemoved, Page: page, Object: prev.pages[i].annotations[id].subtype})
+			}
+		}
+	}
+
+	for i := len(cur.pages); i < len(prev.pages); i++ {
+		changes = append(changes, Change{Type: ChangePageRemoved, Page: i + 1})
+	}
+
+	// compare form fields in a stable order
+	for _, n := range fieldNames(cur.fields) {
+		f := cur.fields[n]
+		prevField, exists := prev.fields[n]
+
+		switch {
+		case f.fieldType == "Sig" && f.value != "" && (!exists || prevField.value == ""):
+			changes = append(changes, Change{Type: ChangeSignatureAdded, Object: n})
+		case !exists:
+			changes = append(changes, Change{Type: ChangeFormFieldAdded, Object: n})
+		case prevField.value != f.value:
+			changes = append(changes, Change{Type: ChangeFormFieldFilled, Object: n})
+		}
+	}
+
+	for _, n := range fieldNames(prev.fields) {
+		if _, exists := cur.fields[n]; !exists {
+			changes = append(changes, Change{Type: ChangeFormFieldRemoved, Object: n})
+		}
+	}
+
+	return changes
+}
+
+// annotationIDs returns the object ids of the annotations in ascending order.
+func annotationIDs(annotations map[uint32]annotationSnapshot) []uint32 {
+	ids := make([]uint32, 0, len(annotations))
+	for id := range annotations {
+		ids = append(ids, id)
+	}
+
+	sort.Slice(ids, func(i, j int) bool { return ids[i] < ids[j] })
+
+	return ids
+}
+
+// fieldNames returns the names of the form fields in alphabetical order.
+func fieldNames(fields map[string]fieldSnapshot) []string {
+	names := make([]string, 0, len(fields))
+	for n := range fields {
+		names = append(names, n)
+	}
+
+	sort.Strings(names)
+
+	return names
+}
+
+// String returns a human readable description of the change.
+func (c Change) String() string {
+	var b strings.Builder
+
+	b.WriteString(strings.ReplaceAll(c.Type, "_", " "))
+
+	if c.Object != "" {
+		fmt.Fprintf(&b, " %q", c.Object)
+	}
+
+	if c.Page > 0 {
+		fmt.Fprintf(&b, " on page %d", c.Page)
+	}
+
+	if !c.Permitted {
+		fmt.Fprintf(&b, ": %s", c.Reason)
+	}
+
+	return b.String()
+}
@@ -0,0 +1,354 @@
+package revision
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"io"
+
+	"github.com/digitorus/pdf"
+	"github.com/pkg/errors"
+)
+
+// Revision represents a single incremental revision of the document.
+type Revision struct {
+	// Number represents the revision number starting from 1 for the original document
+	Number int `json:"number"`
+	// Offset represents byte offset of the start of the incremental update
+	Offset int64 `json:"offset"`
+	// End represents byte offset of the end of the revision, including %%EOF marker
+	End int64 `json:"end"`
+}
+
+// Signature represents a signature found inside the document.
+type Signature struct {
+	// Name represents the name of the signer
+	Name string `json:"name"`
+	// Reason represents the reason of the signature
+	Reason string `json:"reason,omitempty"`
+	// ByteRange represents the byte range covered by the signature
+	ByteRange []int64 `json:"byte_range"`
+	// Revision represents the number of the revision covered by the signature
+	Revision int `json:"revision"`
+	// DocMDP represents DocMDP permissions of a certification signature, 0 if not present
+	DocMDP int `json:"doc_mdp,omitempty"`
+	// FieldMDP represents FieldMDP restrictions of the signature if present
+	FieldMDP *FieldMDP `json:"field_mdp,omitempty"`
+}
+
+// FieldMDP represents the form fields locked by the signature.
+type FieldMDP struct {
+	// Action represents the action All, Include or Exclude
+	Action string `json:"action"`
+	// Fields represents the fully qualified names of the fields
+	Fields []string `json:"fields,omitempty"`
+}
+
+// Locks checks if the field is locked by the FieldMDP restrictions.
+func (f *FieldMDP) Locks(fieldName string) bool {
+	if f == nil {
+		return false
+	}
+
+	var listed bool
+
+	for _, n := range f.Fields {
+		if n == fieldName {
+			listed = true
+
+			break
+		}
+	}
+
+	switch f.Action {
+	case "All":
+		return true
+	case "Include":
+		return listed
+	case "Exclude":
+		return !listed
+	}
+
+	return false
+}
+
+// CoveredLength returns the length of the document covered by the signature.
+func (s Signature) CoveredLength() int64 {
+	if len(s.ByteRange) < 4 {
+		return 0
+	}
+
+	return s.ByteRange[2] + s.ByteRange[3]
+}
+
+var eofMarker = []byte("%%EOF")
+
+// MaxRevisions represents maximum number of the revisions of the document, the documents with more revisions are rejected
+// since every revision is parsed separately.
+const MaxRevisions = 100
+
+// maxEOFMarkers represents maximum number of %%EOF markers scanned, linearized documents contain an additional marker.
+const maxEOFMarkers = 2 * MaxRevisions
+
+// scanChunkSize represents the size of the chunks of the document scanned for %%EOF markers.
+const scanChunkSize = 64 * 1024
+
+// Revisions returns all incremental revisions of the document.
+func Revisions(file io.ReaderAt, size int64) ([]Revision, error) {
+	markers, err := eofOffsets(file, size)
+	if err != nil {
+		return nil, err
+	}
+
+	var revisions []Revision
+
+	var offset int64
+
+	for _, end := range markers {
+		// include end of line after the marker
+		for _, eol := range []byte{'\r', '\n'} {
+			if end < size && byteAt(file, end) == eol {
+				end++
+			}
+		}
+
+		// skip markers that don't end a readable revision, like the first page section of linearized documents
+		if end <= offset || !isReadable(file, end) {
+			continue
+		}
+
+		if len(revisions) == MaxRevisions {
+			return nil, errors.Errorf("document has more than %d revisions", MaxRevisions)
+		}
+
+		revisions = append(revisions, Revision{
+			Number: len(revisions) + 1,
+			Offset: offset,
+			End:    end,
+		})
+
+		offset = end
+	}
+
+	if len(revisions) == 0 {
+		return nil, errors.New("no revisions found, missing %%EOF")
+	}
+
+	// attach trailing data to the last revision
+	revisions[len(revisions)-1].End = size
+
+	return revisions, nil
+}
+
+// eofOffsets returns the offsets right after the %%EOF markers of the document,
+// the document is scanned in chunks instead of being read into memory.
+func eofOffsets(file io.ReaderAt, size int64) ([]int64, error) {
+	var offsets []int64
+
+	// the chunks overlap, so the marker crossing the end of the chunk is found
+	buf := make([]byte, scanChunkSize+len(eofMarker)-1)
+
+	for pos := int64(0); pos < size; pos += scanChunkSize {
+		n := int64(len(buf))
+		if size-pos < n {
+			n = size - pos
+		}
+
+		_, err := file.ReadAt(buf[:n], pos)
+		if err != nil && err != io.EOF {
+			return nil, errors.Wrap(err, "read document")
+		}
+
+		chunk := buf[:n]
+
+		for from := 0; ; {
+			i := bytes.Index(chunk[from:], eofMarker)
+			if i < 0 {
+				break
+			}
+
+			// the marker starting inside the overlap is found in the next chunk
+			start := from + i
+			if start >= scanChunkSize {
+				break
+			}
+
+			if len(offsets) == maxEOFMarkers {
+				return nil, errors.Errorf("document has more than %d %%%%EOF markers", maxEOFMarkers)
+			}
+
+			offsets = append(offsets, pos+int64(start+len(eofMarker)))
+			from = start + len(eofMarker)
+		}
+	}
+
+	return offsets, nil
+}
+
+// byteAt returns the byte of the document at the offset, 0 if it couldn't be read.
+func byteAt(file io.ReaderAt, offset int64) byte {
+	b := make([]byte, 1)
+
+	_, err := file.ReadAt(b, offset)
+	if err != nil {
+		return 0
+	}
+
+	return b[0]
+}
+
+// isReadable checks if the document up to the end offset could be opened.
+func isReadable(file io.ReaderAt, end int64) (ok bool) {
+	defer func() {
+		if r := recover(); r != nil {
+			ok = false
+		}
+	}()
+
+	_, err := pdf.NewReader(io.NewSectionReader(file, 0, end), end)
+
+	return err == nil
+}
+
+// Signatures returns all the signatures of the document and the revisions they cover.
+func Signatures(file io.ReaderAt, size int64, revisions []Revision) (signatures []Signature, err error) {
+	defer func() {
+		if r := recover(); r != nil {
+			err = fmt.Errorf("failed to read signatures (%v)", r)
+		}
+	}()
+
+	rdr, err := pdf.NewReader(file, size)
+	if err != nil {
+		return nil, errors.Wrap(err, "open document")
+	}
+
+	for _, x := range rdr.Xref() {
+		v := rdr.Resolve(x.Ptr(), x.Ptr())
+
+		// only signature dictionaries have a Adobe.PPKLite filter
+		if v.Key("Filter").Name() != "Adobe.PPKLite" {
+			continue
+		}
+
+		s := Signature{
+			Name:   v.Key("Name").Text(),
+			Reason: v.Key("Reason").Text(),
+		}
+
+		for i := 0; i < v.Key("ByteRange").Len(); i++ {
+			s.ByteRange = append(s.ByteRange, v.Key("ByteRange").Index(i).Int64())
+		}
+
+		// determine covered revision
+		for _, r := range revisions {
+			if r.End >= s.CoveredLength() {
+				s.Revision = r.Number
+
+				break
+			}
+		}
+
+		// parse transform methods
+		refs := v.Key("Reference")
+		for i := 0; i < refs.Len(); i++ {
+			parseTransform(refs.Index(i), &s)
+		}
+
+		parseTransform(v, &s)
+
+		signatures = append(signatures, s)
+	}
+
+	return signatures, nil
+}
+
+// parseTransform parses DocMDP and FieldMDP transform parameters.
+func parseTransform(v pdf.Value, s *Signature) {
+	params := v.Key("TransformParams")
+
+	switch v.Key("TransformMethod").Name() {
+	case "DocMDP":
+		s.DocMDP = int(params.Key("P").Int64())
+		// absence of P shall be treated as a value of 2
+		if s.DocMDP == 0 {
+			s.DocMDP = 2
+		}
+	case "FieldMDP":
+		f := FieldMDP{Action: params.Key("Action").Name()}
+
+		fields := params.Key("Fields")
+		for i := 0; i < fields.Len(); i++ {
+			f.Fields = append(f.Fields, fields.Index(i).Text())
+		}
+
+		s.FieldMDP = &f
+	}
+}
+
+// Info represents a revision with the signatures covering it and it's hash.
+type Info struct {
+	Revision
+	// Hash represents SHA-256 of the document up to the end of the revision
+	Hash string `json:"hash"`
+	// Signatures represents the signatures covering exactly this revision
+	Signatures []Signature `json:"signatures,omitempty"`
+}
+
+// List returns all the revisions of the document with their hashes and signatures.
+func List(file io.ReaderAt, size int64) ([]Info, error) {
+	revisions, err := Revisions(file, size)
+	if err != nil {
+		return nil, err
+	}
+
+	signatures, err := Signatures(file, size, revisions)
+	if err != nil {
+		return nil, err
+	}
+
+	infos := make([]Info, 0, len(revisions))
+
+	for _, r := range revisions {
+		h := sha256.New()
+
+		_, err := io.Copy(h, io.NewSectionReader(file, 0, r.End))
+		if err != nil {
+			return nil, errors.Wrap(err, "hash revision")
+		}
+
+		info := Info{Revision: r, Hash: hex.EncodeToString(h.Sum(nil))}
+
+		for _, s := range signatures {
+			if s.Revision == r.Number {
+				info.Signatures = append(info.Signatures, s)
+			}
+		}
+
+		infos = append(infos, info)
+	}
+
+	return infos, nil
+}
+
+// Extract writes the document as it was at the end of the revision, what the signer of the revision actually saw.
+func Extract(file io.ReaderAt, r Revision, w io.Writer) error {
+	_, err := io.Copy(w, io.NewSectionReader(file, 0, r.End))
+	if err != nil {
+		return errors.Wrap(err, "extract revision")
+	}
+
+	return nil
+}
+
+// Find returns the revision by number.
+func Find(revisions []Info, number int) (Revision, error) {
+	for _, r := range revisions {
+		if r.Number == number {
+			return r.Revision, nil
+		}
+	}
+
+	return Revision{}, fmt.Errorf("revision %d is not found", number)
+}
@@ -0,0 +1,165 @@
+package revision
+
+import (
+	"bytes"
+	"io"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/digitorus/pdfsign/sign"
+	"github.com/digitorus/pdfsigner/license"
+	"github.com/digitorus/pdfsigner/signer"
+	"github.com/sirupsen/logrus"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestAnalyze(t *testing.T) {
+	logrus.SetOutput(io.Discard)
+
+	err := license.Initialize([]byte(license.TestLicense))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// create sign data
+	signData := signer.SignData{
+		Signature: sign.SignDataSignature{
+			Info: sign.SignDataSignatureInfo{
+				Name: "Certifier",
+			},
+			CertType:   sign.CertificationSignature,
+			DocMDPPerm: sign.AllowFillingExistingFormFieldsAndSignaturesPerms,
+		},
+	}
+	signData.SetPEM("../testfiles/test.crt", "../testfiles/test.pem", "")
+
+	dir := t.TempDir()
+	certified := filepath.Join(dir, "certified.pdf")
+	approved := filepath.Join(dir, "approved.pdf")
+
+	// certify and sign again
+	assert.NoError(t, signer.SignFile("../testfiles/testfile12.pdf", certified, signData, false))
+
+	signData.Signature.Info.Name = "Approver"
+	signData.Signature.CertType = sign.ApprovalSignature
+	assert.NoError(t, signer.SignFile(certified, approved, signData, false))
+
+	f, err := os.Open(approved)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer func() { _ = f.Close() }()
+
+	fi, err := f.Stat()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// test revisions and signatures
+	revisions, err := Revisions(f, fi.Size())
+	assert.NoError(t, err)
+	assert.Len(t, revisions, 3)
+	assert.Equal(t, fi.Size(), revisions[2].End)
+
+	signatures, err := Signatures(f, fi.Size(), revisions)
+	assert.NoError(t, err)
+	assert.Len(t, signatures, 2)
+
+	for _, s := range signatures {
+		switch s.Name {
+		case "Certifier":
+			assert.Equal(t, 2, s.Revision)
+			assert.Equal(t, 2, s.DocMDP)
+		case "Approver":
+			assert.Equal(t, 3, s.Revision)
+		default:
+			t.Fatalf("unexpected signature %q", s.Name)
+		}
+	}
+
+	// test analysis
+	a, err := Analyze(f, fi.Size())
+	assert.NoError(t, err)
+	assert.Equal(t, VerdictPermitted, a.Verdict)
+	assert.Len(t, a.Revisions, 3)
+	assert.Contains(t, a.Revisions[2].Signatures, "Approver")
+
+	var signatureAdded bool
+	for _, c := range a.Revisions[2].Changes {
+		if c.Type == ChangeSignatureAdded {
+			signatureAdded = true
+		}
+	}
+
+	assert.True(t, signatureAdded, a.Revisions[2].Changes)
+}
+
+func TestCheckPermission(t *testing.T) {
+	certified := []Signature{{Name: "a", DocMDP: 1}}
+
+	c := Change{Type: ChangeSignatureAdded}
+	checkPermission(&c, certified)
+	assert.False(t, c.Permitted)
+
+	c = Change{Type: ChangeAnnotationAdded}
+	checkPermission(&c, []Signature{{Name: "a", DocMDP: 3}})
+	assert.True(t, c.Permitted)
+
+	c = Change{Type: ChangeContentModified}
+	checkPermission(&c, []Signature{{Name: "a", DocMDP: 3}})
+	assert.False(t, c.Permitted)
+
+	c = Change{Type: ChangeFormFieldFilled, Object: "locked"}
+	checkPermission(&c, []Signature{{Name: "a", FieldMDP: &FieldMDP{Action: "Include", Fields: []string{"locked"}}}})
+	assert.False(t, c.Permitted)
+
+	c = Change{Type: ChangeContentModified}
+	checkPermission(&c, []Signature{{Name: "a"}})
+	assert.True(t, c.Permitted)
+}
+
+func TestCompareOrder(t *testing.T) {
+	prev := &snapshot{
+		pages: []pageSnapshot{{annotations: map[uint32]annotationSnapshot{
+			10: {subtype: "Removed10"}, 11: {subtype: "Removed11"}, 12: {subtype: "Removed12"},
+		}}},
+		fields: map[string]fieldSnapshot{"c": {}, "a": {}, "b": {}},
+	}
+	cur := &snapshot{
+		pages: []pageSnapshot{{annotations: map[uint32]annotationSnapshot{
+			3: {subtype: "Added3"}, 1: {subtype: "Added1"}, 2: {subtype: "Added2"},
+		}}},
+		fields: map[string]fieldSnapshot{},
+	}
+
+	var objects []string
+	for _, c := range compare(prev, cur) {
+		objects = append(objects, c.Object)
+	}
+
+	// the changes are ordered by object id and field name, not by map iteration
+	assert.Equal(t, []string{"Added1", "Added2", "Added3", "Removed10", "Removed11", "Removed12", "a", "b", "c"}, objects)
+
+	for i := 0; i < 10; i++ {
+		assert.Equal(t, compare(prev, cur), compare(prev, cur))
+	}
+}
+
+func TestEOFOffsets(t *testing.T) {
+	// the marker crossing the end of the scanned chunk is found once
+	data := bytes.Repeat([]byte{' '}, 2*scanChunkSize)
+	copy(data[10:], eofMarker)
+	copy(data[scanChunkSize-2:], eofMarker)
+	copy(data[len(data)-len(eofMarker):], eofMarker)
+
+	offsets, err := eofOffsets(bytes.NewReader(data), int64(len(data)))
+	assert.NoError(t, err)
+	assert.Equal(t, []int64{15, scanChunkSize + 3, int64(len(data))}, offsets)
+
+	// the number of the markers is limited
+	data = bytes.Repeat(eofMarker, maxEOFMarkers+1)
+
+	_, err = Revisions(bytes.NewReader(data), int64(len(data)))
+	assert.Error(t, err)
+}
@@ -0,0 +1,229 @@
+// Package schedule parses cron expressions and calculates the times of the scheduled runs.
+package schedule
+
+import (
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/pkg/errors"
+)
+
+// Schedule represents parsed cron expression.
+type Schedule struct {
+	// minute, hour, dom, month and dow represent allowed values of the fields as bit sets
+	minute, hour, dom, month, dow uint64
+	// domAny and dowAny represent if the day of month or the day of week is not restricted, only "*" is not restricted
+	domAny, dowAny bool
+}
+
+// descriptors represents predefined schedules.
+var descriptors = map[string]string{
+	"@yearly":   "0 0 1 1 *",
+	"@annually": "0 0 1 1 *",
+	"@monthly":  "0 0 1 * *",
+	"@weekly":   "0 0 * * 0",
+	"@daily":    "0 0 * * *",
+	"@midnight": "0 0 * * *",
+	"@hourly":   "0 * * * *",
+}
+
+// field represents bounds of the field of the expression.
+type field struct {
+	name     string
+	min, max int
+}
+
+var fields = []field{
+	{"minute", 0, 59},
+	{"hour", 0, 23},
+	{"day of month", 1, 31},
+	{"month", 1, 12},
+	{"day of week", 0, 7},
+}
+
+// Parse parses the cron expression with 5 fields: minute, hour, day of month, month and day of week, Ex. "0 0 * * *".
+// The fields support lists, ranges and steps, Ex. "0,30", "1-5", "*/15", Sunday is 0 or 7.
+// The descriptors @yearly, @monthly, @weekly, @daily and @hourly are supported as well.
+// If both the day of month and the day of week are restricted, either of them should match, the field with the step,
+// Ex. "*/2", is restricted, only "*" isn't. The expression which never matches, Ex. "0 0 30 2 *", is an error.
+func Parse(expr string) (*Schedule, error) {
+	if d, exists := descriptors[strings.TrimSpace(expr)]; exists {
+		expr = d
+	}
+
+	parts := strings.Fields(expr)
+	if len(parts) != len(fields) {
+		return nil, errors.Errorf("cron expression should contain %d fields: %q", len(fields), expr)
+	}
+
+	bits := make([]uint64, len(fields))
+
+	for i, f := range fields {
+		b, err := parseField(parts[i], f)
+		if err != nil {
+			return nil, err
+		}
+
+		bits[i] = b
+	}
+
+	s := &Schedule{
+		minute: bits[0],
+		hour:   bits[1],
+		dom:    bits[2],
+		month:  bits[3],
+		dow:    bits[4],
+		domAny: parts[2] == "*",
+		dowAny: parts[4] == "*",
+	}
+
+	// both 0 and 7 represent Sunday
+	if s.dow&(1<<7) != 0 {
+		s.dow |= 1
+	}
+
+	if !s.matchesAnyDay() {
+		return nil, errors.Errorf("cron expression never matches: %q", expr)
+	}
+
+	return s, nil
+}
+
+// daysInMonth represents the maximum number of the days of the months, including February of the leap year.
+var daysInMonth = [13]int{0, 31, 29, 31, 30, 31, 30, 31, 31, 30, 31, 30, 31}
+
+// matchesAnyDay checks if any day of the allowed months matches the schedule, every month has all the days of week,
+// so only the day of month restricting the matching days could make the schedule never match.
+func (s *Schedule) matchesAnyDay() bool {
+	if !s.dowAny || s.domAny {
+		return true
+	}
+
+	for m := 1; m <= 12; m++ {
+		if s.month&(1<<uint(m)) == 0 {
+			continue
+		}
+
+		for d := 1; d <= daysInMonth[m]; d++ {
+			if s.dom&(1<<uint(d)) != 0 {
+				return true
+			}
+		}
+	}
+
+	return false
+}
+
+// parseField parses comma separated list of the values, ranges and steps of the field.
+func parseField(s string, f field) (uint64, error) {
+	var bits uint64
+
+	for _, part := range strings.Split(s, ",") {
+		rangeStr, stepStr, hasStep := strings.Cut(part, "/")
+
+		// parse the range
+		start, end := f.min, f.max
+
+		switch {
+		case rangeStr == "*":
+		case strings.Contains(rangeStr, "-"):
+			startStr, endStr, _ := strings.Cut(rangeStr, "-")
+
+			var err error
+
+			start, err = parseValue(startStr, f)
+			if err != nil {
+				return 0, err
+			}
+
+			end, err = parseValue(endStr, f)
+			if err != nil {
+				return 0, err
+			}
+		default:
+			v, err := parseValue(rangeStr, f)
+			if err != nil {
+				return 0, err
+			}
+
+			// the single value with the step starts the range to the maximum
+			start = v
+			if !hasStep {
+				end = v
+			}
+		}
+
+		if start > end {
+			return 0, errors.Errorf("wrong range of %s: %q", f.name, part)
+		}
+
+		// parse the step
+		step := 1
+
+		if hasStep {
+			var err error
+
+			step, err = strconv.Atoi(stepStr)
+			if err != nil || step < 1 {
+				return 0, errors.Errorf("wrong step of %s: %q", f.name, part)
+			}
+		}
+
+		for v := start; v <= end; v += step {
+			bits |= 1 << uint(v)
+		}
+	}
+
+	return bits, nil
+}
+
+// parseValue parses the value of the field within it's bounds.
+func parseValue(s string, f field) (int, error) {
+	v, err := strconv.Atoi(s)
+	if err != nil || v < f.min || v > f.max {
+		return 0, errors.Errorf("%s should be from %d to %d: %q", f.name, f.min, f.max, s)
+	}
+
+	return v, nil
+}
+
+// Next returns the first time after t matching the schedule in the location of t,
+// the parsed schedule always matches within 8 years, Ex. 29th of February after 2096 is in 2104.
+func (s *Schedule) Next(t time.Time) time.Time {
+	loc := t.Location()
+
+	// start from the next minute
+	t = time.Date(t.Year(), t.Month(), t.Day(), t.Hour(), t.Minute()+1, 0, 0, loc)
+	limit := t.AddDate(9, 0, 0)
+
+	for t.Before(limit) {
+		switch {
+		case s.month&(1<<uint(t.Month())) == 0:
+			t = time.Date(t.Year(), t.Month()+1, 1, 0, 0, 0, 0, loc)
+		case !s.matchesDay(t):
+			t = time.Date(t.Year(), t.Month(), t.Day()+1, 0, 0, 0, 0, loc)
+		case s.hour&(1<<uint(t.Hour())) == 0:
+			t = time.Date(t.Year(), t.Month(), t.Day(), t.Hour()+1, 0, 0, 0, loc)
+		case s.minute&(1<<uint(t.Minute())) == 0:
+			t = t.Add(time.Minute)
+		default:
+			return t
+		}
+	}
+
+	return time.Time{}
+}
+
+// matchesDay checks if the day matches the schedule, if both day of month and day of week are restricted
+// either of them should match.
+func (s *Schedule) matchesDay(t time.Time) bool {
+	dom := s.dom&(1<<uint(t.Day())) != 0
+	dow := s.dow&(1<<uint(t.Weekday())) != 0
+
+	if s.domAny || s.dowAny {
+		return dom && dow
+	}
+
+	return dom || dow
+}
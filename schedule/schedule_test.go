@@ -0,0 +1,58 @@
+package schedule
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestNext(t *testing.T) {
+	// Monday
+	from := time.Date(2024, 1, 1, 10, 30, 20, 0, time.UTC)
+
+	tests := []struct {
+		expr     string
+		expected time.Time
+	}{
+		{"* * * * *", time.Date(2024, 1, 1, 10, 31, 0, 0, time.UTC)},
+		{"@daily", time.Date(2024, 1, 2, 0, 0, 0, 0, time.UTC)},
+		{"@hourly", time.Date(2024, 1, 1, 11, 0, 0, 0, time.UTC)},
+		{"@monthly", time.Date(2024, 2, 1, 0, 0, 0, 0, time.UTC)},
+		{"*/15 * * * *", time.Date(2024, 1, 1, 10, 45, 0, 0, time.UTC)},
+		{"0,30 9-17 * * *", time.Date(2024, 1, 1, 11, 0, 0, 0, time.UTC)},
+		{"0 8 * * 1-5", time.Date(2024, 1, 2, 8, 0, 0, 0, time.UTC)},
+		{"0 0 * * 7", time.Date(2024, 1, 7, 0, 0, 0, 0, time.UTC)},
+		{"0 0 29 2 *", time.Date(2024, 2, 29, 0, 0, 0, 0, time.UTC)},
+		{"0 0 31 * *", time.Date(2024, 1, 31, 0, 0, 0, 0, time.UTC)},
+		// either the day of month or the day of week
+		{"0 0 15 * 3", time.Date(2024, 1, 3, 0, 0, 0, 0, time.UTC)},
+		// the day of month with the step is restricted as well
+		{"0 0 */10 * 3", time.Date(2024, 1, 3, 0, 0, 0, 0, time.UTC)},
+		{"5/20 * * * *", time.Date(2024, 1, 1, 10, 45, 0, 0, time.UTC)},
+	}
+
+	for _, tt := range tests {
+		s, err := Parse(tt.expr)
+		if !assert.NoError(t, err, tt.expr) {
+			continue
+		}
+
+		assert.Equal(t, tt.expected, s.Next(from), tt.expr)
+	}
+}
+
+func TestNextLeapDay(t *testing.T) {
+	s, err := Parse("0 0 29 2 *")
+	assert.NoError(t, err)
+
+	// 2100 is not a leap year
+	assert.Equal(t, time.Date(2104, 2, 29, 0, 0, 0, 0, time.UTC), s.Next(time.Date(2096, 3, 1, 0, 0, 0, 0, time.UTC)))
+}
+
+func TestParseErrors(t *testing.T) {
+	for _, expr := range []string{"", "* * * *", "60 * * * *", "* 24 * * *", "* * 0 * *", "* * * 13 *", "* * * * 8", "5-1 * * * *", "*/0 * * * *", "a * * * *", "0 0 30 2 *", "0 0 31 4,6,9,11 *"} {
+		_, err := Parse(expr)
+		assert.Error(t, err, expr)
+	}
+}
@@ -0,0 +1,78 @@
+package signer
+
+import (
+	"fmt"
+	"net/http"
+	"regexp"
+	"strconv"
+)
+
+const (
+	// ServiceTSA represents the Time Stamping Authority.
+	ServiceTSA = "tsa"
+	// ServiceOCSP represents the OCSP responder.
+	ServiceOCSP = "ocsp"
+	// ServiceCRL represents the CRL distribution point.
+	ServiceCRL = "crl"
+	// ServiceHSM represents the PKCS11 token.
+	ServiceHSM = "hsm"
+)
+
+// ServiceError represents a failure of the service used to sign the file.
+type ServiceError struct {
+	// Service represents the failed service, Ex. ServiceTSA
+	Service string
+	// StatusCode represents the HTTP status of the response, zero if the response isn't received
+	StatusCode int
+	// Temporary tells if the failure could go away when the file is signed again
+	Temporary bool
+	// Err represents the error returned by the service
+	Err error
+}
+
+// Error returns the message of the error.
+func (e *ServiceError) Error() string {
+	if e.StatusCode != 0 {
+		return fmt.Sprintf("%s: status %d: %v", e.Service, e.StatusCode, e.Err)
+	}
+
+	return fmt.Sprintf("%s: %v", e.Service, e.Err)
+}
+
+// Unwrap returns the error returned by the service.
+func (e *ServiceError) Unwrap() error {
+	return e.Err
+}
+
+// newHTTPServiceError creates the error of the service, the failure is temporary
+// if the response isn't received or the status tells that the request could be repeated.
+func newHTTPServiceError(service string, statusCode int, err error) *ServiceError {
+	return &ServiceError{
+		Service:    service,
+		StatusCode: statusCode,
+		Temporary:  statusCode == 0 || isTemporaryStatus(statusCode),
+		Err:        err,
+	}
+}
+
+// isTemporaryStatus checks if the request could succeed when it's repeated.
+func isTemporaryStatus(statusCode int) bool {
+	return statusCode == http.StatusRequestTimeout || statusCode == http.StatusTooManyRequests || statusCode >= 500
+}
+
+// tsaResponseRe matches the error of the TSA client of the pdfsign package,
+// it's the only way to read the status since the client doesn't return a typed error.
+var tsaResponseRe = regexp.MustCompile(`get timestamp: non success response \((\d+)\)`)
+
+// tsaError returns the error of the TSA if the signing failed to get the timestamp,
+// otherwise the error is returned as is.
+func tsaError(err error) error {
+	m := tsaResponseRe.FindStringSubmatch(err.Error())
+	if m == nil {
+		return err
+	}
+
+	statusCode, _ := strconv.Atoi(m[1])
+
+	return newHTTPServiceError(ServiceTSA, statusCode, err)
+}
@@ -0,0 +1,49 @@
+package signer
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+func TestServiceErrors(t *testing.T) {
+	// the status of the TSA is read from the error of the pdfsign package
+	err := tsaError(fmt.Errorf("failed to create signature: %w", errors.New("get timestamp: non success response (503): busy")))
+
+	var serviceErr *ServiceError
+	if !errors.As(err, &serviceErr) {
+		t.Fatalf("expected the error of the service, got %v", err)
+	}
+
+	if serviceErr.Service != ServiceTSA || serviceErr.StatusCode != 503 || !serviceErr.Temporary {
+		t.Fatalf("unexpected error of the TSA: %+v", serviceErr)
+	}
+
+	err = tsaError(errors.New("get timestamp: non success response (401): unauthorized"))
+	if !errors.As(err, &serviceErr) || serviceErr.Temporary {
+		t.Fatalf("expected the permanent error of the TSA, got %v", err)
+	}
+
+	// other errors are returned as is
+	err = tsaError(errors.New("malformed pdf"))
+	if errors.As(err, &serviceErr) {
+		t.Fatalf("unexpected error of the service: %v", err)
+	}
+
+	// the status of the revocation service is returned
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusServiceUnavailable)
+	}))
+	defer ts.Close()
+
+	_, err = fetchRevocationData(ServiceCRL, ts.URL)
+	if !errors.As(err, &serviceErr) {
+		t.Fatalf("expected the error of the service, got %v", err)
+	}
+
+	if serviceErr.Service != ServiceCRL || serviceErr.StatusCode != http.StatusServiceUnavailable || !serviceErr.Temporary {
+		t.Fatalf("unexpected error of the CRL distribution point: %+v", serviceErr)
+	}
+}
@@ -4,12 +4,24 @@
 package signer
 
 import (
+	"crypto"
+	"io"
+
 	"github.com/digitorus/pkcs11"
+	mpkcs11 "github.com/miekg/pkcs11"
+	"github.com/pkg/errors"
 	log "github.com/sirupsen/logrus"
 )
 
 // SetPKSC11 sets specific to PKSC11 settings.
 func (s *SignData) SetPKSC11(libPath, pass, crtChainPath string) {
+	s.SetPKSC11Sessions(libPath, pass, crtChainPath, 1)
+}
+
+// SetPKSC11Sessions sets specific to PKSC11 settings and opens sessions to sign concurrently,
+// the number of the sessions is limited by the maximum session count of the token.
+// Returns the number of opened sessions.
+func (s *SignData) SetPKSC11Sessions(libPath, pass, crtChainPath string, sessions int) int {
 	// pkcs11 key
 	lib, err := pkcs11.FindLib(libPath)
 	if err != nil {
@@ -26,6 +38,10 @@ func (s *SignData) SetPKSC11(libPath, pass, crtChainPath string) {
 	if err != nil {
 		log.Fatal(err)
 	}
+
+	// limit sessions by the maximum session count of the token
+	sessions = limitSessions(ctx, 0, sessions)
+
 	// login
 	session, err := pkcs11.CreateSession(ctx, 0, pass, false)
 	if err != nil {
@@ -45,8 +61,110 @@ func (s *SignData) SetPKSC11(libPath, pass, crtChainPath string) {
 		log.Fatal(err)
 	}
 
-	s.Signer = pkey
+	// the signing is done by the pool even with the single session, so the errors of the token are classified
+	pool := sessionPool{
+		public: pkey.Public(),
+		keys:   make(chan crypto.Signer, sessions),
+	}
+	pool.keys <- pkey
+
+	// open additional sessions, login is shared by all the sessions of the application
+	for i := 1; i < sessions; i++ {
+		session, err := ctx.OpenSession(0, mpkcs11.CKF_SERIAL_SESSION)
+		if err != nil {
+			log.Warnf("Couldn't open PKCS11 session, using %d sessions: %s", i, err)
+
+			sessions = i
+
+			break
+		}
+
+		pkey, err := pkcs11.InitPrivateKey(ctx, session, ckaId)
+		if err != nil {
+			log.Fatal(err)
+		}
+
+		pool.keys <- pkey
+	}
+
+	s.Signer = &pool
 
 	s.SetCertificateChains(crtChainPath)
 	s.SetRevocationSettings()
+
+	return sessions
+}
+
+// limitSessions limits the number of the sessions by the maximum session count of the token.
+func limitSessions(ctx *mpkcs11.Ctx, slot uint, sessions int) int {
+	if sessions < 1 {
+		sessions = 1
+	}
+
+	tokenInfo, err := ctx.GetTokenInfo(slot)
+	if err != nil {
+		log.Warnf("Couldn't get PKCS11 token info: %s", err)
+
+		return 1
+	}
+
+	// the maximum session count could be effectively infinite or unavailable
+	if tokenInfo.MaxSessionCount == 0 || tokenInfo.MaxSessionCount == mpkcs11.CK_UNAVAILABLE_INFORMATION {
+		return sessions
+	}
+
+	// keep the sessions opened by other applications
+	available := int(tokenInfo.MaxSessionCount) - int(tokenInfo.SessionCount)
+	if available < 1 {
+		available = 1
+	}
+
+	if sessions > available {
+		log.Warnf("PKCS11 token allows %d sessions, using %d instead of %d", tokenInfo.MaxSessionCount, available, sessions)
+
+		return available
+	}
+
+	return sessions
+}
+
+// sessionPool signs using the private keys of the PKCS11 sessions,
+// every session is used by a single signing at a time. The errors of the token are returned as ServiceError.
+type sessionPool struct {
+	public crypto.PublicKey
+	keys   chan crypto.Signer
+}
+
+// Public returns the public key of the private key.
+func (p *sessionPool) Public() crypto.PublicKey {
+	return p.public
+}
+
+// Sign signs using the private key of the first available session.
+func (p *sessionPool) Sign(rand io.Reader, digest []byte, opts crypto.SignerOpts) ([]byte, error) {
+	pkey := <-p.keys
+	defer func() { p.keys <- pkey }()
+
+	signature, err := pkey.Sign(rand, digest, opts)
+	if err != nil {
+		return nil, hsmError(err)
+	}
+
+	return signature, nil
+}
+
+// hsmError returns the error of the token, the failure is temporary if the session or the device is lost.
+func hsmError(err error) *ServiceError {
+	var p11Err mpkcs11.Error
+
+	temporary := false
+	if errors.As(err, &p11Err) {
+		switch p11Err {
+		case mpkcs11.CKR_DEVICE_ERROR, mpkcs11.CKR_DEVICE_MEMORY, mpkcs11.CKR_DEVICE_REMOVED,
+			mpkcs11.CKR_SESSION_CLOSED, mpkcs11.CKR_SESSION_HANDLE_INVALID, mpkcs11.CKR_TOKEN_NOT_PRESENT:
+			temporary = true
+		}
+	}
+
+	return &ServiceError{Service: ServiceHSM, Temporary: temporary, Err: err}
 }
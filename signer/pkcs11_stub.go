@@ -11,3 +11,10 @@ import (
 func (s *SignData) SetPKSC11(libPath, pass, crtChainPath string) {
 	log.Fatal("PKCS11 support is not available in this build. Please rebuild with CGO_ENABLED=1")
 }
+
+// SetPKSC11Sessions provides a stub implementation when PKCS11 is not available.
+func (s *SignData) SetPKSC11Sessions(libPath, pass, crtChainPath string, sessions int) int {
+	log.Fatal("PKCS11 support is not available in this build. Please rebuild with CGO_ENABLED=1")
+
+	return 0
+}
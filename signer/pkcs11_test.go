@@ -0,0 +1,53 @@
+//go:build cgo
+// +build cgo
+
+package signer
+
+import (
+	"crypto"
+	"errors"
+	"io"
+	"testing"
+
+	mpkcs11 "github.com/miekg/pkcs11"
+)
+
+// failingKey represents the key of the token failing the signing.
+type failingKey struct {
+	err error
+}
+
+func (k failingKey) Public() crypto.PublicKey {
+	return nil
+}
+
+func (k failingKey) Sign(io.Reader, []byte, crypto.SignerOpts) ([]byte, error) {
+	return nil, k.err
+}
+
+func TestSessionPoolErrors(t *testing.T) {
+	for _, tc := range []struct {
+		err       error
+		temporary bool
+	}{
+		{err: mpkcs11.Error(mpkcs11.CKR_DEVICE_REMOVED), temporary: true},
+		{err: mpkcs11.Error(mpkcs11.CKR_SESSION_CLOSED), temporary: true},
+		{err: mpkcs11.Error(mpkcs11.CKR_KEY_FUNCTION_NOT_PERMITTED), temporary: false},
+	} {
+		// the pool with the single session
+		pool := sessionPool{keys: make(chan crypto.Signer, 1)}
+		pool.keys <- failingKey{err: tc.err}
+
+		_, err := pool.Sign(nil, nil, nil)
+
+		var serviceErr *ServiceError
+		if !errors.As(err, &serviceErr) || serviceErr.Service != ServiceHSM || serviceErr.Temporary != tc.temporary {
+			t.Fatalf("unexpected error of the token %v: %v", tc.err, err)
+		}
+
+		// the session is returned to the pool
+		if len(pool.keys) != 1 {
+			t.Fatal("session is not returned to the pool")
+		}
+	}
+}
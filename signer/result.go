@@ -0,0 +1,120 @@
+package signer
+
+import (
+	"crypto/sha256"
+	"crypto/x509"
+	"encoding/asn1"
+	"encoding/hex"
+	"os"
+	"time"
+
+	"github.com/digitorus/pdf"
+	"github.com/digitorus/pkcs7"
+	"github.com/digitorus/timestamp"
+	"github.com/pkg/errors"
+)
+
+// Result represents the details of the signature added to the file.
+type Result struct {
+	// SigningTime represents the time written into the signature, zero for the document timestamp
+	SigningTime time.Time
+	// CertificateFingerprint represents hex encoded SHA-256 of the signing certificate, empty for the document timestamp
+	CertificateFingerprint string
+	// TimestampTime represents the time of the timestamp of the TSA, zero if the TSA is not used
+	TimestampTime time.Time
+}
+
+// oidTimeStampToken represents the unsigned attribute of the signature containing the timestamp of the TSA, RFC 3161.
+var oidTimeStampToken = asn1.ObjectIdentifier{1, 2, 840, 113549, 1, 9, 16, 2, 14}
+
+// certificateFingerprint returns hex encoded SHA-256 of the certificate, empty if the certificate is not provided.
+func certificateFingerprint(cert *x509.Certificate) string {
+	if cert == nil {
+		return ""
+	}
+
+	sum := sha256.Sum256(cert.Raw)
+
+	return hex.EncodeToString(sum[:])
+}
+
+// signatureTimestamp returns the time of the timestamp of the TSA of the last signature of the file,
+// zero if the signature doesn't contain the timestamp.
+func signatureTimestamp(path string) (time.Time, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return time.Time{}, err
+	}
+	defer func() { _ = f.Close() }()
+
+	finfo, err := f.Stat()
+	if err != nil {
+		return time.Time{}, err
+	}
+
+	rdr, err := pdf.NewReader(f, finfo.Size())
+	if err != nil {
+		return time.Time{}, err
+	}
+
+	// the last signature covers the longest part of the file
+	var (
+		last    pdf.Value
+		lastEnd int64 = -1
+	)
+
+	for _, x := range rdr.Xref() {
+		v := rdr.Resolve(x.Ptr(), x.Ptr())
+		if v.Key("Filter").Name() != "Adobe.PPKLite" {
+			continue
+		}
+
+		byteRange := v.Key("ByteRange")
+		if byteRange.Len() < 2 {
+			continue
+		}
+
+		end := byteRange.Index(byteRange.Len()-2).Int64() + byteRange.Index(byteRange.Len()-1).Int64()
+		if end > lastEnd {
+			last, lastEnd = v, end
+		}
+	}
+
+	if lastEnd < 0 {
+		return time.Time{}, errors.New("signature not found")
+	}
+
+	contents := []byte(last.Key("Contents").RawString())
+
+	// the document timestamp is the timestamp token itself
+	if last.Key("SubFilter").Name() == "ETSI.RFC3161" {
+		ts, err := timestamp.Parse(contents)
+		if err != nil {
+			return time.Time{}, errors.Wrap(err, "parse timestamp")
+		}
+
+		return ts.Time, nil
+	}
+
+	p7, err := pkcs7.Parse(contents)
+	if err != nil {
+		return time.Time{}, errors.Wrap(err, "parse signature")
+	}
+
+	for _, s := range p7.Signers {
+		for _, attr := range s.UnauthenticatedAttributes {
+			if !attr.Type.Equal(oidTimeStampToken) {
+				continue
+			}
+
+			ts, err := timestamp.Parse(attr.Value.Bytes)
+			if err != nil {
+				return time.Time{}, errors.Wrap(err, "parse timestamp")
+			}
+
+			return ts.Time, nil
+		}
+	}
+
+	return time.Time{}, nil
+}
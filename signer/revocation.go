@@ -0,0 +1,91 @@
+package signer
+
+import (
+	"crypto/x509"
+	"encoding/base64"
+	"io"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/digitorus/pdfsign/revocation"
+	"github.com/pkg/errors"
+	"golang.org/x/crypto/ocsp"
+)
+
+// revocationClient represents the HTTP client used to fetch the revocation status.
+var revocationClient = &http.Client{Timeout: 30 * time.Second}
+
+// embedRevocationStatus embeds the OCSP response and the CRL of the certificate like
+// the default function of the pdfsign package, but returns the ServiceError if the service fails.
+func embedRevocationStatus(cert, issuer *x509.Certificate, i *revocation.InfoArchival) error {
+	// OCSP requires issuer certificate
+	if issuer != nil && len(cert.OCSPServer) > 0 {
+		err := embedOCSPRevocationStatus(cert, issuer, i)
+		if err != nil {
+			return err
+		}
+	}
+
+	if len(cert.CRLDistributionPoints) > 0 {
+		err := embedCRLRevocationStatus(cert, i)
+		if err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// embedOCSPRevocationStatus embeds the OCSP response of the certificate.
+func embedOCSPRevocationStatus(cert, issuer *x509.Certificate, i *revocation.InfoArchival) error {
+	req, err := ocsp.CreateRequest(cert, issuer, nil)
+	if err != nil {
+		return err
+	}
+
+	ocspURL := strings.TrimRight(cert.OCSPServer[0], "/") + "/" + base64.StdEncoding.EncodeToString(req)
+
+	body, err := fetchRevocationData(ServiceOCSP, ocspURL)
+	if err != nil {
+		return err
+	}
+
+	// check if we got a valid OCSP response
+	_, err = ocsp.ParseResponseForCert(body, cert, issuer)
+	if err != nil {
+		return &ServiceError{Service: ServiceOCSP, Err: err}
+	}
+
+	return i.AddOCSP(body)
+}
+
+// embedCRLRevocationStatus embeds the CRL of the certificate.
+func embedCRLRevocationStatus(cert *x509.Certificate, i *revocation.InfoArchival) error {
+	body, err := fetchRevocationData(ServiceCRL, cert.CRLDistributionPoints[0])
+	if err != nil {
+		return err
+	}
+
+	return i.AddCRL(body)
+}
+
+// fetchRevocationData returns the body of the response of the service.
+func fetchRevocationData(service, url string) ([]byte, error) {
+	resp, err := revocationClient.Get(url)
+	if err != nil {
+		return nil, newHTTPServiceError(service, 0, err)
+	}
+	defer func() { _ = resp.Body.Close() }()
+
+	body, err := io.ReadAll(resp.Body)
+	if err != nil {
+		return nil, newHTTPServiceError(service, 0, err)
+	}
+
+	if resp.StatusCode < 200 || resp.StatusCode > 299 {
+		return nil, newHTTPServiceError(service, resp.StatusCode, errors.New(http.StatusText(resp.StatusCode)))
+	}
+
+	return body, nil
+}
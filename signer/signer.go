@@ -4,6 +4,7 @@ import (
 	"crypto/x509"
 	"encoding/pem"
 	"os"
+	"path/filepath"
 	"time"
 
 	"github.com/digitorus/pdf"
@@ -91,15 +92,22 @@ func (s *SignData) SetCertificateChains(crtChainPath string) {
 // SetRevocationSettings sets default revocation settings.
 func (s *SignData) SetRevocationSettings() {
 	s.RevocationData = revocation.InfoArchival{}
-	s.RevocationFunction = sign.DefaultEmbedRevocationStatusFunction
+	s.RevocationFunction = embedRevocationStatus
 }
 
 // SignFile checks the license, waits if limits are reached, if allowed signs the file.
 func SignFile(input, output string, s SignData, validateSignature bool) error {
+	_, err := SignFileResult(input, output, s, validateSignature)
+
+	return err
+}
+
+// SignFileResult signs the file like SignFile and returns the details of the added signature.
+func SignFileResult(input, output string, s SignData, validateSignature bool) (Result, error) {
 	// check the license and wait if limits are reached
 	err := license.LD.Wait()
 	if err != nil {
-		return errors.Wrap(err, "")
+		return Result{}, errors.Wrap(err, "")
 	}
 
 	// set date
@@ -108,13 +116,26 @@ func SignFile(input, output string, s SignData, validateSignature bool) error {
 	// sign file
 	err = signFile(input, output, s, validateSignature)
 	if err != nil {
-		return errors.Wrap(err, "")
+		return Result{}, errors.Wrap(err, "")
 	}
 
 	// log the result
 	log.Println("File signed:", output)
 
-	return err
+	res := Result{
+		SigningTime:            s.Signature.Info.Date,
+		CertificateFingerprint: certificateFingerprint(s.Certificate),
+	}
+
+	// the time of the TSA is read from the signature
+	if s.TSA.URL != "" {
+		res.TimestampTime, err = signatureTimestamp(output)
+		if err != nil {
+			return res, errors.Wrap(err, "read timestamp")
+		}
+	}
+
+	return res, nil
 }
 
 func signFile(input string, output string, sign_data SignData, validateSignature bool) error {
@@ -124,11 +145,17 @@ func signFile(input string, output string, sign_data SignData, validateSignature
 	}
 	defer func() { _ = input_file.Close() }()
 
-	output_file, err := os.Create(output)
+	// write to the temporary file next to the output, so the output is never partially written
+	output_file, err := os.CreateTemp(filepath.Dir(output), "."+filepath.Base(output)+".*.tmp")
 	if err != nil {
 		return err
 	}
-	defer func() { _ = output_file.Close() }()
+
+	// remove the temporary file if it's not renamed to the output
+	defer func() {
+		_ = output_file.Close()
+		_ = os.Remove(output_file.Name())
+	}()
 
 	finfo, err := input_file.Stat()
 	if err != nil {
@@ -144,7 +171,7 @@ func signFile(input string, output string, sign_data SignData, validateSignature
 
 	err = sign.Sign(input_file, output_file, rdr, size, sign.SignData(sign_data))
 	if err != nil {
-		return err
+		return tsaError(err)
 	}
 
 	if validateSignature {
@@ -154,5 +181,50 @@ func signFile(input string, output string, sign_data SignData, validateSignature
 		}
 	}
 
-	return nil
+	err = output_file.Chmod(0o644)
+	if err != nil {
+		return err
+	}
+
+	err = output_file.Close()
+	if err != nil {
+		return err
+	}
+
+	return os.Rename(output_file.Name(), output)
+}
+
+// TimestampFile checks the license, waits if limits are reached, if allowed adds the document timestamp of the TSA to the file.
+func TimestampFile(input, output string, tsa sign.TSA) error {
+	_, err := TimestampFileResult(input, output, tsa)
+
+	return err
+}
+
+// TimestampFileResult adds the document timestamp like TimestampFile and returns the time of the TSA.
+func TimestampFileResult(input, output string, tsa sign.TSA) (Result, error) {
+	// check the license and wait if limits are reached
+	err := license.LD.Wait()
+	if err != nil {
+		return Result{}, errors.Wrap(err, "")
+	}
+
+	// the document timestamp is signed by the TSA
+	s := SignData{TSA: tsa}
+	s.Signature.CertType = sign.TimeStampSignature
+
+	err = signFile(input, output, s, false)
+	if err != nil {
+		return Result{}, errors.Wrap(err, "timestamp file")
+	}
+
+	// log the result
+	log.Println("File timestamped:", output)
+
+	ts, err := signatureTimestamp(output)
+	if err != nil {
+		return Result{}, errors.Wrap(err, "read timestamp")
+	}
+
+	return Result{TimestampTime: ts}, nil
 }
@@ -1,8 +1,12 @@
 package signer
 
 import (
+	"crypto/sha256"
+	"encoding/hex"
 	"io"
+	"path/filepath"
 	"testing"
+	"time"
 
 	"github.com/digitorus/pdfsign/sign"
 	"github.com/digitorus/pdfsigner/license"
@@ -40,3 +44,53 @@ func TestSigner(t *testing.T) {
 		}
 	}
 }
+
+func TestSignFileResult(t *testing.T) {
+	logrus.SetOutput(io.Discard)
+
+	err := license.Initialize([]byte(license.TestLicense))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	signData := SignData{}
+	signData.Signature.CertType = sign.ApprovalSignature
+	signData.SetPEM("../testfiles/test.crt", "../testfiles/test.pem", "")
+
+	res, err := SignFileResult("../testfiles/testfile12.pdf", filepath.Join(t.TempDir(), "signed.pdf"), signData, false)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if time.Since(res.SigningTime) > time.Minute {
+		t.Fatalf("unexpected signing time %s", res.SigningTime)
+	}
+
+	sum := sha256.Sum256(signData.Certificate.Raw)
+	if res.CertificateFingerprint != hex.EncodeToString(sum[:]) {
+		t.Fatalf("unexpected certificate fingerprint %s", res.CertificateFingerprint)
+	}
+
+	// the signature without the TSA doesn't have the timestamp
+	if !res.TimestampTime.IsZero() {
+		t.Fatalf("unexpected timestamp time %s", res.TimestampTime)
+	}
+}
+
+func TestSignatureTimestamp(t *testing.T) {
+	// the sample is signed with the timestamp of the TSA
+	ts, err := signatureTimestamp("../testfiles/SampleSignedPDFDocument.pdf")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if expected := time.Date(2009, 7, 16, 14, 47, 57, 0, time.UTC); !ts.Equal(expected) {
+		t.Fatalf("expected %s, got %s", expected, ts)
+	}
+
+	// the unsigned file doesn't have the signature
+	_, err = signatureTimestamp("../testfiles/testfile12.pdf")
+	if err == nil {
+		t.Fatal("expected error for the unsigned file")
+	}
+}
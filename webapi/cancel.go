@@ -0,0 +1,52 @@
+package webapi
+
+import (
+	"net/http"
+
+	"github.com/gorilla/mux"
+	"github.com/pkg/errors"
+)
+
+// handleCancelJob cancels pending tasks of the job and responses with the status of the job.
+func (wa *WebAPI) handleCancelJob(w http.ResponseWriter, r *http.Request) error {
+	// get vars
+	vars := mux.Vars(r)
+	jobID := vars["jobID"]
+
+	err := wa.queue.CancelJob(jobID)
+	if err != nil {
+		return httpError(w, errors.Wrap(err, "couldn't cancel job"), http.StatusBadRequest)
+	}
+
+	return wa.respondStatus(w, jobID)
+}
+
+// handleCancelTask cancels the pending task of the job and responses with the status of the job.
+func (wa *WebAPI) handleCancelTask(w http.ResponseWriter, r *http.Request) error {
+	// get vars
+	vars := mux.Vars(r)
+	jobID := vars["jobID"]
+	taskID := vars["taskID"]
+
+	err := wa.queue.CancelTask(jobID, taskID)
+	if err != nil {
+		return httpError(w, errors.Wrap(err, "couldn't cancel task"), http.StatusBadRequest)
+	}
+
+	return wa.respondStatus(w, jobID)
+}
+
+// respondStatus responds with the status of the job with all the tasks.
+func (wa *WebAPI) respondStatus(w http.ResponseWriter, jobID string) error {
+	j, err := wa.queue.GetJobByID(jobID)
+	if err != nil {
+		return httpError(w, err, http.StatusBadRequest)
+	}
+
+	tasks, err := j.GetTasks("")
+	if err != nil {
+		return httpError(w, err, http.StatusInternalServerError)
+	}
+
+	return respondJSON(w, newJobStatusResponse(j, tasks), http.StatusOK)
+}
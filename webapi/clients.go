@@ -0,0 +1,62 @@
+package webapi
+
+import (
+	"net/http"
+
+	"github.com/digitorus/pdfsigner/queues/priority_queue"
+)
+
+// apiKeyHeader represents the header identifying the client of the web api.
+const apiKeyHeader = "X-API-Key"
+
+// defaultAPIClientName represents the name of the client used for the requests without known key.
+const defaultAPIClientName = "default"
+
+// APIClient represents the client of the web api identified by the key.
+type APIClient struct {
+	// Name represents the name of the client
+	Name string
+	// Key represents the key provided by the client inside X-API-Key header
+	Key string
+	// MaxPriority represents the highest priority of the jobs of the client, not limited if unknown
+	MaxPriority priority_queue.Priority
+}
+
+// SetAPIClients sets the clients of the web api.
+func (wa *WebAPI) SetAPIClients(clients []APIClient) {
+	wa.apiClients = make(map[string]APIClient, len(clients))
+	wa.defaultAPIClient = APIClient{}
+
+	for _, c := range clients {
+		if c.Name == defaultAPIClientName {
+			wa.defaultAPIClient = c
+
+			continue
+		}
+
+		// the client without key couldn't be identified
+		if c.Key == "" {
+			continue
+		}
+
+		wa.apiClients[c.Key] = c
+	}
+}
+
+// getAPIClient returns the client of the request, the default client if the key is not provided or unknown.
+func (wa *WebAPI) getAPIClient(r *http.Request) APIClient {
+	if c, exists := wa.apiClients[r.Header.Get(apiKeyHeader)]; exists {
+		return c
+	}
+
+	return wa.defaultAPIClient
+}
+
+// capPriority limits the priority by the maximum priority of the client.
+func (c APIClient) capPriority(p priority_queue.Priority) priority_queue.Priority {
+	if c.MaxPriority != priority_queue.UnknownPriority && p > c.MaxPriority {
+		return c.MaxPriority
+	}
+
+	return p
+}
@@ -0,0 +1,67 @@
+package webapi
+
+import (
+	"net/http"
+
+	"github.com/gorilla/mux"
+	"github.com/pkg/errors"
+)
+
+// handleGetDeadLetter responses with the dead lettered tasks of the jobs of the api client, filtered by the unit query parameter if provided.
+func (wa *WebAPI) handleGetDeadLetter(w http.ResponseWriter, r *http.Request) error {
+	client := wa.getAPIClient(r)
+	if client.Name == "" {
+		return httpError(w, errors.New("api key is required to list dead lettered tasks"), http.StatusUnauthorized)
+	}
+
+	unitName := r.URL.Query().Get("unit")
+	if unitName != "" {
+		unitName = wa.unitName(unitName)
+	}
+
+	tasks, err := wa.queue.GetDeadLetterTasks(unitName, client.Name)
+	if err != nil {
+		return httpError(w, err, http.StatusInternalServerError)
+	}
+
+	res := deadLetterResponse{Tasks: []deadLetterTask{}}
+
+	for _, t := range tasks {
+		res.Tasks = append(res.Tasks, deadLetterTask{JobID: t.JobID, Unit: t.UnitName, task: newTask(t)})
+	}
+
+	return respondJSON(w, res, http.StatusOK)
+}
+
+// handleRequeueDeadLetter puts the dead lettered task of the job of the api client back to the queue.
+func (wa *WebAPI) handleRequeueDeadLetter(w http.ResponseWriter, r *http.Request) error {
+	client := wa.getAPIClient(r)
+	if client.Name == "" {
+		return httpError(w, errors.New("api key is required to requeue dead lettered tasks"), http.StatusUnauthorized)
+	}
+
+	// get vars
+	vars := mux.Vars(r)
+	jobID := vars["jobID"]
+	taskID := vars["taskID"]
+
+	// the tasks of the jobs of other clients are not found
+	j, err := wa.queue.GetJobByID(jobID)
+	if err != nil {
+		return httpError(w, err, http.StatusBadRequest)
+	}
+
+	if j.Client != client.Name {
+		return httpError(w, errors.New("task is not found"), http.StatusBadRequest)
+	}
+
+	err = wa.queue.RequeueTask(jobID, taskID)
+	if err != nil {
+		return httpError(w, err, http.StatusBadRequest)
+	}
+
+	// respond with ok
+	w.WriteHeader(http.StatusOK)
+
+	return nil
+}
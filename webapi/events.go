@@ -0,0 +1,160 @@
+package webapi
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"time"
+
+	"github.com/digitorus/pdfsigner/queues/queue"
+	"github.com/gorilla/mux"
+)
+
+// eventStatus represents the event with the status of the job sent when the stream is opened.
+const eventStatus = "job.status"
+
+// eventsBuffer represents the number of the events waiting to be sent to the client.
+const eventsBuffer = 100
+
+// eventsHeartbeat represents how often the comment is sent to keep the idle connection open.
+const eventsHeartbeat = 15 * time.Second
+
+// eventsWriteTimeout represents the time to write the single event.
+const eventsWriteTimeout = 10 * time.Second
+
+// jobEventResponse represents the data of the event of the job.
+type jobEventResponse struct {
+	Job       job    `json:"job"`
+	Processed int    `json:"processed"`
+	Total     int    `json:"total"`
+	Task      *task  `json:"task,omitempty"`
+	Tasks     []task `json:"tasks,omitempty"`
+}
+
+// newJobEventResponse creates the data of the event, the tasks are provided with the status of the job and the completed job.
+func newJobEventResponse(e queue.Event) jobEventResponse {
+	res := jobEventResponse{Job: newJob(e.Job), Processed: e.Processed, Total: e.Total}
+
+	if e.Type == queue.EventTaskStarted || e.Type == queue.EventTaskUpdated {
+		t := newTask(e.Task)
+		res.Task = &t
+	}
+
+	for _, t := range e.Job.TasksMap {
+		res.Tasks = append(res.Tasks, newTask(t))
+	}
+
+	return res
+}
+
+// handleEvents streams the changes of the job as server-sent events until the job is completed or the server is shutting down.
+func (wa *WebAPI) handleEvents(w http.ResponseWriter, r *http.Request) error {
+	vars := mux.Vars(r)
+	jobID := vars["jobID"]
+
+	// subscribe before getting the status so the changes are not missed
+	events, unsubscribe := wa.queue.SubscribeJob(jobID, eventsBuffer)
+	defer func() { unsubscribe() }()
+
+	j, err := wa.queue.GetJobByID(jobID)
+	if err != nil {
+		return httpError(w, err, http.StatusBadRequest)
+	}
+
+	w.Header().Set("Content-Type", "text/event-stream")
+	w.Header().Set("Cache-Control", "no-cache")
+	w.Header().Set("Connection", "keep-alive")
+	w.WriteHeader(http.StatusOK)
+
+	rc := http.NewResponseController(w)
+
+	// send the current status of the job
+	completed, err := writeStatusEvent(rc, w, j)
+	if err != nil || completed {
+		return err
+	}
+
+	heartbeat := time.NewTicker(eventsHeartbeat)
+	defer heartbeat.Stop()
+
+	for {
+		select {
+		case e, ok := <-events:
+			// the events were dropped since the client is slow, the status is sent again
+			if !ok {
+				unsubscribe()
+				events, unsubscribe = wa.queue.SubscribeJob(jobID, eventsBuffer)
+
+				j, err := wa.queue.GetJobByID(jobID)
+				if err != nil {
+					return err
+				}
+
+				completed, err := writeStatusEvent(rc, w, j)
+				if err != nil || completed {
+					return err
+				}
+
+				continue
+			}
+
+			err := writeEvent(rc, w, e)
+			if err != nil {
+				return err
+			}
+
+			if e.Type == queue.EventJobCompleted {
+				return nil
+			}
+		case <-heartbeat.C:
+			_ = rc.SetWriteDeadline(time.Now().Add(eventsWriteTimeout))
+
+			_, err := fmt.Fprint(w, ": heartbeat\n\n")
+			if err != nil {
+				return err
+			}
+
+			err = rc.Flush()
+			if err != nil {
+				return err
+			}
+		case <-r.Context().Done():
+			return nil
+		case <-wa.shutdown:
+			return nil
+		}
+	}
+}
+
+// writeStatusEvent writes the event with the status of the job and the completion event if the job is completed,
+// returns true if the job is completed.
+func writeStatusEvent(rc *http.ResponseController, w http.ResponseWriter, j queue.Job) (bool, error) {
+	status := queue.Event{Type: eventStatus, Job: j, Processed: int(j.TotalProcesedTasks), Total: len(j.TasksMap)}
+
+	err := writeEvent(rc, w, status)
+	if err != nil || !j.IsCompleted() {
+		return false, err
+	}
+
+	status.Type = queue.EventJobCompleted
+
+	return true, writeEvent(rc, w, status)
+}
+
+// writeEvent writes the event to the stream and flushes it to the client.
+func writeEvent(rc *http.ResponseController, w http.ResponseWriter, e queue.Event) error {
+	data, err := json.Marshal(newJobEventResponse(e))
+	if err != nil {
+		return err
+	}
+
+	// extend write deadline of the server for every event
+	_ = rc.SetWriteDeadline(time.Now().Add(eventsWriteTimeout))
+
+	_, err = fmt.Fprintf(w, "event: %s\ndata: %s\n\n", e.Type, data)
+	if err != nil {
+		return err
+	}
+
+	return rc.Flush()
+}
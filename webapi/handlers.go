@@ -7,10 +7,15 @@ import (
 	"net/http"
 	"os"
 	"strconv"
+	"time"
 
 	"github.com/digitorus/pdfsign/sign"
 	"github.com/digitorus/pdfsign/verify"
+	"github.com/digitorus/pdfsigner/queues/priority_queue"
 	"github.com/digitorus/pdfsigner/queues/queue"
+	"github.com/digitorus/pdfsigner/report"
+	"github.com/digitorus/pdfsigner/revision"
+	"github.com/digitorus/pdfsigner/webhook"
 	"github.com/gorilla/mux"
 	"github.com/pkg/errors"
 )
@@ -26,6 +31,36 @@ func (wa *WebAPI) handleVerifySchedule(w http.ResponseWriter, r *http.Request) e
 }
 
 func (wa *WebAPI) scheduleJob(jobType string, w http.ResponseWriter, r *http.Request) error {
+	// parse wait duration of the synchronous mode
+	wait, err := parseWait(r)
+	if err != nil {
+		return httpError(w, err, http.StatusBadRequest)
+	}
+
+	// respond with the job added before with the same idempotency key
+	idempotencyKey, err := wa.idempotencyKey(jobType, r)
+	if err != nil {
+		return httpError(w, err, http.StatusBadRequest)
+	}
+
+	if idempotencyKey != "" {
+		if !wa.acquireIdempotencyKey(idempotencyKey) {
+			return httpError(w, errors.New("request with the same idempotency key is being processed"), http.StatusConflict)
+		}
+		defer wa.releaseIdempotencyKey(idempotencyKey)
+
+		jobID, err := wa.queue.IdempotentJobID(idempotencyKey)
+		if err != nil {
+			return httpError(w, errors.Wrap(err, "idempotency key"), http.StatusInternalServerError)
+		}
+
+		if jobID != "" {
+			w.Header().Set(idempotentReplayedHeader, "true")
+
+			return wa.respondScheduled(jobType, jobID, wait, w, r, http.StatusOK)
+		}
+	}
+
 	// put job with specified signer
 	mr, err := r.MultipartReader()
 	if err != nil {
@@ -64,12 +99,55 @@ func (wa *WebAPI) scheduleJob(jobType string, w http.ResponseWriter, r *http.Req
 		}
 	}
 
+	// the signer could be processed by the unit of the service
+	f.unitName = wa.signerUnit(f.unitName)
+
+	// limit the priority by the client
+	f.client = wa.getAPIClient(r)
+
+	// notify default webhooks and the callback url
+	f.webhooks = append(append([]string{}, wa.webhooks...), f.webhooks...)
+
 	// add job to the queue
 	jobID, err := addJob(jobType, wa.queue, f, fileNames)
+	if errors.Is(err, priority_queue.ErrFull) {
+		// the files are not needed since the job was rejected
+		removeTempFiles(fileNames)
+
+		unitName := f.unitName
+		if jobType != "sign" {
+			unitName = queue.VerificationUnitName
+		}
+
+		w.Header().Set("Retry-After", strconv.Itoa(wa.retryAfter(unitName, len(fileNames))))
+
+		return httpError(w, errors.Wrap(err, "add tasks"), http.StatusTooManyRequests)
+	}
+
 	if err != nil {
+		removeTempFiles(fileNames)
+
 		return httpError(w, errors.Wrap(err, "add tasks"), http.StatusBadRequest)
 	}
 
+	// map the idempotency key to the job, so the retries of the request get the same job
+	if idempotencyKey != "" {
+		err := wa.queue.SetIdempotencyKey(idempotencyKey, jobID)
+		if err != nil {
+			return httpError(w, errors.Wrap(err, "idempotency key"), http.StatusInternalServerError)
+		}
+	}
+
+	return wa.respondScheduled(jobType, jobID, wait, w, r, http.StatusCreated)
+}
+
+// respondScheduled responds with the id of the scheduled job or waits for the result in synchronous mode.
+func (wa *WebAPI) respondScheduled(jobType, jobID string, wait time.Duration, w http.ResponseWriter, r *http.Request, code int) error {
+	// wait for the result in synchronous mode
+	if wait > 0 {
+		return wa.respondSync(jobType, jobID, wait, w, r)
+	}
+
 	// create response
 	res := hanldeScheduleResponse{jobID}
 
@@ -77,18 +155,25 @@ func (wa *WebAPI) scheduleJob(jobType string, w http.ResponseWriter, r *http.Req
 	w.Header().Set("Location", "/"+jobType+"/"+jobID)
 
 	// respond with json
-	return respondJSON(w, res, http.StatusCreated)
+	return respondJSON(w, res, code)
 }
 
 // fields represents data received with scheduling request.
 type fields struct {
-	unitName   string
-	signConfig queue.JobSignConfig
+	unitName     string
+	pipeline     string
+	signConfig   queue.JobSignConfig
+	verifyConfig queue.JobVerifyConfig
+	priority     priority_queue.Priority
+	deadline     time.Time
+	notBefore    time.Time
+	client       APIClient
+	webhooks     []string
 }
 
 func parseFields(p *multipart.Part, f *fields) error {
 	switch p.FormName() {
-	case "signer", "name", "location", "reason", "contactInfo", "certType", "approval":
+	case "signer", "pipeline", "name", "location", "reason", "contactInfo", "certType", "approval", "docMDPPermissions", "validateSignature", "refresh", "priority", "deadline", "not_before", "callback_url":
 		// parse params
 		slurp, err := io.ReadAll(p)
 		if err != nil {
@@ -101,6 +186,8 @@ func parseFields(p *multipart.Part, f *fields) error {
 		switch p.FormName() {
 		case "signer":
 			f.unitName = str
+		case "pipeline":
+			f.pipeline = str
 		case "name":
 			f.signConfig.Name = str
 		case "location":
@@ -130,6 +217,41 @@ func parseFields(p *multipart.Part, f *fields) error {
 			}
 
 			f.signConfig.ValidateSignature = b
+		case "refresh":
+			b, err := strconv.ParseBool(str)
+			if err != nil {
+				return err
+			}
+
+			f.verifyConfig.ForceRefresh = b
+		case "priority":
+			p, err := priority_queue.ParsePriority(str)
+			if err != nil {
+				return err
+			}
+
+			f.priority = p
+		case "deadline":
+			d, err := parseDeadline(str)
+			if err != nil {
+				return err
+			}
+
+			f.deadline = d
+		case "not_before":
+			t, err := parseTime("not_before", str)
+			if err != nil {
+				return err
+			}
+
+			f.notBefore = t
+		case "callback_url":
+			err := webhook.ValidateURL(str)
+			if err != nil {
+				return err
+			}
+
+			f.webhooks = append(f.webhooks, str)
 		}
 	}
 
@@ -144,23 +266,73 @@ func addJob(jobType string, qs *queue.Queue, f fields, fileNames map[string]stri
 
 	totalTasks := len(fileNames)
 
+	// check the time the tasks should be processed within
+	if !f.notBefore.IsZero() {
+		if jobType != "sign" {
+			return "", errors.New("not_before is supported only for signing")
+		}
+
+		if !f.deadline.IsZero() && !f.deadline.After(f.notBefore) {
+			return "", errors.New("deadline should be after not_before")
+		}
+	}
+
 	var jobID string
 
 	if jobType == "sign" {
-		if f.unitName == "" {
+		switch {
+		case f.pipeline != "" && f.unitName != "":
+			return "", errors.New("either signer or pipeline should be provided")
+		case f.pipeline != "":
+			// the tasks are added to the unit of the first step of the pipeline
+			id, err := qs.AddPipelineJob(f.pipeline, f.signConfig)
+			if err != nil {
+				return "", err
+			}
+
+			jobID = id
+		case f.unitName == "":
 			return "", errors.New("signer name was not provided")
+		default:
+			jobID = qs.AddSignJob(f.signConfig)
 		}
-
-		jobID = qs.AddSignJob(f.signConfig)
 	} else {
+		if f.pipeline != "" {
+			return "", errors.New("pipeline is supported only for signing")
+		}
+
 		f.unitName = queue.VerificationUnitName
-		jobID = qs.AddVerifyJob()
+		jobID = qs.AddVerifyJob(f.verifyConfig)
+	}
+
+	// determine priority if not provided and limit it by the client
+	priority := f.priority
+	if priority == priority_queue.UnknownPriority {
+		priority = determinePriority(totalTasks)
 	}
 
-	priority := determinePriority(totalTasks)
+	priority = f.client.capPriority(priority)
 
-	err := qs.AddBatchPersistentTasks(f.unitName, jobID, fileNames, priority)
+	// record the client to find the jobs of the client
+	if f.client.Name != "" {
+		err := qs.SetJobClient(jobID, f.client.Name)
+		if err != nil {
+			return "", err
+		}
+	}
+
+	if len(f.webhooks) > 0 {
+		err := qs.SetJobWebhooks(jobID, f.webhooks)
+		if err != nil {
+			return "", err
+		}
+	}
+
+	err := qs.AddBatchPersistentTasks(f.unitName, jobID, fileNames, priority, f.deadline, f.notBefore)
 	if err != nil {
+		// remove the job without tasks
+		_ = qs.DeleteJob(jobID)
+
 		return "", err
 	}
 
@@ -184,16 +356,18 @@ func (wa *WebAPI) handleStatus(w http.ResponseWriter, r *http.Request) error {
 		return httpError(w, err, http.StatusBadRequest)
 	}
 
+	return respondJSON(w, newJobStatusResponse(j, tasks), http.StatusOK)
+}
+
+// newJobStatusResponse creates job status response with the provided tasks.
+func newJobStatusResponse(j queue.Job, tasks []queue.Task) jobStatusResponse {
 	var responseTasks []task
 
 	for _, t := range tasks {
-		rt := task{ID: t.ID, Status: t.Status, OriginalFileName: t.OriginalFileName, Error: t.Error}
-		responseTasks = append(responseTasks, rt)
+		responseTasks = append(responseTasks, newTask(t))
 	}
 
-	jobStatus := jobStatusResponse{Job: job{j.ID}, Tasks: responseTasks}
-
-	return respondJSON(w, jobStatus, http.StatusOK)
+	return jobStatusResponse{Job: newJob(j), Tasks: responseTasks}
 }
 
 func (wa *WebAPI) handleSignGetFile(w http.ResponseWriter, r *http.Request) error {
@@ -208,6 +382,11 @@ func (wa *WebAPI) handleSignGetFile(w http.ResponseWriter, r *http.Request) erro
 		return httpError(w, err, http.StatusBadRequest)
 	}
 
+	return wa.respondSignedFile(w, completedTask)
+}
+
+// respondSignedFile responds with the signed file of the completed task and records the download.
+func (wa *WebAPI) respondSignedFile(w http.ResponseWriter, completedTask queue.Task) error {
 	// get file
 	file, err := os.Open(completedTask.OutputFilePath)
 	if err != nil {
@@ -230,7 +409,8 @@ func (wa *WebAPI) handleSignGetFile(w http.ResponseWriter, r *http.Request) erro
 		return httpError(w, err, http.StatusInternalServerError)
 	}
 
-	return nil
+	// the job could expire after the download
+	return wa.queue.MarkTaskDownloaded(completedTask.JobID, completedTask.ID)
 }
 
 // handleVerifyGetInfo.
@@ -246,17 +426,41 @@ func (wa *WebAPI) handleVerifyGetInfo(w http.ResponseWriter, r *http.Request) er
 		return httpError(w, err, http.StatusBadRequest)
 	}
 
+	return respondVerificationInfo(w, r, completedTask)
+}
+
+// respondVerificationInfo responds with verification information of the completed task.
+func respondVerificationInfo(w http.ResponseWriter, r *http.Request, completedTask queue.Task) error {
+	// respond with ETSI validation report if requested
+	if acceptsXML(r) {
+		b, err := report.NewETSIReport(completedTask.VerificationData, time.Now()).Marshal()
+		if err != nil {
+			return httpError(w, err, http.StatusInternalServerError)
+		}
+
+		return respondXML(w, b, http.StatusOK)
+	}
+
 	// respond with json
-	return respondJSON(w, handleVerifyGetInfoResponse{
-		DocumentInfo: completedTask.VerificationData.DocumentInfo,
-		Signers:      completedTask.VerificationData.Signers,
-	}, http.StatusOK)
+	return respondJSON(w, newVerifyGetInfoResponse(completedTask), http.StatusOK)
+}
+
+// newVerifyGetInfoResponse creates verification information response of the completed task.
+func newVerifyGetInfoResponse(completedTask queue.Task) handleVerifyGetInfoResponse {
+	return handleVerifyGetInfoResponse{
+		DocumentInfo:   completedTask.VerificationData.DocumentInfo,
+		Signers:        completedTask.VerificationData.Signers,
+		ChangeAnalysis: completedTask.ChangeAnalysis,
+		FromCache:      completedTask.FromCache,
+	}
 }
 
 // handleVerifyGetInfoResponse used for handleVerifyGetInfo response.
 type handleVerifyGetInfoResponse struct {
-	DocumentInfo verify.DocumentInfo `json:"document_info"`
-	Signers      []verify.Signer     `json:"signers"`
+	DocumentInfo   verify.DocumentInfo `json:"document_info"`
+	Signers        []verify.Signer     `json:"signers"`
+	ChangeAnalysis *revision.Analysis  `json:"change_analysis,omitempty"`
+	FromCache      bool                `json:"from_cache,omitempty"`
 }
 
 // handleSignDelete removes job from the queue.
@@ -5,10 +5,15 @@ import (
 	"fmt"
 	"io"
 	"mime/multipart"
+	"net/http"
 	"os"
 	"path"
+	"strings"
+	"time"
 
 	"github.com/digitorus/pdfsigner/queues/priority_queue"
+	"github.com/digitorus/pdfsigner/queues/queue"
+	"github.com/digitorus/pdfsigner/report"
 )
 
 // TODO: check if the encryption is needed.
@@ -21,7 +26,7 @@ func savePDFToTemp(p *multipart.Part, fileNames map[string]string) error {
 
 	// parse pdf
 	if ext == ".pdf" {
-		f, err := os.CreateTemp("", "pdfsigner_cache")
+		f, err := os.CreateTemp("", queue.TempFilePrefix)
 		if err != nil {
 			return err
 		}
@@ -42,6 +47,42 @@ func savePDFToTemp(p *multipart.Part, fileNames map[string]string) error {
 	return nil
 }
 
+// removeTempFiles removes saved pdf files.
+func removeTempFiles(fileNames map[string]string) {
+	for tempFileName := range fileNames {
+		_ = os.Remove(tempFileName)
+	}
+}
+
+// parseTime parses the time provided as RFC 3339 time or the duration from now, Ex. 30m.
+func parseTime(name, s string) (time.Time, error) {
+	t, err := time.Parse(time.RFC3339, s)
+	if err != nil {
+		d, durationErr := time.ParseDuration(s)
+		if durationErr != nil {
+			return time.Time{}, fmt.Errorf("%s should be RFC 3339 time or duration: %s", name, s)
+		}
+
+		t = time.Now().Add(d)
+	}
+
+	return t.UTC().Round(0), nil
+}
+
+// parseDeadline parses the deadline provided as RFC 3339 time or the duration from now, Ex. 30m.
+func parseDeadline(s string) (time.Time, error) {
+	deadline, err := parseTime("deadline", s)
+	if err != nil {
+		return time.Time{}, err
+	}
+
+	if !deadline.After(time.Now()) {
+		return time.Time{}, fmt.Errorf("deadline is in the past: %s", s)
+	}
+
+	return deadline, nil
+}
+
 // determinePriority determines priority based on amount of the tasks needed to process.
 func determinePriority(totalTasks int) priority_queue.Priority {
 	var priority priority_queue.Priority
@@ -54,6 +95,22 @@ func determinePriority(totalTasks int) priority_queue.Priority {
 	return priority
 }
 
+// acceptsXML checks if the client requested xml formatted response.
+func acceptsXML(r *http.Request) bool {
+	if r.URL.Query().Get("format") == "etsi" {
+		return true
+	}
+
+	for _, accept := range strings.Split(r.Header.Get("Accept"), ",") {
+		mediaType := strings.TrimSpace(strings.Split(accept, ";")[0])
+		if mediaType == report.ContentTypeXML || mediaType == "text/xml" {
+			return true
+		}
+	}
+
+	return false
+}
+
 // dumpRequest dumps request, only for debugging
 // func dumpRequest(r *http.Request) {
 // 	dump, err := httputil.DumpRequest(r, true)
@@ -0,0 +1,53 @@
+package webapi
+
+import (
+	"net/http"
+
+	"github.com/pkg/errors"
+)
+
+// idempotencyKeyHeader represents the header with the key making the retries of the job submission safe.
+const idempotencyKeyHeader = "Idempotency-Key"
+
+// idempotentReplayedHeader is set when the response is replayed for the job added with the same key before.
+const idempotentReplayedHeader = "Idempotent-Replayed"
+
+// maxIdempotencyKeyLength represents maximum length of the idempotency key.
+const maxIdempotencyKeyLength = 255
+
+// idempotencyKey returns the idempotency key of the request scoped by the job type and the client,
+// empty key is returned if the header is not provided.
+func (wa *WebAPI) idempotencyKey(jobType string, r *http.Request) (string, error) {
+	key := r.Header.Get(idempotencyKeyHeader)
+	if key == "" {
+		return "", nil
+	}
+
+	if len(key) > maxIdempotencyKeyLength {
+		return "", errors.Errorf("%s should not exceed %d characters", idempotencyKeyHeader, maxIdempotencyKeyLength)
+	}
+
+	return jobType + ":" + wa.getAPIClient(r).Name + ":" + key, nil
+}
+
+// acquireIdempotencyKey marks the key as used by the request being handled,
+// returns false if another request with the same key is being handled.
+func (wa *WebAPI) acquireIdempotencyKey(key string) bool {
+	wa.idempotencyMu.Lock()
+	defer wa.idempotencyMu.Unlock()
+
+	if _, exists := wa.idempotencyKeys[key]; exists {
+		return false
+	}
+
+	wa.idempotencyKeys[key] = struct{}{}
+
+	return true
+}
+
+// releaseIdempotencyKey allows the key to be used by another request.
+func (wa *WebAPI) releaseIdempotencyKey(key string) {
+	wa.idempotencyMu.Lock()
+	delete(wa.idempotencyKeys, key)
+	wa.idempotencyMu.Unlock()
+}
@@ -0,0 +1,83 @@
+package webapi
+
+import (
+	"net/http"
+	"net/url"
+	"strconv"
+
+	"github.com/digitorus/pdfsigner/queues/queue"
+	"github.com/pkg/errors"
+)
+
+// handleListJobs responses with the jobs of the client matching the query parameters from the newest to the oldest,
+// the client is identified by the key, the jobs of the default client are listed if the key is not provided or unknown.
+func (wa *WebAPI) handleListJobs(w http.ResponseWriter, r *http.Request) error {
+	// the jobs of other clients are never listed
+	client := wa.getAPIClient(r)
+	if client.Name == "" {
+		return httpError(w, errors.New("api key is required to list jobs"), http.StatusUnauthorized)
+	}
+
+	f, err := wa.parseJobFilter(r.URL.Query())
+	if err != nil {
+		return httpError(w, err, http.StatusBadRequest)
+	}
+
+	f.Client = client.Name
+
+	jobs, nextCursor, err := wa.queue.ListJobs(f)
+	if err != nil {
+		return httpError(w, err, http.StatusBadRequest)
+	}
+
+	res := jobsResponse{Jobs: []jobSummary{}, NextCursor: nextCursor}
+
+	for _, j := range jobs {
+		res.Jobs = append(res.Jobs, newJobSummary(j))
+	}
+
+	return respondJSON(w, res, http.StatusOK)
+}
+
+// parseJobFilter parses the conditions of the listed jobs.
+func (wa *WebAPI) parseJobFilter(values url.Values) (queue.JobFilter, error) {
+	f := queue.JobFilter{
+		Type:     values.Get("type"),
+		Status:   values.Get("status"),
+		FileName: values.Get("file_name"),
+		Cursor:   values.Get("cursor"),
+	}
+
+	if unitName := values.Get("unit"); unitName != "" {
+		f.Unit = wa.unitName(unitName)
+	}
+
+	if s := values.Get("created_after"); s != "" {
+		t, err := parseTime("created_after", s)
+		if err != nil {
+			return f, err
+		}
+
+		f.CreatedAfter = t
+	}
+
+	if s := values.Get("created_before"); s != "" {
+		t, err := parseTime("created_before", s)
+		if err != nil {
+			return f, err
+		}
+
+		f.CreatedBefore = t
+	}
+
+	if s := values.Get("limit"); s != "" {
+		limit, err := strconv.Atoi(s)
+		if err != nil || limit < 1 {
+			return f, errors.New("limit should be positive number")
+		}
+
+		f.Limit = limit
+	}
+
+	return f, nil
+}
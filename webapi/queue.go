@@ -1,8 +1,10 @@
 package webapi
 
 import (
+	"math"
 	"net/http"
 
+	"github.com/digitorus/pdfsigner/queues/queue"
 	"github.com/gorilla/mux"
 )
 
@@ -10,7 +12,7 @@ import (
 func (wa *WebAPI) handleGetQueueSize(w http.ResponseWriter, r *http.Request) error {
 	// get tasks for job
 	vars := mux.Vars(r)
-	signerName := vars["unitName"]
+	signerName := wa.unitName(vars["unitName"])
 
 	// get queue sizes by signer name
 	queue, err := wa.queue.GetQueueSizeByUnitName(signerName)
@@ -20,3 +22,59 @@ func (wa *WebAPI) handleGetQueueSize(w http.ResponseWriter, r *http.Request) err
 
 	return respondJSON(w, queue, http.StatusOK)
 }
+
+// handleGetQueueStats responses with processing statistics by signer name.
+func (wa *WebAPI) handleGetQueueStats(w http.ResponseWriter, r *http.Request) error {
+	vars := mux.Vars(r)
+	unitName := wa.unitName(vars["unitName"])
+
+	// get processing statistics by signer name
+	stats, err := wa.queue.GetUnitStats(unitName)
+	if err != nil {
+		return httpError(w, err, http.StatusNotFound)
+	}
+
+	return respondJSON(w, stats, http.StatusOK)
+}
+
+// SetSignerUnits sets the units processing the files of the signers by name of the signer,
+// the signers without the units are processed by the units with the same name as the signer.
+func (wa *WebAPI) SetSignerUnits(units map[string]string) {
+	wa.signerUnits = units
+}
+
+// unitName returns the name of the queue unit of the signer, "verify" is used for the verification unit.
+func (wa *WebAPI) unitName(name string) string {
+	if name == "verify" {
+		return queue.VerificationUnitName
+	}
+
+	return wa.signerUnit(name)
+}
+
+// signerUnit returns the name of the queue unit processing the files of the signer.
+func (wa *WebAPI) signerUnit(signerName string) string {
+	if unitName, exists := wa.signerUnits[signerName]; exists {
+		return unitName
+	}
+
+	return signerName
+}
+
+// defaultRetryAfter represents seconds to wait before retrying rejected job if the processing statistics are not available.
+const defaultRetryAfter = 5
+
+// retryAfter estimates seconds needed by the unit to process the number of the tasks.
+func (wa *WebAPI) retryAfter(unitName string, tasks int) int {
+	stats, err := wa.queue.GetUnitStats(unitName)
+	if err != nil || stats.AverageTaskSeconds == 0 || stats.Workers < 1 {
+		return defaultRetryAfter
+	}
+
+	seconds := int(math.Ceil(stats.AverageTaskSeconds * float64(tasks) / float64(stats.Workers)))
+	if seconds < 1 {
+		return 1
+	}
+
+	return seconds
+}
@@ -4,6 +4,7 @@ import (
 	"encoding/json"
 	"net/http"
 
+	"github.com/digitorus/pdfsigner/report"
 	"github.com/pkg/errors"
 )
 
@@ -44,3 +45,17 @@ func respondJSON(w http.ResponseWriter, data interface{}, code int) error {
 
 	return err
 }
+
+// respondXML responds with xml.
+func respondXML(w http.ResponseWriter, data []byte, code int) error {
+	// set content type
+	w.Header().Set("Content-Type", report.ContentTypeXML)
+
+	// set response code
+	w.WriteHeader(code)
+
+	// respond with xml
+	_, err := w.Write(data)
+
+	return err
+}
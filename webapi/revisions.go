@@ -0,0 +1,102 @@
+package webapi
+
+import (
+	"fmt"
+	"net/http"
+	"os"
+	"strconv"
+	"strings"
+
+	"github.com/digitorus/pdfsigner/revision"
+	"github.com/gorilla/mux"
+	"github.com/pkg/errors"
+)
+
+// handleGetRevisions responses with the incremental revisions of the verified document.
+func (wa *WebAPI) handleGetRevisions(w http.ResponseWriter, r *http.Request) error {
+	// get vars
+	vars := mux.Vars(r)
+	jobID := vars["jobID"]
+	taskID := vars["taskID"]
+
+	// get task
+	completedTask, err := wa.queue.GetCompletedTask(jobID, taskID)
+	if err != nil {
+		return httpError(w, err, http.StatusBadRequest)
+	}
+
+	// get input file
+	file, err := os.Open(completedTask.InputFilePath)
+	if err != nil {
+		return httpError(w, err, http.StatusInternalServerError)
+	}
+	defer func() { _ = file.Close() }()
+
+	fileInfo, err := file.Stat()
+	if err != nil {
+		return httpError(w, err, http.StatusInternalServerError)
+	}
+
+	// list revisions
+	revisions, err := revision.List(file, fileInfo.Size())
+	if err != nil {
+		return httpError(w, errors.Wrap(err, "list revisions"), http.StatusBadRequest)
+	}
+
+	return respondJSON(w, handleGetRevisionsResponse{Revisions: revisions}, http.StatusOK)
+}
+
+// handleGetRevisionsResponse used for handleGetRevisions response.
+type handleGetRevisionsResponse struct {
+	Revisions []revision.Info `json:"revisions"`
+}
+
+// handleRevisionGetFile responses with the document as it was at the end of the revision.
+func (wa *WebAPI) handleRevisionGetFile(w http.ResponseWriter, r *http.Request) error {
+	// get vars
+	vars := mux.Vars(r)
+	jobID := vars["jobID"]
+	taskID := vars["taskID"]
+
+	number, err := strconv.Atoi(vars["revision"])
+	if err != nil {
+		return httpError(w, errors.Wrap(err, "parse revision"), http.StatusBadRequest)
+	}
+
+	// get task
+	completedTask, err := wa.queue.GetCompletedTask(jobID, taskID)
+	if err != nil {
+		return httpError(w, err, http.StatusBadRequest)
+	}
+
+	// get input file
+	file, err := os.Open(completedTask.InputFilePath)
+	if err != nil {
+		return httpError(w, err, http.StatusInternalServerError)
+	}
+	defer func() { _ = file.Close() }()
+
+	fileInfo, err := file.Stat()
+	if err != nil {
+		return httpError(w, err, http.StatusInternalServerError)
+	}
+
+	// find revision
+	revisions, err := revision.List(file, fileInfo.Size())
+	if err != nil {
+		return httpError(w, errors.Wrap(err, "list revisions"), http.StatusBadRequest)
+	}
+
+	rev, err := revision.Find(revisions, number)
+	if err != nil {
+		return httpError(w, err, http.StatusNotFound)
+	}
+
+	fileName := strings.TrimSuffix(completedTask.OriginalFileName, ".pdf") + fmt.Sprintf("_revision_%d.pdf", rev.Number)
+
+	w.Header().Set("Content-Type", "application/pdf")
+	w.Header().Set("Content-Disposition", fmt.Sprintf(`attachment; filename="%s"`, fileName))
+	w.Header().Set("Content-Length", strconv.FormatInt(rev.End, 10))
+
+	return revision.Extract(file, rev, w)
+}
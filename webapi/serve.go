@@ -1,12 +1,15 @@
 package webapi
 
 import (
+	"context"
 	"net/http"
+	"sync"
 	"time"
 
 	"github.com/digitorus/pdfsigner/queues/queue"
 	"github.com/digitorus/pdfsigner/version"
 	"github.com/gorilla/mux"
+	"github.com/pkg/errors"
 	log "github.com/sirupsen/logrus"
 )
 
@@ -26,12 +29,28 @@ type WebAPI struct {
 	queue *queue.Queue
 	// allowedUnits represents signers that allowed to be used by the web api
 	allowedUnits []string
+	// signerUnits represents the units processing the files of the signers by name of the signer
+	signerUnits map[string]string
 	// version represents git version of the application
 	version version.Version
 	// middlewares represents middlewares used for all handlers
 	middlewares []middleware
 	// defaultValidateSignature defines defaults for signature validation after signing
 	defaultValidateSignature bool
+	// apiClients represents the clients of the web api by key
+	apiClients map[string]APIClient
+	// defaultAPIClient represents the client used for the requests without known key
+	defaultAPIClient APIClient
+	// webhooks represents urls notified about all the jobs
+	webhooks []string
+	// server represents http server of the web api
+	server *http.Server
+	// shutdown is closed when the server is shutting down to stop the long running requests
+	shutdown chan struct{}
+	// idempotencyKeys represents the idempotency keys of the job submissions being handled
+	idempotencyKeys map[string]struct{}
+	// idempotencyMu protects the idempotency keys
+	idempotencyMu sync.Mutex
 }
 
 // NewWebAPI initializes web api with routes.
@@ -45,8 +64,22 @@ func NewWebAPI(addr string, qs *queue.Queue, allowedUnits []string, version vers
 		r:                        mux.NewRouter(),
 		middlewares:              []middleware{},
 		defaultValidateSignature: defaultValidateSignature,
+		shutdown:                 make(chan struct{}),
+		idempotencyKeys:          make(map[string]struct{}),
 	}
 
+	// create server
+	wa.server = &http.Server{
+		Addr:           addr,
+		Handler:        wa.r,
+		ReadTimeout:    10 * time.Second,
+		WriteTimeout:   10 * time.Second,
+		MaxHeaderBytes: 1 << 20,
+	}
+
+	// stop streaming the events, shutdown doesn't wait for the active connections
+	wa.server.RegisterOnShutdown(func() { close(wa.shutdown) })
+
 	wa.allowedUnits = append(allowedUnits, "verify")
 
 	// add middlewares
@@ -56,15 +89,32 @@ func NewWebAPI(addr string, qs *queue.Queue, allowedUnits []string, version vers
 	// initialize sign routes
 	wa.handle("POST", "/sign", wa.handleSignSchedule)
 	wa.handle("GET", "/sign/{jobID}", wa.handleStatus)
+	wa.handle("GET", "/sign/{jobID}/events", wa.handleEvents)
 	wa.handle("GET", "/sign/{jobID}/{taskID}/download", wa.handleSignGetFile)
 	wa.handle("DELETE", "/sign/{jobID}", wa.handleDelete)
+	wa.handle("POST", "/sign/{jobID}/cancel", wa.handleCancelJob)
+	wa.handle("DELETE", "/sign/{jobID}/{taskID}", wa.handleCancelTask)
 	wa.handle("GET", "/queue/{unitName}", wa.handleGetQueueSize)
+	wa.handle("GET", "/queue/{unitName}/stats", wa.handleGetQueueStats)
 	wa.handle("GET", "/version", wa.handleGetVersion)
 
 	// initialize verify routes
 	wa.handle("POST", "/verify", wa.handleVerifySchedule)
 	wa.handle("GET", "/verify/{jobID}", wa.handleStatus)
+	wa.handle("GET", "/verify/{jobID}/events", wa.handleEvents)
+	wa.handle("DELETE", "/verify/{jobID}", wa.handleDelete)
+	wa.handle("POST", "/verify/{jobID}/cancel", wa.handleCancelJob)
+	wa.handle("DELETE", "/verify/{jobID}/{taskID}", wa.handleCancelTask)
 	wa.handle("GET", "/verify/{jobID}/info/{taskID}", wa.handleVerifyGetInfo)
+	wa.handle("GET", "/verify/{jobID}/revisions/{taskID}", wa.handleGetRevisions)
+	wa.handle("GET", "/verify/{jobID}/revisions/{taskID}/{revision}/download", wa.handleRevisionGetFile)
+
+	// initialize jobs routes
+	wa.handle("GET", "/jobs", wa.handleListJobs)
+
+	// initialize dead letter routes
+	wa.handle("GET", "/deadletter", wa.handleGetDeadLetter)
+	wa.handle("POST", "/deadletter/{jobID}/{taskID}/requeue", wa.handleRequeueDeadLetter)
 
 	// add health check endpoint
 	wa.handle("GET", "/health", wa.handleHealth)
@@ -102,24 +152,27 @@ func (wa *WebAPI) addMiddleware(m middleware) {
 	wa.middlewares = append(wa.middlewares, m)
 }
 
-// Serve starts the web server.
-func (wa *WebAPI) Serve() {
-	// create server
-	s := &http.Server{
-		Addr:           wa.addr,
-		Handler:        wa.r,
-		ReadTimeout:    10 * time.Second,
-		WriteTimeout:   10 * time.Second,
-		MaxHeaderBytes: 1 << 20,
-	}
+// SetWebhooks sets urls notified about all the jobs in addition to the callback url of the job.
+func (wa *WebAPI) SetWebhooks(urls []string) {
+	wa.webhooks = urls
+}
 
+// Serve starts the web server, returns when the server is shut down.
+func (wa *WebAPI) Serve() {
 	serveLoggerCtx := log.WithFields(log.Fields{
 		"addr":         wa.addr,
 		"allowedUnits": wa.allowedUnits,
 	})
 	serveLoggerCtx.Info("Starting Web API...")
 
-	if err := s.ListenAndServe(); err != nil {
+	if err := wa.server.ListenAndServe(); err != nil && !errors.Is(err, http.ErrServerClosed) {
 		serveLoggerCtx.Fatal("Coudn't start Web API:", err)
 	}
 }
+
+// Shutdown stops accepting new requests and waits until the requests being handled are finished or the context is done.
+func (wa *WebAPI) Shutdown(ctx context.Context) error {
+	log.WithField("addr", wa.addr).Info("Stopping Web API...")
+
+	return wa.server.Shutdown(ctx)
+}
@@ -2,18 +2,25 @@ package webapi
 
 import (
 	"bytes"
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
 	"encoding/json"
+	"fmt"
 	"io"
 	"mime/multipart"
 	"net/http"
 	"net/http/httptest"
 	"os"
 	"path/filepath"
+	"strconv"
+	"strings"
 	"testing"
 	"time"
 
 	"github.com/digitorus/pdfsign/sign"
 	"github.com/digitorus/pdfsigner/license"
+	"github.com/digitorus/pdfsigner/queues/priority_queue"
 	"github.com/digitorus/pdfsigner/queues/queue"
 	"github.com/digitorus/pdfsigner/signer"
 	"github.com/digitorus/pdfsigner/version"
@@ -68,6 +75,25 @@ func runTest(m *testing.M) int {
 	signData.SetPEM("../testfiles/test.crt", "../testfiles//test.pem", "")
 	q.AddSignUnit("simple", signData)
 	q.AddVerifyUnit()
+
+	// countersign the files with the same signer
+	err = q.AddPipeline(queue.Pipeline{
+		Name: "countersign",
+		Steps: []queue.PipelineStep{
+			{Type: queue.StepSign, Signer: "simple"},
+			{Type: queue.StepSign, Signer: "simple", CertType: sign.ApprovalSignature},
+			{Type: queue.StepVerify, Policy: queue.VerifyPolicy{MinSignatures: 2}},
+		},
+	})
+	if err != nil {
+		log.Fatal(err)
+	}
+
+	err = q.SetUnitWorkers("simple", 2)
+	if err != nil {
+		log.Fatal(err)
+	}
+
 	q.StartProcessor()
 
 	// create web api
@@ -155,7 +181,37 @@ func TestSignFlow(t *testing.T) {
 		w = httptest.NewRecorder()
 		wa.r.ServeHTTP(w, r)
 		assert.Equal(t, http.StatusOK, w.Code, w.Body.String())
-		assert.Len(t, w.Body.Bytes(), 20405)
+		assert.Len(t, w.Body.Bytes(), 20426)
+
+		// all the sign fields of the request override the signer
+		for _, field := range []string{"/Name (My Name)", "/Location (My Location)", "/Reason (My Reason)", "/ContactInfo (My ContactInfo)"} {
+			assert.Contains(t, w.Body.String(), field)
+		}
+
+		// the processing details identify the files and the signature
+		input, err := os.ReadFile("../testfiles/testfile12.pdf")
+		assert.NoError(t, err)
+
+		inputSum := sha256.Sum256(input)
+		outputSum := sha256.Sum256(w.Body.Bytes())
+
+		assert.Equal(t, hex.EncodeToString(inputSum[:]), task.InputSHA256)
+		assert.Equal(t, hex.EncodeToString(outputSum[:]), task.OutputSHA256)
+		assert.Equal(t, int64(20426), task.OutputSize)
+		assert.Len(t, task.CertificateFingerprint, 64)
+
+		if assert.NotNil(t, task.QueuedAt) && assert.NotNil(t, task.StartedAt) && assert.NotNil(t, task.FinishedAt) {
+			assert.False(t, task.StartedAt.Before(*task.QueuedAt))
+			assert.False(t, task.FinishedAt.Before(*task.StartedAt))
+		}
+
+		assert.NotNil(t, task.SigningTime)
+		assert.Nil(t, task.TimestampTime)
+
+		// the download is recorded for the retention
+		j, err := q.GetJobByID(scheduleResponse.JobID)
+		assert.NoError(t, err)
+		assert.False(t, j.TasksMap[task.ID].DownloadedAt.IsZero())
 
 		completedTasks += 1
 	}
@@ -254,6 +310,36 @@ func TestVerifyFlow(t *testing.T) {
 		wa.r.ServeHTTP(w, r)
 		assert.Equal(t, http.StatusOK, w.Code, w.Body.String())
 
+		// test get ETSI validation report
+		r = httptest.NewRequest(http.MethodGet, baseURL+"/verify/"+scheduleResponse.JobID+"/info/"+task.ID, nil)
+		r.Header.Set("Accept", "application/xml")
+		w = httptest.NewRecorder()
+		wa.r.ServeHTTP(w, r)
+		assert.Equal(t, http.StatusOK, w.Code, w.Body.String())
+		assert.Equal(t, "application/xml", w.Header().Get("Content-Type"))
+		assert.Contains(t, w.Body.String(), "<ValidationReport")
+
+		// test get revisions
+		r = httptest.NewRequest(http.MethodGet, baseURL+"/verify/"+scheduleResponse.JobID+"/revisions/"+task.ID, nil)
+		w = httptest.NewRecorder()
+		wa.r.ServeHTTP(w, r)
+		assert.Equal(t, http.StatusOK, w.Code, w.Body.String())
+
+		var revisionsResponse handleGetRevisionsResponse
+		if err := json.NewDecoder(w.Body).Decode(&revisionsResponse); err != nil {
+			t.Fatal(err)
+		}
+
+		assert.Len(t, revisionsResponse.Revisions, 2)
+
+		// test download signed revision
+		signed := revisionsResponse.Revisions[1]
+		r = httptest.NewRequest(http.MethodGet, fmt.Sprintf("%s/verify/%s/revisions/%s/%d/download", baseURL, scheduleResponse.JobID, task.ID, signed.Number), nil)
+		w = httptest.NewRecorder()
+		wa.r.ServeHTTP(w, r)
+		assert.Equal(t, http.StatusOK, w.Code, w.Body.String())
+		assert.Len(t, w.Body.Bytes(), int(signed.End))
+
 		completedTasks += 1
 	}
 
@@ -261,6 +347,73 @@ func TestVerifyFlow(t *testing.T) {
 	assert.Equal(t, 1, completedTasks)
 }
 
+func TestSyncFlow(t *testing.T) {
+	// test synchronous sign
+	r, err := newMultipleFilesUploadRequest(
+		baseURL+"/sign?wait=30s",
+		map[string]string{"signer": "simple"},
+		[]filePart{{"testfile1", "../testfiles/testfile12.pdf"}})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	w := httptest.NewRecorder()
+	wa.r.ServeHTTP(w, r)
+	assert.Equal(t, http.StatusOK, w.Code, w.Body.String())
+	assert.Equal(t, "application/pdf", w.Header().Get("Content-Type"))
+	assert.True(t, bytes.HasPrefix(w.Body.Bytes(), []byte("%PDF")))
+
+	// test synchronous verify
+	r, err = newMultipleFilesUploadRequest(
+		baseURL+"/verify?wait=30s",
+		map[string]string{},
+		[]filePart{{"testfile1", "../testfiles/SampleSignedPDFDocument.pdf"}})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	w = httptest.NewRecorder()
+	wa.r.ServeHTTP(w, r)
+	assert.Equal(t, http.StatusOK, w.Code, w.Body.String())
+
+	var info map[string]interface{}
+
+	d := json.NewDecoder(w.Body)
+	d.UseNumber()
+
+	if err := d.Decode(&info); err != nil {
+		t.Fatal(err)
+	}
+
+	assert.Len(t, info["signers"], 1)
+
+	// test synchronous failure
+	r, err = newMultipleFilesUploadRequest(
+		baseURL+"/sign?wait=30s",
+		map[string]string{"signer": "simple"},
+		[]filePart{{"testfile1", "../testfiles/malformed.pdf"}})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	w = httptest.NewRecorder()
+	wa.r.ServeHTTP(w, r)
+	assert.Equal(t, http.StatusUnprocessableEntity, w.Code, w.Body.String())
+
+	// test wrong wait
+	r, err = newMultipleFilesUploadRequest(
+		baseURL+"/sign?wait=forever",
+		map[string]string{"signer": "simple"},
+		[]filePart{{"testfile1", "../testfiles/testfile12.pdf"}})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	w = httptest.NewRecorder()
+	wa.r.ServeHTTP(w, r)
+	assert.Equal(t, http.StatusBadRequest, w.Code, w.Body.String())
+}
+
 // Creates a new multiple files upload http request with optional extra params.
 func newMultipleFilesUploadRequest(uri string, params map[string]string, fileParts []filePart) (*http.Request, error) {
 	body := &bytes.Buffer{}
@@ -298,3 +451,677 @@ func newMultipleFilesUploadRequest(uri string, params map[string]string, filePar
 
 	return req, err
 }
+
+func TestQueueStats(t *testing.T) {
+	// get stats of the signer
+	r := httptest.NewRequest("GET", baseURL+"/queue/simple/stats", nil)
+	w := httptest.NewRecorder()
+	wa.r.ServeHTTP(w, r)
+	assert.Equal(t, http.StatusOK, w.Code)
+
+	var stats queue.UnitStats
+	assert.NoError(t, json.NewDecoder(w.Body).Decode(&stats))
+	assert.Equal(t, "simple", stats.Name)
+	assert.Equal(t, 2, stats.Workers)
+	assert.False(t, stats.Since.IsZero())
+
+	// get stats of the verifier
+	r = httptest.NewRequest("GET", baseURL+"/queue/verify/stats", nil)
+	w = httptest.NewRecorder()
+	wa.r.ServeHTTP(w, r)
+	assert.Equal(t, http.StatusOK, w.Code)
+
+	// get stats of not existing unit
+	r = httptest.NewRequest("GET", baseURL+"/queue/notexisting/stats", nil)
+	w = httptest.NewRecorder()
+	wa.r.ServeHTTP(w, r)
+	assert.Equal(t, http.StatusNotFound, w.Code)
+}
+
+func TestDeadLetter(t *testing.T) {
+	request := func(method, uri, key string) *httptest.ResponseRecorder {
+		r := httptest.NewRequest(method, baseURL+uri, nil)
+		if key != "" {
+			r.Header.Set(apiKeyHeader, key)
+		}
+
+		w := httptest.NewRecorder()
+		wa.r.ServeHTTP(w, r)
+
+		return w
+	}
+
+	// the client should be identified
+	assert.Equal(t, http.StatusUnauthorized, request("GET", "/deadletter", "").Code)
+	assert.Equal(t, http.StatusUnauthorized, request("POST", "/deadletter/notexisting/notexisting/requeue", "").Code)
+
+	wa.SetAPIClients([]APIClient{{Name: "archive", Key: "archive-key"}, {Name: defaultAPIClientName}})
+	defer wa.SetAPIClients(nil)
+
+	// list dead lettered tasks
+	w := request("GET", "/deadletter?unit=simple", "archive-key")
+	assert.Equal(t, http.StatusOK, w.Code)
+	assert.JSONEq(t, `{"tasks":[]}`, w.Body.String())
+
+	// requeue not existing task
+	assert.Equal(t, http.StatusBadRequest, request("POST", "/deadletter/notexisting/notexisting/requeue", "archive-key").Code)
+
+	// the tasks of other clients are not requeued
+	r, err := newMultipleFilesUploadRequest(baseURL+"/verify", nil, []filePart{{"testfile1", "../testfiles/testfile12.pdf"}})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	r.Header.Set(apiKeyHeader, "archive-key")
+
+	w = httptest.NewRecorder()
+	wa.r.ServeHTTP(w, r)
+	assert.Equal(t, http.StatusCreated, w.Code, w.Body.String())
+
+	var scheduleResponse hanldeScheduleResponse
+	assert.NoError(t, json.NewDecoder(w.Body).Decode(&scheduleResponse))
+
+	j, err := wa.queue.GetJobByID(scheduleResponse.JobID)
+	assert.NoError(t, err)
+
+	for taskID := range j.TasksMap {
+		w = request("POST", "/deadletter/"+scheduleResponse.JobID+"/"+taskID+"/requeue", "")
+		assert.Equal(t, http.StatusBadRequest, w.Code)
+		assert.Contains(t, w.Body.String(), "task is not found")
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 30*time.Second)
+	defer cancel()
+
+	_, err = wa.queue.WaitForJob(ctx, scheduleResponse.JobID)
+	assert.NoError(t, err)
+	assert.NoError(t, wa.queue.DeleteJob(scheduleResponse.JobID))
+}
+
+func TestQueueCapacity(t *testing.T) {
+	// the job with more files than the capacity is never accepted
+	assert.NoError(t, q.SetCapacity(1))
+
+	defer func() { _ = q.SetCapacity(0) }()
+
+	r, err := newMultipleFilesUploadRequest(
+		baseURL+"/sign",
+		map[string]string{"signer": "simple"},
+		[]filePart{{"testfile1", "../testfiles/testfile12.pdf"}, {"testfile2", "../testfiles/testfile12.pdf"}})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	w := httptest.NewRecorder()
+	wa.r.ServeHTTP(w, r)
+	assert.Equal(t, http.StatusTooManyRequests, w.Code, w.Body.String())
+
+	retryAfter, err := strconv.Atoi(w.Header().Get("Retry-After"))
+	assert.NoError(t, err)
+	assert.GreaterOrEqual(t, retryAfter, 1)
+}
+
+func TestSignerUnits(t *testing.T) {
+	// the signer is processed by the unit of the service with its own capacity
+	q.AddSignUnit("service:simple", signer.SignData{})
+	assert.NoError(t, q.SetUnitCapacity("service:simple", 1))
+
+	wa.SetSignerUnits(map[string]string{"simple": "service:simple"})
+
+	defer wa.SetSignerUnits(nil)
+
+	r, err := newMultipleFilesUploadRequest(
+		baseURL+"/sign",
+		map[string]string{"signer": "simple"},
+		[]filePart{{"testfile1", "../testfiles/testfile12.pdf"}, {"testfile2", "../testfiles/testfile12.pdf"}})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	w := httptest.NewRecorder()
+	wa.r.ServeHTTP(w, r)
+	assert.Equal(t, http.StatusTooManyRequests, w.Code, w.Body.String())
+
+	// the queue of the signer is the queue of the unit of the service
+	r = httptest.NewRequest(http.MethodGet, baseURL+"/queue/simple", nil)
+	w = httptest.NewRecorder()
+	wa.r.ServeHTTP(w, r)
+	assert.Equal(t, http.StatusOK, w.Code, w.Body.String())
+}
+
+func TestPriorityAndDeadline(t *testing.T) {
+	// limit the priority of the batch client
+	wa.SetAPIClients([]APIClient{{Name: "batch", Key: "batch-key", MaxPriority: priority_queue.LowPriority}})
+
+	defer wa.SetAPIClients(nil)
+
+	tests := []struct {
+		key      string
+		priority string
+		expected string
+	}{
+		{key: "", priority: "low", expected: "low"},
+		{key: "", priority: "", expected: "high"},
+		{key: "batch-key", priority: "high", expected: "low"},
+	}
+
+	for _, tt := range tests {
+		params := map[string]string{"signer": "simple", "deadline": "1h"}
+		if tt.priority != "" {
+			params["priority"] = tt.priority
+		}
+
+		r, err := newMultipleFilesUploadRequest(baseURL+"/sign", params, []filePart{{"testfile1", "../testfiles/testfile12.pdf"}})
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		r.Header.Set(apiKeyHeader, tt.key)
+
+		w := httptest.NewRecorder()
+		wa.r.ServeHTTP(w, r)
+		assert.Equal(t, http.StatusCreated, w.Code, w.Body.String())
+
+		var scheduleResponse hanldeScheduleResponse
+		assert.NoError(t, json.NewDecoder(w.Body).Decode(&scheduleResponse))
+
+		// check the priority and the deadline of the job
+		r = httptest.NewRequest(http.MethodGet, baseURL+"/sign/"+scheduleResponse.JobID, nil)
+		w = httptest.NewRecorder()
+		wa.r.ServeHTTP(w, r)
+		assert.Equal(t, http.StatusOK, w.Code, w.Body.String())
+
+		var res jobStatusResponse
+		assert.NoError(t, json.NewDecoder(w.Body).Decode(&res))
+		assert.NotNil(t, res.Job.Deadline)
+		assert.False(t, res.Job.DeadlineMissed)
+		assert.Len(t, res.Tasks, 1)
+		assert.Equal(t, tt.expected, res.Tasks[0].Priority)
+	}
+
+	// reject wrong priority and deadline
+	for _, params := range []map[string]string{
+		{"signer": "simple", "priority": "urgent"},
+		{"signer": "simple", "deadline": "yesterday"},
+		{"signer": "simple", "deadline": "2000-01-01T00:00:00Z"},
+	} {
+		r, err := newMultipleFilesUploadRequest(baseURL+"/sign", params, []filePart{{"testfile1", "../testfiles/testfile12.pdf"}})
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		w := httptest.NewRecorder()
+		wa.r.ServeHTTP(w, r)
+		assert.Equal(t, http.StatusBadRequest, w.Code, w.Body.String())
+	}
+}
+
+func TestCancelAndDelete(t *testing.T) {
+	// verify file synchronously
+	r, err := newMultipleFilesUploadRequest(
+		baseURL+"/verify?wait=30s",
+		map[string]string{},
+		[]filePart{{"testfile1", "../testfiles/SampleSignedPDFDocument.pdf"}, {"testfile2", "../testfiles/SampleSignedPDFDocument.pdf"}})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	w := httptest.NewRecorder()
+	wa.r.ServeHTTP(w, r)
+	assert.Equal(t, http.StatusOK, w.Code, w.Body.String())
+
+	var res jobStatusResponse
+	assert.NoError(t, json.NewDecoder(w.Body).Decode(&res))
+	assert.Len(t, res.Tasks, 2)
+
+	jobID := res.Job.ID
+
+	// processed task couldn't be cancelled
+	r = httptest.NewRequest(http.MethodDelete, baseURL+"/verify/"+jobID+"/"+res.Tasks[0].ID, nil)
+	w = httptest.NewRecorder()
+	wa.r.ServeHTTP(w, r)
+	assert.Equal(t, http.StatusBadRequest, w.Code, w.Body.String())
+
+	// cancel job keeps processed tasks
+	r = httptest.NewRequest(http.MethodPost, baseURL+"/verify/"+jobID+"/cancel", nil)
+	w = httptest.NewRecorder()
+	wa.r.ServeHTTP(w, r)
+	assert.Equal(t, http.StatusOK, w.Code, w.Body.String())
+
+	var status jobStatusResponse
+	assert.NoError(t, json.NewDecoder(w.Body).Decode(&status))
+
+	for _, task := range status.Tasks {
+		assert.Equal(t, queue.StatusCompleted, task.Status)
+	}
+
+	// delete job
+	r = httptest.NewRequest(http.MethodDelete, baseURL+"/verify/"+jobID, nil)
+	w = httptest.NewRecorder()
+	wa.r.ServeHTTP(w, r)
+	assert.Equal(t, http.StatusOK, w.Code, w.Body.String())
+
+	r = httptest.NewRequest(http.MethodGet, baseURL+"/verify/"+jobID, nil)
+	w = httptest.NewRecorder()
+	wa.r.ServeHTTP(w, r)
+	assert.Equal(t, http.StatusBadRequest, w.Code, w.Body.String())
+
+	// cancel not existing job
+	r = httptest.NewRequest(http.MethodPost, baseURL+"/sign/notexisting/cancel", nil)
+	w = httptest.NewRecorder()
+	wa.r.ServeHTTP(w, r)
+	assert.Equal(t, http.StatusBadRequest, w.Code, w.Body.String())
+}
+
+func TestWebhookFields(t *testing.T) {
+	// default webhooks are notified before the provided ones
+	wa.SetWebhooks([]string{"http://localhost:8080/default"})
+
+	defer wa.SetWebhooks(nil)
+
+	params := map[string]string{"signer": "simple", "callback_url": "https://example.com/hook"}
+
+	r, err := newMultipleFilesUploadRequest(baseURL+"/sign", params, []filePart{{"testfile1", "../testfiles/testfile12.pdf"}})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	w := httptest.NewRecorder()
+	wa.r.ServeHTTP(w, r)
+	assert.Equal(t, http.StatusCreated, w.Code, w.Body.String())
+
+	var scheduleResponse hanldeScheduleResponse
+	assert.NoError(t, json.NewDecoder(w.Body).Decode(&scheduleResponse))
+
+	job, err := wa.queue.GetJobByID(scheduleResponse.JobID)
+	assert.NoError(t, err)
+	assert.Equal(t, []string{"http://localhost:8080/default", "https://example.com/hook"}, job.Webhooks)
+
+	// reject wrong callback url
+	params["callback_url"] = "ftp://example.com/hook"
+
+	r, err = newMultipleFilesUploadRequest(baseURL+"/sign", params, []filePart{{"testfile1", "../testfiles/testfile12.pdf"}})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	w = httptest.NewRecorder()
+	wa.r.ServeHTTP(w, r)
+	assert.Equal(t, http.StatusBadRequest, w.Code, w.Body.String())
+}
+
+func TestJobEvents(t *testing.T) {
+	r, err := newMultipleFilesUploadRequest(baseURL+"/sign", map[string]string{"signer": "simple"}, []filePart{
+		{"testfile1", "../testfiles/testfile12.pdf"},
+		{"testfile2", "../testfiles/testfile12.pdf"},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	w := httptest.NewRecorder()
+	wa.r.ServeHTTP(w, r)
+	assert.Equal(t, http.StatusCreated, w.Code, w.Body.String())
+
+	var scheduleResponse hanldeScheduleResponse
+	assert.NoError(t, json.NewDecoder(w.Body).Decode(&scheduleResponse))
+
+	// stream the events until the job is completed
+	r = httptest.NewRequest(http.MethodGet, baseURL+"/sign/"+scheduleResponse.JobID+"/events", nil)
+	w = httptest.NewRecorder()
+	wa.r.ServeHTTP(w, r)
+	assert.Equal(t, http.StatusOK, w.Code, w.Body.String())
+	assert.Equal(t, "text/event-stream", w.Header().Get("Content-Type"))
+
+	var (
+		types []string
+		last  jobEventResponse
+	)
+
+	for _, message := range strings.Split(strings.TrimSpace(w.Body.String()), "\n\n") {
+		lines := strings.SplitN(message, "\n", 2)
+		assert.Len(t, lines, 2)
+
+		types = append(types, strings.TrimPrefix(lines[0], "event: "))
+		assert.NoError(t, json.Unmarshal([]byte(strings.TrimPrefix(lines[1], "data: ")), &last))
+		assert.Equal(t, scheduleResponse.JobID, last.Job.ID)
+	}
+
+	assert.Equal(t, "job.status", types[0])
+	assert.Equal(t, "job.completed", types[len(types)-1])
+	assert.Equal(t, 2, last.Processed)
+	assert.Equal(t, 2, last.Total)
+	assert.Len(t, last.Tasks, 2)
+
+	// unknown job
+	r = httptest.NewRequest(http.MethodGet, baseURL+"/verify/notexisting/events", nil)
+	w = httptest.NewRecorder()
+	wa.r.ServeHTTP(w, r)
+	assert.Equal(t, http.StatusBadRequest, w.Code, w.Body.String())
+}
+
+func TestShutdown(t *testing.T) {
+	s := NewWebAPI("127.0.0.1:0", q, []string{"simple"}, version.Version{Version: "0.1"}, true)
+
+	served := make(chan struct{})
+
+	go func() {
+		s.Serve()
+		close(served)
+	}()
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	// serve returns when the server is shut down
+	assert.NoError(t, s.Shutdown(ctx))
+
+	select {
+	case <-served:
+	case <-ctx.Done():
+		t.Fatal("serve is not stopped")
+	}
+}
+
+func TestNotBefore(t *testing.T) {
+	r, err := newMultipleFilesUploadRequest(baseURL+"/sign", map[string]string{"signer": "simple", "not_before": "1h"}, []filePart{{"testfile1", "../testfiles/testfile12.pdf"}})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	w := httptest.NewRecorder()
+	wa.r.ServeHTTP(w, r)
+	assert.Equal(t, http.StatusCreated, w.Code, w.Body.String())
+
+	var scheduleResponse hanldeScheduleResponse
+	assert.NoError(t, json.NewDecoder(w.Body).Decode(&scheduleResponse))
+
+	// the task is scheduled
+	r = httptest.NewRequest(http.MethodGet, baseURL+"/sign/"+scheduleResponse.JobID, nil)
+	w = httptest.NewRecorder()
+	wa.r.ServeHTTP(w, r)
+	assert.Equal(t, http.StatusOK, w.Code, w.Body.String())
+
+	var res jobStatusResponse
+	assert.NoError(t, json.NewDecoder(w.Body).Decode(&res))
+
+	if assert.Len(t, res.Tasks, 1) {
+		assert.Equal(t, queue.StatusScheduled, res.Tasks[0].Status)
+		assert.NotNil(t, res.Tasks[0].NotBefore)
+	}
+
+	// the scheduled job could be deleted
+	r = httptest.NewRequest(http.MethodDelete, baseURL+"/sign/"+scheduleResponse.JobID, nil)
+	w = httptest.NewRecorder()
+	wa.r.ServeHTTP(w, r)
+	assert.Equal(t, http.StatusOK, w.Code, w.Body.String())
+
+	// reject wrong not before
+	for _, tt := range []struct {
+		uri    string
+		params map[string]string
+	}{
+		{"/sign", map[string]string{"signer": "simple", "not_before": "tomorrow"}},
+		{"/sign", map[string]string{"signer": "simple", "not_before": "2h", "deadline": "1h"}},
+		{"/verify", map[string]string{"not_before": "1h"}},
+	} {
+		r, err := newMultipleFilesUploadRequest(baseURL+tt.uri, tt.params, []filePart{{"testfile1", "../testfiles/testfile12.pdf"}})
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		w := httptest.NewRecorder()
+		wa.r.ServeHTTP(w, r)
+		assert.Equal(t, http.StatusBadRequest, w.Code, w.Body.String())
+	}
+}
+
+func TestPipelineJob(t *testing.T) {
+	r, err := newMultipleFilesUploadRequest(baseURL+"/sign", map[string]string{"pipeline": "countersign"}, []filePart{{"testfile1", "../testfiles/testfile12.pdf"}})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	w := httptest.NewRecorder()
+	wa.r.ServeHTTP(w, r)
+	assert.Equal(t, http.StatusCreated, w.Code, w.Body.String())
+
+	var scheduleResponse hanldeScheduleResponse
+	assert.NoError(t, json.NewDecoder(w.Body).Decode(&scheduleResponse))
+
+	ctx, cancel := context.WithTimeout(context.Background(), 30*time.Second)
+	defer cancel()
+
+	_, err = wa.queue.WaitForJob(ctx, scheduleResponse.JobID)
+	assert.NoError(t, err)
+
+	// the status contains the steps of the pipeline
+	r = httptest.NewRequest(http.MethodGet, baseURL+"/sign/"+scheduleResponse.JobID, nil)
+	w = httptest.NewRecorder()
+	wa.r.ServeHTTP(w, r)
+	assert.Equal(t, http.StatusOK, w.Code, w.Body.String())
+
+	var res jobStatusResponse
+	assert.NoError(t, json.NewDecoder(w.Body).Decode(&res))
+	assert.Equal(t, "countersign", res.Job.Pipeline)
+
+	if assert.Len(t, res.Tasks, 1) {
+		assert.Equal(t, queue.StatusCompleted, res.Tasks[0].Status, res.Tasks[0].Error)
+
+		if assert.Len(t, res.Tasks[0].Steps, 3) {
+			assert.Equal(t, queue.StepSign, res.Tasks[0].Steps[0].Type)
+			assert.Equal(t, queue.StepVerify, res.Tasks[0].Steps[2].Type)
+
+			for _, s := range res.Tasks[0].Steps {
+				assert.Equal(t, queue.StatusCompleted, s.Status, s.Error)
+				assert.NotNil(t, s.FinishedAt)
+			}
+		}
+
+		// the result of the pipeline is downloaded
+		r = httptest.NewRequest(http.MethodGet, baseURL+"/sign/"+scheduleResponse.JobID+"/"+res.Tasks[0].ID+"/download", nil)
+		w = httptest.NewRecorder()
+		wa.r.ServeHTTP(w, r)
+		assert.Equal(t, http.StatusOK, w.Code, w.Body.String())
+		assert.True(t, bytes.HasPrefix(w.Body.Bytes(), []byte("%PDF")))
+	}
+
+	assert.NoError(t, wa.queue.DeleteJob(scheduleResponse.JobID))
+
+	// reject wrong pipeline
+	for _, tt := range []struct {
+		uri    string
+		params map[string]string
+	}{
+		{"/sign", map[string]string{"pipeline": "unknown"}},
+		{"/sign", map[string]string{"pipeline": "countersign", "signer": "simple"}},
+		{"/verify", map[string]string{"pipeline": "countersign"}},
+	} {
+		r, err := newMultipleFilesUploadRequest(baseURL+tt.uri, tt.params, []filePart{{"testfile1", "../testfiles/testfile12.pdf"}})
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		w := httptest.NewRecorder()
+		wa.r.ServeHTTP(w, r)
+		assert.Equal(t, http.StatusBadRequest, w.Code, w.Body.String())
+	}
+}
+
+func TestIdempotencyKey(t *testing.T) {
+	schedule := func(uri, key string) *httptest.ResponseRecorder {
+		r, err := newMultipleFilesUploadRequest(baseURL+uri, map[string]string{"signer": "simple"}, []filePart{{"testfile1", "../testfiles/testfile12.pdf"}})
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		r.Header.Set(idempotencyKeyHeader, key)
+
+		w := httptest.NewRecorder()
+		wa.r.ServeHTTP(w, r)
+
+		return w
+	}
+
+	jobID := func(w *httptest.ResponseRecorder) string {
+		var res hanldeScheduleResponse
+		assert.NoError(t, json.NewDecoder(w.Body).Decode(&res))
+
+		return res.JobID
+	}
+
+	w := schedule("/sign", "invoice-42")
+	assert.Equal(t, http.StatusCreated, w.Code, w.Body.String())
+	assert.Empty(t, w.Header().Get(idempotentReplayedHeader))
+
+	first := jobID(w)
+
+	// the retry gets the same job
+	w = schedule("/sign", "invoice-42")
+	assert.Equal(t, http.StatusOK, w.Code, w.Body.String())
+	assert.Equal(t, "true", w.Header().Get(idempotentReplayedHeader))
+	assert.Equal(t, "/sign/"+first, w.Header().Get("Location"))
+	assert.Equal(t, first, jobID(w))
+
+	// the keys of the verification are separate
+	w = schedule("/verify", "invoice-42")
+	assert.Equal(t, http.StatusCreated, w.Code, w.Body.String())
+
+	verifyJobID := jobID(w)
+	assert.NotEqual(t, first, verifyJobID)
+
+	// the key of the request being handled couldn't be used
+	assert.True(t, wa.acquireIdempotencyKey("sign::invoice-43"))
+	w = schedule("/sign", "invoice-43")
+	assert.Equal(t, http.StatusConflict, w.Code, w.Body.String())
+	wa.releaseIdempotencyKey("sign::invoice-43")
+
+	// the key could be used again when the job is deleted
+	assert.NoError(t, wa.queue.DeleteJob(first))
+
+	w = schedule("/sign", "invoice-42")
+	assert.Equal(t, http.StatusCreated, w.Code, w.Body.String())
+
+	second := jobID(w)
+	assert.NotEqual(t, first, second)
+
+	// reject too long key
+	w = schedule("/sign", strings.Repeat("k", maxIdempotencyKeyLength+1))
+	assert.Equal(t, http.StatusBadRequest, w.Code, w.Body.String())
+
+	ctx, cancel := context.WithTimeout(context.Background(), 30*time.Second)
+	defer cancel()
+
+	for _, id := range []string{second, verifyJobID} {
+		_, err := wa.queue.WaitForJob(ctx, id)
+		assert.NoError(t, err)
+		assert.NoError(t, wa.queue.DeleteJob(id))
+	}
+}
+
+func TestListJobs(t *testing.T) {
+	wa.SetAPIClients([]APIClient{{Name: "archive", Key: "archive-key"}})
+	defer wa.SetAPIClients(nil)
+
+	var jobIDs []string
+
+	for _, uri := range []string{"/sign", "/verify"} {
+		r, err := newMultipleFilesUploadRequest(baseURL+uri, map[string]string{"signer": "simple"}, []filePart{{"testfile1", "../testfiles/testfile12.pdf"}})
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		r.Header.Set(apiKeyHeader, "archive-key")
+
+		w := httptest.NewRecorder()
+		wa.r.ServeHTTP(w, r)
+		assert.Equal(t, http.StatusCreated, w.Code, w.Body.String())
+
+		var scheduleResponse hanldeScheduleResponse
+		assert.NoError(t, json.NewDecoder(w.Body).Decode(&scheduleResponse))
+
+		jobIDs = append(jobIDs, scheduleResponse.JobID)
+	}
+
+	request := func(key, query string) *httptest.ResponseRecorder {
+		r := httptest.NewRequest(http.MethodGet, baseURL+"/jobs?"+query, nil)
+		if key != "" {
+			r.Header.Set(apiKeyHeader, key)
+		}
+
+		w := httptest.NewRecorder()
+		wa.r.ServeHTTP(w, r)
+
+		return w
+	}
+
+	list := func(query string) jobsResponse {
+		w := request("archive-key", query)
+		assert.Equal(t, http.StatusOK, w.Code, w.Body.String())
+
+		var res jobsResponse
+		assert.NoError(t, json.NewDecoder(w.Body).Decode(&res))
+
+		return res
+	}
+
+	// the jobs of the client are listed from the newest
+	res := list("")
+	if assert.Len(t, res.Jobs, 2) {
+		assert.Equal(t, jobIDs[1], res.Jobs[0].ID)
+		assert.Equal(t, "verify", res.Jobs[0].Type)
+		assert.Equal(t, "archive", res.Jobs[0].Client)
+		assert.Equal(t, []string{"testfile12.pdf"}, res.Jobs[0].FileNames)
+	}
+
+	// filter by the unit
+	res = list("unit=simple&file_name=TESTFILE12.pdf")
+	if assert.Len(t, res.Jobs, 1) {
+		assert.Equal(t, jobIDs[0], res.Jobs[0].ID)
+	}
+
+	res = list("type=verify&created_after=-1h")
+	if assert.Len(t, res.Jobs, 1) {
+		assert.Equal(t, jobIDs[1], res.Jobs[0].ID)
+	}
+
+	// paginate
+	res = list("limit=1")
+	assert.Len(t, res.Jobs, 1)
+	assert.NotEmpty(t, res.NextCursor)
+
+	res = list("limit=1&cursor=" + res.NextCursor)
+	if assert.Len(t, res.Jobs, 1) {
+		assert.Equal(t, jobIDs[0], res.Jobs[0].ID)
+	}
+
+	assert.Empty(t, res.NextCursor)
+
+	// reject wrong filter
+	for _, query := range []string{"limit=0", "type=print", "status=Unknown", "cursor=wrong", "created_after=yesterday"} {
+		assert.Equal(t, http.StatusBadRequest, request("archive-key", query).Code, query)
+	}
+
+	// the client should be identified
+	for _, key := range []string{"", "unknown"} {
+		assert.Equal(t, http.StatusUnauthorized, request(key, "").Code, key)
+	}
+
+	// the default client lists only it's own jobs
+	wa.SetAPIClients([]APIClient{{Name: "archive", Key: "archive-key"}, {Name: defaultAPIClientName}})
+
+	res = jobsResponse{}
+	w := request("", "")
+	assert.Equal(t, http.StatusOK, w.Code, w.Body.String())
+	assert.NoError(t, json.NewDecoder(w.Body).Decode(&res))
+	assert.Empty(t, res.Jobs)
+
+	ctx, cancel := context.WithTimeout(context.Background(), 30*time.Second)
+	defer cancel()
+
+	for _, id := range jobIDs {
+		_, err := wa.queue.WaitForJob(ctx, id)
+		assert.NoError(t, err)
+		assert.NoError(t, wa.queue.DeleteJob(id))
+	}
+}
@@ -0,0 +1,109 @@
+package webapi
+
+import (
+	"context"
+	"net/http"
+	"time"
+
+	"github.com/digitorus/pdfsigner/queues/queue"
+	"github.com/pkg/errors"
+)
+
+// maxSyncWait represents maximum wait duration of the synchronous mode.
+const maxSyncWait = 2 * time.Minute
+
+// syncWriteTimeout represents the time to write the response after the wait is over.
+const syncWriteTimeout = 10 * time.Second
+
+// parseWait parses wait duration of the synchronous mode, returns 0 if not provided.
+func parseWait(r *http.Request) (time.Duration, error) {
+	waitStr := r.URL.Query().Get("wait")
+	if waitStr == "" {
+		return 0, nil
+	}
+
+	wait, err := time.ParseDuration(waitStr)
+	if err != nil {
+		return 0, errors.Wrap(err, "parse wait")
+	}
+
+	if wait < 0 {
+		return 0, errors.New("wait should be positive")
+	}
+
+	if wait > maxSyncWait {
+		return 0, errors.Errorf("wait should not exceed %s", maxSyncWait)
+	}
+
+	return wait, nil
+}
+
+// respondSync waits for the job to be processed and responds with the result,
+// if the deadline passes responds with the job id to continue asynchronously.
+func (wa *WebAPI) respondSync(jobType, jobID string, wait time.Duration, w http.ResponseWriter, r *http.Request) error {
+	// extend write deadline of the server to wait for the result
+	_ = http.NewResponseController(w).SetWriteDeadline(time.Now().Add(wait + syncWriteTimeout))
+
+	ctx, cancel := context.WithTimeout(r.Context(), wait)
+	defer cancel()
+
+	j, err := wa.queue.WaitForJob(ctx, jobID)
+	if err != nil {
+		if errors.Is(err, context.DeadlineExceeded) {
+			// fallback to asynchronous mode
+			w.Header().Set("Location", "/"+jobType+"/"+jobID)
+
+			return respondJSON(w, hanldeScheduleResponse{jobID}, http.StatusAccepted)
+		}
+
+		return httpError(w, err, http.StatusInternalServerError)
+	}
+
+	tasks, err := j.GetTasks("")
+	if err != nil {
+		return httpError(w, err, http.StatusInternalServerError)
+	}
+
+	// respond with the signed file or verification information if the job contains single task
+	if len(tasks) == 1 {
+		t := tasks[0]
+		if t.Status == queue.StatusCancelled {
+			w.Header().Set("Location", "/"+jobType+"/"+jobID)
+
+			return httpError(w, errors.New("task is cancelled"), http.StatusConflict)
+		}
+
+		if t.Status == queue.StatusFailed || t.Status == queue.StatusDeadLetter {
+			w.Header().Set("Location", "/"+jobType+"/"+jobID)
+
+			return httpError(w, errors.New(t.Error), http.StatusUnprocessableEntity)
+		}
+
+		if jobType == "sign" {
+			return wa.respondSignedFile(w, t)
+		}
+
+		return respondVerificationInfo(w, r, t)
+	}
+
+	// respond with status of the tasks
+	w.Header().Set("Location", "/"+jobType+"/"+jobID)
+
+	if jobType == "sign" {
+		return respondJSON(w, newJobStatusResponse(j, tasks), http.StatusOK)
+	}
+
+	res := syncVerifyResponse{Job: newJob(j)}
+
+	for _, t := range tasks {
+		vt := verifyTask{task: newTask(t)}
+		if t.Status == queue.StatusCompleted {
+			info := newVerifyGetInfoResponse(t)
+			vt.Info = &info
+		}
+
+		res.Tasks = append(res.Tasks, vt)
+	}
+
+	return respondJSON(w, res, http.StatusOK)
+}
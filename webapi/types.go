@@ -1,5 +1,14 @@
 package webapi
 
+import (
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/digitorus/pdfsigner/queues/priority_queue"
+	"github.com/digitorus/pdfsigner/queues/queue"
+)
+
 // hanldeScheduleResponse represents response for handleSignSchedule.
 type hanldeScheduleResponse struct {
 	JobID string `json:"job_id"`
@@ -13,13 +22,201 @@ type jobStatusResponse struct {
 
 // job is a part of jobStatusResponse.
 type job struct {
-	ID string `json:"id"`
+	ID             string     `json:"id"`
+	Pipeline       string     `json:"pipeline,omitempty"`
+	Deadline       *time.Time `json:"deadline,omitempty"`
+	DeadlineMissed bool       `json:"deadline_missed,omitempty"`
+}
+
+// newJob creates job of the response.
+func newJob(j queue.Job) job {
+	res := job{ID: j.ID, Pipeline: j.Pipeline}
+
+	for _, t := range j.TasksMap {
+		if !t.Deadline.IsZero() {
+			deadline := t.Deadline
+			res.Deadline = &deadline
+		}
+
+		if t.MissedDeadline() {
+			res.DeadlineMissed = true
+		}
+	}
+
+	return res
 }
 
 // task is a part of jobStatusResponse.
 type task struct {
-	ID               string `json:"id"`
-	OriginalFileName string `json:"file_name"`
-	Status           string `json:"status"`
-	Error            string `json:"error,omitempty"`
+	ID               string          `json:"id"`
+	OriginalFileName string          `json:"file_name"`
+	Status           string          `json:"status"`
+	Priority         string          `json:"priority,omitempty"`
+	DeadlineMissed   bool            `json:"deadline_missed,omitempty"`
+	NotBefore        *time.Time      `json:"not_before,omitempty"`
+	DuplicateOf      string          `json:"duplicate_of,omitempty"`
+	Error            string          `json:"error,omitempty"`
+	Attempts         []queue.Attempt `json:"attempts,omitempty"`
+	Steps            []step          `json:"steps,omitempty"`
+
+	QueuedAt               *time.Time `json:"queued_at,omitempty"`
+	StartedAt              *time.Time `json:"started_at,omitempty"`
+	FinishedAt             *time.Time `json:"finished_at,omitempty"`
+	DurationSeconds        float64    `json:"duration_seconds,omitempty"`
+	InputSHA256            string     `json:"input_sha256,omitempty"`
+	OutputSHA256           string     `json:"output_sha256,omitempty"`
+	OutputSize             int64      `json:"output_size,omitempty"`
+	CertificateFingerprint string     `json:"certificate_fingerprint,omitempty"`
+	SigningTime            *time.Time `json:"signing_time,omitempty"`
+	TimestampTime          *time.Time `json:"timestamp_time,omitempty"`
+}
+
+// step is a part of task processed by the pipeline.
+type step struct {
+	Type       string     `json:"type"`
+	Unit       string     `json:"unit"`
+	Status     string     `json:"status"`
+	StartedAt  *time.Time `json:"started_at,omitempty"`
+	FinishedAt *time.Time `json:"finished_at,omitempty"`
+	Error      string     `json:"error,omitempty"`
+}
+
+// newTask creates task of the response.
+func newTask(t queue.Task) task {
+	res := task{
+		ID:               t.ID,
+		Status:           t.Status,
+		Priority:         priorityName(t.Priority),
+		DeadlineMissed:   t.MissedDeadline(),
+		OriginalFileName: t.OriginalFileName,
+		DuplicateOf:      t.DuplicateOf,
+		Error:            t.Error,
+		Attempts:         t.Attempts,
+
+		QueuedAt:               optionalTime(t.QueuedAt),
+		StartedAt:              optionalTime(t.StartedAt),
+		FinishedAt:             optionalTime(t.FinishedAt),
+		DurationSeconds:        t.Duration.Seconds(),
+		InputSHA256:            t.InputSHA256,
+		OutputSHA256:           t.OutputSHA256,
+		OutputSize:             t.OutputSize,
+		CertificateFingerprint: t.CertificateFingerprint,
+		SigningTime:            optionalTime(t.SigningTime),
+		TimestampTime:          optionalTime(t.TimestampTime),
+	}
+
+	if !t.NotBefore.IsZero() {
+		notBefore := t.NotBefore
+		res.NotBefore = &notBefore
+	}
+
+	for _, s := range t.Steps {
+		res.Steps = append(res.Steps, newStep(s))
+	}
+
+	return res
+}
+
+// optionalTime returns the time omitted from the response if it's zero.
+func optionalTime(t time.Time) *time.Time {
+	if t.IsZero() {
+		return nil
+	}
+
+	return &t
+}
+
+// newStep creates step of the task of the response.
+func newStep(s queue.StepResult) step {
+	res := step{Type: s.Type, Unit: s.UnitName, Status: s.Status, Error: s.Error}
+
+	if !s.StartedAt.IsZero() {
+		startedAt := s.StartedAt
+		res.StartedAt = &startedAt
+	}
+
+	if !s.FinishedAt.IsZero() {
+		finishedAt := s.FinishedAt
+		res.FinishedAt = &finishedAt
+	}
+
+	return res
+}
+
+// priorityName returns the name of the priority as it's provided in the requests.
+func priorityName(p priority_queue.Priority) string {
+	if p == priority_queue.UnknownPriority {
+		return ""
+	}
+
+	return strings.ToLower(strings.TrimSuffix(p.String(), "Priority"))
+}
+
+// syncVerifyResponse represents response of the synchronous verification of multiple files.
+type syncVerifyResponse struct {
+	Job   job          `json:"job"`
+	Tasks []verifyTask `json:"tasks"`
+}
+
+// verifyTask is a part of syncVerifyResponse.
+type verifyTask struct {
+	task
+	Info *handleVerifyGetInfoResponse `json:"info,omitempty"`
+}
+
+// deadLetterResponse represents response of the dead lettered tasks.
+type deadLetterResponse struct {
+	Tasks []deadLetterTask `json:"tasks"`
+}
+
+// deadLetterTask is a part of deadLetterResponse.
+type deadLetterTask struct {
+	JobID string `json:"job_id"`
+	Unit  string `json:"unit"`
+	task
+}
+
+// jobsResponse represents response of the jobs list.
+type jobsResponse struct {
+	Jobs       []jobSummary `json:"jobs"`
+	NextCursor string       `json:"next_cursor,omitempty"`
+}
+
+// jobSummary is a part of jobsResponse.
+type jobSummary struct {
+	ID          string         `json:"id"`
+	Type        string         `json:"type"`
+	Pipeline    string         `json:"pipeline,omitempty"`
+	Client      string         `json:"client,omitempty"`
+	CreatedAt   time.Time      `json:"created_at"`
+	CompletedAt *time.Time     `json:"completed_at,omitempty"`
+	Tasks       map[string]int `json:"tasks"`
+	FileNames   []string       `json:"file_names"`
+}
+
+// newJobSummary creates job of the jobs list with the number of the tasks by status.
+func newJobSummary(j queue.Job) jobSummary {
+	res := jobSummary{
+		ID:        j.ID,
+		Type:      j.JobType(),
+		Pipeline:  j.Pipeline,
+		Client:    j.Client,
+		CreatedAt: j.CreatedAt,
+		Tasks:     map[string]int{},
+		FileNames: []string{},
+	}
+
+	if !j.CompletedAt.IsZero() {
+		completedAt := j.CompletedAt
+		res.CompletedAt = &completedAt
+	}
+
+	for _, t := range j.TasksMap {
+		res.Tasks[t.Status]++
+		res.FileNames = append(res.FileNames, t.OriginalFileName)
+	}
+
+	sort.Strings(res.FileNames)
+
+	return res
 }
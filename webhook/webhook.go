@@ -0,0 +1,470 @@
+// Package webhook notifies the clients about the processed jobs by posting signed JSON payloads to their urls.
+package webhook
+
+import (
+	"bytes"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"math"
+	"net"
+	"net/http"
+	"net/url"
+	"strings"
+	"sync"
+	"syscall"
+	"time"
+
+	"github.com/digitorus/pdfsigner/db"
+	"github.com/digitorus/pdfsigner/queues/queue"
+	"github.com/google/uuid"
+	"github.com/pkg/errors"
+	log "github.com/sirupsen/logrus"
+)
+
+const (
+	// EventTaskCompleted is sent when the task is processed or cancelled.
+	EventTaskCompleted = "task.completed"
+	// EventJobCompleted is sent when all the tasks of the job are processed or cancelled.
+	EventJobCompleted = "job.completed"
+
+	// SignatureHeader contains HMAC-SHA256 of the body, Ex. sha256=hex.
+	SignatureHeader = "X-PDFSigner-Signature"
+	// EventHeader contains the event of the payload.
+	EventHeader = "X-PDFSigner-Event"
+	// DeliveryHeader contains the id of the delivery, the same for all the attempts.
+	DeliveryHeader = "X-PDFSigner-Delivery"
+)
+
+// dbDeliveryPrefix represents the prefix of the pending deliveries in the db.
+const dbDeliveryPrefix = "webhook_"
+
+// Config represents delivery settings of the webhooks.
+type Config struct {
+	// Secret represents the key of HMAC signature of the payloads, the payloads are not signed if it's empty
+	Secret string
+	// MaxAttempts represents maximum number of the delivery attempts
+	MaxAttempts int
+	// Backoff represents delay before the first retry, the delay is doubled after every attempt
+	Backoff time.Duration
+	// MaxBackoff represents maximum delay between the attempts
+	MaxBackoff time.Duration
+	// Timeout represents timeout of the single attempt
+	Timeout time.Duration
+	// AllowedNetworks represents CIDR ranges of the private networks the webhooks could be delivered to,
+	// Ex. 10.0.0.0/8, the loopback, private, link-local and other not public addresses are rejected by default
+	AllowedNetworks []string
+	// ClaimCompletion checks if the completion of the job should be notified, so the nodes sharing the store
+	// notify the completion once, every completion is notified if it's nil
+	ClaimCompletion func(jobID string) (bool, error)
+}
+
+// DefaultConfig represents the settings used if they're not provided.
+var DefaultConfig = Config{
+	MaxAttempts: 5,
+	Backoff:     10 * time.Second,
+	MaxBackoff:  10 * time.Minute,
+	Timeout:     10 * time.Second,
+}
+
+// Payload represents the body of the webhook request.
+type Payload struct {
+	Event     string    `json:"event"`
+	Timestamp time.Time `json:"timestamp"`
+	Job       Job       `json:"job"`
+	Tasks     []Task    `json:"tasks"`
+}
+
+// Job is a part of the payload.
+type Job struct {
+	ID        string `json:"id"`
+	Completed bool   `json:"completed"`
+}
+
+// Task is a part of the payload.
+type Task struct {
+	ID               string `json:"id"`
+	OriginalFileName string `json:"file_name"`
+	Status           string `json:"status"`
+	Error            string `json:"error,omitempty"`
+}
+
+// delivery represents the payload delivered to the url, persisted until it's delivered or all the attempts failed.
+type delivery struct {
+	ID            string    `json:"id"`
+	URL           string    `json:"url"`
+	Event         string    `json:"event"`
+	Body          []byte    `json:"body"`
+	Signature     string    `json:"signature,omitempty"`
+	Attempts      int       `json:"attempts"`
+	NextAttemptAt time.Time `json:"next_attempt_at"`
+	LastError     string    `json:"last_error,omitempty"`
+}
+
+// Dispatcher delivers the webhooks with retries.
+type Dispatcher struct {
+	config Config
+	client *http.Client
+	// wg represents deliveries in progress
+	wg sync.WaitGroup
+}
+
+// NewDispatcher creates the dispatcher, not provided settings are taken from DefaultConfig.
+// Returns error if the allowed networks are not valid CIDR ranges.
+func NewDispatcher(c Config) (*Dispatcher, error) {
+	if c.MaxAttempts < 1 {
+		c.MaxAttempts = DefaultConfig.MaxAttempts
+	}
+
+	if c.Backoff <= 0 {
+		c.Backoff = DefaultConfig.Backoff
+	}
+
+	if c.MaxBackoff <= 0 {
+		c.MaxBackoff = DefaultConfig.MaxBackoff
+	}
+
+	if c.Timeout <= 0 {
+		c.Timeout = DefaultConfig.Timeout
+	}
+
+	allowed := make([]*net.IPNet, 0, len(c.AllowedNetworks))
+	for _, cidr := range c.AllowedNetworks {
+		_, n, err := net.ParseCIDR(cidr)
+		if err != nil {
+			return nil, errors.Wrap(err, "allowed network")
+		}
+
+		allowed = append(allowed, n)
+	}
+
+	// the address is checked when the connection is made, so the host can't resolve to
+	// the internal address after the validation, the proxy is not used to connect directly
+	dialer := &net.Dialer{
+		Timeout: c.Timeout,
+		Control: func(network, address string, _ syscall.RawConn) error {
+			return checkAddress(address, allowed)
+		},
+	}
+
+	return &Dispatcher{
+		config: c,
+		client: &http.Client{
+			Timeout:   c.Timeout,
+			Transport: &http.Transport{DialContext: dialer.DialContext},
+		},
+	}, nil
+}
+
+// checkAddress checks if the webhook could be delivered to the address,
+// the not public addresses are allowed only if they're in the allowed networks.
+func checkAddress(address string, allowed []*net.IPNet) error {
+	host, _, err := net.SplitHostPort(address)
+	if err != nil {
+		return err
+	}
+
+	ip := net.ParseIP(host)
+	if ip == nil {
+		return fmt.Errorf("webhook address is not an ip: %s", host)
+	}
+
+	for _, n := range allowed {
+		if n.Contains(ip) {
+			return nil
+		}
+	}
+
+	if !isPublicIP(ip) {
+		return fmt.Errorf("webhook address is not public: %s", ip)
+	}
+
+	return nil
+}
+
+// isPublicIP checks if the ip is not loopback, private, link-local, Ex. cloud metadata endpoint, or other special address.
+func isPublicIP(ip net.IP) bool {
+	if ip.IsLoopback() || ip.IsPrivate() || ip.IsLinkLocalUnicast() || ip.IsLinkLocalMulticast() ||
+		ip.IsInterfaceLocalMulticast() || ip.IsMulticast() || ip.IsUnspecified() {
+		return false
+	}
+
+	for _, n := range reservedNetworks {
+		if n.Contains(ip) {
+			return false
+		}
+	}
+
+	return true
+}
+
+// reservedNetworks represents not public ranges which are not covered by the methods of net.IP.
+var reservedNetworks = func() []*net.IPNet {
+	var networks []*net.IPNet
+
+	for _, cidr := range []string{
+		"0.0.0.0/8",     // this network
+		"100.64.0.0/10", // carrier-grade NAT
+		"192.0.0.0/24",  // IETF protocol assignments
+		"198.18.0.0/15", // benchmarking
+		"240.0.0.0/4",   // reserved
+		"64:ff9b::/96",  // IPv4/IPv6 translation
+	} {
+		_, n, _ := net.ParseCIDR(cidr)
+		networks = append(networks, n)
+	}
+
+	return networks
+}()
+
+// ValidateURL checks if the url could be used for the webhook,
+// the address of the host is checked by the dispatcher when the webhook is delivered.
+func ValidateURL(u string) error {
+	parsed, err := url.Parse(u)
+	if err != nil {
+		return err
+	}
+
+	if (parsed.Scheme != "http" && parsed.Scheme != "https") || parsed.Host == "" {
+		return fmt.Errorf("webhook url should be absolute http or https url: %s", u)
+	}
+
+	return nil
+}
+
+// Start schedules the deliveries persisted before the restart.
+func (d *Dispatcher) Start() error {
+	dbDeliveries, err := db.BatchLoad(dbDeliveryPrefix)
+	if err != nil {
+		return errors.Wrap(err, "loading webhooks from the db")
+	}
+
+	for _, b := range dbDeliveries {
+		var dl delivery
+
+		err := json.Unmarshal(b, &dl)
+		if err != nil {
+			return errors.Wrap(err, "unmarshal webhook")
+		}
+
+		d.schedule(dl, time.Until(dl.NextAttemptAt))
+	}
+
+	return nil
+}
+
+// HandleEvent sends the webhooks of the processed tasks and the completed job to the urls of the job,
+// it's subscribed to the events of the queue.
+func (d *Dispatcher) HandleEvent(e queue.Event) {
+	if len(e.Job.Webhooks) == 0 {
+		return
+	}
+
+	var p Payload
+
+	switch {
+	case e.Type == queue.EventJobCompleted:
+		if !d.claimCompletion(e.Job.ID) {
+			return
+		}
+
+		tasks := make([]queue.Task, 0, len(e.Job.TasksMap))
+		for _, t := range e.Job.TasksMap {
+			tasks = append(tasks, t)
+		}
+
+		p = newPayload(EventJobCompleted, e, tasks)
+	case e.Type == queue.EventTaskUpdated && e.Task.Status != queue.StatusPending:
+		p = newPayload(EventTaskCompleted, e, []queue.Task{e.Task})
+	default:
+		return
+	}
+
+	for _, u := range e.Job.Webhooks {
+		err := d.Send(u, p)
+		if err != nil {
+			log.Errorf("Couldn't send webhook %s to %s: %s", p.Event, u, err)
+		}
+	}
+}
+
+// claimCompletion checks if the completion of the job should be notified by the dispatcher,
+// the completion is notified if the claim fails, since the duplicate is better than the lost notification.
+func (d *Dispatcher) claimCompletion(jobID string) bool {
+	if d.config.ClaimCompletion == nil {
+		return true
+	}
+
+	claimed, err := d.config.ClaimCompletion(jobID)
+	if err != nil {
+		log.Errorf("Couldn't claim completion of the job %s: %s", jobID, err)
+
+		return true
+	}
+
+	return claimed
+}
+
+// newPayload creates payload of the event.
+func newPayload(event string, e queue.Event, tasks []queue.Task) Payload {
+	p := Payload{
+		Event:     event,
+		Timestamp: e.Time,
+		Job:       Job{ID: e.Job.ID, Completed: e.Processed == e.Total},
+	}
+
+	for _, t := range tasks {
+		p.Tasks = append(p.Tasks, Task{ID: t.ID, OriginalFileName: t.OriginalFileName, Status: t.Status, Error: t.Error})
+	}
+
+	return p
+}
+
+// Send persists the payload and delivers it to the url in the background.
+func (d *Dispatcher) Send(u string, p Payload) error {
+	body, err := json.Marshal(p)
+	if err != nil {
+		return err
+	}
+
+	dl := delivery{
+		ID:            strings.ReplaceAll(uuid.New().String(), "-", ""),
+		URL:           u,
+		Event:         p.Event,
+		Body:          body,
+		Signature:     Sign(d.config.Secret, body),
+		NextAttemptAt: time.Now().UTC(),
+	}
+
+	// persist before the first attempt to survive restarts
+	err = saveDelivery(dl)
+	if err != nil {
+		return err
+	}
+
+	d.schedule(dl, 0)
+
+	return nil
+}
+
+// Wait waits until all the scheduled deliveries are delivered or failed after all the attempts.
+func (d *Dispatcher) Wait() {
+	d.wg.Wait()
+}
+
+// schedule delivers after the delay.
+func (d *Dispatcher) schedule(dl delivery, delay time.Duration) {
+	if delay < 0 {
+		delay = 0
+	}
+
+	d.wg.Add(1)
+
+	time.AfterFunc(delay, func() {
+		defer d.wg.Done()
+
+		d.deliver(dl)
+	})
+}
+
+// deliver makes the attempt to deliver and schedules the next attempt if it failed.
+func (d *Dispatcher) deliver(dl delivery) {
+	err := d.post(dl)
+	dl.Attempts++
+
+	logger := log.WithFields(log.Fields{
+		"delivery": dl.ID,
+		"event":    dl.Event,
+		"url":      dl.URL,
+		"attempt":  dl.Attempts,
+	})
+
+	// forget delivered or failed after all the attempts
+	if err == nil || dl.Attempts >= d.config.MaxAttempts {
+		if err != nil {
+			logger.Errorf("Webhook failed after all the attempts: %s", err)
+		}
+
+		err := db.DeleteByKey(dbDeliveryPrefix + dl.ID)
+		if err != nil {
+			logger.Errorf("Couldn't delete webhook: %s", err)
+		}
+
+		return
+	}
+
+	backoff := d.backoff(dl.Attempts)
+	dl.LastError = err.Error()
+	dl.NextAttemptAt = time.Now().UTC().Add(backoff)
+
+	logger.WithField("backoff", backoff).Warnf("Retrying webhook: %s", err)
+
+	err = saveDelivery(dl)
+	if err != nil {
+		logger.Errorf("Couldn't save webhook: %s", err)
+	}
+
+	d.schedule(dl, backoff)
+}
+
+// post posts the payload, the response with status other than 2xx is an error.
+func (d *Dispatcher) post(dl delivery) error {
+	req, err := http.NewRequest(http.MethodPost, dl.URL, bytes.NewReader(dl.Body))
+	if err != nil {
+		return err
+	}
+
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set(EventHeader, dl.Event)
+	req.Header.Set(DeliveryHeader, dl.ID)
+
+	if dl.Signature != "" {
+		req.Header.Set(SignatureHeader, dl.Signature)
+	}
+
+	res, err := d.client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer func() { _ = res.Body.Close() }()
+
+	if res.StatusCode < 200 || res.StatusCode > 299 {
+		return fmt.Errorf("unexpected status: %s", res.Status)
+	}
+
+	return nil
+}
+
+// backoff returns delay before the next attempt.
+func (d *Dispatcher) backoff(attempts int) time.Duration {
+	backoff := float64(d.config.Backoff) * math.Pow(2, float64(attempts-1))
+	if backoff > float64(d.config.MaxBackoff) {
+		return d.config.MaxBackoff
+	}
+
+	return time.Duration(backoff)
+}
+
+// Sign returns the signature of the body for SignatureHeader, empty if the secret is not provided.
+func Sign(secret string, body []byte) string {
+	if secret == "" {
+		return ""
+	}
+
+	mac := hmac.New(sha256.New, []byte(secret))
+	_, _ = mac.Write(body)
+
+	return "sha256=" + hex.EncodeToString(mac.Sum(nil))
+}
+
+// saveDelivery saves the delivery to the db.
+func saveDelivery(dl delivery) error {
+	b, err := json.Marshal(dl)
+	if err != nil {
+		return err
+	}
+
+	return db.SaveByKey(dbDeliveryPrefix+dl.ID, b)
+}
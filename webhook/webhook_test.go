@@ -0,0 +1,241 @@
+package webhook
+
+import (
+	"encoding/json"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/digitorus/pdfsigner/db"
+	"github.com/digitorus/pdfsigner/queues/queue"
+	log "github.com/sirupsen/logrus"
+	"github.com/stretchr/testify/assert"
+)
+
+// localNetworks allows to deliver the webhooks to the receiver.
+var localNetworks = []string{"127.0.0.0/8", "::1/128"}
+
+// receiver represents local http server receiving the webhooks.
+type receiver struct {
+	*httptest.Server
+	mu       sync.Mutex
+	failures int
+	payloads []Payload
+	headers  []http.Header
+	bodies   [][]byte
+}
+
+// newReceiver creates receiver failing the first requests.
+func newReceiver(failures int) *receiver {
+	rc := &receiver{failures: failures}
+	rc.Server = httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		rc.mu.Lock()
+		defer rc.mu.Unlock()
+
+		if rc.failures > 0 {
+			rc.failures--
+			w.WriteHeader(http.StatusInternalServerError)
+
+			return
+		}
+
+		body, _ := io.ReadAll(r.Body)
+
+		var p Payload
+		_ = json.Unmarshal(body, &p)
+
+		rc.payloads = append(rc.payloads, p)
+		rc.headers = append(rc.headers, r.Header.Clone())
+		rc.bodies = append(rc.bodies, body)
+	}))
+
+	return rc
+}
+
+func TestSign(t *testing.T) {
+	assert.Equal(t, "", Sign("", []byte("body")))
+	assert.Equal(t, "sha256=dc46983557fea127b43af721467eb9b3fde2338fe3e14f51952aa8478c13d355", Sign("secret", []byte("body")))
+}
+
+func TestValidateURL(t *testing.T) {
+	assert.NoError(t, ValidateURL("https://example.com/hook"))
+	assert.Error(t, ValidateURL("ftp://example.com/hook"))
+	assert.Error(t, ValidateURL("/hook"))
+}
+
+func TestPrivateAddress(t *testing.T) {
+	log.SetOutput(io.Discard)
+
+	rc := newReceiver(0)
+	defer rc.Close()
+
+	// the local receiver is rejected by default
+	d, err := NewDispatcher(Config{MaxAttempts: 1})
+	assert.NoError(t, err)
+	assert.Error(t, d.post(delivery{URL: rc.URL}))
+
+	rc.mu.Lock()
+	assert.Len(t, rc.payloads, 0)
+	rc.mu.Unlock()
+
+	for _, address := range []string{"127.0.0.1:80", "10.1.2.3:443", "169.254.169.254:80", "[::1]:80", "[fd00:ec2::254]:80", "[::ffff:192.168.0.1]:80"} {
+		assert.Error(t, checkAddress(address, nil), address)
+	}
+
+	assert.NoError(t, checkAddress("93.184.215.14:443", nil))
+
+	_, err = NewDispatcher(Config{AllowedNetworks: []string{"10.0.0.0"}})
+	assert.Error(t, err)
+}
+
+func TestHandleEvent(t *testing.T) {
+	log.SetOutput(io.Discard)
+
+	rc := newReceiver(1)
+	defer rc.Close()
+
+	d, err := NewDispatcher(Config{Secret: "secret", Backoff: 10 * time.Millisecond, AllowedNetworks: localNetworks})
+	assert.NoError(t, err)
+
+	// job with the last task processed
+	job := queue.Job{
+		ID: "job1",
+		TasksMap: map[string]queue.Task{
+			"task1": {ID: "task1", OriginalFileName: "file1.pdf", Status: queue.StatusCompleted},
+			"task2": {ID: "task2", OriginalFileName: "file2.pdf", Status: queue.StatusFailed, Error: "malformed"},
+		},
+		TotalProcesedTasks: 2,
+		Webhooks:           []string{rc.URL},
+	}
+
+	events := []queue.Event{
+		{Type: queue.EventTaskStarted, Job: queue.Job{ID: job.ID, Webhooks: job.Webhooks}, Task: job.TasksMap["task2"], Processed: 1, Total: 2},
+		{Type: queue.EventTaskUpdated, Job: queue.Job{ID: job.ID, Webhooks: job.Webhooks}, Task: job.TasksMap["task2"], Processed: 2, Total: 2},
+		{Type: queue.EventJobCompleted, Job: job, Processed: 2, Total: 2},
+	}
+
+	for _, e := range events {
+		d.HandleEvent(e)
+	}
+
+	d.Wait()
+
+	rc.mu.Lock()
+	defer rc.mu.Unlock()
+
+	// the started task is ignored and the failed delivery is retried
+	assert.Len(t, rc.payloads, 2)
+
+	payloads := map[string]Payload{}
+	for i, p := range rc.payloads {
+		payloads[p.Event] = p
+
+		assert.Equal(t, p.Event, rc.headers[i].Get(EventHeader))
+		assert.NotEmpty(t, rc.headers[i].Get(DeliveryHeader))
+		assert.Equal(t, Sign("secret", rc.bodies[i]), rc.headers[i].Get(SignatureHeader))
+	}
+
+	assert.Len(t, payloads[EventTaskCompleted].Tasks, 1)
+	assert.Equal(t, "malformed", payloads[EventTaskCompleted].Tasks[0].Error)
+	assert.True(t, payloads[EventJobCompleted].Job.Completed)
+	assert.Len(t, payloads[EventJobCompleted].Tasks, 2)
+
+	// the job without webhooks is ignored
+	d.HandleEvent(queue.Event{Type: queue.EventJobCompleted, Job: queue.Job{ID: "job2"}})
+	d.Wait()
+	assert.Len(t, rc.payloads, 2)
+}
+
+func TestClaimCompletion(t *testing.T) {
+	log.SetOutput(io.Discard)
+
+	rc := newReceiver(0)
+	defer rc.Close()
+
+	// the completion is claimed by the first node
+	claimed := map[string]bool{}
+
+	d, err := NewDispatcher(Config{
+		AllowedNetworks: localNetworks,
+		ClaimCompletion: func(jobID string) (bool, error) {
+			if claimed[jobID] {
+				return false, nil
+			}
+
+			claimed[jobID] = true
+
+			return true, nil
+		},
+	})
+	assert.NoError(t, err)
+
+	e := queue.Event{Type: queue.EventJobCompleted, Job: queue.Job{ID: "job1", Webhooks: []string{rc.URL}}}
+	d.HandleEvent(e)
+	d.HandleEvent(e)
+	d.Wait()
+
+	rc.mu.Lock()
+	defer rc.mu.Unlock()
+
+	assert.Len(t, rc.payloads, 1)
+}
+
+func TestDeliveryAttempts(t *testing.T) {
+	log.SetOutput(io.Discard)
+
+	rc := newReceiver(10)
+	defer rc.Close()
+
+	d, err := NewDispatcher(Config{MaxAttempts: 3, Backoff: time.Millisecond, AllowedNetworks: localNetworks})
+	assert.NoError(t, err)
+
+	assert.NoError(t, d.Send(rc.URL, Payload{Event: EventJobCompleted}))
+	d.Wait()
+
+	// give up after all the attempts
+	rc.mu.Lock()
+	defer rc.mu.Unlock()
+
+	assert.Equal(t, 7, rc.failures)
+	assert.Len(t, rc.payloads, 0)
+
+	deliveries, err := db.BatchLoad(dbDeliveryPrefix)
+	assert.NoError(t, err)
+	assert.Len(t, deliveries, 0)
+}
+
+func TestDeliveryRestart(t *testing.T) {
+	log.SetOutput(io.Discard)
+
+	rc := newReceiver(0)
+	defer rc.Close()
+
+	// delivery persisted before the restart
+	dl := delivery{
+		ID:            "restarted",
+		URL:           rc.URL,
+		Event:         EventJobCompleted,
+		Body:          []byte(`{"event":"job.completed"}`),
+		Attempts:      1,
+		NextAttemptAt: time.Now(),
+	}
+	assert.NoError(t, saveDelivery(dl))
+
+	d, err := NewDispatcher(Config{AllowedNetworks: localNetworks})
+	assert.NoError(t, err)
+	assert.NoError(t, d.Start())
+	d.Wait()
+
+	rc.mu.Lock()
+	defer rc.mu.Unlock()
+
+	assert.Len(t, rc.payloads, 1)
+	assert.Equal(t, "restarted", rc.headers[0].Get(DeliveryHeader))
+
+	b, err := db.LoadByKey(dbDeliveryPrefix + dl.ID)
+	assert.NoError(t, err)
+	assert.Nil(t, b)
+}